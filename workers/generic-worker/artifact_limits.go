@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// maxArtifactLimitListing is the maximum number of offending artifacts that
+// are listed when an artifact limit is exceeded.
+const maxArtifactLimitListing = 20
+
+// artifactSize is the size of the file of an artifact.
+type artifactSize struct {
+	name string
+	path string
+	size int64
+}
+
+// artifactLimit returns the lower of the limit configured on the worker and
+// the limit requested in the task payload, or zero if neither sets a limit.
+// The payload cannot raise the limit configured on the worker.
+func (task *TaskRun) artifactLimit(description string, configured uint, requested int64) int64 {
+	limit := int64(configured)
+	if requested > 0 {
+		if limit == 0 || requested < limit {
+			limit = requested
+		} else if requested > limit {
+			task.Warnf("%v of %v requested in task payload exceeds worker limit of %v; using worker limit", description, requested, limit)
+		}
+	}
+	return limit
+}
+
+// artifactLimits are the limits of the number of artifacts of a task, the
+// size of each artifact, and their total size, in bytes. Zero means no
+// limit.
+type artifactLimits struct {
+	maxArtifacts int64
+	maxSize      int64
+	maxTotalSize int64
+}
+
+// artifactLimits returns the artifact limits of the task. They are only
+// determined once, so that any warnings about them are only logged once,
+// even though live artifacts are checked against them too. The caller must
+// hold task.liveArtifactsMux.
+func (task *TaskRun) artifactLimits() *artifactLimits {
+	if task.limits == nil {
+		limits := task.Payload.ArtifactLimits
+		task.limits = &artifactLimits{
+			maxArtifacts: task.artifactLimit("Artifact count limit", config.MaxArtifacts, limits.MaxArtifacts),
+			maxSize:      task.artifactLimit("Artifact size limit in megabytes", config.MaxArtifactSizeMegabytes, limits.MaxArtifactSizeMegabytes) * 1024 * 1024,
+			maxTotalSize: task.artifactLimit("Total artifact size limit in megabytes", config.MaxTotalArtifactsSizeMegabytes, limits.MaxTotalSizeMegabytes) * 1024 * 1024,
+		}
+	}
+	return task.limits
+}
+
+// checkArtifactLimits returns a task failure that lists the offending
+// artifacts, if the given payload artifacts exceed the number of artifacts,
+// artifact size or total artifact size limits, so that none of them are
+// uploaded. Live artifacts that task commands have already uploaded count
+// towards the number of artifacts and total artifact size. Artifacts that
+// are uploaded by task features instead are not counted.
+func (task *TaskRun) checkArtifactLimits(artifacts []TaskArtifact) *CommandExecutionError {
+	task.liveArtifactsMux.Lock()
+	limits := *task.artifactLimits()
+	liveArtifacts := task.liveArtifacts
+	liveArtifactsSize := task.liveArtifactsSize
+	task.liveArtifactsMux.Unlock()
+	maxArtifacts := limits.maxArtifacts
+	maxSize := limits.maxSize
+	maxTotalSize := limits.maxTotalSize
+	if maxArtifacts == 0 && maxSize == 0 && maxTotalSize == 0 {
+		return nil
+	}
+
+	names := []string{}
+	sizes := []artifactSize{}
+	totalSize := int64(0)
+	for _, artifact := range artifacts {
+		name := artifact.Base().Name
+		if task.featureArtifacts[name] != "" {
+			continue
+		}
+		names = append(names, name)
+		s3Artifact, isS3Artifact := artifact.(*S3Artifact)
+		if !isS3Artifact {
+			continue
+		}
+		// if the file can't be read, the upload reports it
+		if info, err := os.Stat(filepath.Join(taskContext.TaskDir, s3Artifact.Path)); err == nil {
+			sizes = append(sizes, artifactSize{name: name, path: s3Artifact.Path, size: info.Size()})
+			totalSize += info.Size()
+		}
+	}
+	// largest first
+	sort.SliceStable(sizes, func(i, j int) bool {
+		return sizes[i].size > sizes[j].size
+	})
+
+	problems := []string{}
+	if maxArtifacts > 0 && int64(len(names))+liveArtifacts > maxArtifacts {
+		live := ""
+		if liveArtifacts > 0 {
+			live = fmt.Sprintf(" together with %v live artifacts", liveArtifacts)
+		}
+		problems = append(problems, fmt.Sprintf("Task payload artifacts include %v artifacts, which%v exceeds the limit of %v artifacts:\n%v", len(names), live, maxArtifacts, task.artifactCounts(names)))
+	}
+	if maxSize > 0 {
+		tooLarge := []artifactSize{}
+		for _, s := range sizes {
+			if s.size > maxSize {
+				tooLarge = append(tooLarge, s)
+			}
+		}
+		if len(tooLarge) > 0 {
+			problems = append(problems, fmt.Sprintf("%v task payload artifacts exceed the size limit of %v bytes:\n%v", len(tooLarge), maxSize, listArtifactSizes(tooLarge)))
+		}
+	}
+	if maxTotalSize > 0 && totalSize+liveArtifactsSize > maxTotalSize {
+		live := ""
+		if liveArtifactsSize > 0 {
+			live = fmt.Sprintf(" together with %v bytes of live artifacts", liveArtifactsSize)
+		}
+		problems = append(problems, fmt.Sprintf("Task payload artifacts total %v bytes, which%v exceeds the limit of %v bytes. The largest artifacts are:\n%v", totalSize, live, maxTotalSize, listArtifactSizes(sizes)))
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return Failure(fmt.Errorf("Not uploading any task payload artifacts, since artifact limits are exceeded.\n%v", strings.Join(problems, "\n")))
+}
+
+// artifactCounts lists how many of the given artifact names each entry of
+// payload property artifacts contributes, most first.
+func (task *TaskRun) artifactCounts(names []string) string {
+	type entryCount struct {
+		description string
+		count       int
+	}
+	counts := []entryCount{}
+	for _, artifact := range task.Payload.Artifacts {
+		payloadName := artifact.Name
+		if payloadName == "" {
+			payloadName = canonicalPath(artifact.Path)
+		}
+		count := 0
+		for _, name := range names {
+			if name == payloadName || (artifact.Type == "directory" && strings.HasPrefix(name, strings.TrimSuffix(payloadName, "/")+"/")) {
+				count++
+			}
+		}
+		counts = append(counts, entryCount{
+			description: fmt.Sprintf("%v artifact %v (path %v)", artifact.Type, payloadName, artifact.Path),
+			count:       count,
+		})
+	}
+	sort.SliceStable(counts, func(i, j int) bool {
+		return counts[i].count > counts[j].count
+	})
+	lines := []string{}
+	for i, c := range counts {
+		if i == maxArtifactLimitListing {
+			lines = append(lines, fmt.Sprintf("  ... and %v more", len(counts)-i))
+			break
+		}
+		lines = append(lines, fmt.Sprintf("  %v: %v artifacts", c.description, c.count))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// listArtifactSizes lists the given artifact sizes, up to
+// maxArtifactLimitListing of them.
+func listArtifactSizes(sizes []artifactSize) string {
+	lines := []string{}
+	for i, s := range sizes {
+		if i == maxArtifactLimitListing {
+			lines = append(lines, fmt.Sprintf("  ... and %v more", len(sizes)-i))
+			break
+		}
+		lines = append(lines, fmt.Sprintf("  %v (path %v): %v bytes", s.name, s.path, s.size))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,115 @@
+// +build darwin,!docker linux,!docker freebsd
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestArtifactCountLimitExceeded(t *testing.T) {
+	_, teardown := setupWithFakeServices(t)
+	defer teardown()
+	config.MaxArtifacts = 10
+
+	payload := GenericWorkerPayload{
+		Command: [][]string{
+			{
+				"/bin/bash",
+				"-c",
+				`mkdir out && for i in 1 2 3 4 5; do echo $i > out/$i.txt; done && echo summary > summary.txt`,
+			},
+		},
+		Artifacts: []Artifact{
+			{
+				Path: "out",
+				Name: "public/out",
+				Type: "directory",
+			},
+			{
+				Path: "summary.txt",
+				Name: "public/summary.txt",
+				Type: "file",
+			},
+		},
+		// lowers the worker limit
+		ArtifactLimits: ArtifactLimits{
+			MaxArtifacts: 4,
+		},
+		MaxRunTime: 30,
+	}
+	td := testTask(t)
+
+	taskID := submitAndAssert(t, td, payload, "failed", "failed")
+
+	logtext, _, _, _ := getArtifactContent(t, taskID, "public/logs/live_backing.log")
+	for _, expected := range []string{
+		"Not uploading any task payload artifacts, since artifact limits are exceeded.",
+		"Task payload artifacts include 6 artifacts, which exceeds the limit of 4 artifacts:",
+		"directory artifact public/out (path out): 5 artifacts",
+		"file artifact public/summary.txt (path summary.txt): 1 artifacts",
+	} {
+		if !strings.Contains(string(logtext), expected) {
+			t.Fatalf("Expected task log to contain %q:\n%s", expected, logtext)
+		}
+	}
+	for _, name := range []string{"public/out/1.txt", "public/summary.txt"} {
+		if testQueue.GetArtifact(taskID, "0", name) == nil {
+			t.Fatalf("Expected artifact %v not to be uploaded", name)
+		}
+	}
+}
+
+func TestArtifactSizeLimitExceeded(t *testing.T) {
+	_, teardown := setupWithFakeServices(t)
+	defer teardown()
+	config.MaxArtifactSizeMegabytes = 1
+	config.MaxTotalArtifactsSizeMegabytes = 3
+
+	payload := GenericWorkerPayload{
+		Command: [][]string{
+			{
+				"/bin/bash",
+				"-c",
+				`head -c 2097152 /dev/zero > big.bin && head -c 1048576 /dev/zero > small.bin`,
+			},
+		},
+		Artifacts: []Artifact{
+			{
+				Path: "big.bin",
+				Name: "public/big.bin",
+				Type: "file",
+			},
+			{
+				Path: "small.bin",
+				Name: "public/small.bin",
+				Type: "file",
+			},
+		},
+		// can't raise the worker limit
+		ArtifactLimits: ArtifactLimits{
+			MaxArtifactSizeMegabytes: 5,
+		},
+		MaxRunTime: 30,
+	}
+	td := testTask(t)
+
+	taskID := submitAndAssert(t, td, payload, "failed", "failed")
+
+	logtext, _, _, _ := getArtifactContent(t, taskID, "public/logs/live_backing.log")
+	for _, expected := range []string{
+		"Artifact size limit in megabytes of 5 requested in task payload exceeds worker limit of 1; using worker limit",
+		"1 task payload artifacts exceed the size limit of 1048576 bytes:",
+		"public/big.bin (path big.bin): 2097152 bytes",
+	} {
+		if !strings.Contains(string(logtext), expected) {
+			t.Fatalf("Expected task log to contain %q:\n%s", expected, logtext)
+		}
+	}
+	if strings.Contains(string(logtext), "public/small.bin (path small.bin)") || strings.Contains(string(logtext), "total") {
+		t.Fatalf("Expected only artifact over size limit to be reported:\n%s", logtext)
+	}
+	if testQueue.GetArtifact(taskID, "0", "public/small.bin") == nil {
+		t.Fatal("Expected artifact public/small.bin not to be uploaded")
+	}
+}
@@ -450,7 +450,9 @@ func (task *TaskRun) uploadLog(name, path string) *CommandExecutionError {
 }
 
 func (task *TaskRun) uploadArtifact(artifact TaskArtifact) *CommandExecutionError {
+	task.artifactsMux.Lock()
 	task.Artifacts[artifact.Base().Name] = artifact
+	task.artifactsMux.Unlock()
 	payload, err := json.Marshal(artifact.RequestObject())
 	if err != nil {
 		panic(err)
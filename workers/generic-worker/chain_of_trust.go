@@ -132,6 +132,7 @@ func (feature *ChainOfTrustTaskFeature) Stop(err *ExecutionErrors) {
 	}
 	err.add(feature.task.uploadLog(certifiedLogName, certifiedLogPath))
 	artifactHashes := map[string]ArtifactHash{}
+	feature.task.artifactsMux.Lock()
 	for _, artifact := range feature.task.Artifacts {
 		switch a := artifact.(type) {
 		case *S3Artifact:
@@ -146,6 +147,7 @@ func (feature *ChainOfTrustTaskFeature) Stop(err *ExecutionErrors) {
 			}
 		}
 	}
+	feature.task.artifactsMux.Unlock()
 
 	cotCert := &ChainOfTrustData{
 		Version:     1,
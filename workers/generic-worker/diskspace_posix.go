@@ -18,3 +18,12 @@ func freeDiskSpaceBytes(dir string) (uint64, error) {
 	log.Printf("Disk available: %v bytes", b)
 	return b, nil
 }
+
+func freeInodes(dir string) (uint64, error) {
+	var stat syscall.Statfs_t
+	err := syscall.Statfs(dir, &stat)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(stat.Ffree), nil
+}
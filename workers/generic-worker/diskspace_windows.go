@@ -2,6 +2,7 @@ package main
 
 import (
 	"log"
+	"math"
 	"syscall"
 
 	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/win32"
@@ -20,3 +21,9 @@ func freeDiskSpaceBytes(dir string) (uint64, error) {
 	log.Printf("Disk available: %v bytes", freeBytes)
 	return freeBytes, nil
 }
+
+// freeInodes returns math.MaxUint64, since NTFS has no fixed limit on the
+// number of files a volume can hold.
+func freeInodes(dir string) (uint64, error) {
+	return math.MaxUint64, nil
+}
@@ -2,7 +2,10 @@
 
 package main
 
-import "os"
+import (
+	"os"
+	"time"
+)
 
 const (
 	engine = "docker"
@@ -14,3 +17,13 @@ func secure(configFile string) {
 func MkdirAllTaskUser(dir string, perms os.FileMode) (err error) {
 	return nil
 }
+
+// gracePeriod returns zero, since task commands are killed immediately when
+// the task is aborted.
+func (task *TaskRun) gracePeriod() time.Duration {
+	return 0
+}
+
+func platformFeatures() []Feature {
+	return []Feature{}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cenkalti/backoff/v3"
+	"github.com/taskcluster/httpbackoff/v3"
+)
+
+// downloadProgressInterval is how often the progress of a mount content
+// download is reported in the task log.
+var downloadProgressInterval = 30 * time.Second
+
+// download is the state of a download of a url to a file, which is kept
+// between attempts, so that an attempt can resume where the previous attempt
+// stopped, if the server supports range requests.
+type download struct {
+	url           string
+	contentSource string
+	file          string
+	task          *TaskRun
+	// written is the number of bytes of the file that have been downloaded,
+	// all of which have been written to hash
+	written int64
+	hash    hash.Hash
+	// size is the size of the content, or -1 if unknown
+	size int64
+	// validator is the strong ETag, or otherwise the Last-Modified header, of
+	// the content, which a resumed download requires to be unchanged
+	validator string
+	// resumable is set if the server supports range requests
+	resumable bool
+	// resumed is set if the downloaded content was downloaded by more than
+	// one request
+	resumed      bool
+	lastProgress time.Time
+}
+
+// errContentChanged is returned by an attempt to resume a download, if the
+// server returns content that does not continue the content that has been
+// downloaded already.
+var errContentChanged = errors.New("content does not continue previously downloaded content")
+
+// Utility function to aggressively download a url to a file location. If an
+// attempt fails, the next attempt resumes the download where it stopped, if
+// the server supports range requests. Attempts are retried until config
+// setting mountDownloadRetryTimeoutSecs has elapsed since the first attempt.
+// The SHA256 of the content is calculated while it is downloaded. If the
+// content was downloaded by more than one request, and its SHA256 is not
+// requiredSHA256, it is downloaded again from the start.
+func downloadURLToFile(url, contentSource, file, requiredSHA256 string, task *TaskRun) (sha256 string, err error) {
+	return downloadURLToFileWithRetryTimeout(url, contentSource, file, requiredSHA256, time.Duration(config.MountDownloadRetryTimeoutSecs)*time.Second, task)
+}
+
+// downloadURLToFileWithRetryTimeout is downloadURLToFile, with failed attempts
+// retried until retryTimeout has elapsed since the first attempt, rather than
+// config setting mountDownloadRetryTimeoutSecs. If retryTimeout is zero,
+// failed attempts are retried indefinitely.
+func downloadURLToFileWithRetryTimeout(url, contentSource, file, requiredSHA256 string, retryTimeout time.Duration, task *TaskRun) (sha256 string, err error) {
+	d := &download{
+		url:           url,
+		contentSource: contentSource,
+		file:          file,
+		task:          task,
+		hash:          newSHA256(),
+		size:          -1,
+	}
+	settings := backoff.NewExponentialBackOff()
+	settings.MaxElapsedTime = retryTimeout
+	client := &httpbackoff.Client{
+		BackOffSettings: settings,
+	}
+	// httpbackoff.Get(url) is not sufficient as that only guarantees we have
+	// an http response to read from, but does not retry if we lose
+	// connectivity while reading from it. Therefore include the reading of the
+	// response body inside the retry function.
+	retryFunc := func() (resp *http.Response, tempError error, permError error) {
+		resp, tempError, permError = d.attempt()
+		if tempError != nil || permError != nil {
+			return
+		}
+		sha256 = hex.EncodeToString(d.hash.Sum(nil))
+		if d.resumed && requiredSHA256 != "" && sha256 != requiredSHA256 {
+			task.Warnf("[mounts] Resumed download of %v has SHA256 %v but task definition requires %v; downloading it again from the start", contentSource, sha256, requiredSHA256)
+			d.restart()
+			tempError = fmt.Errorf("SHA256 %v of resumed download is not required SHA256 %v", sha256, requiredSHA256)
+		}
+		return
+	}
+	var resp *http.Response
+	resp, _, err = client.Retry(retryFunc)
+	if err != nil {
+		task.Errorf("[mounts] Could not fetch from %v into file %v: %v", contentSource, file, err)
+		return
+	}
+	defer resp.Body.Close()
+	task.Infof("[mounts] Downloaded %v bytes with SHA256 %v from %v to %v", d.written, sha256, contentSource, file)
+	return
+}
+
+func newSHA256() hash.Hash {
+	return sha256.New()
+}
+
+// attempt makes one attempt to download the content, resuming the download
+// if possible.
+func (d *download) attempt() (resp *http.Response, tempError error, permError error) {
+	req, err := http.NewRequest(http.MethodGet, d.url, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	resuming := d.written > 0 && d.resumable
+	if resuming {
+		d.task.Infof("[mounts] Resuming download of %v to %v at byte %v", d.contentSource, d.file, d.written)
+		req.Header.Set("Range", fmt.Sprintf("bytes=%v-", d.written))
+		if d.validator != "" {
+			req.Header.Set("If-Range", d.validator)
+		}
+	} else {
+		d.task.Infof("[mounts] Downloading %v to %v", d.contentSource, d.file)
+		d.restart()
+	}
+	resp, err = http.DefaultClient.Do(req)
+	// assume all errors should result in a retry
+	if err != nil {
+		d.task.Warnf("[mounts] Download of %v failed on this attempt: %v", d.contentSource, err)
+		// temporary error!
+		return resp, err, nil
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && resuming:
+		err = d.checkContentRange(resp.Header.Get("Content-Range"))
+		if err == nil && contentEncoded(resp) {
+			err = fmt.Errorf("range has content encoding %v: %w", resp.Header.Get("Content-Encoding"), errContentChanged)
+		}
+		if err != nil {
+			d.task.Warnf("[mounts] Could not resume download of %v (%v); downloading it again from the start", d.contentSource, err)
+			d.restart()
+			return resp, err, nil
+		}
+		d.resumed = true
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && resuming:
+		d.task.Warnf("[mounts] Server does not accept range request to resume download of %v; downloading it again from the start", d.contentSource)
+		d.restart()
+		return resp, errContentChanged, nil
+	case resp.StatusCode/100 != 2:
+		// let httpbackoff decide whether to retry
+		return resp, nil, nil
+	default:
+		// the server returned the whole content
+		if resuming {
+			d.task.Warnf("[mounts] Server returned the whole content of %v rather than the requested range; downloading it again from the start", d.contentSource)
+			d.restart()
+		}
+		d.size = resp.ContentLength
+		// Ranges refer to the content as encoded by the server, whereas
+		// written counts the decoded bytes of gzip encoded content, which
+		// the transport decodes transparently, so encoded content can't be
+		// resumed.
+		d.resumable = resp.Header.Get("Accept-Ranges") == "bytes" && !contentEncoded(resp)
+		d.validator = resp.Header.Get("ETag")
+		if d.validator == "" || strings.HasPrefix(d.validator, "W/") {
+			d.validator = resp.Header.Get("Last-Modified")
+		}
+	}
+	f, err := os.OpenFile(d.file, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		d.task.Errorf("[mounts] Could not open file %v: %v", d.file, err)
+		// permanent error!
+		return resp, nil, err
+	}
+	defer f.Close()
+	// discard anything written after the content that has been hashed
+	err = f.Truncate(d.written)
+	if err == nil {
+		_, err = f.Seek(d.written, io.SeekStart)
+	}
+	if err != nil {
+		d.task.Errorf("[mounts] Could not prepare file %v for download: %v", d.file, err)
+		// permanent error!
+		return resp, nil, err
+	}
+	_, err = io.Copy(&downloadWriter{d: d, f: f}, resp.Body)
+	if err != nil {
+		d.task.Warnf("[mounts] Could not write http response from %v to file %v on this attempt, after %v: %v", d.contentSource, d.file, d.progress(), err)
+		// likely a temporary error - network blip
+		return resp, err, nil
+	}
+	if d.size >= 0 && d.written != d.size {
+		err = fmt.Errorf("Downloaded %v bytes of %v, but expected %v bytes", d.written, d.contentSource, d.size)
+		d.task.Warnf("[mounts] %v", err)
+		return resp, err, nil
+	}
+	return resp, nil, nil
+}
+
+// contentEncoded returns whether the content of the response is content
+// encoded, e.g. gzip, including if the transport has decoded it already.
+func contentEncoded(resp *http.Response) bool {
+	if resp.Uncompressed {
+		return true
+	}
+	encoding := resp.Header.Get("Content-Encoding")
+	return encoding != "" && encoding != "identity"
+}
+
+// restart discards the content that has been downloaded, so that the next
+// attempt downloads the content from the start.
+func (d *download) restart() {
+	d.written = 0
+	d.hash.Reset()
+	d.size = -1
+	d.resumed = false
+	d.lastProgress = time.Now()
+}
+
+// checkContentRange checks that the Content-Range header of a response to
+// a range request continues the content that has been downloaded, and sets
+// the size of the content from it.
+func (d *download) checkContentRange(contentRange string) error {
+	// e.g. "bytes 1000-1999/2000"
+	var start, end int64
+	var total string
+	_, err := fmt.Sscanf(contentRange, "bytes %d-%d/%s", &start, &end, &total)
+	if err != nil {
+		return fmt.Errorf("invalid Content-Range header %q", contentRange)
+	}
+	if start != d.written {
+		return fmt.Errorf("Content-Range header %q does not start at byte %v: %w", contentRange, d.written, errContentChanged)
+	}
+	d.size = -1
+	if total != "*" {
+		d.size, err = strconv.ParseInt(total, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid Content-Range header %q", contentRange)
+		}
+	}
+	return nil
+}
+
+// progress describes how much of the content has been downloaded.
+func (d *download) progress() string {
+	if d.size > 0 {
+		return fmt.Sprintf("%v of %v bytes (%.1f%%)", d.written, d.size, float64(d.written)*100/float64(d.size))
+	}
+	return fmt.Sprintf("%v bytes", d.written)
+}
+
+// downloadWriter writes downloaded content to the download file, and to the
+// hash of the download, and reports the progress of the download at
+// intervals.
+type downloadWriter struct {
+	d *download
+	f *os.File
+}
+
+func (w *downloadWriter) Write(p []byte) (n int, err error) {
+	n, err = w.f.Write(p)
+	// only what was written to the file is hashed, so that the hash and
+	// the file stay consistent if the write fails
+	_, _ = w.d.hash.Write(p[:n])
+	w.d.written += int64(n)
+	if time.Since(w.d.lastProgress) >= downloadProgressInterval {
+		w.d.lastProgress = time.Now()
+		w.d.task.Infof("[mounts] Downloaded %v from %v", w.d.progress(), w.d.contentSource)
+	}
+	return
+}
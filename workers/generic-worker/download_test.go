@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flakyServer serves content, aborting the response to the first request
+// half way through. If ranges is true, it supports range requests. If gzip
+// is true, it serves the content gzip encoded, whether or not the request
+// accepts it, as e.g. S3 does for artifacts uploaded with a gzip content
+// encoding.
+type flakyServer struct {
+	sync.Mutex
+	content  func(request int) []byte
+	ranges   bool
+	gzip     bool
+	requests []*http.Request
+}
+
+func (s *flakyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	s.requests = append(s.requests, r)
+	request := len(s.requests)
+	s.Unlock()
+	content := s.content(request)
+	if s.gzip {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		_, _ = gz.Write(content)
+		_ = gz.Close()
+		content = buf.Bytes()
+		w.Header().Set("Content-Encoding", "gzip")
+	}
+	if request == 1 {
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		if s.ranges {
+			w.Header().Set("Accept-Ranges", "bytes")
+			w.Header().Set("ETag", `"v1"`)
+		}
+		_, _ = w.Write(content[:len(content)/2])
+		w.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}
+	if s.ranges {
+		w.Header().Set("ETag", `"v1"`)
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+		return
+	}
+	_, _ = w.Write(content)
+}
+
+func randomContent(t *testing.T) []byte {
+	content := make([]byte, 1024*1024)
+	_, err := rand.Read(content)
+	if err != nil {
+		t.Fatalf("Could not generate content: %v", err)
+	}
+	return content
+}
+
+func sha256Hex(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+func testDownload(t *testing.T, server *flakyServer, requiredSHA256 string) (file, sha256 string) {
+	t.Helper()
+	s := httptest.NewServer(server)
+	defer s.Close()
+	file = filepath.Join(testdataDir, t.Name(), "download")
+	sha256, err := downloadURLToFile(s.URL, "test content", file, requiredSHA256, &TaskRun{})
+	if err != nil {
+		t.Fatalf("Could not download content: %v", err)
+	}
+	return
+}
+
+func TestDownloadResumed(t *testing.T) {
+	defer prepareEnvironment(t)()
+	configureWorker(t)
+	content := randomContent(t)
+	server := &flakyServer{
+		content: func(request int) []byte { return content },
+		ranges:  true,
+	}
+
+	file, sha256 := testDownload(t, server, "")
+
+	if len(server.requests) != 2 {
+		t.Fatalf("Expected 2 requests, but got %v", len(server.requests))
+	}
+	if r := server.requests[1].Header.Get("Range"); r != "bytes=524288-" {
+		t.Fatalf("Expected second request to resume download at byte 524288, but got Range header %q", r)
+	}
+	if r := server.requests[1].Header.Get("If-Range"); r != `"v1"` {
+		t.Fatalf("Expected second request to require unchanged ETag, but got If-Range header %q", r)
+	}
+	downloaded, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatalf("Could not read downloaded file: %v", err)
+	}
+	if !bytes.Equal(downloaded, content) || sha256 != sha256Hex(content) {
+		t.Fatalf("Downloaded content (%v bytes) or its SHA256 %v does not match the served content", len(downloaded), sha256)
+	}
+}
+
+func TestDownloadRestartedWithoutRangeSupport(t *testing.T) {
+	defer prepareEnvironment(t)()
+	configureWorker(t)
+	content := randomContent(t)
+	server := &flakyServer{
+		content: func(request int) []byte { return content },
+	}
+
+	file, sha256 := testDownload(t, server, "")
+
+	if r := server.requests[1].Header.Get("Range"); r != "" {
+		t.Fatalf("Expected second request to download whole content, but got Range header %q", r)
+	}
+	downloaded, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatalf("Could not read downloaded file: %v", err)
+	}
+	if !bytes.Equal(downloaded, content) || sha256 != sha256Hex(content) {
+		t.Fatalf("Downloaded content (%v bytes) or its SHA256 %v does not match the served content", len(downloaded), sha256)
+	}
+}
+
+func TestDownloadRestartedAfterResumedContentMismatch(t *testing.T) {
+	defer prepareEnvironment(t)()
+	configureWorker(t)
+	oldContent := randomContent(t)
+	newContent := randomContent(t)
+	server := &flakyServer{
+		// the content changes after the first request, but the server
+		// doesn't change its ETag
+		content: func(request int) []byte {
+			if request == 1 {
+				return oldContent
+			}
+			return newContent
+		},
+		ranges: true,
+	}
+
+	_, sha256 := testDownload(t, server, sha256Hex(newContent))
+
+	if len(server.requests) != 3 {
+		t.Fatalf("Expected 3 requests, but got %v", len(server.requests))
+	}
+	if r := server.requests[2].Header.Get("Range"); r != "" {
+		t.Fatalf("Expected third request to download whole content, but got Range header %q", r)
+	}
+	if sha256 != sha256Hex(newContent) {
+		t.Fatalf("Expected SHA256 %v of new content, but got %v", sha256Hex(newContent), sha256)
+	}
+}
+
+func TestDownloadRestartedWithContentEncoding(t *testing.T) {
+	defer prepareEnvironment(t)()
+	configureWorker(t)
+	content := randomContent(t)
+	server := &flakyServer{
+		content: func(request int) []byte { return content },
+		ranges:  true,
+		gzip:    true,
+	}
+
+	file, sha256 := testDownload(t, server, "")
+
+	// ranges refer to the gzip encoded content, but the gzip encoded
+	// content of the first request has been decoded, so the download can't
+	// be resumed where it stopped
+	if r := server.requests[1].Header.Get("Range"); r != "" {
+		t.Fatalf("Expected second request to download whole content, but got Range header %q", r)
+	}
+	downloaded, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatalf("Could not read downloaded file: %v", err)
+	}
+	if !bytes.Equal(downloaded, content) || sha256 != sha256Hex(content) {
+		t.Fatalf("Downloaded content (%v bytes) or its SHA256 %v does not match the served content", len(downloaded), sha256)
+	}
+}
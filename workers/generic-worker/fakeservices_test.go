@@ -0,0 +1,122 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// The tests in this file run the worker end-to-end against in-process fakes
+// of the taskcluster services, and so also run without taskcluster
+// credentials.
+
+func TestFakeServicesTaskCompleted(t *testing.T) {
+	fakeServices, teardown := setupWithFakeServices(t)
+	defer teardown()
+
+	payload := GenericWorkerPayload{
+		Command: append(
+			helloGoodbye(),
+			copyTestdataFile(filepath.Join("SampleArtifacts", "_", "X.txt"))...,
+		),
+		MaxRunTime: 30,
+		Artifacts: []Artifact{
+			{
+				Path: filepath.Join("SampleArtifacts", "_", "X.txt"),
+				Type: "file",
+				Name: "public/build/X.txt",
+			},
+		},
+	}
+	td := testTask(t)
+
+	taskID := submitAndAssert(t, td, payload, "completed", "completed")
+
+	content, _, _, _ := getArtifactContent(t, taskID, "public/build/X.txt")
+	if string(content) != "test artifact\n" {
+		t.Fatalf("Unexpected artifact content: %q", content)
+	}
+	logtext, _, _, _ := getArtifactContent(t, taskID, "public/logs/live_backing.log")
+	if !strings.Contains(string(logtext), "hello world!") {
+		t.Fatalf("Task log does not contain task output:\n%s", logtext)
+	}
+	status, err := fakeServices.Queue.Status(taskID)
+	if err != nil {
+		t.Fatalf("Could not get task status: %v", err)
+	}
+	if run := status.Runs[0]; run.WorkerGroup != config.WorkerGroup || run.WorkerID != config.WorkerID {
+		t.Fatalf("Task was claimed by %v/%v rather than %v/%v", run.WorkerGroup, run.WorkerID, config.WorkerGroup, config.WorkerID)
+	}
+}
+
+func TestFakeServicesTaskHistory(t *testing.T) {
+	_, teardown := setupWithFakeServices(t)
+	defer teardown()
+
+	payload := GenericWorkerPayload{
+		Command:    append(helloGoodbye(), returnExitCode(3)...),
+		MaxRunTime: 30,
+	}
+	td := testTask(t)
+
+	taskID := submitAndAssert(t, td, payload, "failed", "failed")
+
+	entries, err := ReadTaskHistory(taskHistoryFile, TaskHistoryFilter{})
+	if err != nil {
+		t.Fatalf("Could not read task history: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("Expected one task history entry but got %#v", entries)
+	}
+	entry := entries[0]
+	if entry.TaskID != taskID || entry.State != "failed" || entry.Reason != "failed" {
+		t.Fatalf("Unexpected task history entry: %#v", entry)
+	}
+	if len(entry.ExitCodes) != 3 || entry.ExitCodes[0] != 0 || entry.ExitCodes[2] != 3 {
+		t.Fatalf("Expected exit codes [0 0 3] but got %v", entry.ExitCodes)
+	}
+	if entry.Finished.Before(entry.Started) || entry.DiskFreeBytesBefore == 0 || entry.DiskFreeBytesAfter == 0 {
+		t.Fatalf("Unexpected task history entry: %#v", entry)
+	}
+	if _, err := os.Stat(runningTaskFile); !os.IsNotExist(err) {
+		t.Fatalf("Running task file %v still exists after task was resolved", runningTaskFile)
+	}
+}
+
+func TestFakeServicesTaskFailed(t *testing.T) {
+	_, teardown := setupWithFakeServices(t)
+	defer teardown()
+
+	payload := GenericWorkerPayload{
+		Command:    returnExitCode(1),
+		MaxRunTime: 30,
+	}
+	td := testTask(t)
+
+	_ = submitAndAssert(t, td, payload, "failed", "failed")
+}
+
+func TestFakeServicesScopesExpandedWithRoles(t *testing.T) {
+	fakeServices, teardown := setupWithFakeServices(t)
+	defer teardown()
+
+	fakeServices.Auth.AddRole("project:fake-services", "generic-worker:cache:fake-services-cache")
+
+	mounts := []MountEntry{
+		// requires scope "generic-worker:cache:fake-services-cache"
+		&WritableDirectoryCache{
+			CacheName: "fake-services-cache",
+			Directory: "cache",
+		},
+	}
+	payload := GenericWorkerPayload{
+		Mounts:     toMountArray(t, &mounts),
+		Command:    helloGoodbye(),
+		MaxRunTime: 30,
+	}
+	td := testTask(t)
+	td.Scopes = []string{"assume:project:fake-services"}
+
+	_ = submitAndAssert(t, td, payload, "completed", "completed")
+}
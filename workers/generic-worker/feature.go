@@ -17,4 +17,21 @@ type (
 		Start() *CommandExecutionError
 		Stop(err *ExecutionErrors)
 	}
+
+	// PayloadValidator is implemented by task features that can detect
+	// problems with the task payload without side effects, so that they are
+	// reported before any task feature starts, and by the validate-payload
+	// target.
+	PayloadValidator interface {
+		ValidatePayload() *CommandExecutionError
+	}
+
+	// ReservedArtifactLocator is implemented by task features that reserve
+	// artifact names given in the task payload, so that a clash with an
+	// artifact of another task feature is reported at the payload value
+	// that gave the name. ReservedArtifactPointer returns the JSON pointer
+	// of that value, or "" if the name is not given in the task payload.
+	ReservedArtifactLocator interface {
+		ReservedArtifactPointer(name string) string
+	}
 )
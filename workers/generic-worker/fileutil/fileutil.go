@@ -4,6 +4,7 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -12,6 +13,10 @@ import (
 	"path/filepath"
 )
 
+// ErrOutsideDir is returned by OpenInDir if the path is not inside the
+// directory.
+var ErrOutsideDir = errors.New("path is not inside the directory")
+
 func WriteToFileAsJSON(obj interface{}, filename string) error {
 	jsonBytes, err := json.MarshalIndent(obj, "", "  ")
 	if err != nil {
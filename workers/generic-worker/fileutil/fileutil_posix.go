@@ -5,10 +5,12 @@ package fileutil
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 
 	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/host"
+	"golang.org/x/sys/unix"
 )
 
 // SecureFiles makes the current user/group the owner of all files in
@@ -55,3 +57,42 @@ func SecureFiles(filepaths ...string) (err error) {
 	}
 	return nil
 }
+
+// OpenInDir opens the file at the given path relative to dir, one path
+// component at a time, without following symbolic links. Since the caller
+// may run as root, resolving the path first and opening it afterwards would
+// allow other users to replace a directory of the path with a symbolic link
+// in between, so that a file outside of dir is opened. Named pipes are
+// opened without blocking, so callers should check that the opened file is
+// a regular file before reading it.
+func OpenInDir(dir, path string) (*os.File, error) {
+	rel := filepath.Clean(path)
+	if filepath.IsAbs(rel) || rel == ".." || strings.HasPrefix(rel, "../") {
+		return nil, ErrOutsideDir
+	}
+	fd, err := unix.Open(dir, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: dir, Err: err}
+	}
+	components := strings.Split(rel, "/")
+	for i, name := range components {
+		flags := unix.O_RDONLY | unix.O_NOFOLLOW | unix.O_CLOEXEC
+		if i < len(components)-1 {
+			flags |= unix.O_DIRECTORY
+		} else {
+			flags |= unix.O_NONBLOCK
+		}
+		dirfd := fd
+		fd, err = unix.Openat(dirfd, name, flags, 0)
+		if err != nil {
+			var stat unix.Stat_t
+			if unix.Fstatat(dirfd, name, &stat, unix.AT_SYMLINK_NOFOLLOW) == nil && stat.Mode&unix.S_IFMT == unix.S_IFLNK {
+				err = fmt.Errorf("%v is a symbolic link", strings.Join(components[:i+1], "/"))
+			}
+			unix.Close(dirfd)
+			return nil, err
+		}
+		unix.Close(dirfd)
+	}
+	return os.NewFile(uintptr(fd), filepath.Join(dir, rel)), nil
+}
@@ -5,7 +5,10 @@ package fileutil
 import (
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
+
+	"golang.org/x/sys/unix"
 )
 
 // TestSecureFile tests that fileutil.SecureFile creates a temporary file,
@@ -42,3 +45,55 @@ func TestSecureFile(t *testing.T) {
 		t.Fatalf("Was expecting file mode 0600 but got %v", stat.Mode())
 	}
 }
+
+func TestOpenInDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestOpenInDir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, step := range []func() error{
+		func() error { return os.Mkdir(filepath.Join(dir, "sub"), 0700) },
+		func() error { return ioutil.WriteFile(filepath.Join(dir, "sub", "file"), []byte("content"), 0600) },
+		func() error { return os.Symlink("/etc/passwd", filepath.Join(dir, "link")) },
+		func() error { return os.Symlink("sub", filepath.Join(dir, "dirlink")) },
+		func() error { return unix.Mkfifo(filepath.Join(dir, "fifo"), 0600) },
+	} {
+		if err := step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	file, err := OpenInDir(dir, "sub/../sub/file")
+	if err != nil {
+		t.Fatalf("Could not open file: %v", err)
+	}
+	content, err := ioutil.ReadAll(file)
+	file.Close()
+	if err != nil || string(content) != "content" {
+		t.Fatalf("Expected content %q but got %q (%v)", "content", content, err)
+	}
+
+	for path, expected := range map[string]string{
+		"link":         "link is a symbolic link",
+		"dirlink/file": "dirlink is a symbolic link",
+		"../file":      ErrOutsideDir.Error(),
+		"/etc/passwd":  ErrOutsideDir.Error(),
+	} {
+		_, err := OpenInDir(dir, path)
+		if err == nil || err.Error() != expected {
+			t.Fatalf("Expected error %q opening %v but got %v", expected, path, err)
+		}
+	}
+
+	// named pipes are opened without blocking
+	file, err = OpenInDir(dir, "fifo")
+	if err != nil {
+		t.Fatalf("Could not open named pipe: %v", err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil || info.Mode().IsRegular() {
+		t.Fatalf("Expected named pipe not to be a regular file (%v)", err)
+	}
+}
@@ -1,7 +1,12 @@
 package fileutil
 
 import (
+	"os"
+	"path/filepath"
+	"strings"
+
 	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/host"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/win32"
 )
 
 // SecureFiles modifies the discretionary access control list (DACL) of each
@@ -16,3 +21,33 @@ func SecureFiles(filepaths ...string) (err error) {
 	}
 	return
 }
+
+// OpenInDir opens the file at the given path relative to dir, and then
+// checks that the final path of the opened file, with any symbolic links
+// and junctions resolved, is inside dir. Checking the path before opening
+// the file would allow other users to replace a directory of the path with
+// a junction in between, so that a file outside of dir is opened.
+func OpenInDir(dir, path string) (*os.File, error) {
+	if filepath.IsAbs(path) {
+		return nil, ErrOutsideDir
+	}
+	resolvedDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(filepath.Join(dir, path))
+	if err != nil {
+		return nil, err
+	}
+	finalPath, err := win32.FinalPathName(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	rel, err := filepath.Rel(resolvedDir, finalPath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		file.Close()
+		return nil, ErrOutsideDir
+	}
+	return file, nil
+}
@@ -111,6 +111,45 @@ type (
 		TaskID string `json:"taskId"`
 	}
 
+	// Limits applied to the artifacts of payload property `artifacts`, which
+	// may be used to protect against tasks that publish far more artifacts,
+	// or far larger artifacts, than intended, for example because a
+	// directory artifact includes more files than expected. These can only
+	// lower the limits configured on the worker (config properties
+	// `maxArtifacts`, `maxArtifactSizeMegabytes` and
+	// `maxTotalArtifactsSizeMegabytes`), they cannot raise them. Limits are
+	// checked before any artifacts are uploaded; if any limit is exceeded,
+	// no artifacts of payload property `artifacts` are uploaded, and the
+	// task fails.
+	//
+	// Since: generic-worker 28.3.0
+	ArtifactLimits struct {
+
+		// The maximum size of any one artifact, in megabytes, before any
+		// content encoding is applied.
+		//
+		// Since: generic-worker 28.3.0
+		//
+		// Mininum:    1
+		MaxArtifactSizeMegabytes int64 `json:"maxArtifactSizeMegabytes,omitempty"`
+
+		// The maximum number of artifacts, counting each file of a directory
+		// artifact as an artifact.
+		//
+		// Since: generic-worker 28.3.0
+		//
+		// Mininum:    1
+		MaxArtifacts int64 `json:"maxArtifacts,omitempty"`
+
+		// The maximum total size of all artifacts, in megabytes, before any
+		// content encoding is applied.
+		//
+		// Since: generic-worker 28.3.0
+		//
+		// Mininum:    1
+		MaxTotalSizeMegabytes int64 `json:"maxTotalSizeMegabytes,omitempty"`
+	}
+
 	// Base64 encoded content of file/archive, up to 64KB (encoded) in size.
 	//
 	// Since: generic-worker 11.1.0
@@ -158,6 +197,19 @@ type (
 		// Since: generic-worker 5.3.0
 		ChainOfTrust bool `json:"chainOfTrust,omitempty"`
 
+		// Scan the files of public artifacts (artifacts whose names start
+		// with `public/`) for secrets, such as private keys and taskcluster
+		// access tokens, before they are uploaded. Depending on worker config
+		// setting `secretScanningAction`, an artifact that appears to contain
+		// a secret is either replaced by an error artifact, which fails the
+		// task, or uploaded with prefix `public/` of its name replaced by
+		// `private/`. Workers with config setting `secretScanning` set to
+		// `always` scan public artifacts regardless of this feature flag, and
+		// workers with it set to `disabled` do not run tasks that enable it.
+		//
+		// Since: generic-worker 28.3.0
+		SecretScanning bool `json:"secretScanning,omitempty"`
+
 		// The taskcluster proxy provides an easy and safe way to make authenticated
 		// taskcluster requests within the scope(s) of a particular task. See
 		// [the github project](https://github.com/taskcluster/taskcluster-proxy) for more information.
@@ -185,6 +237,20 @@ type (
 	// Taskcluster Task definition.
 	GenericWorkerPayload struct {
 
+		// Limits applied to the artifacts of payload property `artifacts`, which
+		// may be used to protect against tasks that publish far more artifacts,
+		// or far larger artifacts, than intended, for example because a
+		// directory artifact includes more files than expected. These can only
+		// lower the limits configured on the worker (config properties
+		// `maxArtifacts`, `maxArtifactSizeMegabytes` and
+		// `maxTotalArtifactsSizeMegabytes`), they cannot raise them. Limits are
+		// checked before any artifacts are uploaded; if any limit is exceeded,
+		// no artifacts of payload property `artifacts` are uploaded, and the
+		// task fails.
+		//
+		// Since: generic-worker 28.3.0
+		ArtifactLimits ArtifactLimits `json:"artifactLimits,omitempty"`
+
 		// Artifacts to be published.
 		//
 		// Since: generic-worker 1.0.0
@@ -193,11 +259,13 @@ type (
 		// One array per command (each command is an array of arguments). Several arrays
 		// for several commands.
 		//
+		// Exactly one of `command` and `steps` must be given.
+		//
 		// Since: generic-worker 0.0.1
 		//
 		// Array items:
 		// Array items:
-		Command [][]string `json:"command"`
+		Command [][]string `json:"command,omitempty"`
 
 		// Env vars must be string to __string__ mappings (not number or boolean). For example:
 		// ```
@@ -232,6 +300,12 @@ type (
 		// Since: generic-worker 5.3.0
 		Features FeatureFlags `json:"features,omitempty"`
 
+		// Limits applied to the task log (`public/logs/live_backing.log`), which
+		// may be used to protect against tasks that produce excessive output.
+		//
+		// Since: generic-worker 28.3.0
+		Logs TaskLogLimits `json:"logs,omitempty"`
+
 		// Maximum time the task container can run in seconds.
 		//
 		// Since: generic-worker 0.0.1
@@ -266,6 +340,15 @@ type (
 		// Array items:
 		OSGroups []string `json:"osGroups,omitempty"`
 
+		// An alternative to `command`, in which each command is a step with an
+		// optional name, environment variables and `continueOnError` flag.
+		// Exactly one of `command` and `steps` must be given. Steps run in
+		// order, like commands. A summary of the steps, with the result, exit code
+		// and duration of each, is published as artifact `public/steps.json`.
+		//
+		// Since: generic-worker 28.3.0
+		Steps []Step `json:"steps,omitempty"`
+
 		// URL of a service that can indicate tasks superseding this one; the current `taskId`
 		// will be appended as a query argument `taskId`. The service should return an object with
 		// a `supersedes` key containing a list of `taskId`s, including the supplied `taskId`. The
@@ -276,6 +359,15 @@ type (
 		//
 		// Since: generic-worker 10.2.2
 		SupersederURL string `json:"supersederUrl,omitempty"`
+
+		// Test result files that the task commands write. Once the task commands
+		// have completed, the files are parsed, a summary of passed, failed and
+		// skipped tests (with the first failures) is written to the task log, and
+		// the results are published in a normalized form as artifact
+		// `public/test-results.json`.
+		//
+		// Since: generic-worker 28.3.0
+		TestResults TestResults `json:"testResults,omitempty"`
 	}
 
 	// Byte-for-byte literal inline content of file/archive, up to 64KB in size.
@@ -317,6 +409,130 @@ type (
 		Format string `json:"format"`
 	}
 
+	Step struct {
+
+		// The command of the step, as an array of arguments.
+		//
+		// Since: generic-worker 28.3.0
+		//
+		// Array items:
+		Command []string `json:"command"`
+
+		// If true, a failure of the step (a non-zero exit code) is recorded
+		// in the step summary, but does not fail the task, and the next step
+		// runs.
+		//
+		// Since: generic-worker 28.3.0
+		//
+		// Default:    false
+		ContinueOnError bool `json:"continueOnError,omitempty"`
+
+		// Environment variables of the step, which override those in `env`.
+		//
+		// Since: generic-worker 28.3.0
+		//
+		// Map entries:
+		Env map[string]string `json:"env,omitempty"`
+
+		// Name of the step, shown in the task log and the step summary.
+		//
+		// Since: generic-worker 28.3.0
+		//
+		// Max length: 255
+		Name string `json:"name,omitempty"`
+	}
+
+	// Limits applied to the task log (`public/logs/live_backing.log`), which
+	// may be used to protect against tasks that produce excessive output.
+	//
+	// Since: generic-worker 28.3.0
+	TaskLogLimits struct {
+
+		// If true, the task will be resolved as `failed` if the task log
+		// exceeds its maximum size.
+		//
+		// Since: generic-worker 28.3.0
+		//
+		// Default:    false
+		FailOnTruncation bool `json:"failOnTruncation,omitempty"`
+
+		// If true, and the task log exceeds its maximum size, the first half
+		// of the log and the most recent output (the last half) are kept,
+		// rather than the start of the log only.
+		//
+		// Since: generic-worker 28.3.0
+		//
+		// Default:    false
+		KeepTail bool `json:"keepTail,omitempty"`
+
+		// The maximum size of the task log, in megabytes. This can only lower
+		// the limit configured on the worker (config property
+		// `maxTaskLogSizeMegabytes`), it cannot raise it. Once the limit is
+		// reached, a truncation notice is written to the log and further
+		// output is discarded (see `keepTail`).
+		//
+		// Since: generic-worker 28.3.0
+		//
+		// Mininum:    1
+		MaxSizeMegabytes int64 `json:"maxSizeMegabytes,omitempty"`
+	}
+
+	TestResultFiles struct {
+
+		// The format of the test result file(s): `junit` for JUnit XML,
+		// `tap` for the Test Anything Protocol, or `go-test-json` for the
+		// output of `go test -json`.
+		//
+		// Since: generic-worker 28.3.0
+		//
+		// Possible values:
+		//   * "junit"
+		//   * "tap"
+		//   * "go-test-json"
+		Format string `json:"format"`
+
+		// Path of the test result file(s), relative to the task
+		// directory. May be a glob pattern, e.g. `reports/*.xml`, in
+		// which case all matching files are parsed.
+		//
+		// Since: generic-worker 28.3.0
+		Path string `json:"path"`
+	}
+
+	// Test result files that the task commands write. Once the task commands
+	// have completed, the files are parsed, a summary of passed, failed and
+	// skipped tests (with the first failures) is written to the task log, and
+	// the results are published in a normalized form as artifact
+	// `public/test-results.json`.
+	//
+	// Since: generic-worker 28.3.0
+	TestResults struct {
+
+		// If true, the task fails if any test failed, even if the task
+		// commands succeeded.
+		//
+		// Since: generic-worker 28.3.0
+		//
+		// Default:    false
+		FailTaskOnFailures bool `json:"failTaskOnFailures,omitempty"`
+
+		// The test result files to parse. If there are none, no test results
+		// are published.
+		//
+		// Since: generic-worker 28.3.0
+		Files []TestResultFiles `json:"files,omitempty"`
+
+		// The maximum number of failed tests that are listed in the task log.
+		// All failed tests are listed in `public/test-results.json`.
+		//
+		// Since: generic-worker 28.3.0
+		//
+		// Default:    10
+		// Mininum:    1
+		// Maximum:    1000
+		MaxFailuresInLog int64 `json:"maxFailuresInLog,omitempty"`
+	}
+
 	// URL to download content from.
 	//
 	// Since: generic-worker 5.4.0
@@ -591,6 +807,33 @@ func taskPayloadSchema() string {
   },
   "description": "This schema defines the structure of the ` + "`" + `payload` + "`" + ` property referred to in a\nTaskcluster Task definition.",
   "properties": {
+    "artifactLimits": {
+      "additionalProperties": false,
+      "description": "Limits applied to the artifacts of payload property ` + "`" + `artifacts` + "`" + `, which\nmay be used to protect against tasks that publish far more artifacts,\nor far larger artifacts, than intended, for example because a\ndirectory artifact includes more files than expected. These can only\nlower the limits configured on the worker (config properties\n` + "`" + `maxArtifacts` + "`" + `, ` + "`" + `maxArtifactSizeMegabytes` + "`" + ` and\n` + "`" + `maxTotalArtifactsSizeMegabytes` + "`" + `), they cannot raise them. Limits are\nchecked before any artifacts are uploaded; if any limit is exceeded,\nno artifacts of payload property ` + "`" + `artifacts` + "`" + ` are uploaded, and the\ntask fails.\n\nSince: generic-worker 28.3.0",
+      "properties": {
+        "maxArtifactSizeMegabytes": {
+          "description": "The maximum size of any one artifact, in megabytes, before any\ncontent encoding is applied.\n\nSince: generic-worker 28.3.0",
+          "minimum": 1,
+          "title": "Maximum artifact size in megabytes",
+          "type": "integer"
+        },
+        "maxArtifacts": {
+          "description": "The maximum number of artifacts, counting each file of a directory\nartifact as an artifact.\n\nSince: generic-worker 28.3.0",
+          "minimum": 1,
+          "title": "Maximum number of artifacts",
+          "type": "integer"
+        },
+        "maxTotalSizeMegabytes": {
+          "description": "The maximum total size of all artifacts, in megabytes, before any\ncontent encoding is applied.\n\nSince: generic-worker 28.3.0",
+          "minimum": 1,
+          "title": "Maximum total artifact size in megabytes",
+          "type": "integer"
+        }
+      },
+      "required": [],
+      "title": "Artifact limits",
+      "type": "object"
+    },
     "artifacts": {
       "description": "Artifacts to be published.\n\nSince: generic-worker 1.0.0",
       "items": {
@@ -648,7 +891,7 @@ func taskPayloadSchema() string {
       "uniqueItems": true
     },
     "command": {
-      "description": "One array per command (each command is an array of arguments). Several arrays\nfor several commands.\n\nSince: generic-worker 0.0.1",
+      "description": "One array per command (each command is an array of arguments). Several arrays\nfor several commands.\n\nExactly one of ` + "`" + `command` + "`" + ` and ` + "`" + `steps` + "`" + ` must be given.\n\nSince: generic-worker 0.0.1",
       "items": {
         "items": {
           "type": "string"
@@ -679,6 +922,11 @@ func taskPayloadSchema() string {
           "title": "Enable generation of signed Chain of Trust artifacts",
           "type": "boolean"
         },
+        "secretScanning": {
+          "description": "Scan the files of public artifacts (artifacts whose names start\nwith ` + "`" + `public/` + "`" + `) for secrets, such as private keys and taskcluster\naccess tokens, before they are uploaded. Depending on worker config\nsetting ` + "`" + `secretScanningAction` + "`" + `, an artifact that appears to contain\na secret is either replaced by an error artifact, which fails the\ntask, or uploaded with prefix ` + "`" + `public/` + "`" + ` of its name replaced by\n` + "`" + `private/` + "`" + `. Workers with config setting ` + "`" + `secretScanning` + "`" + ` set to\n` + "`" + `always` + "`" + ` scan public artifacts regardless of this feature flag, and\nworkers with it set to ` + "`" + `disabled` + "`" + ` do not run tasks that enable it.\n\nSince: generic-worker 28.3.0",
+          "title": "Scan public artifacts for secrets before uploading them",
+          "type": "boolean"
+        },
         "taskclusterProxy": {
           "description": "The taskcluster proxy provides an easy and safe way to make authenticated\ntaskcluster requests within the scope(s) of a particular task. See\n[the github project](https://github.com/taskcluster/taskcluster-proxy) for more information.\n\nSince: generic-worker 10.6.0",
           "title": "Run [taskcluster-proxy](https://github.com/taskcluster/taskcluster-proxy) to allow tasks to dynamically proxy requests to taskcluster services",
@@ -689,6 +937,33 @@ func taskPayloadSchema() string {
       "title": "Feature flags",
       "type": "object"
     },
+    "logs": {
+      "additionalProperties": false,
+      "description": "Limits applied to the task log (` + "`" + `public/logs/live_backing.log` + "`" + `), which\nmay be used to protect against tasks that produce excessive output.\n\nSince: generic-worker 28.3.0",
+      "properties": {
+        "failOnTruncation": {
+          "default": false,
+          "description": "If true, the task will be resolved as ` + "`" + `failed` + "`" + ` if the task log\nexceeds its maximum size.\n\nSince: generic-worker 28.3.0",
+          "title": "Fail the task if the task log is truncated",
+          "type": "boolean"
+        },
+        "keepTail": {
+          "default": false,
+          "description": "If true, and the task log exceeds its maximum size, the first half\nof the log and the most recent output (the last half) are kept,\nrather than the start of the log only.\n\nSince: generic-worker 28.3.0",
+          "title": "Keep the tail of truncated task logs",
+          "type": "boolean"
+        },
+        "maxSizeMegabytes": {
+          "description": "The maximum size of the task log, in megabytes. This can only lower\nthe limit configured on the worker (config property\n` + "`" + `maxTaskLogSizeMegabytes` + "`" + `), it cannot raise it. Once the limit is\nreached, a truncation notice is written to the log and further\noutput is discarded (see ` + "`" + `keepTail` + "`" + `).\n\nSince: generic-worker 28.3.0",
+          "minimum": 1,
+          "title": "Maximum task log size in megabytes",
+          "type": "integer"
+        }
+      },
+      "required": [],
+      "title": "Task log limits",
+      "type": "object"
+    },
     "maxRunTime": {
       "description": "Maximum time the task container can run in seconds.\n\nSince: generic-worker 0.0.1",
       "maximum": 86400,
@@ -736,15 +1011,113 @@ func taskPayloadSchema() string {
       "type": "array",
       "uniqueItems": false
     },
+    "steps": {
+      "description": "An alternative to ` + "`" + `command` + "`" + `, in which each command is a step with an\noptional name, environment variables and ` + "`" + `continueOnError` + "`" + ` flag.\nExactly one of ` + "`" + `command` + "`" + ` and ` + "`" + `steps` + "`" + ` must be given. Steps run in\norder, like commands. A summary of the steps, with the result, exit code\nand duration of each, is published as artifact ` + "`" + `public/steps.json` + "`" + `.\n\nSince: generic-worker 28.3.0",
+      "items": {
+        "additionalProperties": false,
+        "properties": {
+          "command": {
+            "description": "The command of the step, as an array of arguments.\n\nSince: generic-worker 28.3.0",
+            "items": {
+              "type": "string"
+            },
+            "minItems": 1,
+            "title": "Step command",
+            "type": "array"
+          },
+          "continueOnError": {
+            "default": false,
+            "description": "If true, a failure of the step (a non-zero exit code) is recorded\nin the step summary, but does not fail the task, and the next step\nruns.\n\nSince: generic-worker 28.3.0",
+            "title": "Continue on error",
+            "type": "boolean"
+          },
+          "env": {
+            "additionalProperties": {
+              "type": "string"
+            },
+            "description": "Environment variables of the step, which override those in ` + "`" + `env` + "`" + `.\n\nSince: generic-worker 28.3.0",
+            "title": "Step environment variables",
+            "type": "object"
+          },
+          "name": {
+            "description": "Name of the step, shown in the task log and the step summary.\n\nSince: generic-worker 28.3.0",
+            "maxLength": 255,
+            "title": "Step name",
+            "type": "string"
+          }
+        },
+        "required": [
+          "command"
+        ],
+        "title": "Step",
+        "type": "object"
+      },
+      "minItems": 1,
+      "title": "Named steps to run",
+      "type": "array",
+      "uniqueItems": false
+    },
     "supersederUrl": {
       "description": "URL of a service that can indicate tasks superseding this one; the current ` + "`" + `taskId` + "`" + `\nwill be appended as a query argument ` + "`" + `taskId` + "`" + `. The service should return an object with\na ` + "`" + `supersedes` + "`" + ` key containing a list of ` + "`" + `taskId` + "`" + `s, including the supplied ` + "`" + `taskId` + "`" + `. The\ntasks should be ordered such that each task supersedes all tasks appearing later in the\nlist.\n\nSee [superseding](https://docs.taskcluster.net/reference/platform/taskcluster-queue/docs/superseding) for more detail.\n\nSince: generic-worker 10.2.2",
       "format": "uri",
       "title": "Superseder URL",
       "type": "string"
+    },
+    "testResults": {
+      "additionalProperties": false,
+      "description": "Test result files that the task commands write. Once the task commands\nhave completed, the files are parsed, a summary of passed, failed and\nskipped tests (with the first failures) is written to the task log, and\nthe results are published in a normalized form as artifact\n` + "`" + `public/test-results.json` + "`" + `.\n\nSince: generic-worker 28.3.0",
+      "properties": {
+        "failTaskOnFailures": {
+          "default": false,
+          "description": "If true, the task fails if any test failed, even if the task\ncommands succeeded.\n\nSince: generic-worker 28.3.0",
+          "title": "Fail task on test failures",
+          "type": "boolean"
+        },
+        "files": {
+          "description": "The test result files to parse. If there are none, no test results\nare published.\n\nSince: generic-worker 28.3.0",
+          "items": {
+            "additionalProperties": false,
+            "properties": {
+              "format": {
+                "description": "The format of the test result file(s): ` + "`" + `junit` + "`" + ` for JUnit XML,\n` + "`" + `tap` + "`" + ` for the Test Anything Protocol, or ` + "`" + `go-test-json` + "`" + ` for the\noutput of ` + "`" + `go test -json` + "`" + `.\n\nSince: generic-worker 28.3.0",
+                "enum": [
+                  "junit",
+                  "tap",
+                  "go-test-json"
+                ],
+                "title": "Test result file format",
+                "type": "string"
+              },
+              "path": {
+                "description": "Path of the test result file(s), relative to the task\ndirectory. May be a glob pattern, e.g. ` + "`" + `reports/*.xml` + "`" + `, in\nwhich case all matching files are parsed.\n\nSince: generic-worker 28.3.0",
+                "title": "Test result file path",
+                "type": "string"
+              }
+            },
+            "required": [
+              "path",
+              "format"
+            ],
+            "title": "Test result files",
+            "type": "object"
+          },
+          "title": "Test result files",
+          "type": "array"
+        },
+        "maxFailuresInLog": {
+          "default": 10,
+          "description": "The maximum number of failed tests that are listed in the task log.\nAll failed tests are listed in ` + "`" + `public/test-results.json` + "`" + `.\n\nSince: generic-worker 28.3.0",
+          "maximum": 1000,
+          "minimum": 1,
+          "title": "Maximum number of failures in task log",
+          "type": "integer"
+        }
+      },
+      "title": "Test results",
+      "type": "object"
     }
   },
   "required": [
-    "command",
     "maxRunTime"
   ],
   "title": "Generic worker payload",
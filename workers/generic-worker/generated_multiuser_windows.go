@@ -110,6 +110,49 @@ type (
 		TaskID string `json:"taskId"`
 	}
 
+	// Limits applied to the artifacts of payload property `artifacts`, which
+	// may be used to protect against tasks that publish far more artifacts,
+	// or far larger artifacts, than intended, for example because a
+	// directory artifact includes more files than expected. These can only
+	// lower the limits configured on the worker (config properties
+	// `maxArtifacts`, `maxArtifactSizeMegabytes` and
+	// `maxTotalArtifactsSizeMegabytes`), they cannot raise them. Limits are
+	// checked before any artifacts are uploaded; if any limit is exceeded,
+	// no artifacts of payload property `artifacts` are uploaded, and the
+	// task fails.
+	// Artifacts that task commands have already uploaded with feature
+	// `liveArtifacts` count towards the number of artifacts and the total
+	// size, and live artifact uploads that would exceed a limit are
+	// rejected.
+	//
+	// Since: generic-worker 28.3.0
+	ArtifactLimits struct {
+
+		// The maximum size of any one artifact, in megabytes, before any
+		// content encoding is applied.
+		//
+		// Since: generic-worker 28.3.0
+		//
+		// Mininum:    1
+		MaxArtifactSizeMegabytes int64 `json:"maxArtifactSizeMegabytes,omitempty"`
+
+		// The maximum number of artifacts, counting each file of a directory
+		// artifact as an artifact.
+		//
+		// Since: generic-worker 28.3.0
+		//
+		// Mininum:    1
+		MaxArtifacts int64 `json:"maxArtifacts,omitempty"`
+
+		// The maximum total size of all artifacts, in megabytes, before any
+		// content encoding is applied.
+		//
+		// Since: generic-worker 28.3.0
+		//
+		// Mininum:    1
+		MaxTotalSizeMegabytes int64 `json:"maxTotalSizeMegabytes,omitempty"`
+	}
+
 	// Base64 encoded content of file/archive, up to 64KB (encoded) in size.
 	//
 	// Since: generic-worker 11.1.0
@@ -157,6 +200,24 @@ type (
 		// Since: generic-worker 5.3.0
 		ChainOfTrust bool `json:"chainOfTrust,omitempty"`
 
+		// Runs a local HTTP endpoint, whose URL is given to the task commands
+		// in env var `TASKCLUSTER_ARTIFACT_UPLOAD_URL`, that uploads files of
+		// the task directory as artifacts immediately, rather than after the
+		// task commands have completed. Requests must have header
+		// `Authorization: Bearer <token>`, where `<token>` is the value of env
+		// var `TASKCLUSTER_ARTIFACT_UPLOAD_TOKEN`. A request is a `POST` with
+		// a json body such as
+		// `{"path": "results/summary.txt", "name": "public/summary.txt"}`,
+		// and optionally `contentType`, `contentEncoding` and `expires`,
+		// with the same meaning as in payload property `artifacts`. Artifact
+		// names reserved by the worker, or used by payload property
+		// `artifacts`, may not be uploaded, and uploads count towards the
+		// artifact limits of the task (see payload property
+		// `artifactLimits`).
+		//
+		// Since: generic-worker 28.3.0
+		LiveArtifacts bool `json:"liveArtifacts,omitempty"`
+
 		// Runs commands with UAC elevation. Only set to true when UAC is
 		// enabled on the worker and Administrative privileges are required by
 		// task commands. When UAC is disabled on the worker, task commands will
@@ -177,6 +238,30 @@ type (
 		// Since: generic-worker 10.11.0
 		RunAsAdministrator bool `json:"runAsAdministrator,omitempty"`
 
+		// Scan the files of public artifacts (artifacts whose names start
+		// with `public/`) for secrets, such as private keys and taskcluster
+		// access tokens, before they are uploaded. Depending on worker config
+		// setting `secretScanningAction`, an artifact that appears to contain
+		// a secret is either replaced by an error artifact, which fails the
+		// task, or uploaded with prefix `public/` of its name replaced by
+		// `private/`. Workers with config setting `secretScanning` set to
+		// `always` scan public artifacts regardless of this feature flag, and
+		// workers with it set to `disabled` do not run tasks that enable it.
+		//
+		// Since: generic-worker 28.3.0
+		SecretScanning bool `json:"secretScanning,omitempty"`
+
+		// Runs a read-only local HTTP endpoint, whose URL is given to the task
+		// commands in env var `TASKCLUSTER_TASK_METADATA_URL`, that returns
+		// json metadata about the running task: the task definition (`/task`),
+		// the status of the task run, such as its `runId`, `takenUntil`, task
+		// deadline and the time remaining before `maxRunTime` is exceeded
+		// (`/run`), and the identity and location of the worker (`/worker`).
+		// A `GET` request to `/` returns all of them.
+		//
+		// Since: generic-worker 28.3.0
+		TaskMetadata bool `json:"taskMetadata,omitempty"`
+
 		// The taskcluster proxy provides an easy and safe way to make authenticated
 		// taskcluster requests within the scope(s) of a particular task. See
 		// [the github project](https://github.com/taskcluster/taskcluster-proxy) for more information.
@@ -204,6 +289,24 @@ type (
 	// Taskcluster Task definition.
 	GenericWorkerPayload struct {
 
+		// Limits applied to the artifacts of payload property `artifacts`, which
+		// may be used to protect against tasks that publish far more artifacts,
+		// or far larger artifacts, than intended, for example because a
+		// directory artifact includes more files than expected. These can only
+		// lower the limits configured on the worker (config properties
+		// `maxArtifacts`, `maxArtifactSizeMegabytes` and
+		// `maxTotalArtifactsSizeMegabytes`), they cannot raise them. Limits are
+		// checked before any artifacts are uploaded; if any limit is exceeded,
+		// no artifacts of payload property `artifacts` are uploaded, and the
+		// task fails.
+		// Artifacts that task commands have already uploaded with feature
+		// `liveArtifacts` count towards the number of artifacts and the total
+		// size, and live artifact uploads that would exceed a limit are
+		// rejected.
+		//
+		// Since: generic-worker 28.3.0
+		ArtifactLimits ArtifactLimits `json:"artifactLimits,omitempty"`
+
 		// Artifacts to be published.
 		//
 		// Since: generic-worker 1.0.0
@@ -262,6 +365,12 @@ type (
 		// Since: generic-worker 5.3.0
 		Features FeatureFlags `json:"features,omitempty"`
 
+		// Limits applied to the task log (`public/logs/live_backing.log`), which
+		// may be used to protect against tasks that produce excessive output.
+		//
+		// Since: generic-worker 28.3.0
+		Logs TaskLogLimits `json:"logs,omitempty"`
+
 		// Maximum time the task container can run in seconds.
 		//
 		// Since: generic-worker 0.0.1
@@ -334,6 +443,15 @@ type (
 		//
 		// Since: generic-worker 10.2.2
 		SupersederURL string `json:"supersederUrl,omitempty"`
+
+		// Test result files that the task commands write. Once the task commands
+		// have completed, the files are parsed, a summary of passed, failed and
+		// skipped tests (with the first failures) is written to the task log, and
+		// the results are published in a normalized form as artifact
+		// `public/test-results.json`.
+		//
+		// Since: generic-worker 28.3.0
+		TestResults TestResults `json:"testResults,omitempty"`
 	}
 
 	// Byte-for-byte literal inline content of file/archive, up to 64KB in size.
@@ -375,6 +493,97 @@ type (
 		Format string `json:"format"`
 	}
 
+	// Limits applied to the task log (`public/logs/live_backing.log`), which
+	// may be used to protect against tasks that produce excessive output.
+	//
+	// Since: generic-worker 28.3.0
+	TaskLogLimits struct {
+
+		// If true, the task will be resolved as `failed` if the task log
+		// exceeds its maximum size.
+		//
+		// Since: generic-worker 28.3.0
+		//
+		// Default:    false
+		FailOnTruncation bool `json:"failOnTruncation,omitempty"`
+
+		// If true, and the task log exceeds its maximum size, the first half
+		// of the log and the most recent output (the last half) are kept,
+		// rather than the start of the log only.
+		//
+		// Since: generic-worker 28.3.0
+		//
+		// Default:    false
+		KeepTail bool `json:"keepTail,omitempty"`
+
+		// The maximum size of the task log, in megabytes. This can only lower
+		// the limit configured on the worker (config property
+		// `maxTaskLogSizeMegabytes`), it cannot raise it. Once the limit is
+		// reached, a truncation notice is written to the log and further
+		// output is discarded (see `keepTail`).
+		//
+		// Since: generic-worker 28.3.0
+		//
+		// Mininum:    1
+		MaxSizeMegabytes int64 `json:"maxSizeMegabytes,omitempty"`
+	}
+
+	TestResultFiles struct {
+
+		// The format of the test result file(s): `junit` for JUnit XML,
+		// `tap` for the Test Anything Protocol, or `go-test-json` for the
+		// output of `go test -json`.
+		//
+		// Since: generic-worker 28.3.0
+		//
+		// Possible values:
+		//   * "junit"
+		//   * "tap"
+		//   * "go-test-json"
+		Format string `json:"format"`
+
+		// Path of the test result file(s), relative to the task
+		// directory. May be a glob pattern, e.g. `reports/*.xml`, in
+		// which case all matching files are parsed.
+		//
+		// Since: generic-worker 28.3.0
+		Path string `json:"path"`
+	}
+
+	// Test result files that the task commands write. Once the task commands
+	// have completed, the files are parsed, a summary of passed, failed and
+	// skipped tests (with the first failures) is written to the task log, and
+	// the results are published in a normalized form as artifact
+	// `public/test-results.json`.
+	//
+	// Since: generic-worker 28.3.0
+	TestResults struct {
+
+		// If true, the task fails if any test failed, even if the task
+		// commands succeeded.
+		//
+		// Since: generic-worker 28.3.0
+		//
+		// Default:    false
+		FailTaskOnFailures bool `json:"failTaskOnFailures,omitempty"`
+
+		// The test result files to parse. If there are none, no test results
+		// are published.
+		//
+		// Since: generic-worker 28.3.0
+		Files []TestResultFiles `json:"files,omitempty"`
+
+		// The maximum number of failed tests that are listed in the task log.
+		// All failed tests are listed in `public/test-results.json`.
+		//
+		// Since: generic-worker 28.3.0
+		//
+		// Default:    10
+		// Mininum:    1
+		// Maximum:    1000
+		MaxFailuresInLog int64 `json:"maxFailuresInLog,omitempty"`
+	}
+
 	// URL to download content from.
 	//
 	// Since: generic-worker 5.4.0
@@ -649,6 +858,33 @@ func taskPayloadSchema() string {
   },
   "description": "This schema defines the structure of the ` + "`" + `payload` + "`" + ` property referred to in a\nTaskcluster Task definition.",
   "properties": {
+    "artifactLimits": {
+      "additionalProperties": false,
+      "description": "Limits applied to the artifacts of payload property ` + "`" + `artifacts` + "`" + `, which\nmay be used to protect against tasks that publish far more artifacts,\nor far larger artifacts, than intended, for example because a\ndirectory artifact includes more files than expected. These can only\nlower the limits configured on the worker (config properties\n` + "`" + `maxArtifacts` + "`" + `, ` + "`" + `maxArtifactSizeMegabytes` + "`" + ` and\n` + "`" + `maxTotalArtifactsSizeMegabytes` + "`" + `), they cannot raise them. Limits are\nchecked before any artifacts are uploaded; if any limit is exceeded,\nno artifacts of payload property ` + "`" + `artifacts` + "`" + ` are uploaded, and the\ntask fails.\nArtifacts that task commands have already uploaded with feature\n` + "`" + `liveArtifacts` + "`" + ` count towards the number of artifacts and the total\nsize, and live artifact uploads that would exceed a limit are\nrejected.\n\nSince: generic-worker 28.3.0",
+      "properties": {
+        "maxArtifactSizeMegabytes": {
+          "description": "The maximum size of any one artifact, in megabytes, before any\ncontent encoding is applied.\n\nSince: generic-worker 28.3.0",
+          "minimum": 1,
+          "title": "Maximum artifact size in megabytes",
+          "type": "integer"
+        },
+        "maxArtifacts": {
+          "description": "The maximum number of artifacts, counting each file of a directory\nartifact as an artifact.\n\nSince: generic-worker 28.3.0",
+          "minimum": 1,
+          "title": "Maximum number of artifacts",
+          "type": "integer"
+        },
+        "maxTotalSizeMegabytes": {
+          "description": "The maximum total size of all artifacts, in megabytes, before any\ncontent encoding is applied.\n\nSince: generic-worker 28.3.0",
+          "minimum": 1,
+          "title": "Maximum total artifact size in megabytes",
+          "type": "integer"
+        }
+      },
+      "required": [],
+      "title": "Artifact limits",
+      "type": "object"
+    },
     "artifacts": {
       "description": "Artifacts to be published.\n\nSince: generic-worker 1.0.0",
       "items": {
@@ -732,11 +968,26 @@ func taskPayloadSchema() string {
           "title": "Enable generation of signed Chain of Trust artifacts",
           "type": "boolean"
         },
+        "liveArtifacts": {
+          "description": "Runs a local HTTP endpoint, whose URL is given to the task commands\nin env var ` + "`" + `TASKCLUSTER_ARTIFACT_UPLOAD_URL` + "`" + `, that uploads files of\nthe task directory as artifacts immediately, rather than after the\ntask commands have completed. Requests must have header\n` + "`" + `Authorization: Bearer \u003ctoken\u003e` + "`" + `, where ` + "`" + `\u003ctoken\u003e` + "`" + ` is the value of env\nvar ` + "`" + `TASKCLUSTER_ARTIFACT_UPLOAD_TOKEN` + "`" + `. A request is a ` + "`" + `POST` + "`" + ` with\na json body such as\n` + "`" + `{\"path\": \"results/summary.txt\", \"name\": \"public/summary.txt\"}` + "`" + `,\nand optionally ` + "`" + `contentType` + "`" + `, ` + "`" + `contentEncoding` + "`" + ` and ` + "`" + `expires` + "`" + `,\nwith the same meaning as in payload property ` + "`" + `artifacts` + "`" + `. Artifact\nnames reserved by the worker, or used by payload property\n` + "`" + `artifacts` + "`" + `, may not be uploaded, and uploads count towards the\nartifact limits of the task (see payload property\n` + "`" + `artifactLimits` + "`" + `).\n\nSince: generic-worker 28.3.0",
+          "title": "Allow task commands to upload artifacts while the task is running",
+          "type": "boolean"
+        },
         "runAsAdministrator": {
           "description": "Runs commands with UAC elevation. Only set to true when UAC is\nenabled on the worker and Administrative privileges are required by\ntask commands. When UAC is disabled on the worker, task commands will\nalready run with full user privileges, and therefore a value of true\nwill result in a malformed-payload task exception.\n\nA value of true does not add the task user to the ` + "`" + `Administrators` + "`" + `\ngroup - see the ` + "`" + `osGroups` + "`" + ` property for that. Typically\n` + "`" + `task.payload.osGroups` + "`" + ` should include an Administrative group, such\nas ` + "`" + `Administrators` + "`" + `, when setting to true.\n\nFor security, ` + "`" + `runAsAdministrator` + "`" + ` feature cannot be used in\nconjunction with ` + "`" + `chainOfTrust` + "`" + ` feature.\n\nRequires scope\n` + "`" + `generic-worker:run-as-administrator:\u003cprovisionerId\u003e/\u003cworkerType\u003e` + "`" + `.\n\nSince: generic-worker 10.11.0",
           "title": "Run commands with UAC process elevation",
           "type": "boolean"
         },
+        "secretScanning": {
+          "description": "Scan the files of public artifacts (artifacts whose names start\nwith ` + "`" + `public/` + "`" + `) for secrets, such as private keys and taskcluster\naccess tokens, before they are uploaded. Depending on worker config\nsetting ` + "`" + `secretScanningAction` + "`" + `, an artifact that appears to contain\na secret is either replaced by an error artifact, which fails the\ntask, or uploaded with prefix ` + "`" + `public/` + "`" + ` of its name replaced by\n` + "`" + `private/` + "`" + `. Workers with config setting ` + "`" + `secretScanning` + "`" + ` set to\n` + "`" + `always` + "`" + ` scan public artifacts regardless of this feature flag, and\nworkers with it set to ` + "`" + `disabled` + "`" + ` do not run tasks that enable it.\n\nSince: generic-worker 28.3.0",
+          "title": "Scan public artifacts for secrets before uploading them",
+          "type": "boolean"
+        },
+        "taskMetadata": {
+          "description": "Runs a read-only local HTTP endpoint, whose URL is given to the task\ncommands in env var ` + "`" + `TASKCLUSTER_TASK_METADATA_URL` + "`" + `, that returns\njson metadata about the running task: the task definition (` + "`" + `/task` + "`" + `),\nthe status of the task run, such as its ` + "`" + `runId` + "`" + `, ` + "`" + `takenUntil` + "`" + `, task\ndeadline and the time remaining before ` + "`" + `maxRunTime` + "`" + ` is exceeded\n(` + "`" + `/run` + "`" + `), and the identity and location of the worker (` + "`" + `/worker` + "`" + `).\nA ` + "`" + `GET` + "`" + ` request to ` + "`" + `/` + "`" + ` returns all of them.\n\nSince: generic-worker 28.3.0",
+          "title": "Serve task metadata to task commands",
+          "type": "boolean"
+        },
         "taskclusterProxy": {
           "description": "The taskcluster proxy provides an easy and safe way to make authenticated\ntaskcluster requests within the scope(s) of a particular task. See\n[the github project](https://github.com/taskcluster/taskcluster-proxy) for more information.\n\nSince: generic-worker 10.6.0",
           "title": "Run [taskcluster-proxy](https://github.com/taskcluster/taskcluster-proxy) to allow tasks to dynamically proxy requests to taskcluster services",
@@ -747,6 +998,33 @@ func taskPayloadSchema() string {
       "title": "Feature flags",
       "type": "object"
     },
+    "logs": {
+      "additionalProperties": false,
+      "description": "Limits applied to the task log (` + "`" + `public/logs/live_backing.log` + "`" + `), which\nmay be used to protect against tasks that produce excessive output.\n\nSince: generic-worker 28.3.0",
+      "properties": {
+        "failOnTruncation": {
+          "default": false,
+          "description": "If true, the task will be resolved as ` + "`" + `failed` + "`" + ` if the task log\nexceeds its maximum size.\n\nSince: generic-worker 28.3.0",
+          "title": "Fail the task if the task log is truncated",
+          "type": "boolean"
+        },
+        "keepTail": {
+          "default": false,
+          "description": "If true, and the task log exceeds its maximum size, the first half\nof the log and the most recent output (the last half) are kept,\nrather than the start of the log only.\n\nSince: generic-worker 28.3.0",
+          "title": "Keep the tail of truncated task logs",
+          "type": "boolean"
+        },
+        "maxSizeMegabytes": {
+          "description": "The maximum size of the task log, in megabytes. This can only lower\nthe limit configured on the worker (config property\n` + "`" + `maxTaskLogSizeMegabytes` + "`" + `), it cannot raise it. Once the limit is\nreached, a truncation notice is written to the log and further\noutput is discarded (see ` + "`" + `keepTail` + "`" + `).\n\nSince: generic-worker 28.3.0",
+          "minimum": 1,
+          "title": "Maximum task log size in megabytes",
+          "type": "integer"
+        }
+      },
+      "required": [],
+      "title": "Task log limits",
+      "type": "object"
+    },
     "maxRunTime": {
       "description": "Maximum time the task container can run in seconds.\n\nSince: generic-worker 0.0.1",
       "maximum": 86400,
@@ -803,6 +1081,59 @@ func taskPayloadSchema() string {
       "format": "uri",
       "title": "Superseder URL",
       "type": "string"
+    },
+    "testResults": {
+      "additionalProperties": false,
+      "description": "Test result files that the task commands write. Once the task commands\nhave completed, the files are parsed, a summary of passed, failed and\nskipped tests (with the first failures) is written to the task log, and\nthe results are published in a normalized form as artifact\n` + "`" + `public/test-results.json` + "`" + `.\n\nSince: generic-worker 28.3.0",
+      "properties": {
+        "failTaskOnFailures": {
+          "default": false,
+          "description": "If true, the task fails if any test failed, even if the task\ncommands succeeded.\n\nSince: generic-worker 28.3.0",
+          "title": "Fail task on test failures",
+          "type": "boolean"
+        },
+        "files": {
+          "description": "The test result files to parse. If there are none, no test results\nare published.\n\nSince: generic-worker 28.3.0",
+          "items": {
+            "additionalProperties": false,
+            "properties": {
+              "format": {
+                "description": "The format of the test result file(s): ` + "`" + `junit` + "`" + ` for JUnit XML,\n` + "`" + `tap` + "`" + ` for the Test Anything Protocol, or ` + "`" + `go-test-json` + "`" + ` for the\noutput of ` + "`" + `go test -json` + "`" + `.\n\nSince: generic-worker 28.3.0",
+                "enum": [
+                  "junit",
+                  "tap",
+                  "go-test-json"
+                ],
+                "title": "Test result file format",
+                "type": "string"
+              },
+              "path": {
+                "description": "Path of the test result file(s), relative to the task\ndirectory. May be a glob pattern, e.g. ` + "`" + `reports/*.xml` + "`" + `, in\nwhich case all matching files are parsed.\n\nSince: generic-worker 28.3.0",
+                "title": "Test result file path",
+                "type": "string"
+              }
+            },
+            "required": [
+              "path",
+              "format"
+            ],
+            "title": "Test result files",
+            "type": "object"
+          },
+          "title": "Test result files",
+          "type": "array"
+        },
+        "maxFailuresInLog": {
+          "default": 10,
+          "description": "The maximum number of failed tests that are listed in the task log.\nAll failed tests are listed in ` + "`" + `public/test-results.json` + "`" + `.\n\nSince: generic-worker 28.3.0",
+          "maximum": 1000,
+          "minimum": 1,
+          "title": "Maximum number of failures in task log",
+          "type": "integer"
+        }
+      },
+      "title": "Test results",
+      "type": "object"
     }
   },
   "required": [
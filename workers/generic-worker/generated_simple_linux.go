@@ -111,6 +111,49 @@ type (
 		TaskID string `json:"taskId"`
 	}
 
+	// Limits applied to the artifacts of payload property `artifacts`, which
+	// may be used to protect against tasks that publish far more artifacts,
+	// or far larger artifacts, than intended, for example because a
+	// directory artifact includes more files than expected. These can only
+	// lower the limits configured on the worker (config properties
+	// `maxArtifacts`, `maxArtifactSizeMegabytes` and
+	// `maxTotalArtifactsSizeMegabytes`), they cannot raise them. Limits are
+	// checked before any artifacts are uploaded; if any limit is exceeded,
+	// no artifacts of payload property `artifacts` are uploaded, and the
+	// task fails.
+	// Artifacts that task commands have already uploaded with feature
+	// `liveArtifacts` count towards the number of artifacts and the total
+	// size, and live artifact uploads that would exceed a limit are
+	// rejected.
+	//
+	// Since: generic-worker 28.3.0
+	ArtifactLimits struct {
+
+		// The maximum size of any one artifact, in megabytes, before any
+		// content encoding is applied.
+		//
+		// Since: generic-worker 28.3.0
+		//
+		// Mininum:    1
+		MaxArtifactSizeMegabytes int64 `json:"maxArtifactSizeMegabytes,omitempty"`
+
+		// The maximum number of artifacts, counting each file of a directory
+		// artifact as an artifact.
+		//
+		// Since: generic-worker 28.3.0
+		//
+		// Mininum:    1
+		MaxArtifacts int64 `json:"maxArtifacts,omitempty"`
+
+		// The maximum total size of all artifacts, in megabytes, before any
+		// content encoding is applied.
+		//
+		// Since: generic-worker 28.3.0
+		//
+		// Mininum:    1
+		MaxTotalSizeMegabytes int64 `json:"maxTotalSizeMegabytes,omitempty"`
+	}
+
 	// Base64 encoded content of file/archive, up to 64KB (encoded) in size.
 	//
 	// Since: generic-worker 11.1.0
@@ -150,6 +193,61 @@ type (
 	// Since: generic-worker 5.3.0
 	FeatureFlags struct {
 
+		// Runs a local HTTP endpoint, whose URL is given to the task commands
+		// in env var `TASKCLUSTER_ARTIFACT_UPLOAD_URL`, that uploads files of
+		// the task directory as artifacts immediately, rather than after the
+		// task commands have completed. Requests must have header
+		// `Authorization: Bearer <token>`, where `<token>` is the value of env
+		// var `TASKCLUSTER_ARTIFACT_UPLOAD_TOKEN`. A request is a `POST` with
+		// a json body such as
+		// `{"path": "results/summary.txt", "name": "public/summary.txt"}`,
+		// and optionally `contentType`, `contentEncoding` and `expires`,
+		// with the same meaning as in payload property `artifacts`. Artifact
+		// names reserved by the worker, or used by payload property
+		// `artifacts`, may not be uploaded, and uploads count towards the
+		// artifact limits of the task (see payload property
+		// `artifactLimits`).
+		//
+		// Since: generic-worker 28.3.0
+		LiveArtifacts bool `json:"liveArtifacts,omitempty"`
+
+		// Run the task commands in their own network namespace, with egress
+		// restricted to the hosts and networks in payload property
+		// `egressAllowlist` and worker config setting
+		// `networkIsolationEgressAllowlist`. The cloud instance metadata
+		// endpoint (`169.254.169.254`) is always blocked. The taskcluster
+		// proxy and DNS remain reachable on the loopback interface. Only
+		// supported on Linux workers with config setting `networkIsolation`
+		// set to `optional` or `always`; if it is `always`, task commands
+		// are isolated regardless of this feature flag.
+		//
+		// Since: generic-worker 28.3.0
+		NetworkIsolation bool `json:"networkIsolation,omitempty"`
+
+		// Scan the files of public artifacts (artifacts whose names start
+		// with `public/`) for secrets, such as private keys and taskcluster
+		// access tokens, before they are uploaded. Depending on worker config
+		// setting `secretScanningAction`, an artifact that appears to contain
+		// a secret is either replaced by an error artifact, which fails the
+		// task, or uploaded with prefix `public/` of its name replaced by
+		// `private/`. Workers with config setting `secretScanning` set to
+		// `always` scan public artifacts regardless of this feature flag, and
+		// workers with it set to `disabled` do not run tasks that enable it.
+		//
+		// Since: generic-worker 28.3.0
+		SecretScanning bool `json:"secretScanning,omitempty"`
+
+		// Runs a read-only local HTTP endpoint, whose URL is given to the task
+		// commands in env var `TASKCLUSTER_TASK_METADATA_URL`, that returns
+		// json metadata about the running task: the task definition (`/task`),
+		// the status of the task run, such as its `runId`, `takenUntil`, task
+		// deadline and the time remaining before `maxRunTime` is exceeded
+		// (`/run`), and the identity and location of the worker (`/worker`).
+		// A `GET` request to `/` returns all of them.
+		//
+		// Since: generic-worker 28.3.0
+		TaskMetadata bool `json:"taskMetadata,omitempty"`
+
 		// The taskcluster proxy provides an easy and safe way to make authenticated
 		// taskcluster requests within the scope(s) of a particular task. See
 		// [the github project](https://github.com/taskcluster/taskcluster-proxy) for more information.
@@ -177,6 +275,24 @@ type (
 	// Taskcluster Task definition.
 	GenericWorkerPayload struct {
 
+		// Limits applied to the artifacts of payload property `artifacts`, which
+		// may be used to protect against tasks that publish far more artifacts,
+		// or far larger artifacts, than intended, for example because a
+		// directory artifact includes more files than expected. These can only
+		// lower the limits configured on the worker (config properties
+		// `maxArtifacts`, `maxArtifactSizeMegabytes` and
+		// `maxTotalArtifactsSizeMegabytes`), they cannot raise them. Limits are
+		// checked before any artifacts are uploaded; if any limit is exceeded,
+		// no artifacts of payload property `artifacts` are uploaded, and the
+		// task fails.
+		// Artifacts that task commands have already uploaded with feature
+		// `liveArtifacts` count towards the number of artifacts and the total
+		// size, and live artifact uploads that would exceed a limit are
+		// rejected.
+		//
+		// Since: generic-worker 28.3.0
+		ArtifactLimits ArtifactLimits `json:"artifactLimits,omitempty"`
+
 		// Artifacts to be published.
 		//
 		// Since: generic-worker 1.0.0
@@ -185,11 +301,28 @@ type (
 		// One array per command (each command is an array of arguments). Several arrays
 		// for several commands.
 		//
+		// Exactly one of `command` and `steps` must be given.
+		//
 		// Since: generic-worker 0.0.1
 		//
 		// Array items:
 		// Array items:
-		Command [][]string `json:"command"`
+		Command [][]string `json:"command,omitempty"`
+
+		// When the task commands run in an isolated network namespace (see
+		// feature `networkIsolation`), the IPv4 networks (in CIDR notation, e.g.
+		// `10.0.0.0/8`) and hosts (e.g. `github.com`) that task commands may
+		// connect to, in addition to those allowed by worker config setting
+		// `networkIsolationEgressAllowlist`. Hosts are resolved when the task
+		// starts. Each entry requires scope
+		// `generic-worker:network-egress:<provisionerId>/<workerType>/<entry>`.
+		// The cloud instance metadata endpoint (`169.254.169.254`) is always
+		// blocked, even if allowed here.
+		//
+		// Since: generic-worker 28.3.0
+		//
+		// Array items:
+		EgressAllowlist []string `json:"egressAllowlist,omitempty"`
 
 		// Env vars must be string to __string__ mappings (not number or boolean). For example:
 		// ```
@@ -224,6 +357,27 @@ type (
 		// Since: generic-worker 5.3.0
 		Features FeatureFlags `json:"features,omitempty"`
 
+		// When the task is aborted, for example because `maxRunTime` has been
+		// exceeded or the task has been cancelled, the process tree of the
+		// running command is first sent `SIGTERM`, and only killed with
+		// `SIGKILL` if it is still running after this many seconds. This gives
+		// tools a chance to flush state and print diagnostics. Artifacts are
+		// uploaded once the command has exited. If 0, the command is killed
+		// immediately.
+		//
+		// Since: generic-worker 28.3.0
+		//
+		// Default:    0
+		// Mininum:    0
+		// Maximum:    300
+		GracePeriod int64 `json:"gracePeriod,omitempty"`
+
+		// Limits applied to the task log (`public/logs/live_backing.log`), which
+		// may be used to protect against tasks that produce excessive output.
+		//
+		// Since: generic-worker 28.3.0
+		Logs TaskLogLimits `json:"logs,omitempty"`
+
 		// Maximum time the task container can run in seconds.
 		//
 		// Since: generic-worker 0.0.1
@@ -258,6 +412,27 @@ type (
 		// Array items:
 		OSGroups []string `json:"osGroups,omitempty"`
 
+		// Background commands, such as databases or mock servers, that are started
+		// in order before the task commands, and are terminated once the task
+		// commands have completed. Services run as the same user, in the same task
+		// directory, and with the same environment as the task commands. If a
+		// service has a readiness probe, the next service (or the task commands)
+		// is only started once the probe succeeds. The task fails if a service
+		// exits before the task commands have completed. The output of each
+		// service is published as artifact `public/logs/services/<name>.log`.
+		//
+		// Since: generic-worker 28.3.0
+		Services []SidecarService `json:"services,omitempty"`
+
+		// An alternative to `command`, in which each command is a step with an
+		// optional name, timeout, environment variables and `continueOnError`
+		// flag. Exactly one of `command` and `steps` must be given. Steps run in
+		// order, like commands. A summary of the steps, with the result, exit code
+		// and duration of each, is published as artifact `public/steps.json`.
+		//
+		// Since: generic-worker 28.3.0
+		Steps []Step `json:"steps,omitempty"`
+
 		// URL of a service that can indicate tasks superseding this one; the current `taskId`
 		// will be appended as a query argument `taskId`. The service should return an object with
 		// a `supersedes` key containing a list of `taskId`s, including the supplied `taskId`. The
@@ -268,6 +443,15 @@ type (
 		//
 		// Since: generic-worker 10.2.2
 		SupersederURL string `json:"supersederUrl,omitempty"`
+
+		// Test result files that the task commands write. Once the task commands
+		// have completed, the files are parsed, a summary of passed, failed and
+		// skipped tests (with the first failures) is written to the task log, and
+		// the results are published in a normalized form as artifact
+		// `public/test-results.json`.
+		//
+		// Since: generic-worker 28.3.0
+		TestResults TestResults `json:"testResults,omitempty"`
 	}
 
 	// Byte-for-byte literal inline content of file/archive, up to 64KB in size.
@@ -309,6 +493,205 @@ type (
 		Format string `json:"format"`
 	}
 
+	// How to tell that the service is ready. Exactly one of `tcpPort` and
+	// `url` must be given.
+	//
+	// Since: generic-worker 28.3.0
+	ReadinessProbe struct {
+
+		// The service is ready once a TCP connection to this port on
+		// `127.0.0.1` succeeds.
+		//
+		// Since: generic-worker 28.3.0
+		//
+		// Mininum:    1
+		// Maximum:    65535
+		TCPPort int64 `json:"tcpPort,omitempty"`
+
+		// Maximum time, in seconds, to wait for the service to be ready.
+		//
+		// Since: generic-worker 28.3.0
+		//
+		// Default:    60
+		// Mininum:    1
+		// Maximum:    3600
+		Timeout int64 `json:"timeout,omitempty"`
+
+		// The service is ready once an HTTP GET request to this URL
+		// returns a `2xx` status code, e.g. `http://127.0.0.1:8080/health`.
+		//
+		// Since: generic-worker 28.3.0
+		URL string `json:"url,omitempty"`
+	}
+
+	SidecarService struct {
+
+		// The command line of the service, as a list of arguments, e.g.
+		// `["redis-server", "--port", "6379"]`.
+		//
+		// Since: generic-worker 28.3.0
+		//
+		// Array items:
+		Command []string `json:"command"`
+
+		// Environment variables of the service, in addition to those of the
+		// task commands.
+		//
+		// Since: generic-worker 28.3.0
+		//
+		// Map entries:
+		Env map[string]string `json:"env,omitempty"`
+
+		// Name of the service, which must be unique within the task. It is
+		// used in the task log, and in the name of the artifact that the
+		// output of the service is published as.
+		//
+		// Since: generic-worker 28.3.0
+		//
+		// Syntax:     ^[a-zA-Z0-9_.-]{1,64}$
+		Name string `json:"name"`
+
+		// How to tell that the service is ready. Exactly one of `tcpPort` and
+		// `url` must be given.
+		//
+		// Since: generic-worker 28.3.0
+		ReadinessProbe ReadinessProbe `json:"readinessProbe,omitempty"`
+	}
+
+	Step struct {
+
+		// The command of the step, as an array of arguments.
+		//
+		// Since: generic-worker 28.3.0
+		//
+		// Array items:
+		Command []string `json:"command"`
+
+		// If true, a failure of the step (a non-zero exit code, or exceeding
+		// its timeout) is recorded in the step summary, but does not fail
+		// the task, and the next step runs.
+		//
+		// Since: generic-worker 28.3.0
+		//
+		// Default:    false
+		ContinueOnError bool `json:"continueOnError,omitempty"`
+
+		// Environment variables of the step, which override those in `env`.
+		//
+		// Since: generic-worker 28.3.0
+		//
+		// Map entries:
+		Env map[string]string `json:"env,omitempty"`
+
+		// Name of the step, shown in the task log and the step summary.
+		//
+		// Since: generic-worker 28.3.0
+		//
+		// Max length: 255
+		Name string `json:"name,omitempty"`
+
+		// Maximum time, in seconds, that the step may run for, after which
+		// it is terminated and fails. The step is also limited by
+		// `maxRunTime`, which applies to the task as a whole.
+		//
+		// Since: generic-worker 28.3.0
+		//
+		// Mininum:    1
+		// Maximum:    86400
+		Timeout int64 `json:"timeout,omitempty"`
+	}
+
+	// Limits applied to the task log (`public/logs/live_backing.log`), which
+	// may be used to protect against tasks that produce excessive output.
+	//
+	// Since: generic-worker 28.3.0
+	TaskLogLimits struct {
+
+		// If true, the task will be resolved as `failed` if the task log
+		// exceeds its maximum size.
+		//
+		// Since: generic-worker 28.3.0
+		//
+		// Default:    false
+		FailOnTruncation bool `json:"failOnTruncation,omitempty"`
+
+		// If true, and the task log exceeds its maximum size, the first half
+		// of the log and the most recent output (the last half) are kept,
+		// rather than the start of the log only.
+		//
+		// Since: generic-worker 28.3.0
+		//
+		// Default:    false
+		KeepTail bool `json:"keepTail,omitempty"`
+
+		// The maximum size of the task log, in megabytes. This can only lower
+		// the limit configured on the worker (config property
+		// `maxTaskLogSizeMegabytes`), it cannot raise it. Once the limit is
+		// reached, a truncation notice is written to the log and further
+		// output is discarded (see `keepTail`).
+		//
+		// Since: generic-worker 28.3.0
+		//
+		// Mininum:    1
+		MaxSizeMegabytes int64 `json:"maxSizeMegabytes,omitempty"`
+	}
+
+	TestResultFiles struct {
+
+		// The format of the test result file(s): `junit` for JUnit XML,
+		// `tap` for the Test Anything Protocol, or `go-test-json` for the
+		// output of `go test -json`.
+		//
+		// Since: generic-worker 28.3.0
+		//
+		// Possible values:
+		//   * "junit"
+		//   * "tap"
+		//   * "go-test-json"
+		Format string `json:"format"`
+
+		// Path of the test result file(s), relative to the task
+		// directory. May be a glob pattern, e.g. `reports/*.xml`, in
+		// which case all matching files are parsed.
+		//
+		// Since: generic-worker 28.3.0
+		Path string `json:"path"`
+	}
+
+	// Test result files that the task commands write. Once the task commands
+	// have completed, the files are parsed, a summary of passed, failed and
+	// skipped tests (with the first failures) is written to the task log, and
+	// the results are published in a normalized form as artifact
+	// `public/test-results.json`.
+	//
+	// Since: generic-worker 28.3.0
+	TestResults struct {
+
+		// If true, the task fails if any test failed, even if the task
+		// commands succeeded.
+		//
+		// Since: generic-worker 28.3.0
+		//
+		// Default:    false
+		FailTaskOnFailures bool `json:"failTaskOnFailures,omitempty"`
+
+		// The test result files to parse. If there are none, no test results
+		// are published.
+		//
+		// Since: generic-worker 28.3.0
+		Files []TestResultFiles `json:"files,omitempty"`
+
+		// The maximum number of failed tests that are listed in the task log.
+		// All failed tests are listed in `public/test-results.json`.
+		//
+		// Since: generic-worker 28.3.0
+		//
+		// Default:    10
+		// Mininum:    1
+		// Maximum:    1000
+		MaxFailuresInLog int64 `json:"maxFailuresInLog,omitempty"`
+	}
+
 	// URL to download content from.
 	//
 	// Since: generic-worker 5.4.0
@@ -583,6 +966,33 @@ func taskPayloadSchema() string {
   },
   "description": "This schema defines the structure of the ` + "`" + `payload` + "`" + ` property referred to in a\nTaskcluster Task definition.",
   "properties": {
+    "artifactLimits": {
+      "additionalProperties": false,
+      "description": "Limits applied to the artifacts of payload property ` + "`" + `artifacts` + "`" + `, which\nmay be used to protect against tasks that publish far more artifacts,\nor far larger artifacts, than intended, for example because a\ndirectory artifact includes more files than expected. These can only\nlower the limits configured on the worker (config properties\n` + "`" + `maxArtifacts` + "`" + `, ` + "`" + `maxArtifactSizeMegabytes` + "`" + ` and\n` + "`" + `maxTotalArtifactsSizeMegabytes` + "`" + `), they cannot raise them. Limits are\nchecked before any artifacts are uploaded; if any limit is exceeded,\nno artifacts of payload property ` + "`" + `artifacts` + "`" + ` are uploaded, and the\ntask fails.\nArtifacts that task commands have already uploaded with feature\n` + "`" + `liveArtifacts` + "`" + ` count towards the number of artifacts and the total\nsize, and live artifact uploads that would exceed a limit are\nrejected.\n\nSince: generic-worker 28.3.0",
+      "properties": {
+        "maxArtifactSizeMegabytes": {
+          "description": "The maximum size of any one artifact, in megabytes, before any\ncontent encoding is applied.\n\nSince: generic-worker 28.3.0",
+          "minimum": 1,
+          "title": "Maximum artifact size in megabytes",
+          "type": "integer"
+        },
+        "maxArtifacts": {
+          "description": "The maximum number of artifacts, counting each file of a directory\nartifact as an artifact.\n\nSince: generic-worker 28.3.0",
+          "minimum": 1,
+          "title": "Maximum number of artifacts",
+          "type": "integer"
+        },
+        "maxTotalSizeMegabytes": {
+          "description": "The maximum total size of all artifacts, in megabytes, before any\ncontent encoding is applied.\n\nSince: generic-worker 28.3.0",
+          "minimum": 1,
+          "title": "Maximum total artifact size in megabytes",
+          "type": "integer"
+        }
+      },
+      "required": [],
+      "title": "Artifact limits",
+      "type": "object"
+    },
     "artifacts": {
       "description": "Artifacts to be published.\n\nSince: generic-worker 1.0.0",
       "items": {
@@ -640,7 +1050,7 @@ func taskPayloadSchema() string {
       "uniqueItems": true
     },
     "command": {
-      "description": "One array per command (each command is an array of arguments). Several arrays\nfor several commands.\n\nSince: generic-worker 0.0.1",
+      "description": "One array per command (each command is an array of arguments). Several arrays\nfor several commands.\n\nExactly one of ` + "`" + `command` + "`" + ` and ` + "`" + `steps` + "`" + ` must be given.\n\nSince: generic-worker 0.0.1",
       "items": {
         "items": {
           "type": "string"
@@ -654,6 +1064,15 @@ func taskPayloadSchema() string {
       "type": "array",
       "uniqueItems": false
     },
+    "egressAllowlist": {
+      "description": "When the task commands run in an isolated network namespace (see\nfeature ` + "`" + `networkIsolation` + "`" + `), the IPv4 networks (in CIDR notation, e.g.\n` + "`" + `10.0.0.0/8` + "`" + `) and hosts (e.g. ` + "`" + `github.com` + "`" + `) that task commands may\nconnect to, in addition to those allowed by worker config setting\n` + "`" + `networkIsolationEgressAllowlist` + "`" + `. Hosts are resolved when the task\nstarts. Each entry requires scope\n` + "`" + `generic-worker:network-egress:\u003cprovisionerId\u003e/\u003cworkerType\u003e/\u003centry\u003e` + "`" + `.\nThe cloud instance metadata endpoint (` + "`" + `169.254.169.254` + "`" + `) is always\nblocked, even if allowed here.\n\nSince: generic-worker 28.3.0",
+      "items": {
+        "type": "string"
+      },
+      "title": "Egress allowlist",
+      "type": "array",
+      "uniqueItems": true
+    },
     "env": {
       "additionalProperties": {
         "type": "string"
@@ -666,6 +1085,26 @@ func taskPayloadSchema() string {
       "additionalProperties": false,
       "description": "Feature flags enable additional functionality.\n\nSince: generic-worker 5.3.0",
       "properties": {
+        "liveArtifacts": {
+          "description": "Runs a local HTTP endpoint, whose URL is given to the task commands\nin env var ` + "`" + `TASKCLUSTER_ARTIFACT_UPLOAD_URL` + "`" + `, that uploads files of\nthe task directory as artifacts immediately, rather than after the\ntask commands have completed. Requests must have header\n` + "`" + `Authorization: Bearer \u003ctoken\u003e` + "`" + `, where ` + "`" + `\u003ctoken\u003e` + "`" + ` is the value of env\nvar ` + "`" + `TASKCLUSTER_ARTIFACT_UPLOAD_TOKEN` + "`" + `. A request is a ` + "`" + `POST` + "`" + ` with\na json body such as\n` + "`" + `{\"path\": \"results/summary.txt\", \"name\": \"public/summary.txt\"}` + "`" + `,\nand optionally ` + "`" + `contentType` + "`" + `, ` + "`" + `contentEncoding` + "`" + ` and ` + "`" + `expires` + "`" + `,\nwith the same meaning as in payload property ` + "`" + `artifacts` + "`" + `. Artifact\nnames reserved by the worker, or used by payload property\n` + "`" + `artifacts` + "`" + `, may not be uploaded, and uploads count towards the\nartifact limits of the task (see payload property\n` + "`" + `artifactLimits` + "`" + `).\n\nSince: generic-worker 28.3.0",
+          "title": "Allow task commands to upload artifacts while the task is running",
+          "type": "boolean"
+        },
+        "networkIsolation": {
+          "description": "Run the task commands in their own network namespace, with egress\nrestricted to the hosts and networks in payload property\n` + "`" + `egressAllowlist` + "`" + ` and worker config setting\n` + "`" + `networkIsolationEgressAllowlist` + "`" + `. The cloud instance metadata\nendpoint (` + "`" + `169.254.169.254` + "`" + `) is always blocked. The taskcluster\nproxy and DNS remain reachable on the loopback interface. Only\nsupported on Linux workers with config setting ` + "`" + `networkIsolation` + "`" + `\nset to ` + "`" + `optional` + "`" + ` or ` + "`" + `always` + "`" + `; if it is ` + "`" + `always` + "`" + `, task commands\nare isolated regardless of this feature flag.\n\nSince: generic-worker 28.3.0",
+          "title": "Run task commands in an isolated network namespace",
+          "type": "boolean"
+        },
+        "secretScanning": {
+          "description": "Scan the files of public artifacts (artifacts whose names start\nwith ` + "`" + `public/` + "`" + `) for secrets, such as private keys and taskcluster\naccess tokens, before they are uploaded. Depending on worker config\nsetting ` + "`" + `secretScanningAction` + "`" + `, an artifact that appears to contain\na secret is either replaced by an error artifact, which fails the\ntask, or uploaded with prefix ` + "`" + `public/` + "`" + ` of its name replaced by\n` + "`" + `private/` + "`" + `. Workers with config setting ` + "`" + `secretScanning` + "`" + ` set to\n` + "`" + `always` + "`" + ` scan public artifacts regardless of this feature flag, and\nworkers with it set to ` + "`" + `disabled` + "`" + ` do not run tasks that enable it.\n\nSince: generic-worker 28.3.0",
+          "title": "Scan public artifacts for secrets before uploading them",
+          "type": "boolean"
+        },
+        "taskMetadata": {
+          "description": "Runs a read-only local HTTP endpoint, whose URL is given to the task\ncommands in env var ` + "`" + `TASKCLUSTER_TASK_METADATA_URL` + "`" + `, that returns\njson metadata about the running task: the task definition (` + "`" + `/task` + "`" + `),\nthe status of the task run, such as its ` + "`" + `runId` + "`" + `, ` + "`" + `takenUntil` + "`" + `, task\ndeadline and the time remaining before ` + "`" + `maxRunTime` + "`" + ` is exceeded\n(` + "`" + `/run` + "`" + `), and the identity and location of the worker (` + "`" + `/worker` + "`" + `).\nA ` + "`" + `GET` + "`" + ` request to ` + "`" + `/` + "`" + ` returns all of them.\n\nSince: generic-worker 28.3.0",
+          "title": "Serve task metadata to task commands",
+          "type": "boolean"
+        },
         "taskclusterProxy": {
           "description": "The taskcluster proxy provides an easy and safe way to make authenticated\ntaskcluster requests within the scope(s) of a particular task. See\n[the github project](https://github.com/taskcluster/taskcluster-proxy) for more information.\n\nSince: generic-worker 10.6.0",
           "title": "Run [taskcluster-proxy](https://github.com/taskcluster/taskcluster-proxy) to allow tasks to dynamically proxy requests to taskcluster services",
@@ -676,6 +1115,42 @@ func taskPayloadSchema() string {
       "title": "Feature flags",
       "type": "object"
     },
+    "gracePeriod": {
+      "default": 0,
+      "description": "When the task is aborted, for example because ` + "`" + `maxRunTime` + "`" + ` has been\nexceeded or the task has been cancelled, the process tree of the\nrunning command is first sent ` + "`" + `SIGTERM` + "`" + `, and only killed with\n` + "`" + `SIGKILL` + "`" + ` if it is still running after this many seconds. This gives\ntools a chance to flush state and print diagnostics. Artifacts are\nuploaded once the command has exited. If 0, the command is killed\nimmediately.\n\nSince: generic-worker 28.3.0",
+      "maximum": 300,
+      "minimum": 0,
+      "multipleOf": 1,
+      "title": "Grace period in seconds",
+      "type": "integer"
+    },
+    "logs": {
+      "additionalProperties": false,
+      "description": "Limits applied to the task log (` + "`" + `public/logs/live_backing.log` + "`" + `), which\nmay be used to protect against tasks that produce excessive output.\n\nSince: generic-worker 28.3.0",
+      "properties": {
+        "failOnTruncation": {
+          "default": false,
+          "description": "If true, the task will be resolved as ` + "`" + `failed` + "`" + ` if the task log\nexceeds its maximum size.\n\nSince: generic-worker 28.3.0",
+          "title": "Fail the task if the task log is truncated",
+          "type": "boolean"
+        },
+        "keepTail": {
+          "default": false,
+          "description": "If true, and the task log exceeds its maximum size, the first half\nof the log and the most recent output (the last half) are kept,\nrather than the start of the log only.\n\nSince: generic-worker 28.3.0",
+          "title": "Keep the tail of truncated task logs",
+          "type": "boolean"
+        },
+        "maxSizeMegabytes": {
+          "description": "The maximum size of the task log, in megabytes. This can only lower\nthe limit configured on the worker (config property\n` + "`" + `maxTaskLogSizeMegabytes` + "`" + `), it cannot raise it. Once the limit is\nreached, a truncation notice is written to the log and further\noutput is discarded (see ` + "`" + `keepTail` + "`" + `).\n\nSince: generic-worker 28.3.0",
+          "minimum": 1,
+          "title": "Maximum task log size in megabytes",
+          "type": "integer"
+        }
+      },
+      "required": [],
+      "title": "Task log limits",
+      "type": "object"
+    },
     "maxRunTime": {
       "description": "Maximum time the task container can run in seconds.\n\nSince: generic-worker 0.0.1",
       "maximum": 86400,
@@ -723,15 +1198,188 @@ func taskPayloadSchema() string {
       "type": "array",
       "uniqueItems": false
     },
+    "services": {
+      "description": "Background commands, such as databases or mock servers, that are started\nin order before the task commands, and are terminated once the task\ncommands have completed. Services run as the same user, in the same task\ndirectory, and with the same environment as the task commands. If a\nservice has a readiness probe, the next service (or the task commands)\nis only started once the probe succeeds. The task fails if a service\nexits before the task commands have completed. The output of each\nservice is published as artifact ` + "`" + `public/logs/services/\u003cname\u003e.log` + "`" + `.\n\nSince: generic-worker 28.3.0",
+      "items": {
+        "additionalProperties": false,
+        "properties": {
+          "command": {
+            "description": "The command line of the service, as a list of arguments, e.g.\n` + "`" + `[\"redis-server\", \"--port\", \"6379\"]` + "`" + `.\n\nSince: generic-worker 28.3.0",
+            "items": {
+              "type": "string"
+            },
+            "minItems": 1,
+            "title": "Service command",
+            "type": "array"
+          },
+          "env": {
+            "additionalProperties": {
+              "type": "string"
+            },
+            "description": "Environment variables of the service, in addition to those of the\ntask commands.\n\nSince: generic-worker 28.3.0",
+            "title": "Service environment variables",
+            "type": "object"
+          },
+          "name": {
+            "description": "Name of the service, which must be unique within the task. It is\nused in the task log, and in the name of the artifact that the\noutput of the service is published as.\n\nSince: generic-worker 28.3.0",
+            "pattern": "^[a-zA-Z0-9_.-]{1,64}$",
+            "title": "Service name",
+            "type": "string"
+          },
+          "readinessProbe": {
+            "additionalProperties": false,
+            "description": "How to tell that the service is ready. Exactly one of ` + "`" + `tcpPort` + "`" + ` and\n` + "`" + `url` + "`" + ` must be given.\n\nSince: generic-worker 28.3.0",
+            "properties": {
+              "tcpPort": {
+                "description": "The service is ready once a TCP connection to this port on\n` + "`" + `127.0.0.1` + "`" + ` succeeds.\n\nSince: generic-worker 28.3.0",
+                "maximum": 65535,
+                "minimum": 1,
+                "title": "TCP port",
+                "type": "integer"
+              },
+              "timeout": {
+                "default": 60,
+                "description": "Maximum time, in seconds, to wait for the service to be ready.\n\nSince: generic-worker 28.3.0",
+                "maximum": 3600,
+                "minimum": 1,
+                "title": "Readiness timeout",
+                "type": "integer"
+              },
+              "url": {
+                "description": "The service is ready once an HTTP GET request to this URL\nreturns a ` + "`" + `2xx` + "`" + ` status code, e.g. ` + "`" + `http://127.0.0.1:8080/health` + "`" + `.\n\nSince: generic-worker 28.3.0",
+                "format": "uri",
+                "title": "HTTP URL",
+                "type": "string"
+              }
+            },
+            "title": "Readiness probe",
+            "type": "object"
+          }
+        },
+        "required": [
+          "name",
+          "command"
+        ],
+        "title": "Sidecar service",
+        "type": "object"
+      },
+      "title": "Sidecar services",
+      "type": "array"
+    },
+    "steps": {
+      "description": "An alternative to ` + "`" + `command` + "`" + `, in which each command is a step with an\noptional name, timeout, environment variables and ` + "`" + `continueOnError` + "`" + `\nflag. Exactly one of ` + "`" + `command` + "`" + ` and ` + "`" + `steps` + "`" + ` must be given. Steps run in\norder, like commands. A summary of the steps, with the result, exit code\nand duration of each, is published as artifact ` + "`" + `public/steps.json` + "`" + `.\n\nSince: generic-worker 28.3.0",
+      "items": {
+        "additionalProperties": false,
+        "properties": {
+          "command": {
+            "description": "The command of the step, as an array of arguments.\n\nSince: generic-worker 28.3.0",
+            "items": {
+              "type": "string"
+            },
+            "minItems": 1,
+            "title": "Step command",
+            "type": "array"
+          },
+          "continueOnError": {
+            "default": false,
+            "description": "If true, a failure of the step (a non-zero exit code, or exceeding\nits timeout) is recorded in the step summary, but does not fail\nthe task, and the next step runs.\n\nSince: generic-worker 28.3.0",
+            "title": "Continue on error",
+            "type": "boolean"
+          },
+          "env": {
+            "additionalProperties": {
+              "type": "string"
+            },
+            "description": "Environment variables of the step, which override those in ` + "`" + `env` + "`" + `.\n\nSince: generic-worker 28.3.0",
+            "title": "Step environment variables",
+            "type": "object"
+          },
+          "name": {
+            "description": "Name of the step, shown in the task log and the step summary.\n\nSince: generic-worker 28.3.0",
+            "maxLength": 255,
+            "title": "Step name",
+            "type": "string"
+          },
+          "timeout": {
+            "description": "Maximum time, in seconds, that the step may run for, after which\nit is terminated and fails. The step is also limited by\n` + "`" + `maxRunTime` + "`" + `, which applies to the task as a whole.\n\nSince: generic-worker 28.3.0",
+            "maximum": 86400,
+            "minimum": 1,
+            "title": "Step timeout",
+            "type": "integer"
+          }
+        },
+        "required": [
+          "command"
+        ],
+        "title": "Step",
+        "type": "object"
+      },
+      "minItems": 1,
+      "title": "Named steps to run",
+      "type": "array",
+      "uniqueItems": false
+    },
     "supersederUrl": {
       "description": "URL of a service that can indicate tasks superseding this one; the current ` + "`" + `taskId` + "`" + `\nwill be appended as a query argument ` + "`" + `taskId` + "`" + `. The service should return an object with\na ` + "`" + `supersedes` + "`" + ` key containing a list of ` + "`" + `taskId` + "`" + `s, including the supplied ` + "`" + `taskId` + "`" + `. The\ntasks should be ordered such that each task supersedes all tasks appearing later in the\nlist.\n\nSee [superseding](https://docs.taskcluster.net/reference/platform/taskcluster-queue/docs/superseding) for more detail.\n\nSince: generic-worker 10.2.2",
       "format": "uri",
       "title": "Superseder URL",
       "type": "string"
+    },
+    "testResults": {
+      "additionalProperties": false,
+      "description": "Test result files that the task commands write. Once the task commands\nhave completed, the files are parsed, a summary of passed, failed and\nskipped tests (with the first failures) is written to the task log, and\nthe results are published in a normalized form as artifact\n` + "`" + `public/test-results.json` + "`" + `.\n\nSince: generic-worker 28.3.0",
+      "properties": {
+        "failTaskOnFailures": {
+          "default": false,
+          "description": "If true, the task fails if any test failed, even if the task\ncommands succeeded.\n\nSince: generic-worker 28.3.0",
+          "title": "Fail task on test failures",
+          "type": "boolean"
+        },
+        "files": {
+          "description": "The test result files to parse. If there are none, no test results\nare published.\n\nSince: generic-worker 28.3.0",
+          "items": {
+            "additionalProperties": false,
+            "properties": {
+              "format": {
+                "description": "The format of the test result file(s): ` + "`" + `junit` + "`" + ` for JUnit XML,\n` + "`" + `tap` + "`" + ` for the Test Anything Protocol, or ` + "`" + `go-test-json` + "`" + ` for the\noutput of ` + "`" + `go test -json` + "`" + `.\n\nSince: generic-worker 28.3.0",
+                "enum": [
+                  "junit",
+                  "tap",
+                  "go-test-json"
+                ],
+                "title": "Test result file format",
+                "type": "string"
+              },
+              "path": {
+                "description": "Path of the test result file(s), relative to the task\ndirectory. May be a glob pattern, e.g. ` + "`" + `reports/*.xml` + "`" + `, in\nwhich case all matching files are parsed.\n\nSince: generic-worker 28.3.0",
+                "title": "Test result file path",
+                "type": "string"
+              }
+            },
+            "required": [
+              "path",
+              "format"
+            ],
+            "title": "Test result files",
+            "type": "object"
+          },
+          "title": "Test result files",
+          "type": "array"
+        },
+        "maxFailuresInLog": {
+          "default": 10,
+          "description": "The maximum number of failed tests that are listed in the task log.\nAll failed tests are listed in ` + "`" + `public/test-results.json` + "`" + `.\n\nSince: generic-worker 28.3.0",
+          "maximum": 1000,
+          "minimum": 1,
+          "title": "Maximum number of failures in task log",
+          "type": "integer"
+        }
+      },
+      "title": "Test results",
+      "type": "object"
     }
   },
   "required": [
-    "command",
     "maxRunTime"
   ],
   "title": "Generic worker payload",
@@ -12,6 +12,7 @@ import (
 
 	tcclient "github.com/taskcluster/taskcluster/v28/clients/client-go"
 	"github.com/taskcluster/taskcluster/v28/clients/client-go/tcauth"
+	"github.com/taskcluster/taskcluster/v28/clients/client-go/tcindex"
 	"github.com/taskcluster/taskcluster/v28/clients/client-go/tcpurgecache"
 	"github.com/taskcluster/taskcluster/v28/clients/client-go/tcqueue"
 	"github.com/taskcluster/taskcluster/v28/clients/client-go/tcsecrets"
@@ -28,50 +29,84 @@ type (
 
 	PublicConfig struct {
 		PublicEngineConfig
-		AuthRootURL                    string                 `json:"authRootURL"`
-		AvailabilityZone               string                 `json:"availabilityZone"`
-		CachesDir                      string                 `json:"cachesDir"`
-		CheckForNewDeploymentEverySecs uint                   `json:"checkForNewDeploymentEverySecs"`
-		CleanUpTaskDirs                bool                   `json:"cleanUpTaskDirs"`
-		ClientID                       string                 `json:"clientId"`
-		DeploymentID                   string                 `json:"deploymentId"`
-		DisableReboots                 bool                   `json:"disableReboots"`
-		DownloadsDir                   string                 `json:"downloadsDir"`
-		Ed25519SigningKeyLocation      string                 `json:"ed25519SigningKeyLocation"`
-		IdleTimeoutSecs                uint                   `json:"idleTimeoutSecs"`
-		InstanceID                     string                 `json:"instanceId"`
-		InstanceType                   string                 `json:"instanceType"`
-		LiveLogCertificate             string                 `json:"livelogCertificate"`
-		LiveLogExecutable              string                 `json:"livelogExecutable"`
-		LiveLogGETPort                 uint16                 `json:"livelogGETPort"`
-		LiveLogKey                     string                 `json:"livelogKey"`
-		LiveLogPUTPort                 uint16                 `json:"livelogPUTPort"`
-		NumberOfTasksToRun             uint                   `json:"numberOfTasksToRun"`
-		PrivateIP                      net.IP                 `json:"privateIP"`
-		ProvisionerID                  string                 `json:"provisionerId"`
-		PublicIP                       net.IP                 `json:"publicIP"`
-		PurgeCacheRootURL              string                 `json:"purgeCacheRootURL"`
-		QueueRootURL                   string                 `json:"queueRootURL"`
-		Region                         string                 `json:"region"`
-		RequiredDiskSpaceMegabytes     uint                   `json:"requiredDiskSpaceMegabytes"`
-		RootURL                        string                 `json:"rootURL"`
-		RunAfterUserCreation           string                 `json:"runAfterUserCreation"`
-		SecretsRootURL                 string                 `json:"secretsRootURL"`
-		SentryProject                  string                 `json:"sentryProject"`
-		ShutdownMachineOnIdle          bool                   `json:"shutdownMachineOnIdle"`
-		ShutdownMachineOnInternalError bool                   `json:"shutdownMachineOnInternalError"`
-		Subdomain                      string                 `json:"subdomain"`
-		TaskclusterProxyExecutable     string                 `json:"taskclusterProxyExecutable"`
-		TaskclusterProxyPort           uint16                 `json:"taskclusterProxyPort"`
-		TasksDir                       string                 `json:"tasksDir"`
-		WorkerGroup                    string                 `json:"workerGroup"`
-		WorkerID                       string                 `json:"workerId"`
-		WorkerLocation                 string                 `json:"workerLocation"`
-		WorkerManagerRootURL           string                 `json:"workerManagerRootURL"`
-		WorkerType                     string                 `json:"workerType"`
-		WorkerTypeMetadata             map[string]interface{} `json:"workerTypeMetadata"`
-		WSTAudience                    string                 `json:"wstAudience"`
-		WSTServerURL                   string                 `json:"wstServerURL"`
+		AuthRootURL                       string                 `json:"authRootURL"`
+		AvailabilityZone                  string                 `json:"availabilityZone"`
+		CachesDir                         string                 `json:"cachesDir"`
+		CheckForNewDeploymentEverySecs    uint                   `json:"checkForNewDeploymentEverySecs"`
+		CleanUpTaskDirs                   bool                   `json:"cleanUpTaskDirs"`
+		ClientID                          string                 `json:"clientId"`
+		DeploymentID                      string                 `json:"deploymentId"`
+		DisableReboots                    bool                   `json:"disableReboots"`
+		DownloadsDir                      string                 `json:"downloadsDir"`
+		Ed25519SigningKeyLocation         string                 `json:"ed25519SigningKeyLocation"`
+		HealthCheckCommands               []string               `json:"healthCheckCommands"`
+		HealthCheckIntervalSecs           uint                   `json:"healthCheckIntervalSecs"`
+		HealthCheckMaxClockSkewSecs       uint                   `json:"healthCheckMaxClockSkewSecs"`
+		HealthCheckMaxFailureSecs         uint                   `json:"healthCheckMaxFailureSecs"`
+		HealthCheckMaxWorkerFailures      uint                   `json:"healthCheckMaxWorkerFailures"`
+		HealthCheckMinFreeDiskMegabytes   uint                   `json:"healthCheckMinFreeDiskMegabytes"`
+		HealthCheckMinFreeInodes          uint                   `json:"healthCheckMinFreeInodes"`
+		HealthCheckMinFreeMemoryMegabytes uint                   `json:"healthCheckMinFreeMemoryMegabytes"`
+		HealthCheckRequiredExecutables    []string               `json:"healthCheckRequiredExecutables"`
+		HealthCheckTimeoutSecs            uint                   `json:"healthCheckTimeoutSecs"`
+		HealthCheckWorkerFailuresSecs     uint                   `json:"healthCheckWorkerFailuresSecs"`
+		IdleTimeoutSecs                   uint                   `json:"idleTimeoutSecs"`
+		InstanceID                        string                 `json:"instanceId"`
+		InstanceType                      string                 `json:"instanceType"`
+		LiveArtifactsPort                 uint16                 `json:"liveArtifactsPort"`
+		LiveLogCertificate                string                 `json:"livelogCertificate"`
+		LiveLogExecutable                 string                 `json:"livelogExecutable"`
+		LiveLogGETPort                    uint16                 `json:"livelogGETPort"`
+		LiveLogKey                        string                 `json:"livelogKey"`
+		LiveLogPUTPort                    uint16                 `json:"livelogPUTPort"`
+		MaxArtifacts                      uint                   `json:"maxArtifacts"`
+		MaxArtifactSizeMegabytes          uint                   `json:"maxArtifactSizeMegabytes"`
+		MaxConcurrentMounts               uint                   `json:"maxConcurrentMounts"`
+		MaxTaskLogSizeMegabytes           uint                   `json:"maxTaskLogSizeMegabytes"`
+		MaxTotalArtifactsSizeMegabytes    uint                   `json:"maxTotalArtifactsSizeMegabytes"`
+		MountContentCacheRetryTimeoutSecs uint                   `json:"mountContentCacheRetryTimeoutSecs"`
+		MountContentCacheURL              string                 `json:"mountContentCacheURL"`
+		MountDownloadRetryTimeoutSecs     uint                   `json:"mountDownloadRetryTimeoutSecs"`
+		NetworkIsolation                  string                 `json:"networkIsolation"`
+		NetworkIsolationEgressAllowlist   []string               `json:"networkIsolationEgressAllowlist"`
+		NetworkIsolationSubnet            string                 `json:"networkIsolationSubnet"`
+		NumberOfTasksToRun                uint                   `json:"numberOfTasksToRun"`
+		PostTaskHook                      string                 `json:"postTaskHook"`
+		PreTaskHook                       string                 `json:"preTaskHook"`
+		PrewarmCaches                     []PrewarmCache         `json:"prewarmCaches"`
+		PrivateIP                         net.IP                 `json:"privateIP"`
+		ProvisionerID                     string                 `json:"provisionerId"`
+		PublicIP                          net.IP                 `json:"publicIP"`
+		PurgeCacheRootURL                 string                 `json:"purgeCacheRootURL"`
+		QuarantineAfterFailures           uint                   `json:"quarantineAfterFailures"`
+		QuarantineDurationSecs            uint                   `json:"quarantineDurationSecs"`
+		QueueRootURL                      string                 `json:"queueRootURL"`
+		Region                            string                 `json:"region"`
+		RequiredDiskSpaceMegabytes        uint                   `json:"requiredDiskSpaceMegabytes"`
+		RootURL                           string                 `json:"rootURL"`
+		RunAfterUserCreation              string                 `json:"runAfterUserCreation"`
+		SecretScanning                    string                 `json:"secretScanning"`
+		SecretScanningAction              string                 `json:"secretScanningAction"`
+		SecretScanningDetectors           []string               `json:"secretScanningDetectors"`
+		SecretScanningPatterns            []string               `json:"secretScanningPatterns"`
+		SecretsRootURL                    string                 `json:"secretsRootURL"`
+		SentryProject                     string                 `json:"sentryProject"`
+		ShutdownMachineOnIdle             bool                   `json:"shutdownMachineOnIdle"`
+		ShutdownMachineOnInternalError    bool                   `json:"shutdownMachineOnInternalError"`
+		Subdomain                         string                 `json:"subdomain"`
+		TaskclusterProxyExecutable        string                 `json:"taskclusterProxyExecutable"`
+		TaskclusterProxyPort              uint16                 `json:"taskclusterProxyPort"`
+		TaskHookTimeoutSecs               uint                   `json:"taskHookTimeoutSecs"`
+		TaskMetadataPort                  uint16                 `json:"taskMetadataPort"`
+		TasksDir                          string                 `json:"tasksDir"`
+		WorkerGroup                       string                 `json:"workerGroup"`
+		WorkerID                          string                 `json:"workerId"`
+		WorkerLocation                    string                 `json:"workerLocation"`
+		WorkerManagerRootURL              string                 `json:"workerManagerRootURL"`
+		WorkerType                        string                 `json:"workerType"`
+		WorkerTypeMetadata                map[string]interface{} `json:"workerTypeMetadata"`
+		WSTAudience                       string                 `json:"wstAudience"`
+		WSTServerURL                      string                 `json:"wstServerURL"`
 	}
 
 	PrivateConfig struct {
@@ -80,6 +115,16 @@ type (
 		LiveLogSecret string `json:"livelogSecret"`
 	}
 
+	// PrewarmCache is an entry of config setting prewarmCaches: content that
+	// is downloaded into the worker caches when the worker starts, and, if
+	// CacheName is set, extracted into the writable directory cache with that
+	// name.
+	PrewarmCache struct {
+		CacheName string          `json:"cacheName,omitempty"`
+		Content   json.RawMessage `json:"content"`
+		Format    string          `json:"format,omitempty"`
+	}
+
 	MissingConfigError struct {
 		Setting string
 	}
@@ -179,6 +224,10 @@ func (c *Config) Queue() *tcqueue.Queue {
 	return queue
 }
 
+func (c *Config) Index() *tcindex.Index {
+	return tcindex.New(c.Credentials(), c.RootURL)
+}
+
 func (c *Config) PurgeCache() *tcpurgecache.PurgeCache {
 	purgeCache := tcpurgecache.New(c.Credentials(), c.RootURL)
 	// If purgeCacheRootURL provided, it should take precedence over rootURL
@@ -3,4 +3,5 @@
 package gwconfig
 
 type PublicEngineConfig struct {
+	SandboxTasks bool `json:"sandboxTasks"`
 }
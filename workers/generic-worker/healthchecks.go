@@ -0,0 +1,271 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	sysinfo "github.com/elastic/go-sysinfo"
+	tcurls "github.com/taskcluster/taskcluster-lib-urls"
+)
+
+// HealthCheck is a check that the worker host is fit to run tasks.
+type HealthCheck struct {
+	Name string
+	// Check returns an error describing the problem, if the host fails the
+	// check
+	Check func() error
+}
+
+// HostHealth runs health checks before tasks are claimed. The worker does not
+// claim tasks while any of the checks fail.
+type HostHealth struct {
+	checks []HealthCheck
+	// when the checks were last run, or the zero time if they should be run
+	// before the next task is claimed
+	lastChecked time.Time
+	// failures from the last run of the checks
+	failures []string
+	// when the checks started failing, or the zero time if they pass
+	unhealthySince time.Time
+}
+
+// NewHostHealth returns a HostHealth for the health checks enabled in the
+// worker config.
+func NewHostHealth() *HostHealth {
+	return &HostHealth{
+		checks: configuredHealthChecks(),
+	}
+}
+
+// configuredHealthChecks returns the built-in health checks enabled by
+// config settings, followed by a check for each command in config setting
+// healthCheckCommands.
+func configuredHealthChecks() []HealthCheck {
+	checks := []HealthCheck{}
+	for _, dir := range []string{config.TasksDir, config.CachesDir} {
+		dir := dir
+		if config.HealthCheckMinFreeDiskMegabytes > 0 {
+			checks = append(checks, HealthCheck{
+				Name: "free disk space in " + dir,
+				Check: func() error {
+					return checkFreeDiskSpace(dir, uint64(config.HealthCheckMinFreeDiskMegabytes)*1024*1024)
+				},
+			})
+		}
+		if config.HealthCheckMinFreeInodes > 0 {
+			checks = append(checks, HealthCheck{
+				Name: "free inodes in " + dir,
+				Check: func() error {
+					return checkFreeInodes(dir, uint64(config.HealthCheckMinFreeInodes))
+				},
+			})
+		}
+	}
+	if config.HealthCheckMinFreeMemoryMegabytes > 0 {
+		checks = append(checks, HealthCheck{
+			Name: "free memory",
+			Check: func() error {
+				return checkFreeMemory(uint64(config.HealthCheckMinFreeMemoryMegabytes) * 1024 * 1024)
+			},
+		})
+	}
+	if config.HealthCheckMaxClockSkewSecs > 0 {
+		checks = append(checks, HealthCheck{
+			Name: "clock skew",
+			Check: func() error {
+				return checkClockSkew(time.Duration(config.HealthCheckMaxClockSkewSecs) * time.Second)
+			},
+		})
+	}
+	if config.HealthCheckMaxWorkerFailures > 0 {
+		checks = append(checks, HealthCheck{
+			Name: "recent worker failures",
+			Check: func() error {
+				return checkRecentWorkerFailures(config.HealthCheckMaxWorkerFailures, time.Duration(config.HealthCheckWorkerFailuresSecs)*time.Second)
+			},
+		})
+	}
+	for _, executable := range config.HealthCheckRequiredExecutables {
+		executable := executable
+		checks = append(checks, HealthCheck{
+			Name: "executable " + executable,
+			Check: func() error {
+				_, err := exec.LookPath(executable)
+				return err
+			},
+		})
+	}
+	for _, command := range config.HealthCheckCommands {
+		command := command
+		checks = append(checks, HealthCheck{
+			Name: "command " + command,
+			Check: func() error {
+				return runHostCommand("health check", command, time.Duration(config.HealthCheckTimeoutSecs)*time.Second)
+			},
+		})
+	}
+	return checks
+}
+
+// Healthy runs the health checks, if they have not been run in the last
+// healthCheckIntervalSecs seconds, and returns true if they all passed.
+// Failures are logged, and reported in a hostUnhealthy worker metrics event.
+func (h *HostHealth) Healthy() bool {
+	// Round(0) forces wall time calculation instead of monotonic time in case machine slept etc
+	if !h.lastChecked.IsZero() && time.Now().Round(0).Sub(h.lastChecked) < time.Duration(config.HealthCheckIntervalSecs)*time.Second {
+		return len(h.failures) == 0
+	}
+	h.lastChecked = time.Now()
+	failures := []string{}
+	for _, check := range h.checks {
+		if err := check.Check(); err != nil {
+			failures = append(failures, fmt.Sprintf("%v: %v", check.Name, err))
+		}
+	}
+	switch {
+	case len(failures) > 0:
+		if h.unhealthySince.IsZero() {
+			h.unhealthySince = h.lastChecked
+		}
+		for _, failure := range failures {
+			log.Printf("Health check failed - %v", failure)
+		}
+		log.Printf("Host unhealthy for %v, not claiming tasks", h.UnhealthyFor())
+		logEventWithFields("hostUnhealthy", nil, h.lastChecked, map[string]interface{}{
+			"failedHealthChecks": failures,
+		})
+	case len(h.failures) > 0:
+		log.Printf("Health checks passed, host healthy again after %v", h.UnhealthyFor())
+		logEvent("hostHealthy", nil, h.lastChecked)
+		h.unhealthySince = time.Time{}
+	}
+	h.failures = failures
+	return len(failures) == 0
+}
+
+// Failures returns the health checks that failed when they were last run.
+func (h *HostHealth) Failures() []string {
+	return h.failures
+}
+
+// UnhealthyFor returns how long the health checks have been failing for.
+func (h *HostHealth) UnhealthyFor() time.Duration {
+	if h.unhealthySince.IsZero() {
+		return 0
+	}
+	// Round(0) forces wall time calculation instead of monotonic time in case machine slept etc
+	return time.Now().Round(0).Sub(h.unhealthySince)
+}
+
+// Recheck ensures the health checks are run before the next task is claimed,
+// e.g. because a task has just run.
+func (h *HostHealth) Recheck() {
+	h.lastChecked = time.Time{}
+}
+
+// existingDir returns dir, or its closest ancestor that exists, since e.g.
+// the caches directory is only created once a cache is first used.
+func existingDir(dir string) string {
+	for {
+		if _, err := os.Stat(dir); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir
+		}
+		dir = parent
+	}
+}
+
+func checkFreeDiskSpace(dir string, requiredBytes uint64) error {
+	freeBytes, err := freeDiskSpaceBytes(existingDir(dir))
+	if err != nil {
+		return err
+	}
+	if freeBytes < requiredBytes {
+		return fmt.Errorf("%v bytes free, but %v bytes required", freeBytes, requiredBytes)
+	}
+	return nil
+}
+
+func checkFreeInodes(dir string, requiredInodes uint64) error {
+	inodes, err := freeInodes(existingDir(dir))
+	if err != nil {
+		return err
+	}
+	if inodes < requiredInodes {
+		return fmt.Errorf("%v inodes free, but %v inodes required", inodes, requiredInodes)
+	}
+	return nil
+}
+
+func checkFreeMemory(requiredBytes uint64) error {
+	host, err := sysinfo.Host()
+	if err != nil {
+		return fmt.Errorf("could not determine free memory: %v", err)
+	}
+	memory, err := host.Memory()
+	if err != nil {
+		return fmt.Errorf("could not determine free memory: %v", err)
+	}
+	if memory.Available < requiredBytes {
+		return fmt.Errorf("%v bytes of memory available, but %v bytes required", memory.Available, requiredBytes)
+	}
+	return nil
+}
+
+// checkClockSkew compares the local clock to the Date header of a response
+// from the queue. Since the Date header only has a resolution of one second,
+// skew of up to a second is always tolerated. The request to the queue is
+// limited by config setting healthCheckTimeoutSecs, if non-zero.
+func checkClockSkew(maxSkew time.Duration) error {
+	client := &http.Client{
+		Timeout: time.Duration(config.HealthCheckTimeoutSecs) * time.Second,
+	}
+	before := time.Now()
+	resp, err := client.Get(tcurls.API(queue.RootURL, "queue", "v1", "ping"))
+	if err != nil {
+		return fmt.Errorf("could not reach queue: %v", err)
+	}
+	after := time.Now()
+	resp.Body.Close()
+	queueTime, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return fmt.Errorf("could not parse Date header %q of queue response: %v", resp.Header.Get("Date"), err)
+	}
+	localTime := before.Add(after.Sub(before) / 2).Truncate(time.Second)
+	skew := localTime.Sub(queueTime)
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > maxSkew+time.Second {
+		return fmt.Errorf("local clock is %v, but queue clock is %v", localTime.UTC(), queueTime.UTC())
+	}
+	return nil
+}
+
+// checkRecentWorkerFailures reads the task history, and fails if at least
+// maxFailures task runs that started within the given period were worker
+// failures.
+func checkRecentWorkerFailures(maxFailures uint, period time.Duration) error {
+	entries, err := ReadTaskHistory(taskHistoryFile, TaskHistoryFilter{Since: time.Now().Add(-period)})
+	if err != nil {
+		return fmt.Errorf("could not read task history file %v: %v", taskHistoryFile, err)
+	}
+	var failures uint
+	for _, entry := range entries {
+		if isWorkerFailure(entry.State, entry.Reason) {
+			failures++
+		}
+	}
+	if failures >= maxFailures {
+		return fmt.Errorf("%v task runs in the last %v were resolved as exception/%v or exception/%v, reaching healthCheckMaxWorkerFailures (%v)", failures, period, internalError, resourceUnavailable, maxFailures)
+	}
+	return nil
+}
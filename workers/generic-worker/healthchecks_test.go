@@ -0,0 +1,162 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/taskcluster/taskcluster/v28/clients/client-go/tcqueue"
+)
+
+func TestHostHealthRunsChecksEveryInterval(t *testing.T) {
+	_, teardown := setupWithFakeServices(t)
+	defer teardown()
+
+	config.HealthCheckIntervalSecs = 3600
+	checkErr := errors.New("emulator not responding")
+	runs := 0
+	hostHealth := &HostHealth{
+		checks: []HealthCheck{
+			{
+				Name: "emulator",
+				Check: func() error {
+					runs++
+					return checkErr
+				},
+			},
+		},
+	}
+	if hostHealth.Healthy() {
+		t.Fatal("Expected host to be unhealthy when health check fails")
+	}
+	if failures := hostHealth.Failures(); len(failures) != 1 || failures[0] != "emulator: emulator not responding" {
+		t.Fatalf("Unexpected health check failures %v", failures)
+	}
+	checkErr = nil
+	if hostHealth.Healthy() || runs != 1 {
+		t.Fatalf("Expected health checks not to be rerun within healthCheckIntervalSecs, but they ran %v times", runs)
+	}
+	hostHealth.Recheck()
+	if !hostHealth.Healthy() || runs != 2 {
+		t.Fatalf("Expected host to be healthy after health checks rerun, but they ran %v times", runs)
+	}
+	if hostHealth.UnhealthyFor() != 0 {
+		t.Fatalf("Expected healthy host not to be unhealthy for %v", hostHealth.UnhealthyFor())
+	}
+}
+
+func TestDiskSpaceHealthChecksOptIn(t *testing.T) {
+	_, teardown := setupWithFakeServices(t)
+	defer teardown()
+
+	// requiredDiskSpaceMegabytes only affects garbage collection
+	config.RequiredDiskSpaceMegabytes = 1024 * 1024 * 1024
+	for _, check := range configuredHealthChecks() {
+		if strings.HasPrefix(check.Name, "free disk space") {
+			t.Fatalf("Expected no disk space health checks by default, but got %q", check.Name)
+		}
+	}
+	config.HealthCheckMinFreeDiskMegabytes = 1024 * 1024 * 1024
+	names := []string{}
+	for _, check := range configuredHealthChecks() {
+		if err := check.Check(); err != nil {
+			names = append(names, check.Name)
+		}
+	}
+	expected := []string{"free disk space in " + config.TasksDir, "free disk space in " + config.CachesDir}
+	if fmt.Sprint(names) != fmt.Sprint(expected) {
+		t.Fatalf("Expected failed health checks %v, but got %v", expected, names)
+	}
+}
+
+func TestClockSkewHealthCheck(t *testing.T) {
+	_, teardown := setupWithFakeServices(t)
+	defer teardown()
+
+	queue = config.Queue()
+	err := checkClockSkew(time.Second)
+	if err != nil {
+		t.Fatalf("Expected no clock skew with fake queue, but got %v", err)
+	}
+
+	skewedQueue := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat))
+	}))
+	defer skewedQueue.Close()
+	queue = tcqueue.New(nil, skewedQueue.URL)
+	err = checkClockSkew(time.Minute)
+	if err == nil || !strings.Contains(err.Error(), "queue clock is") {
+		t.Fatalf("Expected clock skew of one hour to be detected, but got %v", err)
+	}
+}
+
+func TestClockSkewHealthCheckTimeout(t *testing.T) {
+	_, teardown := setupWithFakeServices(t)
+	defer teardown()
+
+	unblock := make(chan struct{})
+	slowQueue := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-unblock
+	}))
+	defer slowQueue.Close()
+	defer close(unblock)
+	queue = tcqueue.New(nil, slowQueue.URL)
+	config.HealthCheckTimeoutSecs = 1
+	err := checkClockSkew(time.Minute)
+	if err == nil || !strings.Contains(err.Error(), "could not reach queue") {
+		t.Fatalf("Expected clock skew health check to time out, but got %v", err)
+	}
+}
+
+func TestRecentWorkerFailuresHealthCheck(t *testing.T) {
+	_, teardown := setupWithFakeServices(t)
+	defer teardown()
+
+	for i, started := range []time.Time{time.Now().Add(-2 * time.Hour), time.Now()} {
+		err := appendTaskHistory(&TaskHistoryEntry{
+			TaskID:   fmt.Sprintf("failed-task-%v", i),
+			Started:  started,
+			Finished: started,
+			State:    "exception",
+			Reason:   "internal-error",
+		})
+		if err != nil {
+			t.Fatalf("Could not write task history: %v", err)
+		}
+	}
+	if err := checkRecentWorkerFailures(2, time.Hour); err != nil {
+		t.Fatalf("Expected worker failure before the last hour not to be counted, but got %v", err)
+	}
+	if err := checkRecentWorkerFailures(2, 3*time.Hour); err == nil {
+		t.Fatal("Expected health check to fail after two worker failures in the last three hours")
+	}
+}
+
+func TestHealthCheckFailurePreventsClaims(t *testing.T) {
+	fakeServices, teardown := setupWithFakeServices(t)
+	defer teardown()
+
+	config.HealthCheckRequiredExecutables = []string{"generic-worker-no-such-executable"}
+	config.HealthCheckMaxFailureSecs = 1
+
+	taskID := scheduleTask(t, testTask(t), GenericWorkerPayload{
+		Command:    helloGoodbye(),
+		MaxRunTime: 30,
+	})
+	execute(t, HOST_UNHEALTHY)
+
+	if errors := fakeServices.WorkerManager.Errors(); len(errors) != 1 || errors[0].Kind != "health-checks-failed" {
+		t.Fatalf("Expected one worker error to be reported, but got %#v", errors)
+	}
+	status, err := fakeServices.Queue.Status(taskID)
+	if err != nil {
+		t.Fatalf("Could not get task status: %v", err)
+	}
+	if status.State != "pending" {
+		t.Fatalf("Expected task not to be claimed while health checks fail, but it is %v", status.State)
+	}
+}
@@ -24,6 +24,7 @@ import (
 	tcclient "github.com/taskcluster/taskcluster/v28/clients/client-go"
 	"github.com/taskcluster/taskcluster/v28/clients/client-go/tcqueue"
 	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/gwconfig"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/tcfake"
 	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/testutil"
 )
 
@@ -35,6 +36,14 @@ var (
 )
 
 func setupEnvironment(t *testing.T) (teardown func()) {
+	teardown = prepareEnvironment(t)
+	testQueue = NewQueue(t)
+	return teardown
+}
+
+// prepareEnvironment resets the test directories and global state, without
+// creating a queue client for tests to submit tasks with.
+func prepareEnvironment(t *testing.T) (teardown func()) {
 
 	testDir := filepath.Join(testdataDir, t.Name())
 
@@ -56,6 +65,8 @@ func setupEnvironment(t *testing.T) (teardown func()) {
 	for _, file := range []string{
 		filepath.Join(cwd, "file-caches.json"),
 		filepath.Join(cwd, "directory-caches.json"),
+		filepath.Join(cwd, taskHistoryFile),
+		filepath.Join(cwd, runningTaskFile),
 	} {
 		err := os.RemoveAll(file)
 		if err != nil {
@@ -73,8 +84,6 @@ func setupEnvironment(t *testing.T) (teardown func()) {
 	inAnHour = tcclient.Time(time.Now().Add(time.Hour * 1))
 	globalTestName = t.Name()
 
-	testQueue = NewQueue(t)
-
 	return func() {
 		// note for tests that don't submit a task, they will have
 		// taskContext.TaskDir set to the testdata subfolder, and we don't
@@ -93,7 +102,34 @@ func setupEnvironment(t *testing.T) (teardown func()) {
 
 func setup(t *testing.T) (teardown func()) {
 	teardown = setupEnvironment(t)
-	// configure the worker
+	configureWorker(t)
+	return teardown
+}
+
+// setupWithFakeServices is like setup, except that the worker (and testQueue)
+// talk to in-process fakes of the taskcluster services, so no taskcluster
+// credentials or network access are required.
+func setupWithFakeServices(t *testing.T) (fakeServices *tcfake.Server, teardown func()) {
+	teardownEnvironment := prepareEnvironment(t)
+	fakeServices, err := tcfake.NewServer(filepath.Join(testdataDir, t.Name(), "artifacts"))
+	if err != nil {
+		teardownEnvironment()
+		t.Fatalf("Could not start fake taskcluster services: %v", err)
+	}
+	testQueue = tcqueue.New(&tcclient.Credentials{ClientID: "test-client", AccessToken: "test"}, fakeServices.RootURL())
+	configureWorker(t)
+	config.RootURL = fakeServices.RootURL()
+	config.ClientID = "test-client"
+	config.AccessToken = "test"
+	config.Certificate = ""
+	return fakeServices, func() {
+		fakeServices.Close()
+		teardownEnvironment()
+	}
+}
+
+// configureWorker sets the global worker config for the current test.
+func configureWorker(t *testing.T) {
 	testDir := filepath.Join(testdataDir, t.Name())
 	config = &gwconfig.Config{
 		PrivateConfig: gwconfig.PrivateConfig{
@@ -114,34 +150,42 @@ func setup(t *testing.T) (teardown func()) {
 			DisableReboots:                 true,
 			// Need common downloads directory across tests, since files
 			// directory-caches.json and file-caches.json are not per-test.
-			DownloadsDir:              filepath.Join(cwd, "downloads"),
-			Ed25519SigningKeyLocation: filepath.Join(testdataDir, "ed25519_private_key"),
-			IdleTimeoutSecs:           60,
-			InstanceID:                "test-instance-id",
-			InstanceType:              "p3.enormous",
-			LiveLogCertificate:        "",
-			LiveLogExecutable:         "livelog",
-			LiveLogGETPort:            30582,
-			LiveLogKey:                "",
-			LiveLogPUTPort:            43264,
-			NumberOfTasksToRun:        1,
-			PrivateIP:                 net.ParseIP("87.65.43.21"),
-			ProvisionerID:             "test-provisioner",
-			PublicIP:                  net.ParseIP("12.34.56.78"),
-			PurgeCacheRootURL:         "",
-			QueueRootURL:              "",
-			Region:                    "test-worker-group",
+			DownloadsDir:                  filepath.Join(cwd, "downloads"),
+			Ed25519SigningKeyLocation:     filepath.Join(testdataDir, "ed25519_private_key"),
+			IdleTimeoutSecs:               60,
+			InstanceID:                    "test-instance-id",
+			InstanceType:                  "p3.enormous",
+			LiveArtifactsPort:             34570,
+			LiveLogCertificate:            "",
+			LiveLogExecutable:             "livelog",
+			LiveLogGETPort:                30582,
+			LiveLogKey:                    "",
+			LiveLogPUTPort:                43264,
+			MaxConcurrentMounts:           4,
+			MountDownloadRetryTimeoutSecs: 900,
+			NumberOfTasksToRun:            1,
+			PrivateIP:                     net.ParseIP("87.65.43.21"),
+			ProvisionerID:                 "test-provisioner",
+			PublicIP:                      net.ParseIP("12.34.56.78"),
+			PurgeCacheRootURL:             "",
+			QueueRootURL:                  "",
+			Region:                        "test-worker-group",
 			// should be enough for tests, and travis-ci.org CI environments don't
 			// have a lot of free disk
 			RequiredDiskSpaceMegabytes:     16,
 			RootURL:                        os.Getenv("TASKCLUSTER_ROOT_URL"),
 			RunAfterUserCreation:           "",
+			SecretScanning:                 "optional",
+			SecretScanningAction:           "error",
+			SecretScanningDetectors:        []string{"privateKey", "taskclusterAccessToken"},
+			SecretScanningPatterns:         []string{},
 			SentryProject:                  "generic-worker-tests",
 			ShutdownMachineOnIdle:          false,
 			ShutdownMachineOnInternalError: false,
 			Subdomain:                      "taskcluster-worker.net",
 			TaskclusterProxyExecutable:     "taskcluster-proxy",
 			TaskclusterProxyPort:           34569,
+			TaskMetadataPort:               34571,
 			TasksDir:                       testDir,
 			WorkerGroup:                    "test-worker-group",
 			WorkerID:                       "test-worker-id",
@@ -164,7 +208,6 @@ func setup(t *testing.T) (teardown func()) {
 	}
 	configProvider = &TestProvider{}
 	setConfigRunTasksAsCurrentUser()
-	return teardown
 }
 
 type TestProvider struct{}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/fileutil"
+)
+
+// taskHistoryFile is the journal of task runs executed by this worker, which
+// is stored alongside tasks-resolved-count.txt. Entries are only ever
+// appended to it, one json object per line.
+const taskHistoryFile = "task-history.jsonl"
+
+// TaskHistoryEntry records a task run executed by the worker.
+type TaskHistoryEntry struct {
+	TaskID   string    `json:"taskId"`
+	RunID    uint      `json:"runId"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	// State and Reason are the resolution reported to the queue, e.g.
+	// completed/completed, failed/failed or exception/malformed-payload. An
+	// entry with state quarantined and no task ID records that the worker
+	// quarantined itself.
+	State  string `json:"state"`
+	Reason string `json:"reason"`
+	// Exit codes of the task commands that were run, in order
+	ExitCodes []int64 `json:"exitCodes"`
+	// Human readable description of each mount in the task payload
+	Mounts []string `json:"mounts"`
+	// Free disk space in the task directory, before and after the task ran
+	DiskFreeBytesBefore uint64 `json:"diskFreeBytesBefore"`
+	DiskFreeBytesAfter  uint64 `json:"diskFreeBytesAfter"`
+}
+
+// TaskHistoryFilter selects task history entries. Zero values match all
+// entries.
+type TaskHistoryFilter struct {
+	TaskID string
+	State  string
+	Since  time.Time
+	// Only the Last most recent matching entries are selected, if positive
+	Last int
+}
+
+// newTaskHistoryEntry should be called immediately before the given task is
+// run.
+func newTaskHistoryEntry(task *TaskRun) *TaskHistoryEntry {
+	entry := &TaskHistoryEntry{
+		TaskID:    task.TaskID,
+		RunID:     task.RunID,
+		Started:   time.Now(),
+		ExitCodes: []int64{},
+		Mounts:    []string{},
+	}
+	freeBytes, err := freeDiskSpaceBytes(taskContext.TaskDir)
+	if err != nil {
+		log.Printf("WARNING: could not determine free disk space for task history: %v", err)
+	}
+	entry.DiskFreeBytesBefore = freeBytes
+	return entry
+}
+
+// finish completes the entry after the task has run and been resolved with
+// the given errors.
+func (entry *TaskHistoryEntry) finish(task *TaskRun, errors *ExecutionErrors) {
+	entry.Finished = time.Now()
+	entry.State, entry.Reason = resolution(errors)
+	entry.ExitCodes = append(entry.ExitCodes, task.exitCodes...)
+	// the payload is only available once the task has run, since it is
+	// validated as part of running the task
+	entry.Mounts = describeMounts(task)
+	freeBytes, err := freeDiskSpaceBytes(taskContext.TaskDir)
+	if err != nil {
+		log.Printf("WARNING: could not determine free disk space for task history: %v", err)
+	}
+	entry.DiskFreeBytesAfter = freeBytes
+}
+
+// resolution returns the state and reason that a task with the given errors
+// is resolved with. See (*TaskRun).resolve.
+func resolution(errors *ExecutionErrors) (state, reason string) {
+	switch {
+	case !errors.Occurred():
+		return "completed", "completed"
+	case (*errors)[0].TaskStatus == failed:
+		return "failed", "failed"
+	default:
+		return "exception", string((*errors)[0].Reason)
+	}
+}
+
+// describeMounts returns a description of each mount in the task payload,
+// such as "cache my-cache at my-dir" or "file my-file from <content>".
+func describeMounts(task *TaskRun) []string {
+	descriptions := []string{}
+	taskMount := (&MountsFeature{}).NewTaskFeature(task).(*TaskMount)
+	for _, mount := range taskMount.mounts {
+		var description string
+		switch m := mount.(type) {
+		case *WritableDirectoryCache:
+			description = "cache " + m.CacheName + " at " + m.Directory
+		case *ReadOnlyDirectory:
+			description = "directory " + m.Directory
+		case *FileMount:
+			description = "file " + m.File
+		}
+		if fsContent, err := mount.FSContent(); err == nil && fsContent != nil {
+			description += " from " + fsContent.String()
+		}
+		descriptions = append(descriptions, description)
+	}
+	return descriptions
+}
+
+// appendTaskHistory appends the given entry to the task history file.
+func appendTaskHistory(entry *TaskHistoryEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(taskHistoryFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(line, '\n'))
+	if err != nil {
+		f.Close()
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+	return fileutil.SecureFiles(taskHistoryFile)
+}
+
+// ReadTaskHistory returns the entries of the given task history file that
+// match filter, oldest first. Lines that cannot be parsed, such as a partial
+// line written when the worker crashed, are skipped.
+func ReadTaskHistory(file string, filter TaskHistoryFilter) ([]TaskHistoryEntry, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []TaskHistoryEntry{}, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	entries := []TaskHistoryEntry{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		var entry TaskHistoryEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			log.Printf("WARNING: skipping invalid line %v of %v: %v", lineNumber, file, err)
+			continue
+		}
+		if filter.matches(&entry) {
+			entries = append(entries, entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if filter.Last > 0 && len(entries) > filter.Last {
+		entries = entries[len(entries)-filter.Last:]
+	}
+	return entries, nil
+}
+
+func (filter TaskHistoryFilter) matches(entry *TaskHistoryEntry) bool {
+	switch {
+	case filter.TaskID != "" && entry.TaskID != filter.TaskID:
+		return false
+	case filter.State != "" && entry.State != filter.State:
+		return false
+	case !filter.Since.IsZero() && entry.Started.Before(filter.Since):
+		return false
+	}
+	return true
+}
+
+// parseHistorySince interprets the value of the --since option, which is
+// either an RFC3339 timestamp or a duration before now, such as 24h.
+func parseHistorySince(since string) (time.Time, error) {
+	if since == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, since); err == nil {
+		return t, nil
+	}
+	d, err := time.ParseDuration(since)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither an RFC3339 timestamp nor a duration", since)
+	}
+	return time.Now().Add(-d), nil
+}
+
+// writeTaskHistory writes the given entries to w, either as json lines or as
+// a table.
+func writeTaskHistory(w io.Writer, entries []TaskHistoryEntry, asJSON bool) error {
+	if asJSON {
+		encoder := json.NewEncoder(w)
+		for i := range entries {
+			if err := encoder.Encode(&entries[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "STARTED\tDURATION\tTASK ID\tRUN\tRESOLUTION\tEXIT CODES\tDISK FREE BEFORE/AFTER (MB)\tMOUNTS")
+	for _, entry := range entries {
+		exitCodes := make([]string, len(entry.ExitCodes))
+		for i, code := range entry.ExitCodes {
+			exitCodes[i] = fmt.Sprintf("%v", code)
+		}
+		fmt.Fprintf(
+			tw,
+			"%v\t%v\t%v\t%v\t%v/%v\t%v\t%v/%v\t%v\n",
+			entry.Started.Format(time.RFC3339),
+			entry.Finished.Round(0).Sub(entry.Started).Round(time.Second),
+			entry.TaskID,
+			entry.RunID,
+			entry.State,
+			entry.Reason,
+			strings.Join(exitCodes, ","),
+			entry.DiskFreeBytesBefore/1024/1024,
+			entry.DiskFreeBytesAfter/1024/1024,
+			strings.Join(entry.Mounts, "; "),
+		)
+	}
+	return tw.Flush()
+}
+
+// showTaskHistory implements the history target.
+func showTaskHistory(filter TaskHistoryFilter, asJSON bool) ExitCode {
+	entries, err := ReadTaskHistory(taskHistoryFile, filter)
+	if err != nil {
+		log.Printf("Could not read task history file %v: %v", taskHistoryFile, err)
+		return CANT_READ_TASK_HISTORY
+	}
+	err = writeTaskHistory(os.Stdout, entries, asJSON)
+	if err != nil {
+		log.Printf("Could not write task history: %v", err)
+		return INTERNAL_ERROR
+	}
+	return TASKS_COMPLETE
+}
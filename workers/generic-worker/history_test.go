@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadTaskHistory(t *testing.T) {
+	file, err := ioutil.TempFile("", "task-history")
+	if err != nil {
+		t.Fatalf("Could not create temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	now := time.Now()
+	_, err = file.WriteString(strings.Join([]string{
+		`{"taskId": "task-a", "runId": 0, "started": "` + now.Add(-3*time.Hour).Format(time.RFC3339) + `", "state": "completed", "reason": "completed"}`,
+		`{"taskId": "task-b", "runId": 0, "started": "` + now.Add(-2*time.Hour).Format(time.RFC3339) + `", "state": "exception", "reason": "worker-shutdown"}`,
+		`{"taskId": "task-b", "runId": 1, "started": "` + now.Add(-1*time.Hour).Format(time.RFC3339) + `", "state": "failed", "reason": "failed"}`,
+		`{"taskId": "task-c", "runId": 0, "sta`,
+		``,
+	}, "\n"))
+	if err != nil {
+		t.Fatalf("Could not write task history: %v", err)
+	}
+	file.Close()
+
+	for _, test := range []struct {
+		name     string
+		filter   TaskHistoryFilter
+		expected []string
+	}{
+		{"all", TaskHistoryFilter{}, []string{"task-a/0", "task-b/0", "task-b/1"}},
+		{"task id", TaskHistoryFilter{TaskID: "task-b"}, []string{"task-b/0", "task-b/1"}},
+		{"state", TaskHistoryFilter{State: "exception"}, []string{"task-b/0"}},
+		{"since", TaskHistoryFilter{Since: now.Add(-150 * time.Minute)}, []string{"task-b/0", "task-b/1"}},
+		{"last", TaskHistoryFilter{Last: 1}, []string{"task-b/1"}},
+		{"no match", TaskHistoryFilter{TaskID: "task-a", State: "failed"}, []string{}},
+	} {
+		entries, err := ReadTaskHistory(file.Name(), test.filter)
+		if err != nil {
+			t.Fatalf("%v: could not read task history: %v", test.name, err)
+		}
+		actual := []string{}
+		for _, entry := range entries {
+			actual = append(actual, entry.TaskID+"/"+strconv.Itoa(int(entry.RunID)))
+		}
+		if strings.Join(actual, " ") != strings.Join(test.expected, " ") {
+			t.Fatalf("%v: expected task runs %v but got %v", test.name, test.expected, actual)
+		}
+	}
+}
+
+func TestReadTaskHistoryMissingFile(t *testing.T) {
+	entries, err := ReadTaskHistory("this-file-does-not-exist.jsonl", TaskHistoryFilter{})
+	if err != nil || len(entries) != 0 {
+		t.Fatalf("Expected no entries and no error, but got %v and %v", entries, err)
+	}
+}
+
+func TestWriteTaskHistory(t *testing.T) {
+	started := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	entries := []TaskHistoryEntry{
+		{
+			TaskID:              "task-a",
+			Started:             started,
+			Finished:            started.Add(90 * time.Second),
+			State:               "failed",
+			Reason:              "failed",
+			ExitCodes:           []int64{0, 1},
+			Mounts:              []string{"cache my-cache at my-dir"},
+			DiskFreeBytesBefore: 2048 * 1024 * 1024,
+			DiskFreeBytesAfter:  1024 * 1024 * 1024,
+		},
+	}
+	var table bytes.Buffer
+	err := writeTaskHistory(&table, entries, false)
+	if err != nil {
+		t.Fatalf("Could not write task history: %v", err)
+	}
+	for _, expected := range []string{"2020-01-02T03:04:05Z", "1m30s", "failed/failed", "0,1", "2048/1024", "cache my-cache at my-dir"} {
+		if !strings.Contains(table.String(), expected) {
+			t.Fatalf("Expected task history table to contain %q:\n%v", expected, table.String())
+		}
+	}
+}
+
+func TestParseHistorySince(t *testing.T) {
+	since, err := parseHistorySince("2020-01-02T03:04:05Z")
+	if err != nil || !since.Equal(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Fatalf("Unexpected result parsing timestamp: %v %v", since, err)
+	}
+	since, err = parseHistorySince("1h")
+	if err != nil || time.Since(since) < time.Hour || time.Since(since) > 2*time.Hour {
+		t.Fatalf("Unexpected result parsing duration: %v %v", since, err)
+	}
+	_, err = parseHistorySince("yesterday")
+	if err == nil {
+		t.Fatal("Expected an error parsing an invalid value")
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// runHostCommand runs the given command as the user that runs the worker,
+// with the given additional environment variables, and writes its output to
+// the worker log. The command is described in log messages and errors as
+// description, such as "pre-task hook". It is killed, together with any
+// processes that it spawned, if it runs for longer than timeout, if non-zero.
+func runHostCommand(description, command string, timeout time.Duration, env ...string) error {
+	cmd := exec.Command(command)
+	cmd.Env = append(os.Environ(), env...)
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	prepareHostCommand(cmd)
+	log.Printf("Running %v %v", description, command)
+	err := cmd.Start()
+	if err != nil {
+		return fmt.Errorf("%v %v failed: %v", description, command, err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+	// a nil channel never receives, so there is no timeout if timeout is 0
+	var timedOut <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		timedOut = timer.C
+	}
+	deadlineExceeded := false
+	select {
+	case err = <-done:
+	case <-timedOut:
+		deadlineExceeded = true
+		// kill any processes the command spawned too, since they may hold
+		// its output pipes open, which would stop Wait from returning
+		if killErr := killHostCommand(cmd); killErr != nil {
+			log.Printf("WARNING: could not kill %v %v: %v", description, command, killErr)
+		}
+		err = <-done
+	}
+	scanner := bufio.NewScanner(&output)
+	for scanner.Scan() {
+		log.Printf("[%v] %v", description, scanner.Text())
+	}
+	switch {
+	case deadlineExceeded:
+		return fmt.Errorf("%v %v did not complete within %v", description, command, timeout)
+	case err != nil:
+		return fmt.Errorf("%v %v failed: %v", description, command, err)
+	}
+	log.Printf("%v %v completed successfully", description, command)
+	return nil
+}
+
+// runTaskHook runs the given task hook command, killing it if it runs for
+// longer than config setting taskHookTimeoutSecs, if non-zero.
+func runTaskHook(name, command string, env ...string) error {
+	return runHostCommand(name+" hook", command, time.Duration(config.TaskHookTimeoutSecs)*time.Second, env...)
+}
+
+// runPreTaskHook runs config setting preTaskHook, if set. It should be
+// called before the worker claims a task.
+func runPreTaskHook() error {
+	if config.PreTaskHook == "" {
+		return nil
+	}
+	return runTaskHook("pre-task", config.PreTaskHook)
+}
+
+// runPostTaskHook runs config setting postTaskHook, if set, after the given
+// task has been resolved. The task run and its resolution are passed to the
+// hook in environment variables TASK_ID, RUN_ID, TASK_STATE and
+// TASK_REASON_RESOLVED. Since the task has already been resolved, a failing
+// hook is only logged.
+func runPostTaskHook(task *TaskRun, historyEntry *TaskHistoryEntry) {
+	if config.PostTaskHook == "" {
+		return
+	}
+	err := runTaskHook(
+		"post-task",
+		config.PostTaskHook,
+		"TASK_ID="+task.TaskID,
+		"RUN_ID="+strconv.Itoa(int(task.RunID)),
+		"TASK_STATE="+historyEntry.State,
+		"TASK_REASON_RESOLVED="+historyEntry.Reason,
+	)
+	if err != nil {
+		log.Printf("WARNING: %v", err)
+	}
+}
@@ -0,0 +1,20 @@
+// +build darwin linux freebsd
+
+package main
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// prepareHostCommand runs cmd in its own process group, so that
+// killHostCommand also kills any processes that it spawns.
+func prepareHostCommand(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// killHostCommand kills the process group of cmd, which must have been
+// prepared with prepareHostCommand and started.
+func killHostCommand(cmd *exec.Cmd) error {
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
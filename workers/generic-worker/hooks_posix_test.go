@@ -0,0 +1,121 @@
+// +build darwin linux freebsd
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// hookScript writes a shell script with the given body to dir, and returns
+// its path.
+func hookScript(t *testing.T, dir, name, body string) string {
+	t.Helper()
+	script := filepath.Join(dir, name)
+	err := ioutil.WriteFile(script, []byte("#!/bin/sh\n"+body+"\n"), 0755)
+	if err != nil {
+		t.Fatalf("Could not write hook script %v: %v", script, err)
+	}
+	return script
+}
+
+func TestTaskHooks(t *testing.T) {
+	_, teardown := setupWithFakeServices(t)
+	defer teardown()
+
+	dir, err := ioutil.TempDir("", t.Name())
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	hookOutput := filepath.Join(dir, "hooks.txt")
+	config.PreTaskHook = hookScript(t, dir, "pre-task.sh", `echo "pre-task" >> '`+hookOutput+`'`)
+	config.PostTaskHook = hookScript(t, dir, "post-task.sh", `echo "post-task $TASK_ID $RUN_ID $TASK_STATE/$TASK_REASON_RESOLVED" >> '`+hookOutput+`'`)
+
+	payload := GenericWorkerPayload{
+		Command:    returnExitCode(1),
+		MaxRunTime: 30,
+	}
+	taskID := submitAndAssert(t, testTask(t), payload, "failed", "failed")
+
+	output, err := ioutil.ReadFile(hookOutput)
+	if err != nil {
+		t.Fatalf("Could not read hook output: %v", err)
+	}
+	expected := "pre-task\npost-task " + taskID + " 0 failed/failed\n"
+	if string(output) != expected {
+		t.Fatalf("Expected hooks to write %q but they wrote %q", expected, output)
+	}
+}
+
+func TestPreTaskHookFailure(t *testing.T) {
+	fakeServices, teardown := setupWithFakeServices(t)
+	defer teardown()
+
+	dir, err := ioutil.TempDir("", t.Name())
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	config.PreTaskHook = hookScript(t, dir, "pre-task.sh", "echo 'emulator not found'; exit 3")
+
+	taskID := scheduleTask(t, testTask(t), GenericWorkerPayload{
+		Command:    helloGoodbye(),
+		MaxRunTime: 30,
+	})
+	execute(t, HOST_UNHEALTHY)
+
+	if errors := fakeServices.WorkerManager.Errors(); len(errors) != 1 || errors[0].Kind != "pre-task-hook-failed" {
+		t.Fatalf("Expected one worker error to be reported, but got %#v", errors)
+	}
+	status, err := fakeServices.Queue.Status(taskID)
+	if err != nil {
+		t.Fatalf("Could not get task status: %v", err)
+	}
+	if status.State != "pending" {
+		t.Fatalf("Expected task not to be claimed after pre-task hook failed, but it is %v", status.State)
+	}
+}
+
+func TestTaskHookTimeout(t *testing.T) {
+	_, teardown := setupWithFakeServices(t)
+	defer teardown()
+
+	dir, err := ioutil.TempDir("", t.Name())
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	config.TaskHookTimeoutSecs = 1
+
+	err = runTaskHook("pre-task", hookScript(t, dir, "pre-task.sh", "exec sleep 30"))
+	if err == nil || !strings.Contains(err.Error(), "did not complete within 1s") {
+		t.Fatalf("Expected hook to time out, but got error %v", err)
+	}
+}
+
+func TestTaskHookTimeoutKillsChildProcesses(t *testing.T) {
+	_, teardown := setupWithFakeServices(t)
+	defer teardown()
+
+	dir, err := ioutil.TempDir("", t.Name())
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	config.TaskHookTimeoutSecs = 1
+
+	// sleep is a child process of the shell, which inherits its output
+	start := time.Now()
+	err = runTaskHook("pre-task", hookScript(t, dir, "pre-task.sh", "sleep 30\necho done"))
+	if err == nil || !strings.Contains(err.Error(), "did not complete within 1s") {
+		t.Fatalf("Expected hook to time out, but got error %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Fatalf("Expected hook to be killed after 1s, but it took %v", elapsed)
+	}
+}
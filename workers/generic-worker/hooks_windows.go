@@ -0,0 +1,19 @@
+package main
+
+import (
+	"os/exec"
+	"strconv"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/host"
+)
+
+func prepareHostCommand(cmd *exec.Cmd) {
+}
+
+// killHostCommand kills cmd and any processes that it spawned. Here we use
+// taskkill.exe rather than cmd.Process.Kill() since we want child processes
+// also to be killed.
+func killHostCommand(cmd *exec.Cmd) error {
+	_, err := host.CombinedOutput("taskkill.exe", "/pid", strconv.Itoa(cmd.Process.Pid), "/f", "/t")
+	return err
+}
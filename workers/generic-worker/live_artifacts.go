@@ -0,0 +1,397 @@
+// +build !docker
+
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tcclient "github.com/taskcluster/taskcluster/v28/clients/client-go"
+	"github.com/taskcluster/taskcluster/v28/internal/scopes"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/fileutil"
+)
+
+// LiveArtifactsFeature runs a local HTTP endpoint, that task commands can
+// use to upload files of the task directory as artifacts while the task is
+// still running, rather than only after the task commands have completed.
+// Requests are authenticated with a token that is only given to the task
+// commands, since other users of the host can also connect to the endpoint.
+type LiveArtifactsFeature struct {
+}
+
+// liveArtifactsDir is the directory, relative to the task directory, that
+// files are copied to before they are uploaded as live artifacts, so that
+// the task commands can't change them during or after the upload.
+var liveArtifactsDir = filepath.Join("generic-worker", "live-artifacts")
+
+func (feature *LiveArtifactsFeature) Name() string {
+	return "Live Artifacts"
+}
+
+func (feature *LiveArtifactsFeature) Initialise() error {
+	return nil
+}
+
+func (feature *LiveArtifactsFeature) PersistState() error {
+	return nil
+}
+
+func (feature *LiveArtifactsFeature) IsEnabled(task *TaskRun) bool {
+	return task.Payload.Features.LiveArtifacts
+}
+
+type LiveArtifactsTask struct {
+	task   *TaskRun
+	token  string
+	server *http.Server
+	// mutex protects uploaded and copies
+	mutex sync.Mutex
+	// uploaded holds the names of the live artifacts that have been uploaded,
+	// or are being uploaded
+	uploaded map[string]bool
+	// copies is the number of files that have been copied to
+	// liveArtifactsDir
+	copies int
+}
+
+// liveArtifactRequest is the body of a request to upload a live artifact.
+// Properties have the same meaning as in payload property artifacts.
+type liveArtifactRequest struct {
+	Path            string        `json:"path"`
+	Name            string        `json:"name"`
+	ContentType     string        `json:"contentType"`
+	ContentEncoding string        `json:"contentEncoding"`
+	Expires         tcclient.Time `json:"expires"`
+}
+
+// liveArtifactError is a problem with a request to upload a live artifact,
+// together with the HTTP status code to respond with.
+type liveArtifactError struct {
+	statusCode int
+	message    string
+}
+
+func (e *liveArtifactError) Error() string {
+	return e.message
+}
+
+func badLiveArtifactRequest(format string, v ...interface{}) *liveArtifactError {
+	return &liveArtifactError{
+		statusCode: http.StatusBadRequest,
+		message:    fmt.Sprintf(format, v...),
+	}
+}
+
+func (feature *LiveArtifactsFeature) NewTaskFeature(task *TaskRun) TaskFeature {
+	return &LiveArtifactsTask{
+		task:     task,
+		uploaded: map[string]bool{},
+	}
+}
+
+func (lat *LiveArtifactsTask) RequiredScopes() scopes.Required {
+	// artifacts can be uploaded after the task commands have completed
+	// without any scopes, so no reason to require any here
+	return scopes.Required{}
+}
+
+func (lat *LiveArtifactsTask) ReservedArtifacts() []string {
+	return []string{}
+}
+
+func (lat *LiveArtifactsTask) Start() *CommandExecutionError {
+	token := make([]byte, 32)
+	_, err := rand.Read(token)
+	if err != nil {
+		return executionError(internalError, errored, fmt.Errorf("Could not generate live artifacts token: %v", err))
+	}
+	lat.token = hex.EncodeToString(token)
+	err = os.MkdirAll(filepath.Join(taskContext.TaskDir, liveArtifactsDir), 0700)
+	if err != nil {
+		return executionError(internalError, errored, fmt.Errorf("Could not create directory for live artifacts: %v", err))
+	}
+	address := fmt.Sprintf("127.0.0.1:%v", config.LiveArtifactsPort)
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return executionError(internalError, errored, fmt.Errorf("Could not start live artifacts endpoint: %v", err))
+	}
+	lat.server = &http.Server{
+		Handler: lat,
+	}
+	go func() {
+		err := lat.server.Serve(listener)
+		if err != http.ErrServerClosed {
+			log.Printf("WARNING: live artifacts endpoint stopped: %v", err)
+		}
+	}()
+	url := "http://" + address
+	err = lat.task.setVariable("TASKCLUSTER_ARTIFACT_UPLOAD_URL", url)
+	if err != nil {
+		return MalformedPayloadError(err)
+	}
+	err = lat.task.setVariable("TASKCLUSTER_ARTIFACT_UPLOAD_TOKEN", lat.token)
+	if err != nil {
+		return MalformedPayloadError(err)
+	}
+	lat.task.Infof("[live artifacts] Task commands may upload artifacts while the task is running, with a POST to %v", url)
+	return nil
+}
+
+func (lat *LiveArtifactsTask) Stop(err *ExecutionErrors) {
+	if lat.server == nil {
+		return
+	}
+	// waits for any uploads in progress to complete
+	e := lat.server.Shutdown(context.Background())
+	if e != nil {
+		log.Printf("WARNING: could not stop live artifacts endpoint: %v", e)
+	}
+}
+
+func (lat *LiveArtifactsTask) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Only POST requests are supported", http.StatusMethodNotAllowed)
+		return
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(lat.token)) != 1 {
+		http.Error(w, "Header Authorization must be Bearer <TASKCLUSTER_ARTIFACT_UPLOAD_TOKEN>", http.StatusUnauthorized)
+		return
+	}
+	var request liveArtifactRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(&request)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	name, e := lat.upload(&request)
+	if e != nil {
+		lat.task.Warnf("[live artifacts] Could not upload artifact %v from file %v: %v", request.Name, request.Path, e)
+		http.Error(w, e.Error(), e.statusCode)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintf(w, "Uploaded artifact %v\n", name)
+}
+
+// upload uploads the file of the request as an artifact, unless the
+// artifact name is reserved, the file is not inside the task directory, or
+// the upload would exceed the artifact limits of the task, and returns the
+// name it was uploaded as, which differs from the requested name if secret
+// scanning moved it to a private name.
+func (lat *LiveArtifactsTask) upload(request *liveArtifactRequest) (string, *liveArtifactError) {
+	switch {
+	case request.Name == "":
+		return "", badLiveArtifactRequest("Property name is required")
+	case request.Path == "":
+		return "", badLiveArtifactRequest("Property path is required")
+	}
+	switch request.ContentEncoding {
+	case "", "identity", "gzip":
+	default:
+		return "", badLiveArtifactRequest("Invalid contentEncoding %q - must be \"identity\" or \"gzip\"", request.ContentEncoding)
+	}
+	expires := request.Expires
+	if time.Time(expires).IsZero() {
+		expires = lat.task.Definition.Expires
+	}
+	// allow 1s discrepancy, as for payload artifacts
+	if time.Time(expires).Add(time.Second).Before(time.Time(lat.task.Definition.Deadline)) {
+		return "", badLiveArtifactRequest("Artifact expires before task deadline (%v is before %v)", expires, lat.task.Definition.Deadline)
+	}
+	if time.Time(expires).After(time.Time(lat.task.Definition.Expires).Add(time.Second)) {
+		return "", badLiveArtifactRequest("Artifact expires after task expiry (%v is after %v)", expires, lat.task.Definition.Expires)
+	}
+	file, e := liveArtifactFile(request.Path)
+	if e != nil {
+		return "", e
+	}
+	defer file.Close()
+	e = lat.reserve(request.Name)
+	if e != nil {
+		return "", e
+	}
+
+	// copy the file, so that the uploaded content is the content that the
+	// chain of trust certificate includes, even if the file changes later
+	lat.mutex.Lock()
+	lat.copies++
+	copyPath := filepath.Join(liveArtifactsDir, strconv.Itoa(lat.copies)+filepath.Ext(request.Path))
+	lat.mutex.Unlock()
+	copyFile := filepath.Join(taskContext.TaskDir, copyPath)
+	err := writeFileContents(file, copyFile)
+	var info os.FileInfo
+	if err == nil {
+		info, err = os.Stat(copyFile)
+	}
+	if err != nil {
+		lat.release(request.Name)
+		return "", &liveArtifactError{
+			statusCode: http.StatusInternalServerError,
+			message:    fmt.Sprintf("Could not copy file %v: %v", request.Path, err),
+		}
+	}
+	size := info.Size()
+	e = lat.count(size)
+	if e != nil {
+		lat.release(request.Name)
+		_ = os.Remove(copyFile)
+		return "", e
+	}
+	artifact := resolve(
+		&BaseArtifact{
+			Name:    request.Name,
+			Expires: expires,
+		},
+		"file",
+		copyPath,
+		request.ContentType,
+		request.ContentEncoding,
+	)
+	if errArtifact, isErrorArtifact := artifact.(*ErrorArtifact); isErrorArtifact {
+		lat.release(request.Name)
+		lat.uncount(size)
+		return "", badLiveArtifactRequest("%v", errArtifact.Message)
+	}
+	artifact = lat.task.scanArtifactForSecrets(artifact)
+	if errArtifact, isErrorArtifact := artifact.(*ErrorArtifact); isErrorArtifact {
+		lat.release(request.Name)
+		lat.uncount(size)
+		return "", &liveArtifactError{
+			statusCode: http.StatusUnprocessableEntity,
+			message:    errArtifact.Message,
+		}
+	}
+	cee := lat.task.uploadArtifact(artifact)
+	if cee != nil {
+		lat.release(request.Name)
+		lat.uncount(size)
+		return "", &liveArtifactError{
+			statusCode: http.StatusBadGateway,
+			message:    cee.Error(),
+		}
+	}
+	return artifact.Base().Name, nil
+}
+
+// reserve reserves the given artifact name for a live artifact, unless it
+// is reserved by a task feature, used by payload property artifacts, or has
+// already been uploaded as a live artifact.
+func (lat *LiveArtifactsTask) reserve(name string) *liveArtifactError {
+	conflict := func(format string, v ...interface{}) *liveArtifactError {
+		return &liveArtifactError{
+			statusCode: http.StatusConflict,
+			message:    fmt.Sprintf(format, v...),
+		}
+	}
+	if feature := lat.task.featureArtifacts[name]; feature != "" {
+		return conflict("Artifact name %v is reserved by feature %v", name, feature)
+	}
+	for _, artifact := range lat.task.Payload.Artifacts {
+		payloadName := artifact.Name
+		if payloadName == "" {
+			payloadName = canonicalPath(artifact.Path)
+		}
+		if name == payloadName || (artifact.Type == "directory" && strings.HasPrefix(name, strings.TrimSuffix(payloadName, "/")+"/")) {
+			return conflict("Artifact name %v is used by %v artifact %v in the task payload", name, artifact.Type, payloadName)
+		}
+	}
+	lat.mutex.Lock()
+	defer lat.mutex.Unlock()
+	if lat.uploaded[name] {
+		return conflict("Artifact %v has already been uploaded", name)
+	}
+	lat.uploaded[name] = true
+	return nil
+}
+
+// count counts a live artifact of the given size towards the artifact
+// limits of the task, unless it would exceed any of them, in which case it
+// must not be uploaded.
+func (lat *LiveArtifactsTask) count(size int64) *liveArtifactError {
+	task := lat.task
+	task.liveArtifactsMux.Lock()
+	defer task.liveArtifactsMux.Unlock()
+	limits := task.artifactLimits()
+	switch {
+	case limits.maxArtifacts > 0 && task.liveArtifacts >= limits.maxArtifacts:
+		return &liveArtifactError{
+			statusCode: http.StatusConflict,
+			message:    fmt.Sprintf("Task has already uploaded %v live artifacts, which is the limit of %v artifacts", task.liveArtifacts, limits.maxArtifacts),
+		}
+	case limits.maxSize > 0 && size > limits.maxSize:
+		return &liveArtifactError{
+			statusCode: http.StatusRequestEntityTooLarge,
+			message:    fmt.Sprintf("File is %v bytes, which exceeds the artifact size limit of %v bytes", size, limits.maxSize),
+		}
+	case limits.maxTotalSize > 0 && task.liveArtifactsSize+size > limits.maxTotalSize:
+		return &liveArtifactError{
+			statusCode: http.StatusRequestEntityTooLarge,
+			message:    fmt.Sprintf("File is %v bytes, which together with %v bytes of live artifacts already uploaded exceeds the total artifact size limit of %v bytes", size, task.liveArtifactsSize, limits.maxTotalSize),
+		}
+	}
+	task.liveArtifacts++
+	task.liveArtifactsSize += size
+	return nil
+}
+
+// uncount reverts count, after the live artifact could not be uploaded.
+func (lat *LiveArtifactsTask) uncount(size int64) {
+	task := lat.task
+	task.liveArtifactsMux.Lock()
+	defer task.liveArtifactsMux.Unlock()
+	task.liveArtifacts--
+	task.liveArtifactsSize -= size
+}
+
+// release releases the reservation of the given artifact name, after the
+// artifact could not be uploaded, so that the upload can be retried.
+func (lat *LiveArtifactsTask) release(name string) {
+	lat.mutex.Lock()
+	defer lat.mutex.Unlock()
+	delete(lat.uploaded, name)
+}
+
+// liveArtifactFile opens the regular file at the given path relative to the
+// task directory, or returns an error if it is not inside the task
+// directory.
+func liveArtifactFile(path string) (*os.File, *liveArtifactError) {
+	if filepath.IsAbs(path) {
+		return nil, badLiveArtifactRequest("Path %v is not relative to the task directory", path)
+	}
+	// the worker may run as root, so must not follow symbolic links that
+	// task commands could swap into the path
+	file, err := fileutil.OpenInDir(taskContext.TaskDir, path)
+	if err == fileutil.ErrOutsideDir {
+		return nil, badLiveArtifactRequest("File %v is not inside the task directory", path)
+	}
+	if err != nil {
+		return nil, badLiveArtifactRequest("Could not read file %v: %v", path, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, badLiveArtifactRequest("Could not read file %v: %v", path, err)
+	}
+	if !info.Mode().IsRegular() {
+		file.Close()
+		return nil, badLiveArtifactRequest("%v is not a regular file", path)
+	}
+	return file, nil
+}
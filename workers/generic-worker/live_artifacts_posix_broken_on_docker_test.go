@@ -0,0 +1,112 @@
+// +build darwin,!docker linux,!docker freebsd
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLiveArtifactUploadedWhileTaskRunning(t *testing.T) {
+	_, teardown := setupWithFakeServices(t)
+	defer teardown()
+
+	command := [][]string{
+		{
+			"/bin/bash",
+			"-c",
+			`echo 'early result' > result.txt && ln -s /etc/passwd passwd && ln -s /etc etc`,
+		},
+	}
+	command = append(command, goRun("upload-artifact.go", "result.txt", "public/result.txt")...)
+	command = append(command,
+		[]string{"go", "run", "upload-artifact.go", "result.txt", "public/result.txt"},
+		[]string{"go", "run", "upload-artifact.go", "result.txt", "public/logs/live_backing.log"},
+		[]string{"go", "run", "upload-artifact.go", "result.txt", "public/other.txt", "wrong-token"},
+		[]string{"go", "run", "upload-artifact.go", "../result.txt", "public/outside.txt"},
+		[]string{"go", "run", "upload-artifact.go", "passwd", "public/passwd.txt"},
+		[]string{"go", "run", "upload-artifact.go", "etc/passwd", "public/etc-passwd.txt"},
+		// the uploaded content must not change after the upload
+		[]string{"/bin/bash", "-c", `echo 'late result' > result.txt`},
+	)
+	payload := GenericWorkerPayload{
+		Command:    command,
+		MaxRunTime: 180,
+		Features: FeatureFlags{
+			LiveArtifacts: true,
+		},
+	}
+	td := testTask(t)
+
+	taskID := submitAndAssert(t, td, payload, "completed", "completed")
+
+	logtext, _, _, _ := getArtifactContent(t, taskID, "public/logs/live_backing.log")
+	for _, expected := range []string{
+		"Upload of public/result.txt returned status code 200: Uploaded artifact public/result.txt",
+		"Upload of public/result.txt returned status code 409: Artifact public/result.txt has already been uploaded",
+		"Upload of public/logs/live_backing.log returned status code 409: Artifact name public/logs/live_backing.log is reserved by feature",
+		"Upload of public/other.txt returned status code 401",
+		"Upload of public/outside.txt returned status code 400",
+		"Upload of public/passwd.txt returned status code 400: Could not read file passwd: passwd is a symbolic link",
+		"Upload of public/etc-passwd.txt returned status code 400: Could not read file etc/passwd: etc is a symbolic link",
+	} {
+		if !strings.Contains(string(logtext), expected) {
+			t.Fatalf("Expected task log to contain %q:\n%s", expected, logtext)
+		}
+	}
+	content, _, _, _ := getArtifactContent(t, taskID, "public/result.txt")
+	if string(content) != "early result\n" {
+		t.Fatalf("Expected live artifact to have content of file at time of upload, but got %q", content)
+	}
+}
+
+func TestLiveArtifactsCountTowardsArtifactLimits(t *testing.T) {
+	_, teardown := setupWithFakeServices(t)
+	defer teardown()
+	config.MaxArtifacts = 2
+	config.MaxArtifactSizeMegabytes = 1
+
+	command := [][]string{
+		{
+			"/bin/bash",
+			"-c",
+			`echo 'result' > result.txt && head -c 2097152 /dev/zero > big.bin`,
+		},
+	}
+	command = append(command, goRun("upload-artifact.go", "big.bin", "public/big.bin")...)
+	command = append(command,
+		[]string{"go", "run", "upload-artifact.go", "result.txt", "public/first.txt"},
+		[]string{"go", "run", "upload-artifact.go", "result.txt", "public/second.txt"},
+		[]string{"go", "run", "upload-artifact.go", "result.txt", "public/third.txt"},
+	)
+	payload := GenericWorkerPayload{
+		Command: command,
+		Artifacts: []Artifact{
+			{
+				Path: "result.txt",
+				Name: "public/result.txt",
+				Type: "file",
+			},
+		},
+		MaxRunTime: 180,
+		Features: FeatureFlags{
+			LiveArtifacts: true,
+		},
+	}
+	td := testTask(t)
+
+	taskID := submitAndAssert(t, td, payload, "failed", "failed")
+
+	logtext, _, _, _ := getArtifactContent(t, taskID, "public/logs/live_backing.log")
+	for _, expected := range []string{
+		"Upload of public/big.bin returned status code 413: File is 2097152 bytes, which exceeds the artifact size limit of 1048576 bytes",
+		"Upload of public/first.txt returned status code 200",
+		"Upload of public/second.txt returned status code 200",
+		"Upload of public/third.txt returned status code 409: Task has already uploaded 2 live artifacts, which is the limit of 2 artifacts",
+		"Task payload artifacts include 1 artifacts, which together with 2 live artifacts exceeds the limit of 2 artifacts:",
+	} {
+		if !strings.Contains(string(logtext), expected) {
+			t.Fatalf("Expected task log to contain %q:\n%s", expected, logtext)
+		}
+	}
+}
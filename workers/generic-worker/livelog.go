@@ -5,7 +5,6 @@ import (
 	"io"
 	"log"
 	"net/url"
-	"os"
 	"time"
 
 	tcurls "github.com/taskcluster/taskcluster-lib-urls"
@@ -45,7 +44,7 @@ type LiveLogTask struct {
 	liveLog        *livelog.LiveLog
 	exposure       expose.Exposure
 	task           *TaskRun
-	backingLogFile *os.File
+	backingLogFile *TaskLog
 }
 
 func (l *LiveLogTask) ReservedArtifacts() []string {
@@ -89,7 +88,7 @@ func (l *LiveLogTask) updateTaskLogWriter(liveLogWriter io.Writer) *CommandExecu
 	l.task.logMux.Lock()
 	defer l.task.logMux.Unlock()
 	// store current writer so it can be reinstated later when stopping livelog
-	l.backingLogFile = l.task.logWriter.(*os.File)
+	l.backingLogFile = l.task.logWriter.(*TaskLog)
 	// write logs written so far to livelog
 	// first rewind to beginning of backing log...
 	_, err := l.backingLogFile.Seek(0, 0)
@@ -106,7 +105,11 @@ func (l *LiveLogTask) updateTaskLogWriter(liveLogWriter io.Writer) *CommandExecu
 		return nil
 	}
 	// from now on, all output should go to both the backing log and the livelog...
-	l.task.logWriter = io.MultiWriter(liveLogWriter, l.backingLogFile)
+	l.task.logWriter = &liveLogMultiWriter{
+		Writer:     io.MultiWriter(liveLogWriter, l.backingLogFile),
+		liveLog:    liveLogWriter,
+		backingLog: l.backingLogFile,
+	}
 
 	// make sure task also logs to the new multiwriter
 	setCommandLogWriters(l.task.Commands, l.task.logWriter)
@@ -203,3 +206,20 @@ func setCommandLogWriters(commands []*process.Command, logWriter io.Writer) {
 		commands[i].DirectOutput(logWriter)
 	}
 }
+
+// liveLogMultiWriter writes to both the livelog and the backing log, and
+// passes messages from the worker on to the backing log as such, so that
+// they are still written when the backing log is truncated.
+type liveLogMultiWriter struct {
+	io.Writer
+	liveLog    io.Writer
+	backingLog *TaskLog
+}
+
+func (w *liveLogMultiWriter) WriteWorkerMessage(p []byte) (int, error) {
+	n, err := w.liveLog.Write(p)
+	if err != nil {
+		return n, err
+	}
+	return w.backingLog.WriteWorkerMessage(p)
+}
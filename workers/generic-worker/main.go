@@ -12,6 +12,7 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -29,6 +30,7 @@ import (
 	sysinfo "github.com/elastic/go-sysinfo"
 	tcclient "github.com/taskcluster/taskcluster/v28/clients/client-go"
 	"github.com/taskcluster/taskcluster/v28/clients/client-go/tcqueue"
+	"github.com/taskcluster/taskcluster/v28/clients/client-go/tcworkermanager"
 	"github.com/taskcluster/taskcluster/v28/internal/scopes"
 	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/expose"
 	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/fileutil"
@@ -52,6 +54,8 @@ var (
 	configureForGCP bool
 	// Whether we are running in Azure
 	configureForAzure bool
+	// Absolute path of the generic-worker config file
+	configFilePath string
 	// General platform independent user settings, such as home directory, username...
 	// Platform specific data should be managed in plat_<platform>.go files
 	taskContext = &TaskContext{}
@@ -79,15 +83,24 @@ func persistFeaturesState() (err error) {
 	return nil
 }
 
-func initialiseFeatures() (err error) {
-	Features = []Feature{
+// allFeatures returns the features of this engine and platform, in the
+// order that they start.
+func allFeatures() []Feature {
+	features := []Feature{
 		&LiveLogFeature{},
 		&TaskclusterProxyFeature{},
 		&OSGroupsFeature{},
 		&MountsFeature{},
 		&SupersedeFeature{},
+		&StepsFeature{},
+		&TestResultsFeature{},
+		&SecretScanningFeature{},
 	}
-	Features = append(Features, platformFeatures()...)
+	return append(features, platformFeatures()...)
+}
+
+func initialiseFeatures() (err error) {
+	Features = allFeatures()
 	for _, feature := range Features {
 		log.Printf("Initialising task feature %v...", feature.Name())
 		err := feature.Initialise()
@@ -144,6 +157,7 @@ func main() {
 
 		configFileAbs, err := filepath.Abs(arguments["--config"].(string))
 		exitOnError(CANT_LOAD_CONFIG, err, "Cannot determine absolute path location for generic-worker config file '%v'", arguments["--config"])
+		configFilePath = configFileAbs
 
 		configFile := &gwconfig.File{
 			Path: configFileAbs,
@@ -211,11 +225,55 @@ func main() {
 			if config.ShutdownMachineOnInternalError {
 				host.ImmediateShutdown("generic-worker internal error")
 			}
+		case HOST_UNHEALTHY:
+			logEvent("instanceShutdown", nil, time.Now())
+			if config.ShutdownMachineOnInternalError {
+				host.ImmediateShutdown("generic-worker host unhealthy")
+			}
+		case WORKER_QUARANTINED:
+			logEvent("instanceShutdown", nil, time.Now())
+			if config.ShutdownMachineOnInternalError {
+				host.ImmediateShutdown("generic-worker quarantined")
+			}
 		case NONCURRENT_DEPLOYMENT_ID:
 			logEvent("instanceShutdown", nil, time.Now())
 			host.ImmediateShutdown("generic-worker deploymentId is not latest")
 		}
 		os.Exit(int(exitCode))
+	case arguments["run-task"]:
+		configFileAbs, err := filepath.Abs(arguments["--config"].(string))
+		exitOnError(CANT_LOAD_CONFIG, err, "Cannot determine absolute path location for generic-worker config file '%v'", arguments["--config"])
+		configFilePath = configFileAbs
+		configFile := &gwconfig.File{
+			Path: configFileAbs,
+		}
+		exitCode := runTask(configFile, arguments["--payload"].(string), arguments["--artifacts-dir"].(string), arguments["--scope"].([]string))
+		log.Printf("Exiting worker with exit code %v", exitCode)
+		os.Exit(int(exitCode))
+	case arguments["validate-payload"]:
+		configFileAbs, err := filepath.Abs(arguments["--config"].(string))
+		exitOnError(CANT_LOAD_CONFIG, err, "Cannot determine absolute path location for generic-worker config file '%v'", arguments["--config"])
+		configFile := &gwconfig.File{
+			Path: configFileAbs,
+		}
+		os.Exit(int(validateTaskFile(configFile, arguments["--payload"].(string), arguments["--scope"].([]string), arguments["--json"].(bool))))
+	case arguments["history"]:
+		since, err := parseHistorySince(arguments["--since"].(string))
+		exitOnError(CANT_READ_TASK_HISTORY, err, "Invalid value for --since")
+		filter := TaskHistoryFilter{
+			Since: since,
+		}
+		if taskID, ok := arguments["--task-id"].(string); ok {
+			filter.TaskID = taskID
+		}
+		if state, ok := arguments["--state"].(string); ok {
+			filter.State = state
+		}
+		if last, ok := arguments["--last"].(string); ok {
+			filter.Last, err = strconv.Atoi(last)
+			exitOnError(CANT_READ_TASK_HISTORY, err, "Invalid value %q for --last", last)
+		}
+		os.Exit(int(showTaskHistory(filter, arguments["--json"].(bool))))
 	case arguments["install"]:
 		// platform specific...
 		err := install(arguments)
@@ -235,6 +293,17 @@ func loadConfig(configFile *gwconfig.File, provider Provider) (gwconfig.Provider
 	if err != nil {
 		return nil, err
 	}
+	err = applyConfig(configFile, configProvider)
+	if err != nil {
+		return nil, err
+	}
+	return configProvider, nil
+}
+
+// applyConfig sets the global config to the default config, overlaid with
+// values from configFile, or if configFile does not exist, from
+// configProvider.
+func applyConfig(configFile *gwconfig.File, configProvider gwconfig.Provider) (err error) {
 
 	// first assign defaults
 
@@ -242,35 +311,69 @@ func loadConfig(configFile *gwconfig.File, provider Provider) (gwconfig.Provider
 	// only one place if possible (defaults also declared in `usage`)
 	config = &gwconfig.Config{
 		PublicConfig: gwconfig.PublicConfig{
-			AuthRootURL:                    "",
-			CachesDir:                      "caches",
-			CheckForNewDeploymentEverySecs: 1800,
-			CleanUpTaskDirs:                true,
-			DisableReboots:                 false,
-			DownloadsDir:                   "downloads",
-			IdleTimeoutSecs:                0,
-			LiveLogExecutable:              "livelog",
-			LiveLogGETPort:                 60023,
-			LiveLogPUTPort:                 60022,
-			NumberOfTasksToRun:             0,
-			ProvisionerID:                  "test-provisioner",
-			PurgeCacheRootURL:              "",
-			QueueRootURL:                   "",
-			RequiredDiskSpaceMegabytes:     10240,
-			RootURL:                        "",
-			RunAfterUserCreation:           "",
-			SecretsRootURL:                 "",
-			SentryProject:                  "generic-worker",
-			ShutdownMachineOnIdle:          false,
-			ShutdownMachineOnInternalError: false,
-			Subdomain:                      "taskcluster-worker.net",
-			TaskclusterProxyExecutable:     "taskcluster-proxy",
-			TaskclusterProxyPort:           80,
-			TasksDir:                       defaultTasksDir(),
-			WorkerGroup:                    "test-worker-group",
-			WorkerLocation:                 "",
-			WorkerManagerRootURL:           "",
-			WorkerTypeMetadata:             map[string]interface{}{},
+			AuthRootURL:                       "",
+			CachesDir:                         "caches",
+			CheckForNewDeploymentEverySecs:    1800,
+			CleanUpTaskDirs:                   true,
+			DisableReboots:                    false,
+			DownloadsDir:                      "downloads",
+			HealthCheckCommands:               []string{},
+			HealthCheckIntervalSecs:           60,
+			HealthCheckMaxClockSkewSecs:       0,
+			HealthCheckMaxFailureSecs:         0,
+			HealthCheckMaxWorkerFailures:      0,
+			HealthCheckMinFreeDiskMegabytes:   0,
+			HealthCheckMinFreeInodes:          0,
+			HealthCheckMinFreeMemoryMegabytes: 0,
+			HealthCheckRequiredExecutables:    []string{},
+			HealthCheckTimeoutSecs:            60,
+			HealthCheckWorkerFailuresSecs:     3600,
+			IdleTimeoutSecs:                   0,
+			LiveArtifactsPort:                 60024,
+			LiveLogExecutable:                 "livelog",
+			LiveLogGETPort:                    60023,
+			LiveLogPUTPort:                    60022,
+			MaxArtifacts:                      0,
+			MaxArtifactSizeMegabytes:          0,
+			MaxConcurrentMounts:               4,
+			MaxTaskLogSizeMegabytes:           0,
+			MaxTotalArtifactsSizeMegabytes:    0,
+			MountContentCacheRetryTimeoutSecs: 60,
+			MountContentCacheURL:              "",
+			MountDownloadRetryTimeoutSecs:     900,
+			NetworkIsolation:                  "disabled",
+			NetworkIsolationEgressAllowlist:   []string{},
+			NetworkIsolationSubnet:            "10.213.0.0/30",
+			NumberOfTasksToRun:                0,
+			PostTaskHook:                      "",
+			PreTaskHook:                       "",
+			PrewarmCaches:                     []gwconfig.PrewarmCache{},
+			ProvisionerID:                     "test-provisioner",
+			PurgeCacheRootURL:                 "",
+			QuarantineAfterFailures:           0,
+			QuarantineDurationSecs:            86400,
+			QueueRootURL:                      "",
+			RequiredDiskSpaceMegabytes:        10240,
+			RootURL:                           "",
+			RunAfterUserCreation:              "",
+			SecretScanning:                    "optional",
+			SecretScanningAction:              "error",
+			SecretScanningDetectors:           []string{"privateKey", "taskclusterAccessToken"},
+			SecretScanningPatterns:            []string{},
+			SecretsRootURL:                    "",
+			SentryProject:                     "generic-worker",
+			ShutdownMachineOnIdle:             false,
+			ShutdownMachineOnInternalError:    false,
+			Subdomain:                         "taskcluster-worker.net",
+			TaskclusterProxyExecutable:        "taskcluster-proxy",
+			TaskclusterProxyPort:              80,
+			TaskHookTimeoutSecs:               300,
+			TaskMetadataPort:                  60025,
+			TasksDir:                          defaultTasksDir(),
+			WorkerGroup:                       "test-worker-group",
+			WorkerLocation:                    "",
+			WorkerManagerRootURL:              "",
+			WorkerTypeMetadata:                map[string]interface{}{},
 		},
 	}
 
@@ -283,7 +386,7 @@ func loadConfig(configFile *gwconfig.File, provider Provider) (gwconfig.Provider
 	}
 
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	// Add useful worker config to worker metadata
@@ -303,7 +406,7 @@ func loadConfig(configFile *gwconfig.File, provider Provider) (gwconfig.Provider
 		gwMetadata["source"] = "https://github.com/taskcluster/taskcluster/commits/" + revision
 	}
 	config.WorkerTypeMetadata["generic-worker"] = gwMetadata
-	return configProvider, nil
+	return nil
 }
 
 func ConfigProvider(configFile *gwconfig.File, provider Provider) (gwconfig.Provider, error) {
@@ -450,6 +553,15 @@ func RunWorker() (exitCode ExitCode) {
 	// Queue is the object we will use for accessing queue api
 	queue = config.Queue()
 
+	recoverInterruptedTask()
+
+	// consecutive task runs that have failed due to a problem with the worker
+	workerFailures := recentWorkerFailures()
+	if shouldQuarantine(workerFailures) {
+		quarantineWorker(workerFailures)
+		return WORKER_QUARANTINED
+	}
+
 	err = initialiseFeatures()
 	if err != nil {
 		panic(err)
@@ -467,6 +579,8 @@ func RunWorker() (exitCode ExitCode) {
 	// use zero value, to be sure that a check is made before first task runs
 	lastCheckedDeploymentID := time.Time{}
 	lastReportedNoTasks := time.Now()
+	preTaskHookCompleted := false
+	hostHealth := NewHostHealth()
 	sigInterrupt := make(chan os.Signal, 1)
 	signal.Notify(sigInterrupt, os.Interrupt)
 	if RotateTaskEnvironment() {
@@ -490,7 +604,44 @@ func RunWorker() (exitCode ExitCode) {
 			panic(err)
 		}
 
-		task := ClaimWork()
+		// don't claim tasks while health checks fail
+		healthy := hostHealth.Healthy()
+		if !healthy && config.HealthCheckMaxFailureSecs > 0 && hostHealth.UnhealthyFor() > time.Duration(config.HealthCheckMaxFailureSecs)*time.Second {
+			log.Printf("Health checks have failed for %v, exceeding healthCheckMaxFailureSecs (%v)", hostHealth.UnhealthyFor(), config.HealthCheckMaxFailureSecs)
+			reportWorkerError(
+				"health-checks-failed",
+				"Health checks failed",
+				fmt.Sprintf("Worker %v/%v will not claim any more tasks, since its health checks have failed for %v:\n\n  * %v", config.WorkerGroup, config.WorkerID, hostHealth.UnhealthyFor(), strings.Join(hostHealth.Failures(), "\n  * ")),
+				map[string]interface{}{
+					"failedHealthChecks": hostHealth.Failures(),
+				},
+			)
+			return HOST_UNHEALTHY
+		}
+
+		// the pre-task hook runs once before each task is claimed, rather than
+		// before every claimWork call
+		if healthy && !preTaskHookCompleted {
+			err := runPreTaskHook()
+			if err != nil {
+				log.Printf("%v", err)
+				reportWorkerError(
+					"pre-task-hook-failed",
+					"Pre-task hook failed",
+					fmt.Sprintf("Worker %v/%v will not claim any more tasks, since its pre-task hook failed: %v", config.WorkerGroup, config.WorkerID, err),
+					map[string]interface{}{
+						"preTaskHook": config.PreTaskHook,
+					},
+				)
+				return HOST_UNHEALTHY
+			}
+			preTaskHookCompleted = true
+		}
+
+		var task *TaskRun
+		if healthy {
+			task = ClaimWork()
+		}
 
 		// make sure at least 5 seconds pass between tcqueue.ClaimWork API calls
 		wait5Seconds := time.NewTimer(time.Second * 5)
@@ -499,8 +650,16 @@ func RunWorker() (exitCode ExitCode) {
 			logEvent("taskQueued", task, time.Time(task.Definition.Created))
 			logEvent("taskStart", task, time.Now())
 
+			historyEntry := newTaskHistoryEntry(task)
+			untrackRunningTask := trackRunningTask(task, historyEntry)
 			errors := task.Run()
+			untrackRunningTask()
 			logEvent("taskFinish", task, time.Now())
+			historyEntry.finish(task, errors)
+			err = appendTaskHistory(historyEntry)
+			if err != nil {
+				log.Printf("WARNING: could not record task in task history file %v: %v", taskHistoryFile, err)
+			}
 			if errors.Occurred() {
 				log.Printf("ERROR(s) encountered: %v", errors)
 				task.Error(errors.Error())
@@ -516,7 +675,19 @@ func RunWorker() (exitCode ExitCode) {
 			if err != nil {
 				panic(err)
 			}
+			runPostTaskHook(task, historyEntry)
+			preTaskHookCompleted = false
+			hostHealth.Recheck()
 			tasksResolved++
+			if isWorkerFailure(historyEntry.State, historyEntry.Reason) {
+				workerFailures = append(workerFailures, *historyEntry)
+			} else {
+				workerFailures = workerFailures[:0]
+			}
+			if shouldQuarantine(workerFailures) {
+				quarantineWorker(workerFailures)
+				return WORKER_QUARANTINED
+			}
 			// remainingTasks will be -ve, if config.NumberOfTasksToRun is not set (=0)
 			remainingTasks := int(config.NumberOfTasksToRun - tasksResolved)
 			remainingTaskCountText := ""
@@ -590,6 +761,30 @@ func deploymentIDUpdated() bool {
 	return false
 }
 
+// reportWorkerError reports a problem with this worker to the worker manager,
+// so that it is visible in the worker pool errors. Errors are logged, since
+// the worker is typically about to exit anyway.
+func reportWorkerError(kind, title, description string, extra interface{}) {
+	extraJSON, err := json.Marshal(extra)
+	if err != nil {
+		panic(err)
+	}
+	_, err = config.WorkerManager().ReportWorkerError(
+		config.ProvisionerID+"/"+config.WorkerType,
+		&tcworkermanager.WorkerErrorReport{
+			Description: description,
+			Extra:       json.RawMessage(extraJSON),
+			Kind:        kind,
+			Title:       title,
+			WorkerGroup: config.WorkerGroup,
+			WorkerID:    config.WorkerID,
+		},
+	)
+	if err != nil {
+		log.Printf("WARNING: could not report worker error to worker manager: %v", err)
+	}
+}
+
 // ClaimWork queries the Queue to find a task.
 func ClaimWork() *TaskRun {
 	// only log workerReady the first time queue.claimWork is called
@@ -624,35 +819,39 @@ func ClaimWork() *TaskRun {
 	// exactly one task - process it!
 	default:
 		log.Print("Task found")
-		taskResponse := resp.Tasks[0]
-		taskQueue := tcqueue.New(
-			&tcclient.Credentials{
-				ClientID:    taskResponse.Credentials.ClientID,
-				AccessToken: taskResponse.Credentials.AccessToken,
-				Certificate: taskResponse.Credentials.Certificate,
-			},
-			config.RootURL,
-		)
-		// if queueRootURL is configured, this takes precedence over rootURL
-		if config.QueueRootURL != "" {
-			taskQueue.RootURL = config.QueueRootURL
-		}
-		task := &TaskRun{
-			TaskID:            taskResponse.Status.TaskID,
-			RunID:             uint(taskResponse.RunID),
-			Status:            claimed,
-			Definition:        taskResponse.Task,
-			Queue:             taskQueue,
-			TaskClaimResponse: tcqueue.TaskClaimResponse(taskResponse),
-			Artifacts:         map[string]TaskArtifact{},
-			featureArtifacts: map[string]string{
-				logName: "Native Log",
-			},
-			LocalClaimTime: localClaimTime,
-		}
-		task.StatusManager = NewTaskStatusManager(task)
-		return task
+		return taskFromClaim(resp.Tasks[0], localClaimTime)
+	}
+}
+
+// taskFromClaim returns a TaskRun for a task claimed from the queue.
+func taskFromClaim(taskResponse tcqueue.TaskClaim, localClaimTime time.Time) *TaskRun {
+	taskQueue := tcqueue.New(
+		&tcclient.Credentials{
+			ClientID:    taskResponse.Credentials.ClientID,
+			AccessToken: taskResponse.Credentials.AccessToken,
+			Certificate: taskResponse.Credentials.Certificate,
+		},
+		config.RootURL,
+	)
+	// if queueRootURL is configured, this takes precedence over rootURL
+	if config.QueueRootURL != "" {
+		taskQueue.RootURL = config.QueueRootURL
+	}
+	task := &TaskRun{
+		TaskID:            taskResponse.Status.TaskID,
+		RunID:             uint(taskResponse.RunID),
+		Status:            claimed,
+		Definition:        taskResponse.Task,
+		Queue:             taskQueue,
+		TaskClaimResponse: tcqueue.TaskClaimResponse(taskResponse),
+		Artifacts:         map[string]TaskArtifact{},
+		featureArtifacts: map[string]string{
+			logName: "Native Log",
+		},
+		LocalClaimTime: localClaimTime,
 	}
+	task.StatusManager = NewTaskStatusManager(task)
+	return task
 }
 
 func (task *TaskRun) validatePayload() *CommandExecutionError {
@@ -703,7 +902,10 @@ func (task *TaskRun) validatePayload() *CommandExecutionError {
 	if err != nil {
 		return MalformedPayloadError(err)
 	}
-	for _, artifact := range task.Payload.Artifacts {
+	if cee := task.expandSteps(); cee != nil { // platform specific
+		return cee
+	}
+	for i, artifact := range task.Payload.Artifacts {
 		// The default artifact expiry is task expiry, but is only applied when
 		// the task artifacts are resolved. We intentionally don't modify
 		// task.Payload otherwise it no longer reflects the real data defined
@@ -712,12 +914,12 @@ func (task *TaskRun) validatePayload() *CommandExecutionError {
 			// Don't be too strict: allow 1s discrepancy to account for
 			// possible timestamp rounding on upstream systems
 			if time.Time(artifact.Expires).Add(time.Second).Before(time.Time(task.Definition.Deadline)) {
-				return MalformedPayloadError(fmt.Errorf("Malformed payload: artifact '%v' expires before task deadline (%v is before %v)", artifact.Path, artifact.Expires, task.Definition.Deadline))
+				return MalformedPayloadError(atPayloadValue(fmt.Sprintf("/artifacts/%v/expires", i), fmt.Errorf("Malformed payload: artifact '%v' expires before task deadline (%v is before %v)", artifact.Path, artifact.Expires, task.Definition.Deadline)))
 			}
 			// Don't be too strict: allow 1s discrepancy to account for
 			// possible timestamp rounding on upstream systems
 			if time.Time(artifact.Expires).After(time.Time(task.Definition.Expires).Add(time.Second)) {
-				return MalformedPayloadError(fmt.Errorf("Malformed payload: artifact '%v' expires after task expiry (%v is after %v)", artifact.Path, artifact.Expires, task.Definition.Expires))
+				return MalformedPayloadError(atPayloadValue(fmt.Sprintf("/artifacts/%v/expires", i), fmt.Errorf("Malformed payload: artifact '%v' expires after task expiry (%v is after %v)", artifact.Path, artifact.Expires, task.Definition.Expires)))
 			}
 		}
 	}
@@ -780,13 +982,18 @@ func (task *TaskRun) Error(message string) {
 }
 
 // Log lines like:
-//  [taskcluster 2017-01-25T23:31:13.787Z] Hey, hey, we're The Monkees.
+//
+//	[taskcluster 2017-01-25T23:31:13.787Z] Hey, hey, we're The Monkees.
 func (task *TaskRun) Log(prefix, message string) {
 	task.logMux.RLock()
 	defer task.logMux.RUnlock()
 	if task.logWriter != nil {
 		for _, line := range strings.Split(message, "\n") {
-			_, _ = task.logWriter.Write([]byte(prefix + line + "\n"))
+			if w, ok := task.logWriter.(workerMessageWriter); ok {
+				_, _ = w.WriteWorkerMessage([]byte(prefix + line + "\n"))
+			} else {
+				_, _ = task.logWriter.Write([]byte(prefix + line + "\n"))
+			}
 		}
 	} else {
 		log.Print("Unloggable task log message (no task log writer): " + message)
@@ -807,35 +1014,46 @@ func (task *TaskRun) IsIntermittentExitCode(c int64) bool {
 }
 
 func (task *TaskRun) ExecuteCommand(index int) *CommandExecutionError {
-	task.Infof("Executing command %v: %v", index, task.formatCommand(index))
+	task.Infof("Executing %v: %v", task.commandDescription(index), task.formatCommand(index))
 	log.Print("Executing command " + strconv.Itoa(index) + ": " + task.Commands[index].String())
 	cee := task.prepareCommand(index)
 	if cee != nil {
 		panic(cee)
 	}
+	started := time.Now()
+	stopStepTimer := task.setStepTimer(index)
 	result := task.Commands[index].Execute()
+	stepTimedOut := stopStepTimer()
+	exitCode := int64(result.ExitCode())
+	task.exitCodes = append(task.exitCodes, exitCode)
+	task.Infof("%v", result)
 	if ae := task.StatusManager.AbortException(); ae != nil {
+		task.recordStep(index, started, result.Duration, exitCode, "aborted")
 		return ae
 	}
-	task.Infof("%v", result)
 
 	switch {
+	case stepTimedOut && result.Failed():
+		task.recordStep(index, started, result.Duration, exitCode, "timed-out")
+		return task.stepError(index, Failure(fmt.Errorf("%v exceeded its timeout of %v", task.commandDescription(index), task.step(index).Timeout)))
 	case result.Failed():
+		task.recordStep(index, started, result.Duration, exitCode, "failed")
 		if task.IsIntermittentExitCode(int64(result.ExitCode())) {
-			return &CommandExecutionError{
+			return task.stepError(index, &CommandExecutionError{
 				Cause:      fmt.Errorf("Task appears to have failed intermittently - exit code %v found in task payload.onExitStatus list", result.ExitCode()),
 				Reason:     intermittentTask,
 				TaskStatus: errored,
-			}
+			})
 		} else {
-			return &CommandExecutionError{
+			return task.stepError(index, &CommandExecutionError{
 				Cause:      result.FailureCause(),
 				TaskStatus: failed,
-			}
+			})
 		}
 	case result.Crashed():
 		panic(result.CrashCause())
 	}
+	task.recordStep(index, started, result.Duration, exitCode, "succeeded")
 	return nil
 }
 
@@ -891,13 +1109,21 @@ func (task *TaskRun) resolve(e *ExecutionErrors) *CommandExecutionError {
 	return ResourceUnavailable(task.StatusManager.ReportException((*e)[0].Reason))
 }
 
+// errMaxRunTimeExceeded is the cause of the abort exception of a task that
+// exceeds its max run time
+var errMaxRunTimeExceeded = errors.New("Task aborted - max run time exceeded")
+
 func (task *TaskRun) setMaxRunTimer() *time.Timer {
+	maxRunTime := time.Second * time.Duration(task.Payload.MaxRunTime)
+	task.maxRunTimeMux.Lock()
+	task.maxRunTimeDeadline = time.Now().Add(maxRunTime)
+	task.maxRunTimeMux.Unlock()
 	return time.AfterFunc(
-		time.Second*time.Duration(task.Payload.MaxRunTime),
+		maxRunTime,
 		func() {
 			// ignore any error the Abort function returns - we are in the
 			// wrong go routine to properly handle it
-			err := task.StatusManager.Abort(Failure(fmt.Errorf("Task aborted - max run time exceeded")))
+			err := task.StatusManager.Abort(Failure(errMaxRunTimeExceeded))
 			if err != nil {
 				task.Warnf("Error when aborting task: %v", err)
 			}
@@ -905,9 +1131,17 @@ func (task *TaskRun) setMaxRunTimer() *time.Timer {
 	)
 }
 
-func (task *TaskRun) kill() {
+// kill terminates the task commands, allowing them the grace period
+// requested in the task payload to exit, before they are killed. timedOut
+// should be true if the task is being aborted since it exceeded its max run
+// time.
+func (task *TaskRun) kill(timedOut bool) {
+	gracePeriod := task.gracePeriod()
+	if gracePeriod > 0 {
+		task.Infof("Sending SIGTERM to task commands, which will be killed if still running after grace period of %v", gracePeriod)
+	}
 	for _, command := range task.Commands {
-		output, err := command.Kill()
+		output, err := command.Terminate(gracePeriod, timedOut)
 		if len(output) > 0 {
 			task.Info(string(output))
 		}
@@ -918,16 +1152,35 @@ func (task *TaskRun) kill() {
 	}
 }
 
-func (task *TaskRun) createLogFile() *os.File {
+func (task *TaskRun) createLogFile() *TaskLog {
 	absLogFile := filepath.Join(taskContext.TaskDir, logPath)
 	logFileHandle, err := os.Create(absLogFile)
 	if err != nil {
 		panic(err)
 	}
+	taskLog := NewTaskLog(logFileHandle, int64(config.MaxTaskLogSizeMegabytes)*1024*1024)
 	task.logMux.Lock()
 	defer task.logMux.Unlock()
-	task.logWriter = logFileHandle
-	return logFileHandle
+	task.logWriter = taskLog
+	return taskLog
+}
+
+// applyLogLimits lowers the maximum size of the task log, if requested in
+// the task payload. The payload cannot raise the limit configured on the
+// worker.
+func (task *TaskRun) applyLogLimits(taskLog *TaskLog) {
+	maxSize := int64(config.MaxTaskLogSizeMegabytes) * 1024 * 1024
+	if requested := task.Payload.Logs.MaxSizeMegabytes * 1024 * 1024; requested > 0 {
+		if maxSize == 0 || requested < maxSize {
+			maxSize = requested
+		} else if requested > maxSize {
+			task.Warnf("Task log size limit of %v megabytes requested in task payload exceeds worker limit of %v megabytes; using worker limit", task.Payload.Logs.MaxSizeMegabytes, config.MaxTaskLogSizeMegabytes)
+		}
+	}
+	if maxSize > 0 {
+		task.Infof("Task log will be truncated if it exceeds %v bytes", maxSize)
+	}
+	taskLog.SetLimits(maxSize, task.Payload.Logs.KeepTail)
 }
 
 func (task *TaskRun) logHeader() {
@@ -941,6 +1194,66 @@ func (task *TaskRun) logHeader() {
 	task.Info("=== Task Starting ===")
 }
 
+// TaskFeatureOrigin tracks which Feature created which TaskFeature
+type TaskFeatureOrigin struct {
+	taskFeature TaskFeature
+	feature     Feature
+}
+
+// createTaskFeatures creates the task features of the enabled features,
+// checking that they accept the task payload, that the task has the scopes
+// that they require, and that they don't reserve the same artifact names.
+// Problems are added to err, so that all of them are reported together.
+func (task *TaskRun) createTaskFeatures(err *ExecutionErrors) []TaskFeatureOrigin {
+	taskFeatureOrigins := []TaskFeatureOrigin{}
+	for _, feature := range Features {
+		if feature.IsEnabled(task) {
+			log.Printf("Creating task feature %v...", feature.Name())
+			taskFeature := feature.NewTaskFeature(task)
+			if validator, ok := taskFeature.(PayloadValidator); ok {
+				// the required scopes of a task feature can't be relied on if
+				// it doesn't accept the task payload
+				if e := validator.ValidatePayload(); e != nil {
+					err.add(e)
+					continue
+				}
+			}
+			requiredScopes := taskFeature.RequiredScopes()
+			scopesSatisfied, scopeValidationErr := scopes.Given(task.Definition.Scopes).Satisfies(requiredScopes, config.Auth())
+			if scopeValidationErr != nil {
+				// presumably we couldn't expand assume:* scopes due to auth
+				// service unavailability
+				err.add(ResourceUnavailable(scopeValidationErr))
+				continue
+			}
+			if !scopesSatisfied {
+				err.add(MalformedPayloadError(fmt.Errorf("Feature %q requires scopes:\n\n%v\n\nbut task only has scopes:\n\n%v\n\nYou probably should add some scopes to your task definition", feature.Name(), requiredScopes, scopes.Given(task.Definition.Scopes))))
+				continue
+			}
+			reservedArtifacts := taskFeature.ReservedArtifacts()
+			for _, a := range reservedArtifacts {
+				if f := task.featureArtifacts[a]; f != "" {
+					clash := fmt.Errorf("Feature %q wishes to publish artifact %v but feature %v has already reserved this artifact name", feature.Name(), a, f)
+					if locator, ok := taskFeature.(ReservedArtifactLocator); ok && locator.ReservedArtifactPointer(a) != "" {
+						clash = atPayloadValue(locator.ReservedArtifactPointer(a), clash)
+					}
+					err.add(MalformedPayloadError(clash))
+				} else {
+					task.featureArtifacts[a] = feature.Name()
+				}
+			}
+			taskFeatureOrigins = append(
+				taskFeatureOrigins,
+				TaskFeatureOrigin{
+					taskFeature: taskFeature,
+					feature:     feature,
+				},
+			)
+		}
+	}
+	return taskFeatureOrigins
+}
+
 func (task *TaskRun) Run() (err *ExecutionErrors) {
 
 	// err is essentially a list of all errors that occur. We'll base the task
@@ -964,6 +1277,9 @@ func (task *TaskRun) Run() (err *ExecutionErrors) {
 
 	logHandle := task.createLogFile()
 	defer func() {
+		if logHandle.Truncated() && task.Payload.Logs.FailOnTruncation {
+			err.add(Failure(fmt.Errorf("Task log exceeded its maximum size of %v bytes", logHandle.MaxSize())))
+		}
 		// log any errors that occurred
 		if err.Occurred() {
 			task.Error(err.Error())
@@ -984,6 +1300,7 @@ func (task *TaskRun) Run() (err *ExecutionErrors) {
 	if err.Occurred() {
 		return
 	}
+	task.applyLogLimits(logHandle)
 	log.Printf("Running task %v/tasks/%v/runs/%v", config.RootURL, task.TaskID, task.RunID)
 
 	task.Commands = make([]*process.Command, len(task.Payload.Command))
@@ -994,49 +1311,10 @@ func (task *TaskRun) Run() (err *ExecutionErrors) {
 			panic(err)
 		}
 	}
+	task.generateServiceCommands() // platform specific
+	task.setStepEnv()              // platform specific
 
-	// tracks which Feature created which TaskFeature
-	type TaskFeatureOrigin struct {
-		taskFeature TaskFeature
-		feature     Feature
-	}
-
-	taskFeatureOrigins := []TaskFeatureOrigin{}
-
-	// create task features
-	for _, feature := range Features {
-		if feature.IsEnabled(task) {
-			log.Printf("Creating task feature %v...", feature.Name())
-			taskFeature := feature.NewTaskFeature(task)
-			requiredScopes := taskFeature.RequiredScopes()
-			scopesSatisfied, scopeValidationErr := scopes.Given(task.Definition.Scopes).Satisfies(requiredScopes, config.Auth())
-			if scopeValidationErr != nil {
-				// presumably we couldn't expand assume:* scopes due to auth
-				// service unavailability
-				err.add(ResourceUnavailable(scopeValidationErr))
-				continue
-			}
-			if !scopesSatisfied {
-				err.add(MalformedPayloadError(fmt.Errorf("Feature %q requires scopes:\n\n%v\n\nbut task only has scopes:\n\n%v\n\nYou probably should add some scopes to your task definition", feature.Name(), requiredScopes, scopes.Given(task.Definition.Scopes))))
-				continue
-			}
-			reservedArtifacts := taskFeature.ReservedArtifacts()
-			for _, a := range reservedArtifacts {
-				if f := task.featureArtifacts[a]; f != "" {
-					err.add(MalformedPayloadError(fmt.Errorf("Feature %q wishes to publish artifact %v but feature %v has already reserved this artifact name", feature.Name(), a, f)))
-				} else {
-					task.featureArtifacts[a] = feature.Name()
-				}
-			}
-			taskFeatureOrigins = append(
-				taskFeatureOrigins,
-				TaskFeatureOrigin{
-					taskFeature: taskFeature,
-					feature:     feature,
-				},
-			)
-		}
-	}
+	taskFeatureOrigins := task.createTaskFeatures(err)
 	if err.Occurred() {
 		return
 	}
@@ -1060,7 +1338,15 @@ func (task *TaskRun) Run() (err *ExecutionErrors) {
 	}
 
 	defer func() {
-		for _, artifact := range task.PayloadArtifacts() {
+		artifacts := task.PayloadArtifacts()
+		// check limits before uploading anything, so that either all or none
+		// of the payload artifacts are uploaded
+		if e := task.checkArtifactLimits(artifacts); e != nil {
+			err.add(e)
+			task.Errorf("TASK FAILURE during artifact upload: %v", e)
+			return
+		}
+		for _, artifact := range artifacts {
 			// Any attempt to upload a feature artifact should be skipped
 			// but not cause a failure, since e.g. a directory artifact
 			// could include one, non-maliciously, such as a top level
@@ -1070,6 +1356,7 @@ func (task *TaskRun) Run() (err *ExecutionErrors) {
 				task.Warnf("Not uploading artifact %v found in task.payload.artifacts section, since this will be uploaded later by %v", artifact.Base().Name, feature)
 				continue
 			}
+			artifact = task.scanArtifactForSecrets(artifact)
 			err.add(task.uploadArtifact(artifact))
 			// Note - the above error only covers not being able to upload an
 			// artifact, but doesn't cover case that an artifact could not be
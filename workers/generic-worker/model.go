@@ -24,6 +24,9 @@ type (
 		Artifacts map[string]TaskArtifact `json:"-"`
 		Status    TaskStatus              `json:"-"`
 		Commands  []*process.Command      `json:"-"`
+		// ServiceCommands are the commands of the sidecar services of the
+		// task, which run alongside Commands
+		ServiceCommands []*process.Command `json:"-"`
 		// not exported
 		logMux         sync.RWMutex
 		logWriter      io.Writer
@@ -42,12 +45,45 @@ type (
 		// be useful for the user. Normally this map would get appended to by
 		// features when they are started.
 		featureArtifacts map[string]string
+		// exit codes of the task commands that have been executed
+		exitCodes []int64
+		// steps of the task payload, if it has steps rather than commands,
+		// and their outcomes
+		steps         []*taskStep
+		stepSummaries []*StepSummary
+		// scanSecrets is set if public artifacts should be scanned for
+		// secrets before they are uploaded
+		scanSecrets bool
+		// artifactsMux protects Artifacts, since live artifacts are uploaded
+		// concurrently with other artifacts
+		artifactsMux sync.Mutex
+		// maxRunTimeDeadline is when the task will be aborted for exceeding
+		// its max run time, or zero if the max run timer has not started yet.
+		// It is protected by maxRunTimeMux, since the task metadata endpoint
+		// reads it concurrently.
+		maxRunTimeDeadline time.Time
+		maxRunTimeMux      sync.Mutex
+		// limits are the artifact limits of the task, once determined
+		limits *artifactLimits
+		// liveArtifacts and liveArtifactsSize are the number and total size
+		// of the artifacts that task commands have uploaded while the task
+		// is running, which count towards the artifact limits. They, and
+		// limits, are protected by liveArtifactsMux.
+		liveArtifacts     int64
+		liveArtifactsSize int64
+		liveArtifactsMux  sync.Mutex
 	}
 
 	TaskStatus       string
 	TaskUpdateReason string
 )
 
+// allCommands returns the task commands together with the service commands,
+// for features that need to configure every process that the task runs.
+func (task *TaskRun) allCommands() []*process.Command {
+	return append(append([]*process.Command{}, task.Commands...), task.ServiceCommands...)
+}
+
 func (task *TaskRun) String() string {
 	response := fmt.Sprintf("Task Id:                 %v\n", task.TaskID)
 	response += fmt.Sprintf("Run Id:                  %v\n", task.RunID)
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+	"time"
+)
+
+// downloadMountContent downloads the mount content at the given url to file.
+// If config setting mountContentCacheURL is set, and the task payload
+// declares the SHA256 of the content, the content is first requested from the
+// mount content cache, a pull-through HTTP cache that is keyed by the SHA256
+// of the content, and that fetches the content from the given url if it
+// doesn't have it already. If the content cannot be downloaded from the
+// mount content cache, or the content it serves does not have the required
+// SHA256, the content is downloaded from the given url directly instead.
+//
+// The returned SHA256 is the SHA256 of the downloaded file, which the caller
+// is responsible for checking against the required SHA256.
+func downloadMountContent(url, contentSource, file, requiredSHA256 string, task *TaskRun) (sha256 string, err error) {
+	if config.MountContentCacheURL == "" || requiredSHA256 == "" {
+		return downloadURLToFile(url, contentSource, file, requiredSHA256, task)
+	}
+	cacheURL := mountContentCacheURL(url, requiredSHA256)
+	retryTimeout := time.Duration(config.MountContentCacheRetryTimeoutSecs) * time.Second
+	sha256, err = downloadURLToFileWithRetryTimeout(cacheURL, contentSource+" via mount content cache", file, requiredSHA256, retryTimeout, task)
+	if err != nil {
+		task.Warnf("[mounts] Could not download %v via mount content cache (%v); downloading it directly instead", contentSource, err)
+		return downloadURLToFile(url, contentSource, file, requiredSHA256, task)
+	}
+	if sha256 != requiredSHA256 {
+		task.Warnf("[mounts] Mount content cache served content with SHA256 %v for %v, but task definition requires %v; downloading it directly instead", sha256, contentSource, requiredSHA256)
+		return downloadURLToFile(url, contentSource, file, requiredSHA256, task)
+	}
+	return
+}
+
+// mountContentCacheURL returns the url of the content with the given SHA256
+// in the mount content cache, which is
+//
+//   <mountContentCacheURL>/sha256/<sha256>?url=<url>
+//
+// where url is the url that the mount content cache can fetch the content
+// from, if it doesn't have it already.
+func mountContentCacheURL(contentURL, sha256 string) string {
+	return strings.TrimSuffix(config.MountContentCacheURL, "/") + "/sha256/" + url.PathEscape(sha256) + "?" + url.Values{"url": {contentURL}}.Encode()
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// contentServer serves content, or responds with the given status code if
+// set, and records the requests it receives.
+type contentServer struct {
+	sync.Mutex
+	content  []byte
+	status   int
+	requests []*http.Request
+}
+
+func (s *contentServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	s.requests = append(s.requests, r)
+	s.Unlock()
+	if s.status != 0 {
+		http.Error(w, http.StatusText(s.status), s.status)
+		return
+	}
+	_, _ = w.Write(s.content)
+}
+
+func testDownloadMountContent(t *testing.T, cache, origin *contentServer, requiredSHA256 string) (sha256, originURL string) {
+	t.Helper()
+	defer prepareEnvironment(t)()
+	configureWorker(t)
+	cacheServer := httptest.NewServer(cache)
+	defer cacheServer.Close()
+	originServer := httptest.NewServer(origin)
+	defer originServer.Close()
+	config.MountContentCacheURL = cacheServer.URL + "/"
+	config.MountContentCacheRetryTimeoutSecs = 5
+	originURL = originServer.URL + "/toolchain.tar.gz?version=1"
+	file := filepath.Join(testdataDir, t.Name(), "download")
+	sha256, err := downloadMountContent(originURL, "test content", file, requiredSHA256, &TaskRun{})
+	if err != nil {
+		t.Fatalf("Could not download content: %v", err)
+	}
+	return
+}
+
+func TestMountContentCacheHit(t *testing.T) {
+	content := []byte("toolchain")
+	cache := &contentServer{content: content}
+	origin := &contentServer{content: content}
+
+	sha256, originURL := testDownloadMountContent(t, cache, origin, sha256Hex(content))
+
+	if sha256 != sha256Hex(content) {
+		t.Fatalf("Expected SHA256 %v but got %v", sha256Hex(content), sha256)
+	}
+	if len(cache.requests) != 1 || len(origin.requests) != 0 {
+		t.Fatalf("Expected content to be downloaded from cache only, but cache got %v requests and origin got %v requests", len(cache.requests), len(origin.requests))
+	}
+	if path := cache.requests[0].URL.Path; path != "/sha256/"+sha256Hex(content) {
+		t.Fatalf("Expected content to be requested from cache by SHA256, but got path %v", path)
+	}
+	if u := cache.requests[0].URL.Query().Get("url"); u != originURL {
+		t.Fatalf("Expected cache to be given url %v to fetch content from, but got %v", originURL, u)
+	}
+}
+
+func TestMountContentCacheWrongContent(t *testing.T) {
+	content := []byte("toolchain")
+	cache := &contentServer{content: []byte("stale toolchain")}
+	origin := &contentServer{content: content}
+
+	sha256, _ := testDownloadMountContent(t, cache, origin, sha256Hex(content))
+
+	if sha256 != sha256Hex(content) || len(origin.requests) != 1 {
+		t.Fatalf("Expected content with SHA256 %v to be downloaded from origin, but got SHA256 %v after %v requests to origin", sha256Hex(content), sha256, len(origin.requests))
+	}
+}
+
+func TestMountContentCacheUnavailable(t *testing.T) {
+	content := []byte("toolchain")
+	cache := &contentServer{status: http.StatusNotFound}
+	origin := &contentServer{content: content}
+
+	sha256, _ := testDownloadMountContent(t, cache, origin, sha256Hex(content))
+
+	if sha256 != sha256Hex(content) || len(origin.requests) != 1 {
+		t.Fatalf("Expected content with SHA256 %v to be downloaded from origin, but got SHA256 %v after %v requests to origin", sha256Hex(content), sha256, len(origin.requests))
+	}
+}
+
+func TestMountContentCacheNotUsedWithoutSHA256(t *testing.T) {
+	content := []byte("toolchain")
+	cache := &contentServer{content: content}
+	origin := &contentServer{content: content}
+
+	_, _ = testDownloadMountContent(t, cache, origin, "")
+
+	if len(cache.requests) != 0 || len(origin.requests) != 1 {
+		t.Fatalf("Expected content to be downloaded from origin only, but cache got %v requests and origin got %v requests", len(cache.requests), len(origin.requests))
+	}
+}
@@ -4,18 +4,19 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
+	"runtime"
+	"runtime/debug"
 	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/mholt/archiver"
-	"github.com/taskcluster/httpbackoff/v3"
 	"github.com/taskcluster/slugid-go/slugid"
 	tcclient "github.com/taskcluster/taskcluster/v28/clients/client-go"
 	"github.com/taskcluster/taskcluster/v28/clients/client-go/tcpurgecache"
@@ -40,6 +41,15 @@ var (
 	// we track this in order to reduce number of results we get back from
 	// purge cache service
 	lastQueriedPurgeCacheService time.Time
+	// cachesMutex guards fileCaches and directoryCaches, and contentLocks,
+	// since mounts may be prepared concurrently
+	cachesMutex sync.Mutex
+	// contentLocks are held while content is being cached, and read from
+	// the cache, so that content that is needed by several mounts that are
+	// prepared concurrently is only downloaded once, and is not expunged
+	// from the cache while it is read. The key is the unique key of the
+	// content.
+	contentLocks = map[string]*contentLock{}
 )
 
 type (
@@ -87,7 +97,9 @@ func (cache *Cache) Expunge(task *TaskRun) error {
 	if task != nil {
 		task.Infof("[mounts] Removing cache %v from cache table", cache.Key)
 	}
+	cachesMutex.Lock()
 	delete(cache.Owner, cache.Key)
+	cachesMutex.Unlock()
 	if task != nil {
 		task.Infof("[mounts] Deleting cache %v file(s) at %v", cache.Key, cache.Location)
 	}
@@ -158,7 +170,7 @@ func (feature *MountsFeature) Initialise() error {
 	fileCaches.LoadFromFile("file-caches.json", config.CachesDir)
 	directoryCaches.LoadFromFile("directory-caches.json", config.DownloadsDir)
 	pc = config.PurgeCache()
-	return nil
+	return prewarmCaches()
 }
 
 // Represents the Mounts feature for an individual task (one per task)
@@ -167,7 +179,7 @@ type TaskMount struct {
 	mounts  []MountEntry
 	mounted []MountEntry
 	// payload errors are detected when creating feature but only reported when
-	// feature starts, so need to keep hold of any error raised...
+	// the payload is validated, so need to keep hold of any error raised...
 	payloadError      error
 	requiredScopes    scopes.Required
 	referencedTaskIDs map[string]bool // simple implementation of set of strings
@@ -247,18 +259,18 @@ func (feature *MountsFeature) NewTaskFeature(task *TaskRun) TaskFeature {
 		// We have to check keys to find out...
 		var m map[string]interface{}
 		if err := json.Unmarshal(taskMount, &m); err != nil {
-			tm.payloadError = fmt.Errorf("Could not read task mount %v: %v\n%v", i, string(taskMount), err)
+			tm.payloadError = atPayloadValue(mountPointer(i), fmt.Errorf("Could not read task mount %v: %v\n%v", i, string(taskMount), err))
 			return tm
 		}
 		switch {
 		case m["cacheName"] != nil:
-			tm.Unmarshal(taskMount, &WritableDirectoryCache{})
+			tm.Unmarshal(i, taskMount, &WritableDirectoryCache{})
 		case m["directory"] != nil:
-			tm.Unmarshal(taskMount, &ReadOnlyDirectory{})
+			tm.Unmarshal(i, taskMount, &ReadOnlyDirectory{})
 		case m["file"] != nil:
-			tm.Unmarshal(taskMount, &FileMount{})
+			tm.Unmarshal(i, taskMount, &FileMount{})
 		default:
-			tm.payloadError = fmt.Errorf("Unrecognised mount entry in payload - %#v", m)
+			tm.payloadError = atPayloadValue(mountPointer(i), fmt.Errorf("Unrecognised mount entry in payload - %#v", m))
 		}
 	}
 	tm.initRequiredScopes()
@@ -267,14 +279,20 @@ func (feature *MountsFeature) NewTaskFeature(task *TaskRun) TaskFeature {
 }
 
 // Utility method to unmarshal a json blob and add it to the mounts in the TaskMount
-func (taskMount *TaskMount) Unmarshal(rm json.RawMessage, m MountEntry) {
+func (taskMount *TaskMount) Unmarshal(index int, rm json.RawMessage, m MountEntry) {
 	// only update if nil, otherwise we could replace a previous error with nil
 	if taskMount.payloadError == nil {
-		taskMount.payloadError = json.Unmarshal(rm, m)
+		taskMount.payloadError = atPayloadValue(mountPointer(index), json.Unmarshal(rm, m))
 		taskMount.mounts = append(taskMount.mounts, m)
 	}
 }
 
+// mountPointer returns the JSON pointer of the mount with the given index in
+// the task payload.
+func mountPointer(index int) string {
+	return fmt.Sprintf("/mounts/%v", index)
+}
+
 // Note, we've calculated the required scopes in NewTaskFeature(...) already -
 // we do this in advance in case there is an error, we can report it upfront
 // when we initialise, rather than later when we go to check what scopes are
@@ -287,11 +305,11 @@ func (taskMount *TaskMount) RequiredScopes() scopes.Required {
 // mount them
 func (taskMount *TaskMount) initRequiredScopes() {
 	requiredScopes := []string{}
-	for _, mount := range taskMount.mounts {
+	for i, mount := range taskMount.mounts {
 		requiredScopes = append(requiredScopes, mount.RequiredScopes()...)
 		fsContent, err := mount.FSContent()
 		if err != nil {
-			taskMount.payloadError = err
+			taskMount.payloadError = atPayloadValue(mountPointer(i)+"/content", err)
 			return
 		}
 		// A writable cache might not be preloaded so might have no initial content
@@ -305,29 +323,27 @@ func (taskMount *TaskMount) initRequiredScopes() {
 // loops through all referenced mounts and keeps a list of referenced TaskIDs
 func (taskMount *TaskMount) initReferencedTaskIDs() {
 	taskMount.referencedTaskIDs = map[string]bool{}
-	for _, mount := range taskMount.mounts {
+	taskDependencies := map[string]bool{}
+	for _, taskID := range taskMount.task.Definition.Dependencies {
+		taskDependencies[taskID] = true
+	}
+	for i, mount := range taskMount.mounts {
 		fsContent, err := mount.FSContent()
 		if err != nil {
-			taskMount.payloadError = err
+			taskMount.payloadError = atPayloadValue(mountPointer(i)+"/content", err)
 			return
 		}
 		// A writable cache might not be preloaded so might have no initial content
 		if fsContent != nil {
 			for _, taskID := range fsContent.TaskDependencies() {
 				taskMount.referencedTaskIDs[taskID] = true
+				if !taskDependencies[taskID] {
+					taskMount.payloadError = atPayloadValue(mountPointer(i)+"/content", fmt.Errorf("[mounts] task.dependencies needs to include %v since one or more of its artifacts are mounted", taskID))
+					return
+				}
 			}
 		}
 	}
-	taskDependencies := map[string]bool{}
-	for _, taskID := range taskMount.task.Definition.Dependencies {
-		taskDependencies[taskID] = true
-	}
-	for taskID := range taskMount.referencedTaskIDs {
-		if !taskDependencies[taskID] {
-			taskMount.payloadError = fmt.Errorf("[mounts] task.dependencies needs to include %v since one or more of its artifacts are mounted", taskID)
-			return
-		}
-	}
 }
 
 // Here the order is important. We want to delete file caches before we delete
@@ -340,11 +356,14 @@ func garbageCollection() error {
 	return runGarbageCollection(r)
 }
 
+// ValidatePayload reports any problem with the mounts in the task payload,
+// that was found when the task feature was created.
+func (taskMount *TaskMount) ValidatePayload() *CommandExecutionError {
+	return MalformedPayloadError(taskMount.payloadError)
+}
+
 // called when a task starts
 func (taskMount *TaskMount) Start() *CommandExecutionError {
-	if taskMount.payloadError != nil {
-		return MalformedPayloadError(taskMount.payloadError)
-	}
 	// Check if any caches need to be purged. See:
 	//   https://docs.taskcluster.net/reference/core/purge-cache
 	err := taskMount.purgeCaches()
@@ -360,21 +379,147 @@ func (taskMount *TaskMount) Start() *CommandExecutionError {
 		taskMount.task.Warn("[mounts] Could not reach purgecache service to see if caches need purging:")
 		taskMount.task.Warn("[mounts] " + err.Error())
 	}
-	// loop through all mounts described in payload
-	for _, mount := range taskMount.mounts {
-		err = mount.Mount(taskMount.task)
-		// An error is returned if it is a task problem, such as an invalid url
-		// to download content, or a downloaded archive cannot be extracted.
-		// If the problem is internal (e.g. can't mount a writable cache) then
-		// this is handled by a panic.
-		if err != nil {
-			return Failure(fmt.Errorf("[mounts] %s", err))
+	return taskMount.mountAll()
+}
+
+// mountResult is the outcome of mounting a mount entry
+type mountResult struct {
+	mounted bool
+	err     error
+	// panicked is set if mounting panicked, with value panicValue
+	panicked   bool
+	panicValue interface{}
+}
+
+// mountAll mounts all mounts described in the payload, preparing up to config
+// setting maxConcurrentMounts of them at a time. A mount is only prepared once
+// the mounts listed before it in the payload that it depends on (see
+// mountDependencies) have been mounted. Once a mount has failed, no further
+// mounts are started. The error that is returned is the error of the first
+// failed mount in the payload, regardless of which mount failed first.
+func (taskMount *TaskMount) mountAll() *CommandExecutionError {
+	mounts := taskMount.mounts
+	concurrency := int(config.MaxConcurrentMounts)
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	dependencies := mountDependencies(mounts)
+	results := make([]mountResult, len(mounts))
+	done := make([]chan struct{}, len(mounts))
+	slots := make(chan struct{}, concurrency)
+	var failed int32
+	var wg sync.WaitGroup
+	// Slots are taken in payload order, so every mount that a started mount
+	// depends on has been started too, and will finish.
+	for i, mount := range mounts {
+		slots <- struct{}{}
+		if atomic.LoadInt32(&failed) != 0 {
+			<-slots
+			break
+		}
+		done[i] = make(chan struct{})
+		wg.Add(1)
+		go func(i int, mount MountEntry) {
+			defer wg.Done()
+			defer close(done[i])
+			defer func() { <-slots }()
+			defer func() {
+				// Panics are raised again once all mounts have finished, since
+				// they are handled by the task run, not this goroutine.
+				if r := recover(); r != nil {
+					log.Printf("[mounts] Panic while mounting mount entry %v: %v\n%s", i, r, debug.Stack())
+					results[i] = mountResult{panicked: true, panicValue: r}
+					atomic.StoreInt32(&failed, 1)
+				}
+			}()
+			for _, j := range dependencies[i] {
+				<-done[j]
+				if !results[j].mounted {
+					// the failure of mount j is reported instead
+					return
+				}
+			}
+			err := mount.Mount(taskMount.task)
+			// An error is returned if it is a task problem, such as an invalid
+			// url to download content, or a downloaded archive cannot be
+			// extracted. If the problem is internal (e.g. can't mount a
+			// writable cache) then this is handled by a panic.
+			if err != nil {
+				results[i] = mountResult{err: err}
+				atomic.StoreInt32(&failed, 1)
+				return
+			}
+			results[i] = mountResult{mounted: true}
+		}(i, mount)
+	}
+	wg.Wait()
+	for i, mount := range mounts {
+		if results[i].mounted {
+			taskMount.mounted = append(taskMount.mounted, mount)
+		}
+	}
+	for _, result := range results {
+		if result.panicked {
+			panic(result.panicValue)
+		}
+		if result.err != nil {
+			return Failure(fmt.Errorf("[mounts] %s", result.err))
 		}
-		taskMount.mounted = append(taskMount.mounted, mount)
 	}
 	return nil
 }
 
+// mountDependencies returns, for each of the given mounts, the indexes of the
+// mounts listed before it that must be mounted before it is, since they
+// mount to the same path, or to a parent or child path of its path, or are
+// the same writable directory cache. Other mounts can be prepared
+// concurrently, since caching of their content is safe for concurrent use.
+func mountDependencies(mounts []MountEntry) [][]int {
+	dependencies := make([][]int, len(mounts))
+	for i := range mounts {
+		dependencies[i] = []int{}
+		for j := 0; j < i; j++ {
+			if pathsOverlap(mountPath(mounts[i]), mountPath(mounts[j])) || sameWritableDirectoryCache(mounts[i], mounts[j]) {
+				dependencies[i] = append(dependencies[i], j)
+			}
+		}
+	}
+	return dependencies
+}
+
+// mountPath returns the path, relative to the task directory, that the given
+// mount is mounted to
+func mountPath(mount MountEntry) string {
+	switch m := mount.(type) {
+	case *WritableDirectoryCache:
+		return m.Directory
+	case *ReadOnlyDirectory:
+		return m.Directory
+	case *FileMount:
+		return m.File
+	}
+	panic(fmt.Sprintf("Internal worker bug! Unknown mount entry type %T", mount))
+}
+
+// pathsOverlap returns true if the given paths are the same path, or one of
+// them is inside the other
+func pathsOverlap(a, b string) bool {
+	a = filepath.Clean(filepath.Join(taskContext.TaskDir, a))
+	b = filepath.Clean(filepath.Join(taskContext.TaskDir, b))
+	if runtime.GOOS == "windows" {
+		a = strings.ToLower(a)
+		b = strings.ToLower(b)
+	}
+	sep := string(filepath.Separator)
+	return a == b || strings.HasPrefix(a, b+sep) || strings.HasPrefix(b, a+sep)
+}
+
+func sameWritableDirectoryCache(a, b MountEntry) bool {
+	w1, isCache1 := a.(*WritableDirectoryCache)
+	w2, isCache2 := b.(*WritableDirectoryCache)
+	return isCache1 && isCache2 && w1.CacheName == w2.CacheName
+}
+
 // called when a task has completed
 func (taskMount *TaskMount) Stop(err *ExecutionErrors) {
 	// loop through all mounts described in payload
@@ -434,12 +579,27 @@ func (f *FileMount) FSContent() (FSContent, error) {
 
 func (w *WritableDirectoryCache) Mount(task *TaskRun) error {
 	target := filepath.Join(taskContext.TaskDir, w.Directory)
-	// cache already there?
-	if _, dirCacheExists := directoryCaches[w.CacheName]; dirCacheExists {
+	cachesMutex.Lock()
+	cache, dirCacheExists := directoryCaches[w.CacheName]
+	if dirCacheExists {
 		// bump counter
-		directoryCaches[w.CacheName].Hits++
+		cache.Hits++
+	} else {
+		// new cache, let's initialise it...
+		cache = &Cache{
+			Hits:     1,
+			Created:  time.Now(),
+			Location: filepath.Join(config.CachesDir, slugid.Nice()),
+			Owner:    directoryCaches,
+			Key:      w.CacheName,
+		}
+		directoryCaches[w.CacheName] = cache
+	}
+	cachesMutex.Unlock()
+	// cache already there?
+	if dirCacheExists {
 		// move it into place...
-		src := directoryCaches[w.CacheName].Location
+		src := cache.Location
 		parentDir := filepath.Dir(target)
 		task.Infof("[mounts] Moving existing writable directory cache %v from %v to %v", w.CacheName, src, target)
 		MkdirAllOrDie(task, parentDir, 0700)
@@ -448,17 +608,7 @@ func (w *WritableDirectoryCache) Mount(task *TaskRun) error {
 			panic(fmt.Errorf("[mounts] Not able to rename dir %v as %v: %v", src, target, err))
 		}
 	} else {
-		// new cache, let's initialise it...
-		basename := slugid.Nice()
-		file := filepath.Join(config.CachesDir, basename)
-		task.Infof("[mounts] No existing writable directory cache '%v' - creating %v", w.CacheName, file)
-		directoryCaches[w.CacheName] = &Cache{
-			Hits:     1,
-			Created:  time.Now(),
-			Location: file,
-			Owner:    directoryCaches,
-			Key:      w.CacheName,
-		}
+		task.Infof("[mounts] No existing writable directory cache '%v' - creating %v", w.CacheName, cache.Location)
 		// preloaded content?
 		if w.Content != nil {
 			c, err := FSContentFrom(w.Content)
@@ -487,7 +637,9 @@ func (w *WritableDirectoryCache) Mount(task *TaskRun) error {
 }
 
 func (w *WritableDirectoryCache) Unmount(task *TaskRun) error {
+	cachesMutex.Lock()
 	cache := directoryCaches[w.CacheName]
+	cachesMutex.Unlock()
 	cacheDir := cache.Location
 	taskCacheDir := filepath.Join(taskContext.TaskDir, w.Directory)
 	task.Infof("[mounts] Preserving cache: Moving %q to %q", taskCacheDir, cacheDir)
@@ -559,6 +711,8 @@ func (f *FileMount) Mount(task *TaskRun) error {
 	if err != nil {
 		return err
 	}
+	lock := lockContent(fsContent.UniqueKey())
+	defer lock.unlock()
 	cacheFile, err := ensureCached(fsContent, task)
 	if err != nil {
 		return err
@@ -592,21 +746,29 @@ func (f *FileMount) Unmount(task *TaskRun) error {
 	return nil
 }
 
-// ensureCached returns a file containing the given content
+// ensureCached returns a file containing the given content. The caller must
+// hold the lock of the content (see lockContent) until it has finished
+// reading the file, since another mount of the same content with a
+// different required SHA256 may expunge it from the cache.
 func ensureCached(fsContent FSContent, task *TaskRun) (file string, err error) {
 	cacheKey := fsContent.UniqueKey()
 	var sha256 string
 	requiredSHA256 := fsContent.RequiredSHA256()
-	if _, inCache := fileCaches[cacheKey]; inCache {
-		file = fileCaches[cacheKey].Location
+	cachesMutex.Lock()
+	cache, inCache := fileCaches[cacheKey]
+	cachesMutex.Unlock()
+	if inCache {
+		file = cache.Location
 		// Sanity check - if file is in file map, but not on file system,
 		// something is seriously wrong, so should be a worker exception
 		// (panic), not a task failure
 		_, err = os.Stat(file)
 		if err != nil {
-			panic(fmt.Errorf("File in cache, but not on filesystem: %v", *fileCaches[cacheKey]))
+			panic(fmt.Errorf("File in cache, but not on filesystem: %v", *cache))
 		}
-		fileCaches[cacheKey].Hits++
+		cachesMutex.Lock()
+		cache.Hits++
+		cachesMutex.Unlock()
 
 		// validate SHA256 in case of either tampering or new content at url...
 		sha256, err = fileutil.CalculateSHA256(file)
@@ -622,9 +784,9 @@ func ensureCached(fsContent FSContent, task *TaskRun) (file string, err error) {
 			return
 		}
 		task.Infof("Found existing download of %v (%v) with SHA256 %v but task definition explicitly requires %v so deleting it", cacheKey, file, sha256, requiredSHA256)
-		err = fileCaches[cacheKey].Expunge(task)
+		err = cache.Expunge(task)
 		if err != nil {
-			panic(fmt.Errorf("Could not delete cache entry %v: %v", fileCaches[cacheKey], err))
+			panic(fmt.Errorf("Could not delete cache entry %v: %v", cache, err))
 		}
 	}
 	file, sha256, err = fsContent.Download(task)
@@ -632,7 +794,7 @@ func ensureCached(fsContent FSContent, task *TaskRun) (file string, err error) {
 		task.Errorf("Could not download %v to %v due to %v", fsContent.UniqueKey(), file, err)
 		return
 	}
-	fileCaches[cacheKey] = &Cache{
+	cache = &Cache{
 		Location: file,
 		Hits:     1,
 		Created:  time.Now(),
@@ -640,15 +802,18 @@ func ensureCached(fsContent FSContent, task *TaskRun) (file string, err error) {
 		Key:      cacheKey,
 		SHA256:   sha256,
 	}
+	cachesMutex.Lock()
+	fileCaches[cacheKey] = cache
+	cachesMutex.Unlock()
 	if requiredSHA256 == "" {
 		task.Warnf("[mounts] Download %v of %v has SHA256 %v but task payload does not declare a required value, so content authenticity cannot be verified", file, fsContent, sha256)
 		return
 	}
 	if requiredSHA256 != sha256 {
 		err = fmt.Errorf("Download %v of %v has SHA256 %v but task definition explicitly requires %v; not retrying download as there were no connection failures and HTTP response status code was 200", file, fsContent, sha256, requiredSHA256)
-		err2 := fileCaches[cacheKey].Expunge(task)
+		err2 := cache.Expunge(task)
 		if err2 != nil {
-			panic(fmt.Errorf("Could not delete cache entry %v: %v", fileCaches[cacheKey], err2))
+			panic(fmt.Errorf("Could not delete cache entry %v: %v", cache, err2))
 		}
 		return
 	}
@@ -656,7 +821,45 @@ func ensureCached(fsContent FSContent, task *TaskRun) (file string, err error) {
 	return
 }
 
+// contentLock is the lock of the content with unique key key. refs is the
+// number of holders and waiters of the lock, so that it can be removed from
+// contentLocks once it is no longer needed.
+type contentLock struct {
+	sync.Mutex
+	key  string
+	refs int
+}
+
+// lockContent locks, and returns, the lock of the content with the given
+// unique key
+func lockContent(cacheKey string) *contentLock {
+	cachesMutex.Lock()
+	lock, exists := contentLocks[cacheKey]
+	if !exists {
+		lock = &contentLock{key: cacheKey}
+		contentLocks[cacheKey] = lock
+	}
+	lock.refs++
+	cachesMutex.Unlock()
+	lock.Lock()
+	return lock
+}
+
+// unlock unlocks the lock, and removes it from contentLocks if nobody else
+// holds or waits for it
+func (lock *contentLock) unlock() {
+	lock.Unlock()
+	cachesMutex.Lock()
+	defer cachesMutex.Unlock()
+	lock.refs--
+	if lock.refs == 0 {
+		delete(contentLocks, lock.key)
+	}
+}
+
 func extract(fsContent FSContent, format string, dir string, task *TaskRun) error {
+	lock := lockContent(fsContent.UniqueKey())
+	defer lock.unlock()
 	cacheFile, err := ensureCached(fsContent, task)
 	if err != nil {
 		log.Printf("Could not cache content: %v", err)
@@ -726,7 +929,7 @@ func (ac *ArtifactContent) Download(task *TaskRun) (file string, sha256 string,
 	if err != nil {
 		return
 	}
-	sha256, err = downloadURLToFile(signedURL.String(), ac.String(), file, task)
+	sha256, err = downloadMountContent(signedURL.String(), ac.String(), file, ac.Sha256, task)
 	return
 }
 
@@ -752,7 +955,7 @@ func (ac *ArtifactContent) TaskDependencies() []string {
 func (uc *URLContent) Download(task *TaskRun) (file string, sha256 string, err error) {
 	basename := slugid.Nice()
 	file = filepath.Join(config.DownloadsDir, basename)
-	sha256, err = downloadURLToFile(uc.URL, uc.String(), file, task)
+	sha256, err = downloadMountContent(uc.URL, uc.String(), file, uc.Sha256, task)
 	return
 }
 
@@ -772,54 +975,6 @@ func (uc *URLContent) TaskDependencies() []string {
 	return []string{}
 }
 
-// Utility function to aggressively download a url to a file location
-func downloadURLToFile(url, contentSource, file string, task *TaskRun) (sha256 string, err error) {
-	var contentSize int64
-	// httpbackoff.Get(url) is not sufficient as that only guarantees we have
-	// an http response to read from, but does not retry if we lose
-	// connectivity while reading from it. Therefore include the reading of the
-	// response body inside the retry function.
-	retryFunc := func() (resp *http.Response, tempError error, permError error) {
-		task.Infof("[mounts] Downloading %v to %v", contentSource, file)
-		resp, err := http.Get(url)
-		// assume all errors should result in a retry
-		if err != nil {
-			task.Warnf("[mounts] Download of %v failed on this attempt: %v", contentSource, err)
-			// temporary error!
-			return resp, err, nil
-		}
-		defer resp.Body.Close()
-		f, err := os.OpenFile(file, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
-		if err != nil {
-			task.Errorf("[mounts] Could not open file %v: %v", file, err)
-			// permanent error!
-			return resp, nil, err
-		}
-		defer f.Close()
-		contentSize, err = io.Copy(f, resp.Body)
-		if err != nil {
-			task.Warnf("[mounts] Could not write http response from %v to file %v on this attempt: %v", contentSource, file, err)
-			// likely a temporary error - network blip
-			return resp, err, nil
-		}
-		return resp, nil, nil
-	}
-	var resp *http.Response
-	resp, _, err = httpbackoff.Retry(retryFunc)
-	if err != nil {
-		task.Errorf("[mounts] Could not fetch from %v into file %v: %v", contentSource, file, err)
-		return
-	}
-	defer resp.Body.Close()
-	sha256, err = fileutil.CalculateSHA256(file)
-	if err != nil {
-		task.Infof("[mounts] Downloaded %v bytes from %v to %v but cannot calculate SHA256", contentSize, contentSource, file)
-		panic(fmt.Sprintf("Internal worker bug! Cannot calculate SHA256 of file %v that I just downloaded: %v", file, err))
-	}
-	task.Infof("[mounts] Downloaded %v bytes with SHA256 %v from %v to %v", contentSize, sha256, contentSource, file)
-	return
-}
-
 //RawContent to file
 func (rc *RawContent) Download(task *TaskRun) (file string, sha256 string, err error) {
 	basename := slugid.Nice()
@@ -927,7 +1082,10 @@ func (taskMount *TaskMount) purgeCaches() error {
 	// again to account for clock drift, let's remove caches up to 5 minutes
 	// older than the given "before" date.
 	for _, request := range purgeRequests.Requests {
-		if cache, exists := directoryCaches[request.CacheName]; exists {
+		cachesMutex.Lock()
+		cache, exists := directoryCaches[request.CacheName]
+		cachesMutex.Unlock()
+		if exists {
 			if cache.Created.Add(-5 * time.Minute).Before(time.Time(request.Before)) {
 				err := cache.Expunge(taskMount.task)
 				if err != nil {
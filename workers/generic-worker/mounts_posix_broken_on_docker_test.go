@@ -0,0 +1,115 @@
+// +build darwin,!docker linux,!docker freebsd
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMountsPreparedConcurrently(t *testing.T) {
+	_, teardown := setupWithFakeServices(t)
+	defer teardown()
+
+	// Content is only served once both /a and /b have been requested, so the
+	// mounts can only be prepared if they are prepared concurrently.
+	var mutex sync.Mutex
+	requests := map[string]int{}
+	bothRequested := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		requests[r.URL.Path]++
+		if requests[r.URL.Path] == 1 && len(requests) == 2 {
+			close(bothRequested)
+		}
+		mutex.Unlock()
+		select {
+		case <-bothRequested:
+			_, _ = w.Write([]byte("content of " + r.URL.Path + "\n"))
+		case <-time.After(10 * time.Second):
+			http.Error(w, "Other content not requested concurrently", http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	mounts := []MountEntry{
+		&FileMount{
+			File:    "a/file",
+			Content: []byte(`{"url": "` + server.URL + `/a"}`),
+		},
+		&FileMount{
+			File:    "b/file",
+			Content: []byte(`{"url": "` + server.URL + `/b"}`),
+		},
+		// same content as the first mount, so should not be downloaded again
+		&FileMount{
+			File:    "c/file",
+			Content: []byte(`{"url": "` + server.URL + `/a"}`),
+		},
+	}
+	payload := GenericWorkerPayload{
+		Mounts: toMountArray(t, &mounts),
+		Command: [][]string{
+			{"/bin/bash", "-c", "cat a/file b/file c/file"},
+		},
+		MaxRunTime: 30,
+	}
+	td := testTask(t)
+
+	taskID := submitAndAssert(t, td, payload, "completed", "completed")
+
+	logtext, _, _, _ := getArtifactContent(t, taskID, "public/logs/live_backing.log")
+	if !strings.Contains(string(logtext), "content of /a\ncontent of /b\ncontent of /a\n") {
+		t.Fatalf("Expected mounted content in task log:\n%s", logtext)
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if requests["/a"] != 1 || requests["/b"] != 1 {
+		t.Fatalf("Expected each content to be downloaded once, but got requests %v", requests)
+	}
+}
+
+func TestFirstFailedMountReported(t *testing.T) {
+	_, teardown := setupWithFakeServices(t)
+	defer teardown()
+
+	// the download of the first mount fails after the download of the second
+	// mount has failed
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(time.Second)
+			http.Error(w, "Gone", http.StatusGone)
+			return
+		}
+		http.Error(w, "Not found", http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	mounts := []MountEntry{
+		&FileMount{
+			File:    "slow",
+			Content: []byte(`{"url": "` + server.URL + `/slow"}`),
+		},
+		&FileMount{
+			File:    "fast",
+			Content: []byte(`{"url": "` + server.URL + `/fast"}`),
+		},
+	}
+	payload := GenericWorkerPayload{
+		Mounts:     toMountArray(t, &mounts),
+		Command:    helloGoodbye(),
+		MaxRunTime: 30,
+	}
+	td := testTask(t)
+
+	taskID := submitAndAssert(t, td, payload, "failed", "failed")
+
+	logtext, _, _, _ := getArtifactContent(t, taskID, "public/logs/live_backing.log")
+	if !strings.Contains(string(logtext), "[mounts] (Permanent) HTTP response code 410") || strings.Contains(string(logtext), "[mounts] (Permanent) HTTP response code 404") {
+		t.Fatalf("Expected failure of first mount to be reported:\n%s", logtext)
+	}
+}
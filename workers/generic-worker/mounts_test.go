@@ -5,9 +5,11 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
 	"regexp"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/taskcluster/slugid-go/slugid"
 	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/gwconfig"
@@ -553,3 +555,64 @@ func TestWritableDirectoryCacheNoSHA256(t *testing.T) {
 		},
 	)
 }
+
+func TestMountDependencies(t *testing.T) {
+	defer prepareEnvironment(t)()
+	mounts := []MountEntry{
+		&WritableDirectoryCache{
+			CacheName: "cache-1",
+			Directory: "cache",
+		},
+		&FileMount{
+			File: filepath.Join("cache", "file"),
+		},
+		&ReadOnlyDirectory{
+			Directory: "tools",
+		},
+		// not inside directory tools
+		&FileMount{
+			File: "tools-version",
+		},
+		&WritableDirectoryCache{
+			CacheName: "cache-1",
+			Directory: "other-cache",
+		},
+		&ReadOnlyDirectory{
+			Directory: filepath.Join("tools", "..", "cache"),
+		},
+	}
+	expected := [][]int{{}, {0}, {}, {}, {0}, {0, 1}}
+	if dependencies := mountDependencies(mounts); !reflect.DeepEqual(dependencies, expected) {
+		t.Fatalf("Expected mount dependencies %v but got %v", expected, dependencies)
+	}
+}
+
+func TestContentLockRemovedWhenUnused(t *testing.T) {
+	first := lockContent("some content")
+	locked := make(chan *contentLock)
+	go func() {
+		locked <- lockContent("some content")
+	}()
+	// wait for the goroutine to wait for the lock
+	for waiting := false; !waiting; time.Sleep(10 * time.Millisecond) {
+		cachesMutex.Lock()
+		waiting = first.refs == 2
+		cachesMutex.Unlock()
+	}
+	select {
+	case <-locked:
+		t.Fatal("Expected content lock to be held until it is unlocked")
+	default:
+	}
+	first.unlock()
+	second := <-locked
+	if second != first {
+		t.Fatal("Expected waiter to acquire the same content lock")
+	}
+	second.unlock()
+	cachesMutex.Lock()
+	defer cachesMutex.Unlock()
+	if _, exists := contentLocks["some content"]; exists {
+		t.Fatal("Expected content lock to be removed once it is no longer held or waited for")
+	}
+}
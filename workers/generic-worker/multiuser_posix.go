@@ -9,6 +9,8 @@ import (
 	"path/filepath"
 	"runtime"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/taskcluster/shell"
 	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/host"
@@ -22,10 +24,23 @@ func (task *TaskRun) formatCommand(index int) string {
 
 func platformFeatures() []Feature {
 	return []Feature{
+		// network isolation is stopped after the process reaper, so that no
+		// task processes remain in the task network namespace
+		&NetworkIsolationFeature{},
+		&ProcessReaperFeature{},
+		// task metadata is started before services, so that services can
+		// also query it
+		&TaskMetadataFeature{},
+		// services are started after the features above have configured
+		// the service commands, and are stopped before they are stopped
+		&ServicesFeature{},
 		// keep chain of trust as low down as possible, as it checks permissions
 		// of signing key file, and a feature could change them, so we want these
 		// checks as late as possible
 		&ChainOfTrustFeature{},
+		// live artifacts are stopped before chain of trust, so that its
+		// certificate includes all of them
+		&LiveArtifactsFeature{},
 	}
 }
 
@@ -57,6 +72,12 @@ func (task *TaskRun) generateCommand(index int) error {
 	return nil
 }
 
+// newServiceCommand returns a command that runs as the task user, in the
+// task directory, with the environment of the task commands.
+func (task *TaskRun) newServiceCommand(commandLine []string) (*process.Command, error) {
+	return process.NewCommand(commandLine, taskContext.TaskDir, task.EnvVars(), taskContext.pd)
+}
+
 func (task *TaskRun) prepareCommand(index int) *CommandExecutionError {
 	return nil
 }
@@ -64,8 +85,8 @@ func (task *TaskRun) prepareCommand(index int) *CommandExecutionError {
 // Set an environment variable in each command.  This can be called from a feature's
 // NewTaskFeature method to set variables for the task.
 func (task *TaskRun) setVariable(variable string, value string) error {
-	for i := range task.Commands {
-		task.Commands[i].SetEnv(variable, value)
+	for _, command := range task.allCommands() {
+		command.SetEnv(variable, value)
 	}
 	return nil
 }
@@ -200,3 +221,71 @@ func makeDirUnreadableForUser(dir string, user *gwruntime.OSUser) error {
 	}
 	return os.Chmod(dir, 0700)
 }
+
+// gracePeriod returns how long task commands have to exit after SIGTERM,
+// before they are killed, when the task is aborted.
+func (task *TaskRun) gracePeriod() time.Duration {
+	return time.Duration(task.Payload.GracePeriod) * time.Second
+}
+
+func (task *TaskRun) addUserToGroups(groups []string) (updatedGroups []string, notUpdatedGroups []string) {
+	if len(groups) == 0 {
+		return []string{}, []string{}
+	}
+	for _, group := range groups {
+		err := gwruntime.AddUserToGroup(taskContext.User.Name, group)
+		if err == nil {
+			updatedGroups = append(updatedGroups, group)
+		} else {
+			notUpdatedGroups = append(notUpdatedGroups, group)
+		}
+	}
+	return
+}
+
+func (task *TaskRun) removeUserFromGroups(groups []string) (updatedGroups []string, notUpdatedGroups []string) {
+	if len(groups) == 0 {
+		return []string{}, []string{}
+	}
+	for _, group := range groups {
+		err := gwruntime.RemoveUserFromGroup(taskContext.User.Name, group)
+		if err == nil {
+			updatedGroups = append(updatedGroups, group)
+		} else {
+			notUpdatedGroups = append(notUpdatedGroups, group)
+		}
+	}
+	return
+}
+
+// groupIDs returns the IDs of all the groups that the given user is a
+// member of, according to the user database.
+func groupIDs(username string) ([]uint32, error) {
+	out, err := host.CombinedOutput("id", "-G", username)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to run command to determine groups of user %v: %v", username, err)
+	}
+	gids := []uint32{}
+	for _, gidString := range strings.Fields(out) {
+		gid, err := strconv.ParseUint(gidString, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to convert GID %q from a string to an int: %v", gidString, err)
+		}
+		gids = append(gids, uint32(gid))
+	}
+	return gids, nil
+}
+
+// setSupplementaryGroups sets the supplementary groups that command runs
+// with. Commands share the process attributes of the task user platform
+// data, so these are copied first, in order not to affect other commands.
+func setSupplementaryGroups(command *process.Command, gids []uint32) {
+	if command.SysProcAttr == nil || command.SysProcAttr.Credential == nil {
+		return
+	}
+	attr := *command.SysProcAttr
+	credential := *attr.Credential
+	credential.Groups = gids
+	attr.Credential = &credential
+	command.SysProcAttr = &attr
+}
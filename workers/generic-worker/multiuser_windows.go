@@ -13,6 +13,7 @@ import (
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/host"
 	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/process"
@@ -31,10 +32,14 @@ func platformFeatures() []Feature {
 	return []Feature{
 		&RDPFeature{},
 		&RunAsAdministratorFeature{}, // depends on (must appear later in list than) OSGroups feature
+		&TaskMetadataFeature{},
 		// keep chain of trust as low down as possible, as it checks permissions
 		// of signing key file, and a feature could change them, so we want these
 		// checks as late as possible
 		&ChainOfTrustFeature{},
+		// live artifacts are stopped before chain of trust, so that its
+		// certificate includes all of them
+		&LiveArtifactsFeature{},
 	}
 }
 
@@ -567,3 +572,9 @@ func convertNilToEmptyString(val interface{}) string {
 	}
 	return val.(string)
 }
+
+// gracePeriod returns zero, since task commands are killed immediately when
+// the task is aborted.
+func (task *TaskRun) gracePeriod() time.Duration {
+	return 0
+}
@@ -0,0 +1,284 @@
+// +build darwin,!docker linux,!docker freebsd
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+
+	"github.com/taskcluster/taskcluster/v28/internal/scopes"
+)
+
+// NetworkIsolationFeature runs task commands in their own network namespace,
+// connected to the worker host by a veth pair and NATed, so that they may
+// only connect to an allowlist of networks and hosts. The cloud instance
+// metadata endpoint is always blocked, since the worker fetches its own
+// config from it. Only supported on Linux.
+//
+// The livelog and taskcluster proxy processes, and the live artifacts and
+// task metadata endpoints, remain in the network namespace of the worker,
+// listening on its loopback interface. Connections to the taskcluster proxy,
+// live artifacts and task metadata ports, and to any DNS resolvers listening
+// on the loopback interface (such as systemd-resolved), on the loopback
+// interface of the task network namespace are forwarded to the worker
+// loopback interface by the worker.
+type NetworkIsolationFeature struct {
+}
+
+// instanceMetadataIP is the IP address of the cloud instance metadata
+// endpoint, which tasks may never connect to.
+const instanceMetadataIP = "169.254.169.254"
+
+func (feature *NetworkIsolationFeature) Name() string {
+	return "Network Isolation"
+}
+
+func (feature *NetworkIsolationFeature) Initialise() error {
+	switch networkIsolationMode() {
+	case "disabled":
+		return nil
+	case "optional", "always":
+	default:
+		return fmt.Errorf("Invalid value %q for config setting networkIsolation - must be one of \"disabled\", \"optional\" or \"always\"", config.NetworkIsolation)
+	}
+	_, _, _, err := taskNetworkAddresses(config.NetworkIsolationSubnet)
+	if err != nil {
+		return fmt.Errorf("Invalid config setting networkIsolationSubnet: %v", err)
+	}
+	for _, entry := range config.NetworkIsolationEgressAllowlist {
+		if _, _, err := parseEgressEntry(entry); err != nil {
+			return fmt.Errorf("Invalid entry in config setting networkIsolationEgressAllowlist: %v", err)
+		}
+	}
+	return initialiseNetworkIsolation() // platform specific
+}
+
+func (feature *NetworkIsolationFeature) PersistState() error {
+	return nil
+}
+
+// IsEnabled returns true if the task requests network isolation, even if the
+// worker does not support it, so that the task is not run without it.
+func (feature *NetworkIsolationFeature) IsEnabled(task *TaskRun) bool {
+	return networkIsolationMode() == "always" || task.Payload.Features.NetworkIsolation
+}
+
+type NetworkIsolationTask struct {
+	task    *TaskRun
+	network *taskNetwork
+}
+
+func (feature *NetworkIsolationFeature) NewTaskFeature(task *TaskRun) TaskFeature {
+	return &NetworkIsolationTask{
+		task: task,
+	}
+}
+
+func (ni *NetworkIsolationTask) RequiredScopes() scopes.Required {
+	requiredScopes := make([]string, len(ni.task.Payload.EgressAllowlist))
+	for i, entry := range ni.task.Payload.EgressAllowlist {
+		requiredScopes[i] = "generic-worker:network-egress:" + config.ProvisionerID + "/" + config.WorkerType + "/" + entry
+	}
+	return scopes.Required{requiredScopes}
+}
+
+func (ni *NetworkIsolationTask) ReservedArtifacts() []string {
+	return []string{}
+}
+
+func (ni *NetworkIsolationTask) Start() *CommandExecutionError {
+	if networkIsolationMode() == "disabled" {
+		return MalformedPayloadError(fmt.Errorf("Task payload enables feature networkIsolation, but it is disabled on worker type %v/%v", config.ProvisionerID, config.WorkerType))
+	}
+	for _, entry := range ni.task.Payload.EgressAllowlist {
+		if _, _, err := parseEgressEntry(entry); err != nil {
+			return MalformedPayloadError(fmt.Errorf("Invalid entry in payload property egressAllowlist: %v", err))
+		}
+	}
+	entries := append(append([]string{}, config.NetworkIsolationEgressAllowlist...), ni.task.Payload.EgressAllowlist...)
+	allowlist, err := resolveEgressAllowlist(entries)
+	if err != nil {
+		return ResourceUnavailable(err)
+	}
+	loopbackPorts := []uint16{}
+	if ni.task.Payload.Features.TaskclusterProxy {
+		loopbackPorts = append(loopbackPorts, config.TaskclusterProxyPort)
+	}
+	if ni.task.Payload.Features.LiveArtifacts {
+		loopbackPorts = append(loopbackPorts, config.LiveArtifactsPort)
+	}
+	if ni.task.Payload.Features.TaskMetadata {
+		loopbackPorts = append(loopbackPorts, config.TaskMetadataPort)
+	}
+	ni.network, err = newTaskNetwork(allowlist, loopbackPorts) // platform specific
+	if err != nil {
+		return executionError(internalError, errored, fmt.Errorf("Could not create isolated task network: %v", err))
+	}
+	for _, command := range ni.task.allCommands() {
+		ni.network.isolate(command)
+	}
+	ni.task.Info("[network isolation] Task commands run in an isolated network namespace")
+	if len(entries) == 0 {
+		ni.task.Info("[network isolation] Egress is blocked")
+	} else {
+		ni.task.Infof("[network isolation] Egress is allowed to: %v", strings.Join(entries, ", "))
+	}
+	return nil
+}
+
+func (ni *NetworkIsolationTask) Stop(err *ExecutionErrors) {
+	if ni.network == nil {
+		return
+	}
+	// Failing to tear down the task network does not affect the task, and
+	// any leftovers are removed before the next task network is created.
+	if e := ni.network.destroy(); e != nil {
+		log.Printf("WARNING: could not tear down isolated task network: %v", e)
+	}
+}
+
+// networkIsolationMode returns config setting networkIsolation, treating an
+// empty string as "disabled".
+func networkIsolationMode() string {
+	if config.NetworkIsolation == "" {
+		return "disabled"
+	}
+	return config.NetworkIsolation
+}
+
+// parseEgressEntry parses an entry of an egress allowlist, which is either
+// an IPv4 network in CIDR notation, an IPv4 address, or a host name. Exactly
+// one of network and host is returned, if err is nil.
+func parseEgressEntry(entry string) (network *net.IPNet, host string, err error) {
+	if strings.Contains(entry, "/") {
+		ip, network, err := net.ParseCIDR(entry)
+		if err != nil || ip.To4() == nil {
+			return nil, "", fmt.Errorf("%q is not an IPv4 network in CIDR notation", entry)
+		}
+		return network, "", nil
+	}
+	if ip := net.ParseIP(entry); ip != nil {
+		if ip.To4() == nil {
+			return nil, "", fmt.Errorf("%q is not an IPv4 address", entry)
+		}
+		return &net.IPNet{IP: ip.To4(), Mask: net.CIDRMask(32, 32)}, "", nil
+	}
+	if entry == "" || strings.ContainsAny(entry, " \t\n:") {
+		return nil, "", fmt.Errorf("%q is not a valid host name", entry)
+	}
+	return nil, entry, nil
+}
+
+// resolveEgressAllowlist returns the IPv4 networks that the given egress
+// allowlist entries allow, resolving host names.
+func resolveEgressAllowlist(entries []string) ([]*net.IPNet, error) {
+	allowlist := []*net.IPNet{}
+	for _, entry := range entries {
+		network, host, err := parseEgressEntry(entry)
+		if err != nil {
+			return nil, err
+		}
+		if network != nil {
+			allowlist = append(allowlist, network)
+			continue
+		}
+		ips, err := net.LookupIP(host)
+		if err != nil {
+			return nil, fmt.Errorf("Could not resolve host %q of egress allowlist: %v", host, err)
+		}
+		for _, ip := range ips {
+			if ip.To4() != nil {
+				allowlist = append(allowlist, &net.IPNet{IP: ip.To4(), Mask: net.CIDRMask(32, 32)})
+			}
+		}
+	}
+	return allowlist, nil
+}
+
+// taskNetworkAddresses returns the IP addresses of the worker and task ends
+// of the link between the worker and the task network namespace, which are
+// the first two host addresses of the given IPv4 subnet.
+func taskNetworkAddresses(subnet string) (hostIP, taskIP net.IP, prefixLength int, err error) {
+	_, network, err := net.ParseCIDR(subnet)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	ip := network.IP.To4()
+	if ip == nil {
+		return nil, nil, 0, fmt.Errorf("%q is not an IPv4 subnet", subnet)
+	}
+	prefixLength, _ = network.Mask.Size()
+	if prefixLength > 30 {
+		return nil, nil, 0, fmt.Errorf("subnet %q has fewer than two host addresses", subnet)
+	}
+	hostIP = net.IPv4(ip[0], ip[1], ip[2], ip[3]+1).To4()
+	taskIP = net.IPv4(ip[0], ip[1], ip[2], ip[3]+2).To4()
+	return hostIP, taskIP, prefixLength, nil
+}
+
+// iptablesRule is an iptables rule, in the given table and chain.
+type iptablesRule struct {
+	table string
+	chain string
+	spec  []string
+}
+
+// args returns the iptables arguments for the given operation on the rule,
+// e.g. "-A" to append it, or "-D" to delete it.
+func (rule iptablesRule) args(operation string) []string {
+	return append([]string{"-w", "-t", rule.table, operation, rule.chain}, rule.spec...)
+}
+
+// taskNetworkRules returns the iptables rules that are inserted into the
+// built-in chains for the task network. Traffic from the task network
+// namespace is passed to egressChain, the worker host itself is unreachable
+// from the task, and connections into the task network namespace are only
+// allowed if the task initiated them.
+func taskNetworkRules(hostInterface, egressChain string, taskIP net.IP) []iptablesRule {
+	return []iptablesRule{
+		{"filter", "INPUT", []string{"-i", hostInterface, "-j", "DROP"}},
+		{"filter", "FORWARD", []string{"-i", hostInterface, "-j", egressChain}},
+		{"filter", "FORWARD", []string{"-o", hostInterface, "-m", "conntrack", "--ctstate", "ESTABLISHED,RELATED", "-j", "ACCEPT"}},
+		{"filter", "FORWARD", []string{"-o", hostInterface, "-j", "DROP"}},
+		{"nat", "POSTROUTING", []string{"-s", taskIP.String() + "/32", "!", "-o", hostInterface, "-j", "MASQUERADE"}},
+	}
+}
+
+// egressRules returns the iptables rules of egressChain, which allow traffic
+// to the given networks, and DNS queries to the given name servers, and drop
+// everything else. Traffic to the cloud instance metadata endpoint is always
+// dropped.
+func egressRules(egressChain string, allowlist []*net.IPNet, nameservers []net.IP) []iptablesRule {
+	rules := []iptablesRule{
+		{"filter", egressChain, []string{"-d", instanceMetadataIP + "/32", "-j", "DROP"}},
+	}
+	for _, nameserver := range nameservers {
+		for _, protocol := range []string{"udp", "tcp"} {
+			rules = append(rules, iptablesRule{"filter", egressChain, []string{"-d", nameserver.String() + "/32", "-p", protocol, "--dport", "53", "-j", "ACCEPT"}})
+		}
+	}
+	for _, network := range allowlist {
+		rules = append(rules, iptablesRule{"filter", egressChain, []string{"-d", network.String(), "-j", "ACCEPT"}})
+	}
+	return append(rules, iptablesRule{"filter", egressChain, []string{"-j", "DROP"}})
+}
+
+// parseNameservers returns the IPv4 name servers listed in the given
+// resolv.conf content.
+func parseNameservers(resolvConf string) []net.IP {
+	nameservers := []net.IP{}
+	scanner := bufio.NewScanner(strings.NewReader(resolvConf))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "nameserver" {
+			continue
+		}
+		if ip := net.ParseIP(fields[1]); ip != nil && ip.To4() != nil {
+			nameservers = append(nameservers, ip.To4())
+		}
+	}
+	return nameservers
+}
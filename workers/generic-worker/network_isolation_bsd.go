@@ -0,0 +1,29 @@
+// +build darwin,!docker freebsd
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"runtime"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/process"
+)
+
+func initialiseNetworkIsolation() error {
+	return fmt.Errorf("Network isolation is not supported on platform %v", runtime.GOOS)
+}
+
+type taskNetwork struct {
+}
+
+func newTaskNetwork(allowlist []*net.IPNet, loopbackPorts []uint16) (*taskNetwork, error) {
+	return nil, fmt.Errorf("network isolation is not supported on platform %v", runtime.GOOS)
+}
+
+func (n *taskNetwork) isolate(command *process.Command) {
+}
+
+func (n *taskNetwork) destroy() error {
+	return nil
+}
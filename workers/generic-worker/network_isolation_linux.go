@@ -0,0 +1,374 @@
+// +build !docker
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/host"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/process"
+)
+
+const (
+	// Only one task runs at a time, so the task network always has the same
+	// names, which makes it simple to clean up after an interrupted task.
+	taskNetworkNamespace   = "generic-worker-task"
+	taskHostInterface      = "gw-host"
+	taskNamespaceInterface = "gw-task"
+	taskEgressChain        = "GW-TASK-EGRESS"
+)
+
+func taskNetworkNamespacePath() string {
+	return "/var/run/netns/" + taskNetworkNamespace
+}
+
+func initialiseNetworkIsolation() error {
+	if os.Geteuid() != 0 {
+		return errors.New("Network isolation requires generic-worker to run as root")
+	}
+	for _, executable := range []string{"ip", "iptables"} {
+		if _, err := exec.LookPath(executable); err != nil {
+			return fmt.Errorf("Network isolation requires %v: %v", executable, err)
+		}
+	}
+	removeLeftoverTaskNetwork()
+	return nil
+}
+
+// taskNetwork is the network namespace that isolated task commands run in,
+// together with the forwarders to the loopback interface of the worker.
+type taskNetwork struct {
+	forwarders []io.Closer
+	// forwarding is the previous value of the forwarding sysctl of each
+	// interface that forwarding was enabled on, by interface name
+	forwarding map[string]string
+}
+
+// newTaskNetwork creates the task network namespace, allowing egress to the
+// given networks. Connections to loopbackPorts on the loopback interface of
+// the task network namespace are forwarded to the same ports on the loopback
+// interface of the worker, such as the taskcluster proxy port.
+func newTaskNetwork(allowlist []*net.IPNet, loopbackPorts []uint16) (n *taskNetwork, err error) {
+	hostIP, taskIP, prefixLength, err := taskNetworkAddresses(config.NetworkIsolationSubnet)
+	if err != nil {
+		return nil, err
+	}
+	loopbackNameservers := []net.IP{}
+	otherNameservers := []net.IP{}
+	resolvConf, readErr := ioutil.ReadFile("/etc/resolv.conf")
+	if readErr != nil {
+		log.Printf("WARNING: could not read /etc/resolv.conf - tasks will not be able to resolve host names: %v", readErr)
+	}
+	for _, nameserver := range parseNameservers(string(resolvConf)) {
+		if nameserver.IsLoopback() {
+			loopbackNameservers = append(loopbackNameservers, nameserver)
+		} else {
+			otherNameservers = append(otherNameservers, nameserver)
+		}
+	}
+
+	removeLeftoverTaskNetwork()
+	n = &taskNetwork{
+		forwarding: map[string]string{},
+	}
+	defer func() {
+		if err != nil {
+			_ = n.destroy()
+		}
+	}()
+	commands := [][]string{
+		{"ip", "netns", "add", taskNetworkNamespace},
+		{"ip", "link", "add", taskHostInterface, "type", "veth", "peer", "name", taskNamespaceInterface},
+		{"ip", "link", "set", taskNamespaceInterface, "netns", taskNetworkNamespace},
+		{"ip", "addr", "add", fmt.Sprintf("%v/%v", hostIP, prefixLength), "dev", taskHostInterface},
+		{"ip", "link", "set", taskHostInterface, "up"},
+		{"ip", "-n", taskNetworkNamespace, "link", "set", "lo", "up"},
+		{"ip", "-n", taskNetworkNamespace, "addr", "add", fmt.Sprintf("%v/%v", taskIP, prefixLength), "dev", taskNamespaceInterface},
+		{"ip", "-n", taskNetworkNamespace, "link", "set", taskNamespaceInterface, "up"},
+		{"ip", "-n", taskNetworkNamespace, "route", "add", "default", "via", hostIP.String()},
+		{"iptables", "-w", "-N", taskEgressChain},
+	}
+	for _, rule := range egressRules(taskEgressChain, allowlist, otherNameservers) {
+		commands = append(commands, append([]string{"iptables"}, rule.args("-A")...))
+	}
+	// Insert rules into the built-in chains in reverse order, since each
+	// rule is inserted at the top of its chain, so that they take precedence
+	// over any rules already there.
+	rules := taskNetworkRules(taskHostInterface, taskEgressChain, taskIP)
+	for i := len(rules) - 1; i >= 0; i-- {
+		commands = append(commands, append([]string{"iptables"}, rules[i].args("-I")...))
+	}
+	err = host.RunBatch(false, commands...)
+	if err != nil {
+		return
+	}
+	// Forwarding is only enabled on the interfaces that task traffic passes
+	// through, rather than host-wide with net.ipv4.ip_forward, since IPv4
+	// forwarding is controlled by the interface that a packet arrives on.
+	err = n.enableForwarding(append([]string{taskHostInterface}, egressInterfaces(allowlist, otherNameservers)...))
+	if err != nil {
+		return
+	}
+
+	for _, port := range loopbackPorts {
+		err = n.forward("tcp", fmt.Sprintf("127.0.0.1:%v", port))
+		if err != nil {
+			return
+		}
+	}
+	for _, nameserver := range loopbackNameservers {
+		for _, network := range []string{"tcp", "udp"} {
+			err = n.forward(network, net.JoinHostPort(nameserver.String(), "53"))
+			if err != nil {
+				return
+			}
+		}
+	}
+	return n, nil
+}
+
+// isolate causes command to be started in the task network namespace.
+func (n *taskNetwork) isolate(command *process.Command) {
+	command.SetNetworkNamespace(taskNetworkNamespacePath())
+}
+
+// forward listens on address in the task network namespace, and forwards
+// connections (for network "tcp") or datagrams (for network "udp") to the
+// same address in the network namespace of the worker.
+func (n *taskNetwork) forward(network, address string) error {
+	var forwarder io.Closer
+	err := process.InNetworkNamespace(taskNetworkNamespacePath(), func() error {
+		switch network {
+		case "tcp":
+			listener, err := net.Listen(network, address)
+			if err != nil {
+				return err
+			}
+			forwarder = listener
+			go forwardTCP(listener, address)
+		case "udp":
+			conn, err := net.ListenPacket(network, address)
+			if err != nil {
+				return err
+			}
+			forwarder = conn
+			go forwardUDP(conn, address)
+		default:
+			return fmt.Errorf("cannot forward network %q", network)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("could not forward %v %v from task network namespace: %v", network, address, err)
+	}
+	n.forwarders = append(n.forwarders, forwarder)
+	return nil
+}
+
+// destroy stops the forwarders and removes the task network namespace,
+// together with its veth pair and iptables rules, and restores the
+// forwarding sysctls of the egress interfaces.
+func (n *taskNetwork) destroy() error {
+	n.closeForwarders()
+	err := host.RunBatch(true, taskNetworkTeardownCommands()...)
+	n.restoreForwarding()
+	return err
+}
+
+// enableForwarding enables IPv4 forwarding of packets that arrive on the
+// given interfaces, recording the previous setting of each interface.
+func (n *taskNetwork) enableForwarding(interfaces []string) error {
+	for _, iface := range interfaces {
+		sysctl := forwardingSysctl(iface)
+		previous, err := ioutil.ReadFile(sysctl)
+		if err != nil {
+			return err
+		}
+		n.forwarding[iface] = strings.TrimSpace(string(previous))
+		err = ioutil.WriteFile(sysctl, []byte("1"), 0644)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreForwarding restores the forwarding sysctls changed by
+// enableForwarding, other than that of the veth pair, which no longer
+// exists.
+func (n *taskNetwork) restoreForwarding() {
+	for iface, previous := range n.forwarding {
+		if iface == taskHostInterface {
+			continue
+		}
+		err := ioutil.WriteFile(forwardingSysctl(iface), []byte(previous), 0644)
+		if err != nil {
+			log.Printf("WARNING: could not restore forwarding setting of interface %v: %v", iface, err)
+		}
+	}
+	n.forwarding = map[string]string{}
+}
+
+func forwardingSysctl(iface string) string {
+	return "/proc/sys/net/ipv4/conf/" + iface + "/forwarding"
+}
+
+// egressInterfaces returns the interfaces of the routes to the given
+// networks and nameservers, which responses to task traffic arrive on. The
+// interfaces of the default routes are used for networks with a prefix
+// length of 0. Destinations that have no route are skipped.
+func egressInterfaces(allowlist []*net.IPNet, nameservers []net.IP) []string {
+	routes := []string{}
+	route := func(args ...string) {
+		out, err := host.CombinedOutput("ip", append([]string{"-o", "-4", "route"}, args...)...)
+		if err != nil {
+			log.Printf("WARNING: could not look up route (%v): %v", strings.Join(args, " "), err)
+			return
+		}
+		routes = append(routes, out)
+	}
+	for _, network := range allowlist {
+		if ones, _ := network.Mask.Size(); ones == 0 {
+			route("show", "default")
+			continue
+		}
+		route("get", network.IP.String())
+	}
+	for _, nameserver := range nameservers {
+		route("get", nameserver.String())
+	}
+	return routeInterfaces(strings.Join(routes, "\n"))
+}
+
+// routeInterfaces returns the interfaces that the given output of ip route
+// refers to, other than the loopback interface and the veth pair.
+func routeInterfaces(routes string) []string {
+	interfaces := []string{}
+	seen := map[string]bool{"lo": true, taskHostInterface: true}
+	fields := strings.Fields(routes)
+	for i := 0; i+1 < len(fields); i++ {
+		if fields[i] != "dev" || seen[fields[i+1]] {
+			continue
+		}
+		seen[fields[i+1]] = true
+		interfaces = append(interfaces, fields[i+1])
+	}
+	return interfaces
+}
+
+func (n *taskNetwork) closeForwarders() {
+	for _, forwarder := range n.forwarders {
+		_ = forwarder.Close()
+	}
+	n.forwarders = nil
+}
+
+func taskNetworkTeardownCommands() [][]string {
+	commands := [][]string{}
+	_, taskIP, _, err := taskNetworkAddresses(config.NetworkIsolationSubnet)
+	if err == nil {
+		for _, rule := range taskNetworkRules(taskHostInterface, taskEgressChain, taskIP) {
+			commands = append(commands, append([]string{"iptables"}, rule.args("-D")...))
+		}
+	}
+	return append(
+		commands,
+		[]string{"iptables", "-w", "-F", taskEgressChain},
+		[]string{"iptables", "-w", "-X", taskEgressChain},
+		// deleting one end of a veth pair deletes the other end too
+		[]string{"ip", "link", "del", taskHostInterface},
+		[]string{"ip", "netns", "del", taskNetworkNamespace},
+	)
+}
+
+// removeLeftoverTaskNetwork removes the task network of a previous task, if
+// the worker was interrupted before it could tear it down.
+func removeLeftoverTaskNetwork() {
+	_, err := os.Stat(taskNetworkNamespacePath())
+	if err != nil {
+		if _, err := net.InterfaceByName(taskHostInterface); err != nil {
+			return
+		}
+	}
+	log.Print("Removing leftover isolated task network...")
+	_ = host.RunBatch(true, taskNetworkTeardownCommands()...)
+}
+
+// forwardTCP forwards connections accepted by listener to target, until
+// listener is closed.
+func forwardTCP(listener net.Listener, target string) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			upstream, err := net.Dial("tcp", target)
+			if err != nil {
+				log.Printf("Could not forward connection from task network namespace to %v: %v", target, err)
+				return
+			}
+			defer upstream.Close()
+			done := make(chan struct{})
+			go func() {
+				copyAndCloseWrite(upstream, conn)
+				close(done)
+			}()
+			copyAndCloseWrite(conn, upstream)
+			<-done
+		}()
+	}
+}
+
+// copyAndCloseWrite copies from src to dst, and then closes the write side
+// of dst, so that the peer sees EOF while responses may still be read.
+func copyAndCloseWrite(dst, src net.Conn) {
+	_, _ = io.Copy(dst, src)
+	if c, ok := dst.(interface{ CloseWrite() error }); ok {
+		_ = c.CloseWrite()
+	} else {
+		_ = dst.Close()
+	}
+}
+
+// forwardUDP forwards datagrams received by conn to target, and the
+// response to each datagram back to its sender, until conn is closed. This
+// is sufficient for DNS queries.
+func forwardUDP(conn net.PacketConn, target string) {
+	buffer := make([]byte, 65535)
+	for {
+		n, client, err := conn.ReadFrom(buffer)
+		if err != nil {
+			return
+		}
+		request := append([]byte{}, buffer[:n]...)
+		go func() {
+			upstream, err := net.Dial("udp", target)
+			if err != nil {
+				log.Printf("Could not forward datagram from task network namespace to %v: %v", target, err)
+				return
+			}
+			defer upstream.Close()
+			_ = upstream.SetDeadline(time.Now().Add(10 * time.Second))
+			if _, err := upstream.Write(request); err != nil {
+				return
+			}
+			response := make([]byte, 65535)
+			n, err := upstream.Read(response)
+			if err != nil {
+				return
+			}
+			_, _ = conn.WriteTo(response[:n], client)
+		}()
+	}
+}
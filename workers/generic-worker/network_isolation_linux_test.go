@@ -0,0 +1,220 @@
+// +build !docker
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/host"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/process"
+)
+
+// createTestNetworkNamespace creates the task network namespace, with only
+// a loopback interface, and returns a function that removes it.
+func createTestNetworkNamespace(t *testing.T) func() {
+	if os.Geteuid() != 0 {
+		t.Skip("Creating network namespaces requires root")
+	}
+	err := host.RunBatch(
+		false,
+		[]string{"ip", "netns", "add", taskNetworkNamespace},
+		[]string{"ip", "-n", taskNetworkNamespace, "link", "set", "lo", "up"},
+	)
+	if err != nil {
+		t.Fatalf("Could not create network namespace: %v", err)
+	}
+	return func() {
+		_ = host.Run("ip", "netns", "del", taskNetworkNamespace)
+	}
+}
+
+func TestCommandInNetworkNamespace(t *testing.T) {
+	defer createTestNetworkNamespace(t)()
+	command := exec.Command("ip", "-o", "link")
+	output := new(strings.Builder)
+	command.Stdout = output
+	err := process.InNetworkNamespace(taskNetworkNamespacePath(), command.Start)
+	if err != nil {
+		t.Fatalf("Could not start command in network namespace: %v", err)
+	}
+	err = command.Wait()
+	if err != nil {
+		t.Fatalf("Command failed: %v", err)
+	}
+	if lines := strings.Split(strings.TrimSpace(output.String()), "\n"); len(lines) != 1 || !strings.Contains(lines[0], " lo:") {
+		t.Fatalf("Expected command to only see the loopback interface, but got:\n%v", output)
+	}
+	// the worker itself should still be in its own network namespace
+	workerNamespace, err := os.Stat("/proc/self/ns/net")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	taskNamespace, err := os.Stat(taskNetworkNamespacePath())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if os.SameFile(workerNamespace, taskNamespace) {
+		t.Fatal("Expected worker to remain in its own network namespace")
+	}
+}
+
+func TestRouteInterfaces(t *testing.T) {
+	routes := strings.Join([]string{
+		"default via 10.0.0.1 dev eth0 proto dhcp metric 100",
+		"default via 192.168.0.1 dev wlan0 proto dhcp metric 600",
+		"140.82.112.3 via 10.0.0.1 dev eth0 src 10.0.0.5 uid 0 \\    cache",
+		"127.0.0.53 dev lo src 127.0.0.1 uid 0 \\    cache",
+		"10.213.0.2 dev " + taskHostInterface + " src 10.213.0.1 uid 0 \\    cache",
+	}, "\n")
+	interfaces := routeInterfaces(routes)
+	if len(interfaces) != 2 || interfaces[0] != "eth0" || interfaces[1] != "wlan0" {
+		t.Fatalf("Expected egress interfaces eth0 and wlan0, but got %v", interfaces)
+	}
+}
+
+func TestForwardingRestored(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("Changing forwarding settings requires root")
+	}
+	iface := "gw-test"
+	err := host.Run("ip", "link", "add", iface, "type", "veth", "peer", "name", iface+"-peer")
+	if err != nil {
+		t.Skipf("Could not create veth pair: %v", err)
+	}
+	defer func() {
+		_ = host.Run("ip", "link", "del", iface)
+	}()
+	err = ioutil.WriteFile(forwardingSysctl(iface), []byte("0"), 0644)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	n := &taskNetwork{
+		forwarding: map[string]string{},
+	}
+	err = n.enableForwarding([]string{iface})
+	if err != nil {
+		t.Fatalf("Could not enable forwarding: %v", err)
+	}
+	if forwarding, _ := ioutil.ReadFile(forwardingSysctl(iface)); strings.TrimSpace(string(forwarding)) != "1" {
+		t.Fatalf("Expected forwarding to be enabled on %v, but it is %q", iface, forwarding)
+	}
+	n.restoreForwarding()
+	if forwarding, _ := ioutil.ReadFile(forwardingSysctl(iface)); strings.TrimSpace(string(forwarding)) != "0" {
+		t.Fatalf("Expected forwarding to be disabled again on %v, but it is %q", iface, forwarding)
+	}
+}
+
+func TestTCPForwarding(t *testing.T) {
+	defer createTestNetworkNamespace(t)()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		fmt.Fprintf(conn, "echo: %v", line)
+	}()
+
+	n := &taskNetwork{}
+	defer n.closeForwarders()
+	err = n.forward("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	var conn net.Conn
+	err = process.InNetworkNamespace(taskNetworkNamespacePath(), func() (err error) {
+		conn, err = net.Dial("tcp", listener.Addr().String())
+		return
+	})
+	if err != nil {
+		t.Fatalf("Could not connect from network namespace: %v", err)
+	}
+	defer conn.Close()
+	fmt.Fprint(conn, "hello\n")
+	response, _ := bufio.NewReader(conn).ReadString('\n')
+	if response != "echo: hello\n" {
+		t.Fatalf("Got unexpected response %q", response)
+	}
+}
+
+func TestUDPForwarding(t *testing.T) {
+	defer createTestNetworkNamespace(t)()
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer server.Close()
+	go func() {
+		buffer := make([]byte, 1024)
+		n, client, err := server.ReadFrom(buffer)
+		if err != nil {
+			return
+		}
+		_, _ = server.WriteTo(append([]byte("echo: "), buffer[:n]...), client)
+	}()
+
+	n := &taskNetwork{}
+	defer n.closeForwarders()
+	err = n.forward("udp", server.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	var conn net.Conn
+	err = process.InNetworkNamespace(taskNetworkNamespacePath(), func() (err error) {
+		conn, err = net.Dial("udp", server.LocalAddr().String())
+		return
+	})
+	if err != nil {
+		t.Fatalf("Could not connect from network namespace: %v", err)
+	}
+	defer conn.Close()
+	fmt.Fprint(conn, "hello")
+	response := make([]byte, 1024)
+	count, err := conn.Read(response)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if string(response[:count]) != "echo: hello" {
+		t.Fatalf("Got unexpected response %q", response[:count])
+	}
+}
+
+func TestNetworkIsolation(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("Network isolation requires root")
+	}
+	if _, err := exec.LookPath("iptables"); err != nil {
+		t.Skip("Network isolation requires iptables")
+	}
+	_, teardown := setupWithFakeServices(t)
+	defer teardown()
+	config.NetworkIsolation = "always"
+	config.NetworkIsolationSubnet = "10.213.0.0/30"
+	payload := GenericWorkerPayload{
+		Command: [][]string{
+			{"ip", "-o", "-4", "addr"},
+		},
+		MaxRunTime: 30,
+	}
+	td := testTask(t)
+
+	taskID := submitAndAssert(t, td, payload, "completed", "completed")
+
+	logtext, _, _, _ := getArtifactContent(t, taskID, "public/logs/live_backing.log")
+	if !strings.Contains(string(logtext), "[network isolation] Egress is blocked") || !strings.Contains(string(logtext), "10.213.0.2/30") {
+		t.Fatalf("Expected task command to run in isolated network namespace:\n%s", logtext)
+	}
+}
@@ -0,0 +1,111 @@
+// +build darwin,!docker linux,!docker freebsd
+
+package main
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestParseEgressEntry(t *testing.T) {
+	for _, entry := range []struct {
+		entry   string
+		network string
+		host    string
+	}{
+		{entry: "10.0.0.0/8", network: "10.0.0.0/8"},
+		{entry: "192.168.1.7/24", network: "192.168.1.0/24"},
+		{entry: "1.2.3.4", network: "1.2.3.4/32"},
+		{entry: "github.com", host: "github.com"},
+	} {
+		network, host, err := parseEgressEntry(entry.entry)
+		if err != nil {
+			t.Fatalf("Could not parse egress allowlist entry %q: %v", entry.entry, err)
+		}
+		if network != nil && network.String() != entry.network || network == nil && entry.network != "" || host != entry.host {
+			t.Fatalf("Expected %q to be parsed as network %q and host %q, but got %v and %q", entry.entry, entry.network, entry.host, network, host)
+		}
+	}
+	for _, entry := range []string{"", "10.0.0.0/33", "fd00::/8", "::1", "bad host"} {
+		if _, _, err := parseEgressEntry(entry); err == nil {
+			t.Fatalf("Expected egress allowlist entry %q to be invalid", entry)
+		}
+	}
+}
+
+func TestTaskNetworkAddresses(t *testing.T) {
+	hostIP, taskIP, prefixLength, err := taskNetworkAddresses("10.213.0.0/30")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if hostIP.String() != "10.213.0.1" || taskIP.String() != "10.213.0.2" || prefixLength != 30 {
+		t.Fatalf("Got unexpected task network addresses %v, %v, /%v", hostIP, taskIP, prefixLength)
+	}
+	for _, subnet := range []string{"10.213.0.0/31", "fd00::/64", "10.213.0.0"} {
+		if _, _, _, err := taskNetworkAddresses(subnet); err == nil {
+			t.Fatalf("Expected subnet %q to be invalid", subnet)
+		}
+	}
+}
+
+func TestEgressRules(t *testing.T) {
+	_, allowed, _ := net.ParseCIDR("0.0.0.0/0")
+	rules := egressRules("EGRESS", []*net.IPNet{allowed}, []net.IP{net.ParseIP("10.0.0.2")})
+	args := make([][]string, len(rules))
+	for i, rule := range rules {
+		args[i] = rule.args("-A")
+	}
+	expected := [][]string{
+		// the instance metadata endpoint is blocked, even if allowed
+		{"-w", "-t", "filter", "-A", "EGRESS", "-d", "169.254.169.254/32", "-j", "DROP"},
+		{"-w", "-t", "filter", "-A", "EGRESS", "-d", "10.0.0.2/32", "-p", "udp", "--dport", "53", "-j", "ACCEPT"},
+		{"-w", "-t", "filter", "-A", "EGRESS", "-d", "10.0.0.2/32", "-p", "tcp", "--dport", "53", "-j", "ACCEPT"},
+		{"-w", "-t", "filter", "-A", "EGRESS", "-d", "0.0.0.0/0", "-j", "ACCEPT"},
+		{"-w", "-t", "filter", "-A", "EGRESS", "-j", "DROP"},
+	}
+	if !reflect.DeepEqual(args, expected) {
+		t.Fatalf("Expected egress rules\n%q\nbut got\n%q", expected, args)
+	}
+}
+
+func TestParseNameservers(t *testing.T) {
+	nameservers := parseNameservers("# comment\nnameserver 127.0.0.53\nnameserver fe80::1\nsearch example.com\nnameserver 10.0.0.2\n")
+	if len(nameservers) != 2 || nameservers[0].String() != "127.0.0.53" || nameservers[1].String() != "10.0.0.2" {
+		t.Fatalf("Got unexpected name servers %v", nameservers)
+	}
+}
+
+func TestNetworkIsolationDisabled(t *testing.T) {
+	_, teardown := setupWithFakeServices(t)
+	defer teardown()
+	config.NetworkIsolation = "disabled"
+	payload := GenericWorkerPayload{
+		Command:    helloGoodbye(),
+		MaxRunTime: 30,
+		Features: FeatureFlags{
+			NetworkIsolation: true,
+		},
+	}
+	td := testTask(t)
+
+	_ = submitAndAssert(t, td, payload, "exception", "malformed-payload")
+}
+
+func TestEgressAllowlistRequiresScopes(t *testing.T) {
+	_, teardown := setupWithFakeServices(t)
+	defer teardown()
+	// scopes are checked before the worker config, so this test does not
+	// require network isolation to be supported
+	payload := GenericWorkerPayload{
+		Command:    helloGoodbye(),
+		MaxRunTime: 30,
+		Features: FeatureFlags{
+			NetworkIsolation: true,
+		},
+		EgressAllowlist: []string{"10.0.0.0/8"},
+	}
+	td := testTask(t)
+
+	_ = submitAndAssert(t, td, payload, "exception", "malformed-payload")
+}
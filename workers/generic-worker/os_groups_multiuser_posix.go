@@ -0,0 +1,41 @@
+// +build multiuser,darwin multiuser,linux
+
+package main
+
+import (
+	"fmt"
+)
+
+func (osGroups *OSGroups) Start() *CommandExecutionError {
+	groups := osGroups.Task.Payload.OSGroups
+	if len(groups) == 0 {
+		return nil
+	}
+	if config.RunTasksAsCurrentUser {
+		osGroups.Task.Infof("Not adding task user to group(s) %v since we are running as current user.", groups)
+		return nil
+	}
+	updatedGroups, notUpdatedGroups := osGroups.Task.addUserToGroups(groups)
+	osGroups.AddedGroups = updatedGroups
+	if len(notUpdatedGroups) > 0 {
+		return MalformedPayloadError(fmt.Errorf("Could not add task user to os group(s): %v", notUpdatedGroups))
+	}
+	// Task commands get their supplementary groups from their process
+	// attributes, not from the user database, so they need to be updated.
+	gids, err := groupIDs(taskContext.User.Name)
+	if err != nil {
+		return executionError(internalError, errored, err)
+	}
+	for _, command := range osGroups.Task.allCommands() {
+		setSupplementaryGroups(command, gids)
+	}
+	return nil
+}
+
+func (osGroups *OSGroups) Stop(err *ExecutionErrors) {
+	groups := osGroups.AddedGroups
+	_, notUpdatedGroups := osGroups.Task.removeUserFromGroups(groups)
+	if len(notUpdatedGroups) > 0 {
+		err.add(MalformedPayloadError(fmt.Errorf("Could not remove task user from os group(s): %v", notUpdatedGroups)))
+	}
+}
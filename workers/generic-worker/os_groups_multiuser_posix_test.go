@@ -0,0 +1,55 @@
+// +build multiuser,darwin multiuser,linux
+
+package main
+
+import (
+	"os/exec"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestOSGroupsAddedToTaskCommands(t *testing.T) {
+	defer setup(t)()
+	if config.RunTasksAsCurrentUser {
+		t.Skip("Task user is not added to groups when running tasks as current user")
+	}
+	// a group that exists by default, but that the task user isn't a member of
+	group := "video"
+	if runtime.GOOS == "darwin" {
+		group = "_developer"
+	}
+	payload := GenericWorkerPayload{
+		Command: [][]string{
+			{"id", "-Gn"},
+		},
+		MaxRunTime: 30,
+		OSGroups:   []string{group},
+	}
+	td := testTask(t)
+	td.Scopes = []string{
+		"generic-worker:os-group:" + td.ProvisionerID + "/" + td.WorkerType + "/" + group,
+	}
+
+	taskID := submitAndAssert(t, td, payload, "completed", "completed")
+
+	logtext, _, _, _ := getArtifactContent(t, taskID, "public/logs/live_backing.log")
+	found := false
+	for _, line := range strings.Split(string(logtext), "\n") {
+		// skip worker log lines, which may mention the payload
+		if strings.HasPrefix(line, "[") {
+			continue
+		}
+		for _, field := range strings.Fields(line) {
+			if field == group {
+				found = true
+			}
+		}
+	}
+	if !found {
+		t.Fatalf("Expected task command to run with group %v:\n%s", group, logtext)
+	}
+	if out, err := exec.Command("id", "-Gn", taskContext.User.Name).Output(); err != nil || strings.Contains(" "+strings.TrimSpace(string(out))+" ", " "+group+" ") {
+		t.Fatalf("Expected task user to have been removed from group %v again, but has groups %q (%v)", group, out, err)
+	}
+}
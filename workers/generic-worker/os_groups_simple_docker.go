@@ -0,0 +1,21 @@
+// +build simple docker
+
+package main
+
+import (
+	"fmt"
+)
+
+func (osGroups *OSGroups) ValidatePayload() *CommandExecutionError {
+	if len(osGroups.Task.Payload.OSGroups) > 0 {
+		return MalformedPayloadError(atPayloadValue("/osGroups", fmt.Errorf("osGroups feature is not supported by the %v engine - please modify task definition and try again", engine)))
+	}
+	return nil
+}
+
+func (osGroups *OSGroups) Start() *CommandExecutionError {
+	return nil
+}
+
+func (osGroups *OSGroups) Stop(err *ExecutionErrors) {
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/taskcluster/slugid-go/slugid"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/gwconfig"
+)
+
+var sha256Pattern = regexp.MustCompile(`^[a-f0-9]{64}$`)
+
+// IndexedContent is content of config setting prewarmCaches that is an
+// artifact of the task that is indexed at the given namespace, when the worker
+// starts.
+type IndexedContent struct {
+	Namespace string `json:"namespace"`
+	Artifact  string `json:"artifact"`
+	Sha256    string `json:"sha256"`
+}
+
+// prewarmEntry is a validated entry of config setting prewarmCaches
+type prewarmEntry struct {
+	gwconfig.PrewarmCache
+	// content is nil if the content is indexed content, until it is resolved
+	content FSContent
+	indexed *IndexedContent
+}
+
+// prewarmCaches downloads the content of config setting prewarmCaches into
+// the file caches, and extracts the content of entries with a cache name into
+// new writable directory caches, so that tasks on a fresh worker get cache
+// hits. It is called when the mounts feature is initialised, before the
+// worker claims its first task. Invalid entries are returned as an error
+// before any content is downloaded. Content that cannot be downloaded, or does
+// not have the required SHA256, is only logged, and left to be downloaded by
+// the tasks that mount it.
+func prewarmCaches() error {
+	entries := []*prewarmEntry{}
+	cacheNames := map[string]bool{}
+	for i, c := range config.PrewarmCaches {
+		entry, err := newPrewarmEntry(c)
+		if err != nil {
+			return fmt.Errorf("Invalid entry %v in config setting prewarmCaches: %v", i, err)
+		}
+		if cacheNames[c.CacheName] {
+			return fmt.Errorf("Invalid entry %v in config setting prewarmCaches: cache name %q is used by more than one entry", i, c.CacheName)
+		}
+		if c.CacheName != "" {
+			cacheNames[c.CacheName] = true
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	log.Printf("[mounts] Pre-warming %v caches", len(entries))
+	// messages about the downloads go to the worker log, since there is no
+	// task log yet
+	task := &TaskRun{
+		logWriter: log.Writer(),
+	}
+	concurrency := int(config.MaxConcurrentMounts)
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for _, entry := range entries {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(entry *prewarmEntry) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			err := entry.prewarm(task)
+			if err != nil {
+				log.Printf("WARNING: [mounts] Could not pre-warm cache with content %s: %v", entry.Content, err)
+			}
+		}(entry)
+	}
+	wg.Wait()
+	log.Print("[mounts] Finished pre-warming caches")
+	return nil
+}
+
+// newPrewarmEntry validates the given entry of config setting prewarmCaches
+func newPrewarmEntry(c gwconfig.PrewarmCache) (*prewarmEntry, error) {
+	entry := &prewarmEntry{
+		PrewarmCache: c,
+	}
+	if c.CacheName != "" {
+		switch c.Format {
+		case "rar", "tar.bz2", "tar.gz", "zip":
+		default:
+			return nil, fmt.Errorf("format must be one of \"rar\", \"tar.bz2\", \"tar.gz\" or \"zip\", since cache name %q is set", c.CacheName)
+		}
+	} else if c.Format != "" {
+		return nil, fmt.Errorf("format %q is set, but cache name is not", c.Format)
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(c.Content, &m); err != nil {
+		return nil, fmt.Errorf("invalid content: %v", err)
+	}
+	var sha256 string
+	switch {
+	case m["namespace"] != nil:
+		entry.indexed = &IndexedContent{}
+		if err := json.Unmarshal(c.Content, entry.indexed); err != nil {
+			return nil, fmt.Errorf("invalid indexed content: %v", err)
+		}
+		if entry.indexed.Artifact == "" {
+			return nil, fmt.Errorf("indexed content %s has no artifact", c.Content)
+		}
+		sha256 = entry.indexed.Sha256
+	case m["artifact"] != nil:
+		ac := &ArtifactContent{}
+		if err := json.Unmarshal(c.Content, ac); err != nil {
+			return nil, fmt.Errorf("invalid artifact content: %v", err)
+		}
+		if ac.TaskID == "" {
+			return nil, fmt.Errorf("artifact content %s has no taskId", c.Content)
+		}
+		entry.content = ac
+		sha256 = ac.Sha256
+	case m["url"] != nil:
+		uc := &URLContent{}
+		if err := json.Unmarshal(c.Content, uc); err != nil {
+			return nil, fmt.Errorf("invalid url content: %v", err)
+		}
+		entry.content = uc
+		sha256 = uc.Sha256
+	default:
+		return nil, fmt.Errorf("content %s must have property url, artifact (with taskId) or namespace (with artifact)", c.Content)
+	}
+	if !sha256Pattern.MatchString(sha256) {
+		return nil, fmt.Errorf("content %s must have property sha256, with the hex encoded SHA256 of the content", c.Content)
+	}
+	return entry, nil
+}
+
+// prewarm downloads the content of the entry into the file caches, unless it
+// is cached already, and extracts it into a new writable directory cache, if
+// the entry has a cache name and the worker does not have a writable
+// directory cache with that name already.
+func (entry *prewarmEntry) prewarm(task *TaskRun) error {
+	if entry.indexed != nil {
+		indexedTask, err := config.Index().FindTask(entry.indexed.Namespace)
+		if err != nil {
+			return fmt.Errorf("could not find task indexed at %v: %v", entry.indexed.Namespace, err)
+		}
+		entry.content = &ArtifactContent{
+			TaskID:   indexedTask.TaskID,
+			Artifact: entry.indexed.Artifact,
+			Sha256:   entry.indexed.Sha256,
+		}
+	}
+	if entry.CacheName == "" {
+		lock := lockContent(entry.content.UniqueKey())
+		defer lock.unlock()
+		_, err := ensureCached(entry.content, task)
+		return err
+	}
+	cachesMutex.Lock()
+	_, exists := directoryCaches[entry.CacheName]
+	cachesMutex.Unlock()
+	if exists {
+		log.Printf("[mounts] Not pre-warming writable directory cache %v, since it exists already", entry.CacheName)
+		return nil
+	}
+	location := filepath.Join(config.CachesDir, slugid.Nice())
+	err := extract(entry.content, entry.Format, location, task)
+	if err != nil {
+		_ = os.RemoveAll(location)
+		return err
+	}
+	cachesMutex.Lock()
+	directoryCaches[entry.CacheName] = &Cache{
+		Created:  time.Now(),
+		Location: location,
+		Owner:    directoryCaches,
+		Key:      entry.CacheName,
+	}
+	cachesMutex.Unlock()
+	log.Printf("[mounts] Pre-warmed writable directory cache %v at %v", entry.CacheName, location)
+	return nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/gwconfig"
+)
+
+func TestPrewarmCaches(t *testing.T) {
+	defer prepareEnvironment(t)()
+	configureWorker(t)
+	server := httptest.NewServer(http.FileServer(http.Dir(testdataDir)))
+	defer server.Close()
+
+	zipURL := server.URL + "/unknown_issuer_app_1.zip"
+	fileURL := server.URL + "/SampleArtifacts/_/X.txt"
+	config.PrewarmCaches = []gwconfig.PrewarmCache{
+		{
+			Content: json.RawMessage(`{"url": "` + fileURL + `", "sha256": "8308d593eb56527137532595a60255a3fcfbe4b6b068e29b22d99742bad80f6f"}`),
+		},
+		{
+			CacheName: "unknown-issuer-app",
+			Content:   json.RawMessage(`{"url": "` + zipURL + `", "sha256": "625554ec8ce731e486a5fb904f3331d18cf84a944dd9e40c19550686d4e8492e"}`),
+			Format:    "zip",
+		},
+		// wrong SHA256, so should not prevent the worker from starting
+		{
+			Content: json.RawMessage(`{"url": "` + server.URL + `/mozharness.zip", "sha256": "7777777777777777777777777777777777777777777777777777777777777777"}`),
+		},
+	}
+	err := (&MountsFeature{}).Initialise()
+	if err != nil {
+		t.Fatalf("Could not initialise mounts feature: %v", err)
+	}
+
+	for _, key := range []string{"urlcontent:" + fileURL, "urlcontent:" + zipURL} {
+		if cache := fileCaches[key]; cache == nil {
+			t.Fatalf("Expected file cache %v to be pre-warmed", key)
+		}
+	}
+	if cache := fileCaches["urlcontent:"+server.URL+"/mozharness.zip"]; cache != nil {
+		t.Fatalf("Expected content with wrong SHA256 not to be cached, but got cache %v", cache)
+	}
+	cache := directoryCaches["unknown-issuer-app"]
+	if cache == nil {
+		t.Fatal("Expected writable directory cache unknown-issuer-app to be pre-warmed")
+	}
+	if _, err := os.Stat(filepath.Join(cache.Location, "META-INF", "ids.json")); err != nil {
+		t.Fatalf("Expected zip to be extracted into writable directory cache: %v", err)
+	}
+}
+
+func TestPrewarmCachesInvalidConfig(t *testing.T) {
+	defer prepareEnvironment(t)()
+	configureWorker(t)
+	for _, test := range []struct {
+		entry    gwconfig.PrewarmCache
+		expected string
+	}{
+		{
+			entry:    gwconfig.PrewarmCache{Content: json.RawMessage(`{"url": "https://example.com/toolchain.zip"}`)},
+			expected: "must have property sha256",
+		},
+		{
+			entry:    gwconfig.PrewarmCache{Content: json.RawMessage(`{"raw": "hello"}`)},
+			expected: "must have property url, artifact (with taskId) or namespace (with artifact)",
+		},
+		{
+			entry: gwconfig.PrewarmCache{
+				CacheName: "toolchain",
+				Content:   json.RawMessage(`{"namespace": "project.toolchains.latest", "artifact": "public/toolchain.7z", "sha256": "625554ec8ce731e486a5fb904f3331d18cf84a944dd9e40c19550686d4e8492e"}`),
+				Format:    "7z",
+			},
+			expected: "format must be one of",
+		},
+	} {
+		config.PrewarmCaches = []gwconfig.PrewarmCache{test.entry}
+		err := prewarmCaches()
+		if err == nil || !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("Expected error containing %q for entry %s, but got %v", test.expected, test.entry.Content, err)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+// +build simple multiuser
+
+package process
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// Cgroup is a control group that commands can be started in. Every process
+// that such a command spawns also belongs to the cgroup, even if it leaves
+// the process group of the command or clears its environment, and cannot
+// leave the cgroup without root privileges.
+type Cgroup struct {
+	// mountPoint is the directory the cgroup hierarchy is mounted at, and
+	// path the directory of the cgroup within it
+	mountPoint string
+	path       string
+	// v1 is true if the cgroup belongs to a cgroup v1 hierarchy, in which
+	// individual threads can be moved between cgroups
+	v1 bool
+}
+
+// NewCgroup creates a cgroup with the given name, as a child of the cgroup
+// of the worker, or returns it if it already exists, e.g. since the worker
+// was interrupted while running a task. The pids hierarchy is used on hosts
+// with cgroup v1, since it does not otherwise affect processes. Creating a
+// cgroup requires root privileges.
+func NewCgroup(name string) (*Cgroup, error) {
+	cg := &Cgroup{}
+	mountPoint := "/sys/fs/cgroup/pids"
+	controller := "pids"
+	if _, err := os.Stat(mountPoint); err == nil {
+		cg.v1 = true
+	} else {
+		mountPoint = "/sys/fs/cgroup"
+		controller = ""
+		if _, err := os.Stat(filepath.Join(mountPoint, "cgroup.controllers")); err != nil {
+			// hybrid hierarchy, with cgroup v2 mounted alongside cgroup v1
+			mountPoint = "/sys/fs/cgroup/unified"
+		}
+	}
+	parent, err := cgroupOf("/proc/self/cgroup", controller)
+	if err != nil {
+		return nil, err
+	}
+	cg.mountPoint = mountPoint
+	cg.path = filepath.Join(mountPoint, parent, name)
+	err = os.Mkdir(cg.path, 0755)
+	if err != nil && !os.IsExist(err) {
+		return nil, err
+	}
+	return cg, nil
+}
+
+// cgroupOf returns the path of the cgroup listed in the given
+// /proc/<pid>/cgroup or /proc/<pid>/task/<tid>/cgroup file, in the cgroup
+// v1 hierarchy of the given controller, or in the cgroup v2 hierarchy if
+// controller is "".
+func cgroupOf(file, controller string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// hierarchy-ID:controller-list:cgroup-path
+		fields := strings.SplitN(scanner.Text(), ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		if controller == "" && fields[0] == "0" {
+			return fields[2], nil
+		}
+		for _, c := range strings.Split(fields[1], ",") {
+			if controller != "" && c == controller {
+				return fields[2], nil
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("no %q cgroup listed in %v", controller, file)
+}
+
+// Processes returns the process IDs of the processes in the cgroup.
+func (cg *Cgroup) Processes() ([]int, error) {
+	procs, err := ioutil.ReadFile(filepath.Join(cg.path, "cgroup.procs"))
+	if err != nil {
+		return nil, err
+	}
+	pids := []int{}
+	for _, line := range strings.Fields(string(procs)) {
+		pid, err := strconv.Atoi(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid process ID %q in %v: %v", line, cg.path, err)
+		}
+		pids = append(pids, pid)
+	}
+	return pids, nil
+}
+
+// Remove removes the cgroup, which fails if it still contains processes.
+func (cg *Cgroup) Remove() error {
+	return os.Remove(cg.path)
+}
+
+// SetCgroup causes the command to be started in the given cgroup.
+func (c *Command) SetCgroup(cg *Cgroup) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.cgroup = cg
+}
+
+// startIn calls start, which starts cmd, such that cmd is started in the
+// cgroup. With cgroup v1, start is called on an OS thread that has joined
+// the cgroup, so that the process is created in the cgroup. Since cgroup v2
+// only allows whole processes to be moved, the process is moved into the
+// cgroup immediately after it has started instead.
+func (cg *Cgroup) startIn(cmd *exec.Cmd, start func() error) error {
+	if !cg.v1 {
+		err := start()
+		if err != nil {
+			return err
+		}
+		err = writeID(filepath.Join(cg.path, "cgroup.procs"), cmd.Process.Pid)
+		if err != nil {
+			// the command is already running, so this is not fatal
+			log.Printf("WARNING: could not move process %v into cgroup %v: %v", cmd.Process.Pid, cg.path, err)
+		}
+		return nil
+	}
+	runtime.LockOSThread()
+	tid := unix.Gettid()
+	original, err := cgroupOf(fmt.Sprintf("/proc/self/task/%v/cgroup", tid), "pids")
+	if err != nil {
+		runtime.UnlockOSThread()
+		return fmt.Errorf("could not determine cgroup of current thread: %v", err)
+	}
+	err = writeID(filepath.Join(cg.path, "tasks"), tid)
+	if err != nil {
+		runtime.UnlockOSThread()
+		return fmt.Errorf("could not join cgroup %v: %v", cg.path, err)
+	}
+	defer func() {
+		err := writeID(filepath.Join(cg.mountPoint, original, "tasks"), tid)
+		if err != nil {
+			// Leave the thread locked, so that the Go runtime terminates it
+			// when the goroutine exits, rather than reusing it.
+			log.Printf("WARNING: could not restore cgroup of thread: %v", err)
+			return
+		}
+		runtime.UnlockOSThread()
+	}()
+	return start()
+}
+
+// writeID writes the given process or thread ID to the given cgroup file,
+// such as cgroup.procs, which moves the process or thread into the cgroup.
+func writeID(file string, id int) error {
+	return ioutil.WriteFile(file, []byte(strconv.Itoa(id)), 0644)
+}
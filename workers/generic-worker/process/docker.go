@@ -128,3 +128,7 @@ func NewCommand(commandLine []string, workingDirectory string, env []string) (*C
 func (c *Command) Kill() ([]byte, error) {
 	return nil, nil
 }
+
+func (c *Command) Terminate(gracePeriod time.Duration, timedOut bool) ([]byte, error) {
+	return c.Kill()
+}
@@ -22,6 +22,18 @@ type Command struct {
 	// return even if cmd.Wait() is blocked. This is useful since cmd.Wait()
 	// sometimes does not return promptly.
 	abort chan struct{}
+	// exited channel is closed when cmd.Wait() returns
+	exited chan struct{}
+	// terminated is set when Terminate() is called, and timedOut if the
+	// command was terminated since it exceeded its maximum run time
+	terminated bool
+	timedOut   bool
+	// networkNamespace is the path of the network namespace to start the
+	// command in, or "" to start it in the network namespace of the worker
+	networkNamespace string
+	// cgroup is the cgroup to start the command in, or nil to start it in
+	// the cgroup of the worker
+	cgroup *Cgroup
 }
 
 type Result struct {
@@ -29,15 +41,18 @@ type Result struct {
 	ExitError   *exec.ExitError
 	Duration    time.Duration
 	Aborted     bool
-	KernelTime  time.Duration
-	UserTime    time.Duration
+	// TimedOut is true if the command was aborted since it exceeded its
+	// maximum run time, rather than e.g. because the task was cancelled
+	TimedOut   bool
+	KernelTime time.Duration
+	UserTime   time.Duration
 }
 
 // ExitCode returns the exit code, or
 //  -1 if the process has not exited
 //  -2 if the process crashed
 //  -3 it could not be established what happened
-//  -4 if process was aborted
+//  -4 if process was aborted (including if it timed out)
 func (r *Result) ExitCode() int {
 	if r.Aborted {
 		return -4
@@ -58,7 +73,7 @@ func (c *Command) Execute() (r *Result) {
 	r = &Result{}
 	started := time.Now()
 	c.mutex.Lock()
-	err := c.Start()
+	err := c.start()
 	c.mutex.Unlock()
 	if err != nil {
 		r.SystemError = err
@@ -68,6 +83,7 @@ func (c *Command) Execute() (r *Result) {
 	// wait for command to complete in separate go routine, so we handle abortion in parallel to command termination
 	go func() {
 		err := c.Wait()
+		close(c.exited)
 		exitErr <- err
 	}()
 	select {
@@ -85,6 +101,11 @@ func (c *Command) Execute() (r *Result) {
 		r.SystemError = fmt.Errorf("Process aborted")
 		r.Aborted = true
 	}
+	c.mutex.RLock()
+	// the process may have exited within the grace period of Terminate()
+	r.Aborted = r.Aborted || c.terminated
+	r.TimedOut = c.timedOut
+	c.mutex.RUnlock()
 	finished := time.Now()
 	// Round(0) forces wall time calculation instead of monotonic time in case machine slept etc
 	r.Duration = finished.Round(0).Sub(started)
@@ -97,7 +118,7 @@ func (c *Command) String() string {
 
 func (r *Result) String() string {
 	if r.Aborted {
-		return fmt.Sprintf("Command ABORTED after %v", r.Duration)
+		return fmt.Sprintf("Command %v after %v", r.Verdict(), r.Duration)
 	}
 	if r.SystemError != nil {
 		return fmt.Sprintf("System error executing command: %v", r.SystemError)
@@ -118,6 +139,8 @@ func (r *Result) String() string {
 
 func (r *Result) Verdict() string {
 	switch {
+	case r.TimedOut:
+		return "TIMED OUT"
 	case r.Aborted:
 		return "ABORTED"
 	case r.ExitError == nil:
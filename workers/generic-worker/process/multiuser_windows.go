@@ -104,8 +104,9 @@ func NewCommand(commandLine []string, workingDirectory string, env []string, pd
 		}
 	}
 	return &Command{
-		Cmd:   cmd,
-		abort: make(chan struct{}),
+		Cmd:    cmd,
+		abort:  make(chan struct{}),
+		exited: make(chan struct{}),
 	}, nil
 }
 
@@ -178,3 +179,19 @@ func GrantSIDWinstaAccess(sid string, pd *PlatformData) {
 		sidsThatCanControlDesktopAndWindowsStation[sid] = true
 	}
 }
+
+// Terminate kills the process tree of the command. Windows has no equivalent
+// of SIGTERM for console processes, so gracePeriod is ignored. If timedOut is
+// true, the Result of Execute records that the command exceeded its maximum
+// run time, rather than that it was aborted.
+func (c *Command) Terminate(gracePeriod time.Duration, timedOut bool) (killOutput string, err error) {
+	c.mutex.Lock()
+	if c.terminated {
+		c.mutex.Unlock()
+		return "", nil
+	}
+	c.terminated = true
+	c.timedOut = timedOut
+	c.mutex.Unlock()
+	return c.Kill()
+}
@@ -0,0 +1,82 @@
+// +build simple multiuser
+
+package process
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+
+	"golang.org/x/sys/unix"
+)
+
+// SetNetworkNamespace causes the command to be started in the network
+// namespace bound to the given path, e.g. /var/run/netns/<name>, rather than
+// in the network namespace of the worker.
+func (c *Command) SetNetworkNamespace(path string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.networkNamespace = path
+}
+
+// InNetworkNamespace calls f in the network namespace that the command is
+// started in, e.g. in order to connect to a port that the command listens
+// on.
+func (c *Command) InNetworkNamespace(f func() error) error {
+	c.mutex.RLock()
+	path := c.networkNamespace
+	c.mutex.RUnlock()
+	if path == "" {
+		return f()
+	}
+	return InNetworkNamespace(path, f)
+}
+
+func (c *Command) start() error {
+	start := c.Start
+	if c.cgroup != nil {
+		start = func() error {
+			return c.cgroup.startIn(c.Cmd, c.Start)
+		}
+	}
+	if c.networkNamespace == "" {
+		return start()
+	}
+	return InNetworkNamespace(c.networkNamespace, start)
+}
+
+// InNetworkNamespace calls f on an OS thread that has joined the network
+// namespace bound to the given path. Processes started and sockets created by
+// f belong to that network namespace. Other goroutines are unaffected.
+func InNetworkNamespace(path string, f func() error) error {
+	runtime.LockOSThread()
+	original, err := os.Open(fmt.Sprintf("/proc/self/task/%v/ns/net", unix.Gettid()))
+	if err != nil {
+		runtime.UnlockOSThread()
+		return fmt.Errorf("could not open network namespace of current thread: %v", err)
+	}
+	defer original.Close()
+	target, err := os.Open(path)
+	if err != nil {
+		runtime.UnlockOSThread()
+		return fmt.Errorf("could not open network namespace %v: %v", path, err)
+	}
+	defer target.Close()
+	err = unix.Setns(int(target.Fd()), unix.CLONE_NEWNET)
+	if err != nil {
+		runtime.UnlockOSThread()
+		return fmt.Errorf("could not join network namespace %v: %v", path, err)
+	}
+	defer func() {
+		err := unix.Setns(int(original.Fd()), unix.CLONE_NEWNET)
+		if err != nil {
+			// Leave the thread locked, so that the Go runtime terminates it
+			// when the goroutine exits, rather than reusing it.
+			log.Printf("WARNING: could not restore network namespace of thread: %v", err)
+			return
+		}
+		runtime.UnlockOSThread()
+	}()
+	return f()
+}
@@ -0,0 +1,18 @@
+// +build simple,!linux multiuser,!linux
+
+package process
+
+func (c *Command) start() error {
+	return c.Start()
+}
+
+// InNetworkNamespace calls f in the network namespace that the command is
+// started in, which is always the network namespace of the worker.
+func (c *Command) InNetworkNamespace(f func() error) error {
+	return f()
+}
+
+// Cgroup is a control group, which commands can only be started in on
+// Linux.
+type Cgroup struct {
+}
@@ -0,0 +1,302 @@
+// +build simple
+
+package process
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// sandboxInit is the argv[0] that the worker executable is re-executed with,
+// in order to set up the sandbox of a command, before running the command.
+const sandboxInit = "generic-worker-sandbox-init"
+
+// Sandbox restricts the filesystem access of a command. The command runs in
+// its own user and mount namespaces, in which all mounts are read-only,
+// apart from WritablePaths, /tmp (which is an empty tmpfs, unless it contains
+// any of WritablePaths), /dev, /proc and /sys. HiddenPaths are replaced by an
+// empty file or directory.
+type Sandbox struct {
+	WritablePaths []string `json:"writablePaths"`
+	HiddenPaths   []string `json:"hiddenPaths"`
+}
+
+// sandboxSpec is passed to the sandbox init process, which sets up the
+// sandbox and then runs the command.
+type sandboxSpec struct {
+	Sandbox
+	Path string `json:"path"`
+	Dir  string `json:"dir"`
+}
+
+// SetSandbox causes the command to run inside the given sandbox. The
+// command is started by a sandbox init process, which is the worker
+// executable itself. The init process sets up the mounts of the sandbox,
+// and then runs the command in a nested user namespace, so that the command
+// cannot undo them.
+func (c *Command) SetSandbox(sandbox *Sandbox) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	dir, err := filepath.Abs(c.Dir)
+	if err != nil {
+		return fmt.Errorf("could not determine absolute path of working directory %v: %v", c.Dir, err)
+	}
+	spec, err := json.Marshal(&sandboxSpec{
+		Sandbox: *sandbox,
+		Path:    c.Path,
+		Dir:     dir,
+	})
+	if err != nil {
+		return err
+	}
+	c.Args = append([]string{sandboxInit, string(spec)}, c.Args...)
+	c.Path = "/proc/self/exe"
+	if c.SysProcAttr == nil {
+		c.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	c.SysProcAttr.Cloneflags |= syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS
+	c.SysProcAttr.UidMappings = []syscall.SysProcIDMap{{ContainerID: os.Geteuid(), HostID: os.Geteuid(), Size: 1}}
+	c.SysProcAttr.GidMappings = []syscall.SysProcIDMap{{ContainerID: os.Getegid(), HostID: os.Getegid(), Size: 1}}
+	// the init process needs to be able to mount filesystems, even though
+	// it does not run as root
+	c.SysProcAttr.AmbientCaps = []uintptr{unix.CAP_SYS_ADMIN}
+	return nil
+}
+
+func init() {
+	if len(os.Args) < 3 || os.Args[0] != sandboxInit {
+		return
+	}
+	// the command line of the sandbox init process is not under the control
+	// of the task, so any error is a problem setting up the sandbox
+	err := runSandboxed(os.Args[1], os.Args[2:])
+	fmt.Fprintf(os.Stderr, "generic-worker sandbox: %v\n", err)
+	os.Exit(126)
+}
+
+// runSandboxed sets up the sandbox described by the given spec, and runs
+// the command with the given arguments inside it. It only returns if the
+// sandbox could not be set up, or the command could not be started.
+// Otherwise, it exits with the exit status of the command.
+func runSandboxed(specJSON string, args []string) error {
+	var spec sandboxSpec
+	err := json.Unmarshal([]byte(specJSON), &spec)
+	if err != nil {
+		return fmt.Errorf("invalid sandbox spec: %v", err)
+	}
+	err = setupSandboxMounts(&spec.Sandbox)
+	if err != nil {
+		return err
+	}
+	// the original working directory may be on a mount that has since been
+	// made read-only
+	err = os.Chdir(spec.Dir)
+	if err != nil {
+		return err
+	}
+	cmd := &exec.Cmd{
+		Path:   spec.Path,
+		Args:   args,
+		Stdin:  os.Stdin,
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+		SysProcAttr: &syscall.SysProcAttr{
+			Cloneflags:  syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS,
+			UidMappings: []syscall.SysProcIDMap{{ContainerID: os.Geteuid(), HostID: os.Geteuid(), Size: 1}},
+			GidMappings: []syscall.SysProcIDMap{{ContainerID: os.Getegid(), HostID: os.Getegid(), Size: 1}},
+		},
+	}
+	// The command is in the same process group, so receives any signals sent
+	// to it directly. The init process waits for the command to exit.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP, syscall.SIGQUIT)
+	go func() {
+		for range signals {
+		}
+	}()
+	err = cmd.Start()
+	if err != nil {
+		return err
+	}
+	_ = cmd.Wait()
+	status, ok := cmd.ProcessState.Sys().(syscall.WaitStatus)
+	if ok && status.Signaled() {
+		// die from the same signal as the command
+		signal.Reset()
+		_ = syscall.Kill(os.Getpid(), status.Signal())
+		os.Exit(128 + int(status.Signal()))
+	}
+	os.Exit(cmd.ProcessState.ExitCode())
+	return nil
+}
+
+// setupSandboxMounts makes all mounts read-only, apart from the writable
+// paths of the sandbox and /dev, /proc and /sys, mounts an empty tmpfs on
+// /tmp, and hides the hidden paths of the sandbox.
+func setupSandboxMounts(sandbox *Sandbox) error {
+	// don't propagate any changes to the mounts of the worker
+	err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, "")
+	if err != nil {
+		return fmt.Errorf("could not make mounts private: %v", err)
+	}
+	writable := []string{"/dev", "/proc", "/sys"}
+	for _, path := range sandbox.WritablePaths {
+		// bind mount writable paths onto themselves, so that they are
+		// separate mounts, that are not made read-only
+		err := unix.Mount(path, path, "", unix.MS_BIND|unix.MS_REC, "")
+		if err != nil {
+			return fmt.Errorf("could not bind mount writable path %v: %v", path, err)
+		}
+		writable = append(writable, path)
+	}
+	mountPoints, err := mountPoints()
+	if err != nil {
+		return err
+	}
+	for _, mountPoint := range mountPoints {
+		if isUnderAny(mountPoint, writable) {
+			continue
+		}
+		err := remountReadOnly(mountPoint)
+		if err != nil {
+			return err
+		}
+	}
+	// an empty /tmp would hide any writable paths inside it
+	if !anyUnder(sandbox.WritablePaths, "/tmp") {
+		err = unix.Mount("tmpfs", "/tmp", "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, "mode=1777")
+		if err != nil {
+			return fmt.Errorf("could not mount tmpfs on /tmp: %v", err)
+		}
+	}
+	for _, path := range sandbox.HiddenPaths {
+		err := hide(path)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// remountReadOnly makes the mount at the given mount point read-only. The
+// other flags of the mount are preserved, since a user namespace may not
+// change them.
+func remountReadOnly(mountPoint string) error {
+	var stat unix.Statfs_t
+	err := unix.Statfs(mountPoint, &stat)
+	if err != nil {
+		if err == unix.ENOENT || err == unix.EACCES {
+			// not reachable by the command either
+			return nil
+		}
+		return fmt.Errorf("could not stat mount %v: %v", mountPoint, err)
+	}
+	if int64(stat.Flags)&unix.ST_RDONLY != 0 {
+		return nil
+	}
+	flags := uintptr(unix.MS_BIND | unix.MS_REMOUNT | unix.MS_RDONLY)
+	for st, ms := range map[int64]uintptr{
+		unix.ST_NOSUID:     unix.MS_NOSUID,
+		unix.ST_NODEV:      unix.MS_NODEV,
+		unix.ST_NOEXEC:     unix.MS_NOEXEC,
+		unix.ST_NOATIME:    unix.MS_NOATIME,
+		unix.ST_NODIRATIME: unix.MS_NODIRATIME,
+		unix.ST_RELATIME:   unix.MS_RELATIME,
+	} {
+		if int64(stat.Flags)&st != 0 {
+			flags |= ms
+		}
+	}
+	err = unix.Mount("", mountPoint, "", flags, "")
+	if err != nil {
+		return fmt.Errorf("could not make mount %v read-only: %v", mountPoint, err)
+	}
+	return nil
+}
+
+// hide replaces the file or directory at the given path with an empty one.
+func hide(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("could not hide %v: %v", path, err)
+	}
+	if info.IsDir() {
+		err = unix.Mount("tmpfs", path, "tmpfs", unix.MS_RDONLY|unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, "size=0")
+	} else {
+		err = unix.Mount("/dev/null", path, "", unix.MS_BIND, "")
+	}
+	if err != nil {
+		return fmt.Errorf("could not hide %v: %v", path, err)
+	}
+	return nil
+}
+
+// mountPoints returns the mount points listed in /proc/self/mountinfo.
+func mountPoints() ([]string, error) {
+	mountInfo, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return nil, err
+	}
+	defer mountInfo.Close()
+	mountPoints := []string{}
+	scanner := bufio.NewScanner(mountInfo)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 {
+			continue
+		}
+		mountPoints = append(mountPoints, unescapeMountPoint(fields[4]))
+	}
+	return mountPoints, scanner.Err()
+}
+
+// unescapeMountPoint decodes the octal escapes, such as \040 for a space,
+// that mount points in /proc/self/mountinfo contain.
+func unescapeMountPoint(mountPoint string) string {
+	var unescaped strings.Builder
+	for i := 0; i < len(mountPoint); i++ {
+		if mountPoint[i] == '\\' && i+3 < len(mountPoint) {
+			if b, err := strconv.ParseUint(mountPoint[i+1:i+4], 8, 8); err == nil {
+				unescaped.WriteByte(byte(b))
+				i += 3
+				continue
+			}
+		}
+		unescaped.WriteByte(mountPoint[i])
+	}
+	return unescaped.String()
+}
+
+// anyUnder returns true if any of the given paths is dir, or is inside it.
+func anyUnder(paths []string, dir string) bool {
+	for _, path := range paths {
+		if isUnderAny(path, []string{dir}) {
+			return true
+		}
+	}
+	return false
+}
+
+// isUnderAny returns true if path is one of the given directories, or is
+// inside one of them.
+func isUnderAny(path string, dirs []string) bool {
+	for _, dir := range dirs {
+		if path == dir || strings.HasPrefix(path, strings.TrimSuffix(dir, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
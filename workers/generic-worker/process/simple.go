@@ -67,8 +67,9 @@ func NewCommand(commandLine []string, workingDirectory string, env []string) (*C
 	// See https://medium.com/@felixge/killing-a-child-process-and-all-of-its-children-in-go-54079af94773
 	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
 	return &Command{
-		Cmd:   cmd,
-		abort: make(chan struct{}),
+		Cmd:    cmd,
+		abort:  make(chan struct{}),
+		exited: make(chan struct{}),
 	}, nil
 }
 
@@ -0,0 +1,53 @@
+// +build simple multiuser,darwin multiuser,linux
+
+package process
+
+import (
+	"log"
+	"syscall"
+	"time"
+)
+
+// Terminate stops the process tree of the command. The process tree is first
+// sent SIGTERM, so that it has a chance to flush state and exit cleanly, and
+// is then killed with SIGKILL if it is still running after gracePeriod. If
+// gracePeriod is zero, the process tree is killed immediately. Terminate does
+// not wait for the process tree to exit. If timedOut is true, the Result of
+// Execute records that the command exceeded its maximum run time, rather than
+// that it was aborted.
+func (c *Command) Terminate(gracePeriod time.Duration, timedOut bool) (killOutput string, err error) {
+	c.mutex.Lock()
+	if c.terminated {
+		// already being terminated
+		c.mutex.Unlock()
+		return "", nil
+	}
+	c.terminated = true
+	c.timedOut = timedOut
+	started := c.Process != nil
+	c.mutex.Unlock()
+	if gracePeriod <= 0 || !started {
+		return c.Kill()
+	}
+	pid := c.Process.Pid
+	log.Printf("Sending SIGTERM to process tree with parent PID %v, which will be killed if still running after %v... (%p)", pid, gracePeriod, c)
+	// See https://medium.com/@felixge/killing-a-child-process-and-all-of-its-children-in-go-54079af94773
+	err = syscall.Kill(-pid, syscall.SIGTERM)
+	if err != nil {
+		log.Printf("Could not send SIGTERM to process tree with parent PID %v: %v", pid, err)
+		return c.Kill()
+	}
+	go func() {
+		select {
+		case <-c.exited:
+			log.Printf("Process tree with parent PID %v exited within grace period", pid)
+		case <-time.After(gracePeriod):
+			log.Printf("Process tree with parent PID %v still running after grace period of %v", pid, gracePeriod)
+			_, err := c.Kill()
+			if err != nil {
+				log.Printf("WARNING: could not kill process tree with parent PID %v: %v", pid, err)
+			}
+		}
+	}()
+	return "", nil
+}
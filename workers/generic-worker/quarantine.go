@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	tcclient "github.com/taskcluster/taskcluster/v28/clients/client-go"
+	"github.com/taskcluster/taskcluster/v28/clients/client-go/tcqueue"
+)
+
+// isWorkerFailure returns true if a task run resolved with the given state
+// and reason suggests a problem with the worker host, rather than with the
+// task.
+func isWorkerFailure(state, reason string) bool {
+	return state == "exception" && (reason == string(internalError) || reason == string(resourceUnavailable))
+}
+
+// quarantineMarkerState is the state of the task history entry that is
+// written when the worker quarantines itself. Worker failures before the
+// marker have already been acted on, so they are not counted again when the
+// worker next starts.
+const quarantineMarkerState = "quarantined"
+
+// trailingWorkerFailures returns the task runs at the end of the given task
+// history that are worker failures.
+func trailingWorkerFailures(entries []TaskHistoryEntry) []TaskHistoryEntry {
+	i := len(entries)
+	for i > 0 && isWorkerFailure(entries[i-1].State, entries[i-1].Reason) {
+		i--
+	}
+	return append([]TaskHistoryEntry{}, entries[i:]...)
+}
+
+// recentWorkerFailures returns the consecutive worker failures at the end of
+// the task history, as far as they are relevant for deciding whether to
+// quarantine the worker.
+func recentWorkerFailures() []TaskHistoryEntry {
+	if config.QuarantineAfterFailures == 0 {
+		return []TaskHistoryEntry{}
+	}
+	entries, err := ReadTaskHistory(taskHistoryFile, TaskHistoryFilter{Last: int(config.QuarantineAfterFailures)})
+	if err != nil {
+		log.Printf("WARNING: could not read task history file %v: %v", taskHistoryFile, err)
+		return []TaskHistoryEntry{}
+	}
+	return trailingWorkerFailures(entries)
+}
+
+// shouldQuarantine returns true if the given consecutive worker failures
+// have reached config setting quarantineAfterFailures.
+func shouldQuarantine(workerFailures []TaskHistoryEntry) bool {
+	return config.QuarantineAfterFailures > 0 && uint(len(workerFailures)) >= config.QuarantineAfterFailures
+}
+
+// quarantineWorker asks the queue to quarantine this worker, so that it is
+// not given any more tasks, and reports the given consecutive worker
+// failures to the worker manager. Errors are logged, since the worker exits
+// regardless.
+func quarantineWorker(workerFailures []TaskHistoryEntry) {
+	quarantineUntil := tcclient.Time(time.Now().Add(time.Duration(config.QuarantineDurationSecs) * time.Second))
+	log.Printf("Quarantining worker until %v after %v consecutive worker failures", quarantineUntil, len(workerFailures))
+	_, err := queue.QuarantineWorker(
+		config.ProvisionerID,
+		config.WorkerType,
+		config.WorkerGroup,
+		config.WorkerID,
+		&tcqueue.QuarantineWorkerRequest{
+			QuarantineUntil: quarantineUntil,
+		},
+	)
+	if err != nil {
+		log.Printf("WARNING: could not quarantine worker: %v", err)
+	}
+	now := time.Now()
+	err = appendTaskHistory(&TaskHistoryEntry{
+		Started:   now,
+		Finished:  now,
+		State:     quarantineMarkerState,
+		Reason:    "worker-quarantined",
+		ExitCodes: []int64{},
+		Mounts:    []string{},
+	})
+	if err != nil {
+		log.Printf("WARNING: could not record quarantine in task history file %v: %v", taskHistoryFile, err)
+	}
+
+	taskRuns := make([]string, len(workerFailures))
+	for i, entry := range workerFailures {
+		taskRuns[i] = fmt.Sprintf("  * task %v run %v: %v/%v", entry.TaskID, entry.RunID, entry.State, entry.Reason)
+	}
+	reportWorkerError(
+		"worker-quarantined",
+		"Worker quarantined after repeated worker failures",
+		fmt.Sprintf("Worker %v/%v quarantined itself until %v, since the last %v tasks it ran were resolved as exception/%v or exception/%v:\n\n%v", config.WorkerGroup, config.WorkerID, quarantineUntil, len(workerFailures), internalError, resourceUnavailable, strings.Join(taskRuns, "\n")),
+		map[string]interface{}{
+			"quarantineUntil": quarantineUntil,
+			"taskRuns":        workerFailures,
+		},
+	)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTrailingWorkerFailures(t *testing.T) {
+	entries := []TaskHistoryEntry{
+		{TaskID: "a", State: "exception", Reason: "internal-error"},
+		{TaskID: "b", State: "completed", Reason: "completed"},
+		{TaskID: "c", State: "exception", Reason: "resource-unavailable"},
+		{TaskID: "d", State: "exception", Reason: "internal-error"},
+	}
+	failures := trailingWorkerFailures(entries)
+	if len(failures) != 2 || failures[0].TaskID != "c" || failures[1].TaskID != "d" {
+		t.Fatalf("Expected task runs c and d to be trailing worker failures, but got %#v", failures)
+	}
+	entries = append(entries, TaskHistoryEntry{TaskID: "e", State: "exception", Reason: "malformed-payload"})
+	if failures := trailingWorkerFailures(entries); len(failures) != 0 {
+		t.Fatalf("Expected no trailing worker failures, but got %#v", failures)
+	}
+}
+
+func TestQuarantineAfterWorkerFailures(t *testing.T) {
+	fakeServices, teardown := setupWithFakeServices(t)
+	defer teardown()
+
+	for _, taskID := range []string{"failed-task-1", "failed-task-2"} {
+		err := appendTaskHistory(&TaskHistoryEntry{
+			TaskID:   taskID,
+			Started:  time.Now(),
+			Finished: time.Now(),
+			State:    "exception",
+			Reason:   "internal-error",
+		})
+		if err != nil {
+			t.Fatalf("Could not write task history: %v", err)
+		}
+	}
+	config.QuarantineAfterFailures = 2
+	config.QuarantineDurationSecs = 3600
+
+	taskID := scheduleTask(t, testTask(t), GenericWorkerPayload{
+		Command:    helloGoodbye(),
+		MaxRunTime: 30,
+	})
+	execute(t, WORKER_QUARANTINED)
+
+	if fakeServices.Queue.QuarantinedUntil(config.ProvisionerID, config.WorkerType, config.WorkerGroup, config.WorkerID).Before(time.Now()) {
+		t.Fatal("Expected worker to be quarantined")
+	}
+	if errors := fakeServices.WorkerManager.Errors(); len(errors) != 1 || errors[0].Kind != "worker-quarantined" {
+		t.Fatalf("Expected one worker error to be reported, but got %#v", errors)
+	}
+	status, err := fakeServices.Queue.Status(taskID)
+	if err != nil {
+		t.Fatalf("Could not get task status: %v", err)
+	}
+	if status.State != "pending" {
+		t.Fatalf("Expected task not to be claimed by quarantined worker, but it is %v", status.State)
+	}
+	// the failures that led to the quarantine should not quarantine the
+	// worker again when it next starts
+	if failures := recentWorkerFailures(); len(failures) != 0 {
+		t.Fatalf("Expected no worker failures after quarantine, but got %#v", failures)
+	}
+}
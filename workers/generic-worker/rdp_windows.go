@@ -66,6 +66,15 @@ func (l *RDPTask) ReservedArtifacts() []string {
 	}
 }
 
+// ReservedArtifactPointer returns the JSON pointer of payload property
+// rdpInfo, if it gives the name of the given artifact.
+func (l *RDPTask) ReservedArtifactPointer(name string) string {
+	if name == l.task.Payload.RdpInfo {
+		return "/rdpInfo"
+	}
+	return ""
+}
+
 func (l *RDPTask) Start() *CommandExecutionError {
 	l.createRDPArtifact()
 	return l.uploadRDPArtifact()
@@ -0,0 +1,178 @@
+// +build darwin,!docker linux,!docker freebsd
+
+package main
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/taskcluster/taskcluster/v28/internal/scopes"
+)
+
+// ProcessReaperFeature kills processes that a task leaves running, such as
+// daemons that call setsid or double-fork in order to escape the process
+// group of the task command, so that they do not run into the next task,
+// holding files in caches open.
+//
+// On Linux, task commands are started in a cgroup, which contains every
+// process that they spawn. On multiuser engines, processes of the task user
+// that were started while the task ran also belong to the task. Processes
+// that were already running when the task started, such as a desktop session
+// of the task user, are left running. Otherwise, and in addition, processes
+// are identified by the TASK_ID and RUN_ID environment variables that every
+// task command is given, and which are inherited by every process it
+// spawns, unless it clears its environment.
+type ProcessReaperFeature struct {
+}
+
+// TaskProcess is a process that was spawned by a task.
+type TaskProcess struct {
+	PID     int
+	Command string
+}
+
+// processFinder lists processes that belong to a task.
+type processFinder func() ([]TaskProcess, error)
+
+func (feature *ProcessReaperFeature) Name() string {
+	return "Process Reaper"
+}
+
+func (feature *ProcessReaperFeature) Initialise() error {
+	return nil
+}
+
+func (feature *ProcessReaperFeature) PersistState() error {
+	return nil
+}
+
+// Process reaper is always enabled
+func (feature *ProcessReaperFeature) IsEnabled(task *TaskRun) bool {
+	return true
+}
+
+type ProcessReaperTask struct {
+	task *TaskRun
+	// finders list the processes of the task, in different ways
+	finders []processFinder
+	// cleanUps release resources used by the finders, once the processes
+	// of the task have been killed
+	cleanUps []func()
+}
+
+func (feature *ProcessReaperFeature) NewTaskFeature(task *TaskRun) TaskFeature {
+	return &ProcessReaperTask{
+		task: task,
+	}
+}
+
+func (pr *ProcessReaperTask) RequiredScopes() scopes.Required {
+	return scopes.Required{}
+}
+
+func (pr *ProcessReaperTask) ReservedArtifacts() []string {
+	return []string{}
+}
+
+func (pr *ProcessReaperTask) Start() *CommandExecutionError {
+	pr.trackCgroup()   // platform specific
+	pr.trackTaskUser() // engine specific
+	vars := taskProcessEnv(pr.task)
+	pr.finders = append(pr.finders, func() ([]TaskProcess, error) {
+		return processesWithEnv(vars)
+	})
+	return nil
+}
+
+// Stop kills any processes that the task left running, and lists them in the
+// task log.
+func (pr *ProcessReaperTask) Stop(err *ExecutionErrors) {
+	killed := killTaskProcesses(pr.task, pr.finders)
+	for _, cleanUp := range pr.cleanUps {
+		cleanUp()
+	}
+	if len(killed) == 0 {
+		return
+	}
+	pr.task.Warnf("[process reaper] Killed %v process(es) left running by the task:", len(killed))
+	for _, p := range killed {
+		pr.task.Warnf("[process reaper]   PID %v: %v", p.PID, p.Command)
+	}
+}
+
+// taskProcessEnv returns the environment variables that identify processes
+// spawned by the given task run.
+func taskProcessEnv(task *TaskRun) []string {
+	return []string{
+		"TASK_ID=" + task.TaskID,
+		"RUN_ID=" + strconv.Itoa(int(task.RunID)),
+	}
+}
+
+// killTaskProcesses kills all processes of the given task run that are still
+// running, as listed by the given finders, and returns them. Since processes
+// may spawn further processes while they are being killed, this is repeated
+// a few times. Killed processes may still be listed until they have exited,
+// so each process is only returned once.
+func killTaskProcesses(task *TaskRun, finders []processFinder) []TaskProcess {
+	killed := []TaskProcess{}
+	killedPIDs := map[int]bool{}
+	for attempt := 0; attempt < 3; attempt++ {
+		if attempt > 0 {
+			time.Sleep(100 * time.Millisecond)
+		}
+		processes := []TaskProcess{}
+		for _, find := range finders {
+			found, err := find()
+			if err != nil {
+				log.Printf("WARNING: could not list processes left running by task %v: %v", task.TaskID, err)
+				continue
+			}
+			processes = append(processes, found...)
+		}
+		if len(processes) == 0 {
+			break
+		}
+		for _, p := range processes {
+			if killedPIDs[p.PID] || isWorkerProcess(p.PID) {
+				continue
+			}
+			log.Printf("Killing process %v left running by task %v: %v", p.PID, task.TaskID, p.Command)
+			err := syscall.Kill(p.PID, syscall.SIGKILL)
+			if err != nil && err != syscall.ESRCH {
+				log.Printf("WARNING: could not kill process %v: %v", p.PID, err)
+				continue
+			}
+			killedPIDs[p.PID] = true
+			killed = append(killed, p)
+		}
+	}
+	return killed
+}
+
+// isWorkerProcess returns true if pid is the generic-worker process itself,
+// which must never be killed, even if e.g. its environment happens to match.
+func isWorkerProcess(pid int) bool {
+	return pid == os.Getpid()
+}
+
+// containsAll returns true if environ contains all of the given environment
+// variables.
+func containsAll(environ []string, vars []string) bool {
+	for _, v := range vars {
+		found := false
+		for _, e := range environ {
+			if e == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
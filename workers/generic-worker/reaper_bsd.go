@@ -0,0 +1,89 @@
+// +build darwin,!docker freebsd
+
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/host"
+)
+
+// trackCgroup does nothing, since cgroups only exist on Linux.
+func (pr *ProcessReaperTask) trackCgroup() {
+}
+
+// processesWithEnv returns the running processes whose environment contains
+// all of the given variables. The environment of each process is listed by
+// ps, after its command line, which is only permitted for processes of the
+// same user, unless running as root.
+func processesWithEnv(vars []string) ([]TaskProcess, error) {
+	withEnv, err := listProcesses("-axeww")
+	if err != nil {
+		return nil, err
+	}
+	commands, err := listProcesses("-axww")
+	if err != nil {
+		return nil, err
+	}
+	processes := []TaskProcess{}
+	for pid, commandAndEnv := range withEnv {
+		if isWorkerProcess(pid) {
+			continue
+		}
+		fields := strings.Fields(commandAndEnv)
+		if !containsAll(fields, vars) {
+			continue
+		}
+		command, running := commands[pid]
+		if !running {
+			continue
+		}
+		processes = append(processes, TaskProcess{
+			PID:     pid,
+			Command: command,
+		})
+	}
+	return processes, nil
+}
+
+// processesOfUser returns the running processes whose real user ID is uid.
+func processesOfUser(uid uint32) ([]TaskProcess, error) {
+	commands, err := listProcesses("-xww", "-U", strconv.Itoa(int(uid)))
+	if err != nil {
+		return nil, err
+	}
+	processes := []TaskProcess{}
+	for pid, command := range commands {
+		if isWorkerProcess(pid) {
+			continue
+		}
+		processes = append(processes, TaskProcess{
+			PID:     pid,
+			Command: command,
+		})
+	}
+	return processes, nil
+}
+
+// listProcesses returns the command of each process listed by ps with the
+// given flags, by pid.
+func listProcesses(flags ...string) (map[int]string, error) {
+	out, err := host.CombinedOutput("ps", append(flags, "-o", "pid=,command=")...)
+	if err != nil {
+		return nil, err
+	}
+	processes := map[int]string{}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.SplitN(strings.TrimSpace(line), " ", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		pid, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
+		}
+		processes[pid] = strings.TrimSpace(fields[1])
+	}
+	return processes, nil
+}
@@ -0,0 +1,120 @@
+// +build !docker
+
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/process"
+)
+
+// taskCgroup is the name of the cgroup that task commands are started in.
+// Only one task runs at a time, so it is always the same.
+const taskCgroup = "generic-worker-task"
+
+// trackCgroup starts the task commands in a cgroup, if the worker runs as
+// root, so that processes that leave the process group of the task and
+// clear their environment are also found.
+func (pr *ProcessReaperTask) trackCgroup() {
+	if os.Geteuid() != 0 {
+		return
+	}
+	cgroup, err := process.NewCgroup(taskCgroup)
+	if err != nil {
+		log.Printf("WARNING: could not create cgroup for task processes: %v", err)
+		return
+	}
+	for _, command := range pr.task.Commands {
+		command.SetCgroup(cgroup)
+	}
+	pr.finders = append(pr.finders, func() ([]TaskProcess, error) {
+		pids, err := cgroup.Processes()
+		if err != nil {
+			return nil, err
+		}
+		processes := []TaskProcess{}
+		for _, pid := range pids {
+			processes = append(processes, TaskProcess{
+				PID:     pid,
+				Command: processCommand(pid),
+			})
+		}
+		return processes, nil
+	})
+	pr.cleanUps = append(pr.cleanUps, func() {
+		err := cgroup.Remove()
+		if err != nil {
+			log.Printf("WARNING: could not remove cgroup of task processes: %v", err)
+		}
+	})
+}
+
+// processesWithEnv returns the running processes whose environment contains
+// all of the given variables, by inspecting /proc. Processes whose
+// environment cannot be read, e.g. since they belong to another user, are
+// skipped.
+func processesWithEnv(vars []string) ([]TaskProcess, error) {
+	entries, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+	processes := []TaskProcess{}
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || isWorkerProcess(pid) {
+			continue
+		}
+		environ, err := ioutil.ReadFile(filepath.Join("/proc", entry.Name(), "environ"))
+		if err != nil {
+			// process exited, or we are not permitted to read its environment
+			continue
+		}
+		if !containsAll(strings.Split(string(environ), "\x00"), vars) {
+			continue
+		}
+		processes = append(processes, TaskProcess{
+			PID:     pid,
+			Command: processCommand(pid),
+		})
+	}
+	return processes, nil
+}
+
+// processesOfUser returns the running processes whose effective user ID is
+// uid, by inspecting /proc.
+func processesOfUser(uid uint32) ([]TaskProcess, error) {
+	entries, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+	processes := []TaskProcess{}
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || isWorkerProcess(pid) {
+			continue
+		}
+		// /proc/<pid> is owned by the effective user of the process
+		stat, ok := entry.Sys().(*syscall.Stat_t)
+		if !ok || stat.Uid != uid {
+			continue
+		}
+		processes = append(processes, TaskProcess{
+			PID:     pid,
+			Command: processCommand(pid),
+		})
+	}
+	return processes, nil
+}
+
+// processCommand returns the command line of the given process, which is
+// empty if the process has just exited.
+func processCommand(pid int) string {
+	cmdline, _ := ioutil.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "cmdline"))
+	return strings.TrimSpace(strings.ReplaceAll(string(cmdline), "\x00", " "))
+}
@@ -0,0 +1,41 @@
+// +build !docker
+
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestProcessesWithClearedEnvironmentKilled(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("Creating cgroups requires root")
+	}
+	_, teardown := setupWithFakeServices(t)
+	defer teardown()
+
+	payload := GenericWorkerPayload{
+		Command: [][]string{
+			{
+				"/bin/bash",
+				"-c",
+				// leave the process group, and clear the environment, so
+				// that only the cgroup of the task identifies the process
+				"setsid env -i /bin/sleep 601 > /dev/null 2>&1 < /dev/null & echo started",
+			},
+		},
+		MaxRunTime: 30,
+	}
+	td := testTask(t)
+
+	taskID := submitAndAssert(t, td, payload, "completed", "completed")
+
+	logtext, _, _, _ := getArtifactContent(t, taskID, "public/logs/live_backing.log")
+	if !strings.Contains(string(logtext), "[process reaper] Killed 1 process(es) left running by the task") || !strings.Contains(string(logtext), "sleep 601") {
+		t.Fatalf("Expected task log to list leftover sleep process:\n%s", logtext)
+	}
+	if _, err := os.Stat("/sys/fs/cgroup/pids/" + taskCgroup); err == nil {
+		t.Fatal("Expected cgroup of task processes to have been removed")
+	}
+}
@@ -0,0 +1,51 @@
+// +build multiuser,darwin multiuser,linux
+
+package main
+
+import (
+	"log"
+	"os/user"
+	"strconv"
+)
+
+// trackTaskUser finds processes of the task user that were started while the
+// task ran, unless tasks run as the worker user. Processes of the task user
+// that are already running, such as its desktop session, are recorded, so
+// that they are left running.
+func (pr *ProcessReaperTask) trackTaskUser() {
+	if config.RunTasksAsCurrentUser {
+		return
+	}
+	taskUser, err := user.Lookup(taskContext.User.Name)
+	if err != nil {
+		log.Printf("WARNING: could not look up task user %v: %v", taskContext.User.Name, err)
+		return
+	}
+	uid, err := strconv.ParseUint(taskUser.Uid, 10, 32)
+	if err != nil {
+		log.Printf("WARNING: invalid user ID %q of task user %v: %v", taskUser.Uid, taskUser.Username, err)
+		return
+	}
+	existing, err := processesOfUser(uint32(uid))
+	if err != nil {
+		log.Printf("WARNING: could not list processes of task user %v: %v", taskUser.Username, err)
+		return
+	}
+	existingPIDs := map[int]bool{}
+	for _, p := range existing {
+		existingPIDs[p.PID] = true
+	}
+	pr.finders = append(pr.finders, func() ([]TaskProcess, error) {
+		processes, err := processesOfUser(uint32(uid))
+		if err != nil {
+			return nil, err
+		}
+		started := []TaskProcess{}
+		for _, p := range processes {
+			if !existingPIDs[p.PID] {
+				started = append(started, p)
+			}
+		}
+		return started, nil
+	})
+}
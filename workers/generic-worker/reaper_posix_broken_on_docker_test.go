@@ -0,0 +1,51 @@
+// +build darwin,!docker linux,!docker freebsd
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLeftoverProcessesKilled(t *testing.T) {
+	_, teardown := setupWithFakeServices(t)
+	defer teardown()
+
+	payload := GenericWorkerPayload{
+		Command: [][]string{
+			{
+				"/bin/bash",
+				"-c",
+				// double-fork, so that the sleep process is orphaned
+				"(sleep 600 > /dev/null 2>&1 < /dev/null &); echo started",
+			},
+		},
+		MaxRunTime: 30,
+	}
+	td := testTask(t)
+
+	taskID := submitAndAssert(t, td, payload, "completed", "completed")
+
+	logtext, _, _, _ := getArtifactContent(t, taskID, "public/logs/live_backing.log")
+	if !strings.Contains(string(logtext), "[process reaper] Killed 1 process(es) left running by the task") || !strings.Contains(string(logtext), "sleep 600") {
+		t.Fatalf("Expected task log to list leftover sleep process:\n%s", logtext)
+	}
+	// SIGKILL is delivered asynchronously, so allow killed processes a
+	// moment to disappear
+	var processes []TaskProcess
+	for attempt := 0; attempt < 50; attempt++ {
+		var err error
+		processes, err = processesWithEnv([]string{"TASK_ID=" + taskID, "RUN_ID=0"})
+		if err != nil {
+			t.Fatalf("Could not list processes: %v", err)
+		}
+		if len(processes) == 0 {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if len(processes) > 0 {
+		t.Fatalf("Expected leftover processes of task to have been killed, but found %#v", processes)
+	}
+}
@@ -0,0 +1,8 @@
+// +build darwin,simple linux,simple freebsd,simple
+
+package main
+
+// trackTaskUser does nothing, since task commands run as the worker user,
+// whose other processes do not belong to the task.
+func (pr *ProcessReaperTask) trackTaskUser() {
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	sysinfo "github.com/elastic/go-sysinfo"
+	"github.com/taskcluster/taskcluster/v28/clients/client-go/tcqueue"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/fileutil"
+)
+
+// runningTaskFile records the task run that the worker is currently
+// executing. If the worker crashes, or the host reboots, while the task is
+// running, the file is still present when the worker next starts, and the
+// task run can be resolved immediately, rather than only when its claim
+// expires.
+const runningTaskFile = "running-task.json"
+
+// RunningTask is the content of the running task file.
+type RunningTask struct {
+	// Claim holds the credentials and takenUntil of the most recent claim
+	// or reclaim of the task run
+	Claim   tcqueue.TaskClaim `json:"claim"`
+	TaskDir string            `json:"taskDir"`
+	// BootTime is the time the host booted, as of when the task started, so
+	// that a reboot can be distinguished from a worker crash
+	BootTime time.Time         `json:"bootTime"`
+	History  *TaskHistoryEntry `json:"history"`
+}
+
+// hostBootTime returns the time the host booted, or the zero time if it
+// cannot be determined.
+func hostBootTime() time.Time {
+	host, err := sysinfo.Host()
+	if err != nil {
+		return time.Time{}
+	}
+	return host.Info().BootTime
+}
+
+// trackRunningTask writes the running task file for the given task, and
+// keeps it up to date as the task is reclaimed. The returned function removes
+// the file again, and should be called once the task has been resolved.
+func trackRunningTask(task *TaskRun, historyEntry *TaskHistoryEntry) (untrack func()) {
+	runningTask := &RunningTask{
+		Claim:    tcqueue.TaskClaim(task.TaskClaimResponse),
+		TaskDir:  taskContext.TaskDir,
+		BootTime: hostBootTime(),
+		History:  historyEntry,
+	}
+	writeRunningTaskFile(runningTask)
+	listener := &TaskStatusChangeListener{
+		Name: "running task file",
+		Callback: func(ts TaskStatus) {
+			if ts != reclaimed {
+				return
+			}
+			runningTask.Claim.Credentials = task.TaskReclaimResponse.Credentials
+			runningTask.Claim.Status = task.TaskReclaimResponse.Status
+			runningTask.Claim.TakenUntil = task.TaskReclaimResponse.TakenUntil
+			writeRunningTaskFile(runningTask)
+		},
+	}
+	task.StatusManager.RegisterListener(listener)
+	return func() {
+		task.StatusManager.DeregisterListener(listener)
+		removeRunningTaskFile()
+	}
+}
+
+func writeRunningTaskFile(runningTask *RunningTask) {
+	err := fileutil.WriteToFileAsJSON(runningTask, runningTaskFile)
+	if err == nil {
+		// file contains task credentials
+		err = fileutil.SecureFiles(runningTaskFile)
+	}
+	if err != nil {
+		log.Printf("WARNING: could not write running task file %v: %v", runningTaskFile, err)
+	}
+}
+
+func removeRunningTaskFile() {
+	err := os.Remove(runningTaskFile)
+	if err != nil && !os.IsNotExist(err) {
+		log.Printf("WARNING: could not remove running task file %v: %v", runningTaskFile, err)
+	}
+}
+
+// recoverInterruptedTask resolves the task run recorded in the running task
+// file, if there is one, since the worker must have crashed, or the host
+// rebooted, while it was running. If the claim of the task run has not yet
+// expired, the task log written so far is uploaded, and the run is resolved
+// as exception/worker-shutdown after a reboot, or exception/internal-error
+// after a worker crash. The interrupted run is also recorded in the task
+// history.
+func recoverInterruptedTask() {
+	if _, err := os.Stat(runningTaskFile); os.IsNotExist(err) {
+		return
+	}
+	var runningTask RunningTask
+	err := loadFromJSONFile(&runningTask, runningTaskFile)
+	if err != nil {
+		log.Printf("WARNING: could not read running task file %v: %v", runningTaskFile, err)
+		removeRunningTaskFile()
+		return
+	}
+	// don't try to recover more than once, e.g. if recovery itself crashes
+	defer removeRunningTaskFile()
+
+	claim := runningTask.Claim
+	taskID := claim.Status.TaskID
+	log.Printf("Task %v run %v was interrupted by a worker crash or host reboot", taskID, claim.RunID)
+
+	reason := internalError
+	if bootTime := hostBootTime(); !bootTime.IsZero() && !runningTask.BootTime.IsZero() {
+		// boot time is derived from uptime, so allow for some jitter
+		if d := bootTime.Sub(runningTask.BootTime); d > time.Minute || d < -time.Minute {
+			reason = workerShutdown
+		}
+	}
+
+	historyEntry := runningTask.History
+	if historyEntry == nil {
+		historyEntry = &TaskHistoryEntry{
+			TaskID:    taskID,
+			RunID:     uint(claim.RunID),
+			ExitCodes: []int64{},
+			Mounts:    []string{},
+		}
+	}
+	historyEntry.Finished = time.Now()
+	historyEntry.State = "exception"
+	defer func() {
+		err := appendTaskHistory(historyEntry)
+		if err != nil {
+			log.Printf("WARNING: could not record task in task history file %v: %v", taskHistoryFile, err)
+		}
+	}()
+
+	// Round(0) forces wall time calculation instead of monotonic time in case machine slept etc
+	if time.Now().Round(0).After(time.Time(claim.TakenUntil)) {
+		log.Printf("Claim of task %v run %v expired at %v, so it will have been resolved by the queue", taskID, claim.RunID, claim.TakenUntil)
+		historyEntry.Reason = "claim-expired"
+		return
+	}
+	status, err := queue.Status(taskID)
+	if err != nil {
+		log.Printf("WARNING: could not query status of interrupted task %v: %v", taskID, err)
+		historyEntry.Reason = string(reason)
+		return
+	}
+	if claim.RunID >= int64(len(status.Status.Runs)) {
+		log.Printf("WARNING: queue has no run %v of interrupted task %v", claim.RunID, taskID)
+		return
+	}
+	if run := status.Status.Runs[claim.RunID]; run.State != "running" || run.WorkerGroup != claim.WorkerGroup || run.WorkerID != claim.WorkerID {
+		log.Printf("Interrupted task %v run %v has already been resolved as %v/%v", taskID, claim.RunID, run.State, run.ReasonResolved)
+		historyEntry.State = run.State
+		historyEntry.Reason = run.ReasonResolved
+		return
+	}
+	historyEntry.Reason = string(reason)
+
+	task := taskFromClaim(claim, time.Now())
+
+	// artifacts are uploaded relative to the task directory
+	currentTaskContext := taskContext
+	taskContext = &TaskContext{
+		TaskDir: runningTask.TaskDir,
+	}
+	defer func() {
+		taskContext = currentTaskContext
+	}()
+
+	logFile, err := os.OpenFile(filepath.Join(runningTask.TaskDir, logPath), os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		log.Printf("WARNING: could not open log of interrupted task %v: %v", taskID, err)
+	} else {
+		task.logWriter = logFile
+		if reason == workerShutdown {
+			task.Errorf("The worker host rebooted while this task was running. Resolving task as exception/%v.", reason)
+		} else {
+			task.Errorf("The worker crashed while this task was running. Resolving task as exception/%v.", reason)
+		}
+		task.logWriter = nil
+		err = logFile.Close()
+		if err != nil {
+			log.Printf("WARNING: could not close log of interrupted task %v: %v", taskID, err)
+		}
+		if e := task.uploadLog(logName, logPath); e != nil {
+			log.Printf("WARNING: could not upload log of interrupted task %v: %v", taskID, e)
+		}
+	}
+	err = task.StatusManager.ReportException(reason)
+	if err != nil {
+		log.Printf("WARNING: could not resolve interrupted task %v: %v", taskID, err)
+		return
+	}
+	log.Printf("Resolved interrupted task %v run %v as exception/%v", taskID, claim.RunID, reason)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	tcclient "github.com/taskcluster/taskcluster/v28/clients/client-go"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/tcfake"
+)
+
+// interruptTask schedules and claims a task in the fake queue, and writes a
+// task log and running task file for it, as if the worker had been
+// interrupted while running it.
+func interruptTask(t *testing.T, fakeServices *tcfake.Server, bootTime time.Time, takenUntil time.Time) (taskID string) {
+	t.Helper()
+	taskID = scheduleTask(t, testTask(t), GenericWorkerPayload{
+		Command:    helloGoodbye(),
+		MaxRunTime: 30,
+	})
+	claim, err := fakeServices.Queue.ClaimTask(taskID, config.WorkerGroup, config.WorkerID)
+	if err != nil {
+		t.Fatalf("Could not claim task: %v", err)
+	}
+	claim.TakenUntil = tcclient.Time(takenUntil)
+	taskDir := filepath.Join(config.TasksDir, "task_interrupted")
+	err = os.MkdirAll(filepath.Join(taskDir, filepath.Dir(logPath)), 0755)
+	if err != nil {
+		t.Fatalf("Could not create task directory: %v", err)
+	}
+	err = ioutil.WriteFile(filepath.Join(taskDir, logPath), []byte("hello world!\n"), 0644)
+	if err != nil {
+		t.Fatalf("Could not write task log: %v", err)
+	}
+	writeRunningTaskFile(&RunningTask{
+		Claim:    *claim,
+		TaskDir:  taskDir,
+		BootTime: bootTime,
+		History: &TaskHistoryEntry{
+			TaskID:    taskID,
+			RunID:     uint(claim.RunID),
+			Started:   time.Now(),
+			ExitCodes: []int64{},
+			Mounts:    []string{},
+		},
+	})
+	queue = config.Queue()
+	return taskID
+}
+
+func checkRecoveredTask(t *testing.T, taskID, state, reason string) {
+	t.Helper()
+	if _, err := os.Stat(runningTaskFile); !os.IsNotExist(err) {
+		t.Fatalf("Running task file %v still exists after recovery", runningTaskFile)
+	}
+	status, err := testQueue.Status(taskID)
+	if err != nil {
+		t.Fatalf("Could not get task status: %v", err)
+	}
+	if run := status.Status.Runs[0]; run.State != state || run.ReasonResolved != reason {
+		t.Fatalf("Expected run 0 of task %v to be %v/%v but it is %v/%v", taskID, state, reason, run.State, run.ReasonResolved)
+	}
+	entries, err := ReadTaskHistory(taskHistoryFile, TaskHistoryFilter{TaskID: taskID})
+	if err != nil {
+		t.Fatalf("Could not read task history: %v", err)
+	}
+	if len(entries) != 1 || entries[0].State != "exception" {
+		t.Fatalf("Expected interrupted task to be recorded in task history, but got %#v", entries)
+	}
+}
+
+func TestRecoverTaskAfterWorkerCrash(t *testing.T) {
+	fakeServices, teardown := setupWithFakeServices(t)
+	defer teardown()
+
+	taskID := interruptTask(t, fakeServices, hostBootTime(), time.Now().Add(10*time.Minute))
+	recoverInterruptedTask()
+	checkRecoveredTask(t, taskID, "exception", "internal-error")
+
+	logtext, _, _, _ := getArtifactContent(t, taskID, logName)
+	if !strings.HasPrefix(string(logtext), "hello world!\n") || !strings.Contains(string(logtext), "The worker crashed while this task was running") {
+		t.Fatalf("Unexpected task log:\n%s", logtext)
+	}
+}
+
+func TestRecoverTaskAfterReboot(t *testing.T) {
+	fakeServices, teardown := setupWithFakeServices(t)
+	defer teardown()
+
+	bootTime := hostBootTime()
+	if bootTime.IsZero() {
+		t.Skip("Boot time of host cannot be determined")
+	}
+	taskID := interruptTask(t, fakeServices, bootTime.Add(-time.Hour), time.Now().Add(10*time.Minute))
+	recoverInterruptedTask()
+	checkRecoveredTask(t, taskID, "exception", "worker-shutdown")
+
+	status, err := testQueue.Status(taskID)
+	if err != nil {
+		t.Fatalf("Could not get task status: %v", err)
+	}
+	if len(status.Status.Runs) != 2 || status.Status.State != "pending" {
+		t.Fatalf("Expected task to be retried after reboot, but got status %#v", status.Status)
+	}
+}
+
+func TestRecoverTaskAfterClaimExpired(t *testing.T) {
+	fakeServices, teardown := setupWithFakeServices(t)
+	defer teardown()
+
+	taskID := interruptTask(t, fakeServices, hostBootTime(), time.Now().Add(-time.Minute))
+	recoverInterruptedTask()
+	// the fake queue doesn't expire claims, so the run is left alone
+	if _, err := os.Stat(runningTaskFile); !os.IsNotExist(err) {
+		t.Fatalf("Running task file %v still exists after recovery", runningTaskFile)
+	}
+	status, err := testQueue.Status(taskID)
+	if err != nil {
+		t.Fatalf("Could not get task status: %v", err)
+	}
+	if status.Status.Runs[0].State != "running" {
+		t.Fatalf("Expected task with expired claim not to be resolved by worker, but it is %v", status.Status.Runs[0].State)
+	}
+	entries, err := ReadTaskHistory(taskHistoryFile, TaskHistoryFilter{TaskID: taskID})
+	if err != nil {
+		t.Fatalf("Could not read task history: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Reason != "claim-expired" {
+		t.Fatalf("Expected interrupted task to be recorded in task history, but got %#v", entries)
+	}
+}
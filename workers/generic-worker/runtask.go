@@ -0,0 +1,230 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/taskcluster/slugid-go/slugid"
+	tcclient "github.com/taskcluster/taskcluster/v28/clients/client-go"
+	"github.com/taskcluster/taskcluster/v28/clients/client-go/tcqueue"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/gwconfig"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/tcfake"
+	"golang.org/x/crypto/ed25519"
+)
+
+// localConfigProvider is used by the run-task target when there is no
+// generic-worker config file, so that the default config is used.
+type localConfigProvider struct {
+}
+
+func (l *localConfigProvider) NewestDeploymentID() (string, error) {
+	return config.DeploymentID, nil
+}
+
+func (l *localConfigProvider) UpdateConfig(c *gwconfig.Config) error {
+	return nil
+}
+
+// runTask runs a single task with the payload in payloadFile, without a
+// taskcluster deployment. The task is created in a fake queue served on a
+// local port, and its artifacts are written under artifactsDir rather than
+// uploaded to S3.
+func runTask(configFile *gwconfig.File, payloadFile, artifactsDir string, taskScopes []string) (exitCode ExitCode) {
+	defer func() {
+		if r := recover(); r != nil {
+			HandleCrash(r)
+			exitCode = INTERNAL_ERROR
+		}
+	}()
+
+	payload, err := ioutil.ReadFile(payloadFile)
+	if err != nil {
+		log.Printf("Could not read task payload file %v: %v", payloadFile, err)
+		return CANT_READ_TASK_PAYLOAD
+	}
+	if !json.Valid(payload) {
+		log.Printf("Task payload file %v does not contain valid json", payloadFile)
+		return CANT_READ_TASK_PAYLOAD
+	}
+
+	configProvider = &localConfigProvider{}
+	err = applyConfig(configFile, configProvider)
+	if err != nil {
+		log.Printf("Error loading configuration: %v", err)
+		return CANT_LOAD_CONFIG
+	}
+
+	absArtifactsDir, err := filepath.Abs(artifactsDir)
+	if err != nil {
+		log.Printf("Cannot determine absolute path of artifacts directory %v: %v", artifactsDir, err)
+		return INTERNAL_ERROR
+	}
+	server, err := tcfake.NewServer(absArtifactsDir)
+	if err != nil {
+		log.Printf("Could not start local queue: %v", err)
+		return INTERNAL_ERROR
+	}
+	defer server.Close()
+
+	cleanUp, err := configureForLocalQueue(server.RootURL())
+	defer cleanUp()
+	if err != nil {
+		log.Printf("Could not configure worker for local queue: %v", err)
+		return INTERNAL_ERROR
+	}
+	err = config.Validate()
+	if err != nil {
+		log.Printf("Invalid config: %v", err)
+		return INVALID_CONFIG
+	}
+	log.Printf("Config: %v", config)
+
+	err = setupExposer()
+	if err != nil {
+		log.Printf("Could not initialize exposer: %v", err)
+		return INTERNAL_ERROR
+	}
+
+	queue = config.Queue()
+
+	err = initialiseFeatures()
+	if err != nil {
+		panic(err)
+	}
+	defer func() {
+		err := persistFeaturesState()
+		if err != nil {
+			log.Printf("Could not persist features: %v", err)
+			exitCode = INTERNAL_ERROR
+		}
+	}()
+
+	if RotateTaskEnvironment() {
+		log.Print("A reboot is required before a task can be run")
+		return REBOOT_REQUIRED
+	}
+
+	taskID := slugid.Nice()
+	now := time.Now()
+	server.Queue.CreateTask(
+		taskID,
+		tcqueue.TaskDefinitionResponse{
+			Created:  tcclient.Time(now),
+			Deadline: tcclient.Time(now.Add(24 * time.Hour)),
+			Expires:  tcclient.Time(now.Add(28 * 24 * time.Hour)),
+			Metadata: tcqueue.TaskMetadata{
+				Description: "Task run locally from payload file " + payloadFile,
+				Name:        "generic-worker run-task",
+				Owner:       "nobody@localhost",
+				Source:      "file://" + payloadFile,
+			},
+			Payload:       json.RawMessage(payload),
+			Priority:      "lowest",
+			ProvisionerID: config.ProvisionerID,
+			Retries:       0,
+			SchedulerID:   "-",
+			Scopes:        taskScopes,
+			TaskGroupID:   taskID,
+			WorkerType:    config.WorkerType,
+		},
+	)
+	taskClaim, err := server.Queue.ClaimTask(taskID, config.WorkerGroup, config.WorkerID)
+	if err != nil {
+		panic(err)
+	}
+	task := taskFromClaim(*taskClaim, now)
+
+	log.Printf("Running task %v from payload file %v", taskID, payloadFile)
+	errors := task.Run()
+	if errors.Occurred() {
+		log.Printf("ERROR(s) encountered: %v", errors)
+	}
+	err = task.ReleaseResources()
+	if err != nil {
+		log.Printf("ERROR: releasing resources\n%v", err)
+	}
+
+	status, err := server.Queue.Status(taskID)
+	if err != nil {
+		panic(err)
+	}
+	run := status.Runs[task.RunID]
+	log.Printf("Task %v resolved as %v/%v", taskID, run.State, run.ReasonResolved)
+	log.Printf("Task directory: %v", taskContext.TaskDir)
+	for _, artifact := range server.Queue.Artifacts(taskID, int64(task.RunID)) {
+		switch artifact.StorageType {
+		case "s3":
+			log.Printf("Artifact %v: %v", artifact.Name, artifact.Path)
+		case "reference":
+			log.Printf("Artifact %v: redirect to %v", artifact.Name, artifact.URL)
+		default:
+			log.Printf("Artifact %v: %v error (%v)", artifact.Name, artifact.Reason, artifact.Message)
+		}
+	}
+	if run.State != "completed" {
+		return TASK_UNSUCCESSFUL
+	}
+	return TASKS_COMPLETE
+}
+
+// configureForLocalQueue updates the global config so that the worker talks
+// to the local queue with the given root URL, and sets placeholder values for
+// required settings that are not needed when running a task locally. The
+// returned function removes any temporary files that were created for the
+// config, and should be called when the task has run, even if an error is
+// returned.
+func configureForLocalQueue(rootURL string) (cleanUp func(), err error) {
+	cleanUp = func() {}
+	config.QueueRootURL = rootURL
+	config.PurgeCacheRootURL = rootURL
+	if config.RootURL == "" {
+		config.RootURL = rootURL
+	}
+	if config.ClientID == "" {
+		config.ClientID = "run-task"
+	}
+	if config.AccessToken == "" {
+		config.AccessToken = "run-task"
+	}
+	if config.WorkerID == "" {
+		config.WorkerID = "run-task"
+	}
+	if config.WorkerType == "" {
+		config.WorkerType = "run-task"
+	}
+	if config.PublicIP == nil {
+		config.PublicIP = net.ParseIP("127.0.0.1")
+	}
+	if config.Ed25519SigningKeyLocation == "" {
+		// chain of trust artifacts are signed with a throwaway key
+		keyFile, err := ioutil.TempFile("", "run-task-ed25519-key")
+		if err != nil {
+			return cleanUp, err
+		}
+		keyFile.Close()
+		cleanUp = func() {
+			err := os.Remove(keyFile.Name())
+			if err != nil {
+				log.Printf("WARNING: could not remove temporary signing key %v: %v", keyFile.Name(), err)
+			}
+		}
+		_, privateKey, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			return cleanUp, err
+		}
+		err = writeEd25519PrivateKeyToFile(privateKey, keyFile.Name())
+		if err != nil {
+			return cleanUp, err
+		}
+		config.Ed25519SigningKeyLocation = keyFile.Name()
+	}
+	// keep the task directories of previous local runs, so that they can be
+	// inspected
+	config.CleanUpTaskDirs = false
+	return cleanUp, nil
+}
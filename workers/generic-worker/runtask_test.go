@@ -0,0 +1,25 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestConfigureForLocalQueueRemovesSigningKey(t *testing.T) {
+	defer prepareEnvironment(t)()
+	configureWorker(t)
+	config.Ed25519SigningKeyLocation = ""
+
+	cleanUp, err := configureForLocalQueue("http://localhost:1234")
+	if err != nil {
+		t.Fatalf("Could not configure worker for local queue: %v", err)
+	}
+	keyFile := config.Ed25519SigningKeyLocation
+	if _, err := os.Stat(keyFile); err != nil {
+		t.Fatalf("Expected temporary signing key to be written: %v", err)
+	}
+	cleanUp()
+	if _, err := os.Stat(keyFile); !os.IsNotExist(err) {
+		t.Fatalf("Expected temporary signing key %v to be removed, but got %v", keyFile, err)
+	}
+}
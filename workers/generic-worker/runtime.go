@@ -11,6 +11,12 @@ func copyFileContents(src, dst string) (err error) {
 		return
 	}
 	defer in.Close()
+	return writeFileContents(in, dst)
+}
+
+// writeFileContents writes everything read from src to the file dst,
+// replacing any existing content of dst.
+func writeFileContents(src io.Reader, dst string) (err error) {
 	out, err := os.Create(dst)
 	if err != nil {
 		return
@@ -21,7 +27,7 @@ func copyFileContents(src, dst string) (err error) {
 			err = cerr
 		}
 	}()
-	if _, err = io.Copy(out, in); err != nil {
+	if _, err = io.Copy(out, src); err != nil {
 		return
 	}
 	err = out.Sync()
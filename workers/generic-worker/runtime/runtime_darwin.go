@@ -51,6 +51,16 @@ func DeleteUser(username string) (err error) {
 	return nil
 }
 
+// AddUserToGroup adds the given user to the given existing group.
+func AddUserToGroup(username, group string) error {
+	return host.Run("/usr/bin/sudo", "/usr/sbin/dseditgroup", "-o", "edit", "-a", username, "-t", "user", group)
+}
+
+// RemoveUserFromGroup removes the given user from the given group.
+func RemoveUserFromGroup(username, group string) error {
+	return host.Run("/usr/bin/sudo", "/usr/sbin/dseditgroup", "-o", "edit", "-d", username, "-t", "user", group)
+}
+
 func ListUserAccounts() (usernames []string, err error) {
 	var out string
 	out, err = host.CombinedOutput("/usr/bin/dscl", ".", "-list", "/Users")
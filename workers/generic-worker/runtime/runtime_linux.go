@@ -38,6 +38,16 @@ func DeleteUser(username string) (err error) {
 	return host.Run("/usr/bin/sudo", "/usr/sbin/deluser", "--force", "--remove-all-files", username)
 }
 
+// AddUserToGroup adds the given user to the given existing group.
+func AddUserToGroup(username, group string) error {
+	return host.Run("/usr/bin/sudo", "/usr/bin/gpasswd", "--add", username, group)
+}
+
+// RemoveUserFromGroup removes the given user from the given group.
+func RemoveUserFromGroup(username, group string) error {
+	return host.Run("/usr/bin/sudo", "/usr/bin/gpasswd", "--delete", username, group)
+}
+
 func ListUserAccounts() (usernames []string, err error) {
 	var passwd []byte
 	passwd, err = ioutil.ReadFile("/etc/passwd")
@@ -0,0 +1,94 @@
+// +build darwin,simple linux,simple freebsd,simple
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/taskcluster/taskcluster/v28/internal/scopes"
+)
+
+// SandboxFeature runs task commands of the simple engine in a sandbox, in
+// which the task directory is the only writable location on persistent
+// storage, and the caches, downloads, config and keys of the worker are
+// hidden, so that a task cannot tamper with the worker, or with the caches
+// of future tasks. Only supported on Linux, where the sandbox is built from
+// unprivileged user and mount namespaces.
+type SandboxFeature struct {
+}
+
+func (feature *SandboxFeature) Name() string {
+	return "Sandbox"
+}
+
+func (feature *SandboxFeature) Initialise() error {
+	if !config.SandboxTasks {
+		return nil
+	}
+	err := initialiseSandbox() // platform specific
+	if err != nil {
+		return fmt.Errorf("Config setting sandboxTasks is enabled, but task commands cannot be sandboxed: %v", err)
+	}
+	return nil
+}
+
+func (feature *SandboxFeature) PersistState() error {
+	return nil
+}
+
+// The sandbox is enabled for all tasks, or none, depending on worker config.
+func (feature *SandboxFeature) IsEnabled(task *TaskRun) bool {
+	return config.SandboxTasks
+}
+
+type SandboxTask struct {
+	task *TaskRun
+}
+
+func (feature *SandboxFeature) NewTaskFeature(task *TaskRun) TaskFeature {
+	return &SandboxTask{
+		task: task,
+	}
+}
+
+func (st *SandboxTask) RequiredScopes() scopes.Required {
+	return scopes.Required{}
+}
+
+func (st *SandboxTask) ReservedArtifacts() []string {
+	return []string{}
+}
+
+func (st *SandboxTask) Start() *CommandExecutionError {
+	err := sandboxCommands(st.task) // platform specific
+	if err != nil {
+		return executionError(internalError, errored, fmt.Errorf("Could not sandbox task commands: %v", err))
+	}
+	st.task.Info("[sandbox] Task commands run in a sandbox - only the task directory is writable")
+	return nil
+}
+
+func (st *SandboxTask) Stop(err *ExecutionErrors) {
+}
+
+// sandboxHiddenPaths returns the absolute paths of the files and directories
+// of the worker that sandboxed task commands may not read.
+func sandboxHiddenPaths() []string {
+	hiddenPaths := []string{}
+	for _, path := range []string{
+		config.CachesDir,
+		config.DownloadsDir,
+		configFilePath,
+		config.Ed25519SigningKeyLocation,
+		config.LiveLogKey,
+	} {
+		if path == "" {
+			continue
+		}
+		if absPath, err := filepath.Abs(path); err == nil {
+			hiddenPaths = append(hiddenPaths, absPath)
+		}
+	}
+	return hiddenPaths
+}
@@ -0,0 +1,16 @@
+// +build darwin,simple freebsd,simple
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func initialiseSandbox() error {
+	return fmt.Errorf("sandboxing is not supported on platform %v", runtime.GOOS)
+}
+
+func sandboxCommands(task *TaskRun) error {
+	return fmt.Errorf("sandboxing is not supported on platform %v", runtime.GOOS)
+}
@@ -0,0 +1,42 @@
+// +build simple
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/process"
+)
+
+// initialiseSandbox checks that user namespaces are available, by running a
+// trivial command in a sandbox.
+func initialiseSandbox() error {
+	cmd, err := process.NewCommand([]string{"/bin/true"}, "/", nil)
+	if err != nil {
+		return err
+	}
+	err = cmd.SetSandbox(&process.Sandbox{})
+	if err != nil {
+		return err
+	}
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+func sandboxCommands(task *TaskRun) error {
+	sandbox := &process.Sandbox{
+		WritablePaths: []string{taskContext.TaskDir},
+		HiddenPaths:   sandboxHiddenPaths(),
+	}
+	for _, command := range task.allCommands() {
+		err := command.SetSandbox(sandbox)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+// +build simple
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSandboxedTaskCommands(t *testing.T) {
+	_, teardown := setupWithFakeServices(t)
+	defer teardown()
+	config.SandboxTasks = true
+
+	err := os.MkdirAll(config.CachesDir, 0755)
+	if err != nil {
+		t.Fatalf("Could not create caches directory: %v", err)
+	}
+	err = ioutil.WriteFile(filepath.Join(config.CachesDir, "secret.txt"), []byte("secret"), 0644)
+	if err != nil {
+		t.Fatalf("Could not write file to caches directory: %v", err)
+	}
+
+	script := strings.Join([]string{
+		"set -u",
+		"echo hello > in-task-dir.txt || exit 64",
+		fmt.Sprintf("test ! -e %q || exit 65", filepath.Join(config.CachesDir, "secret.txt")),
+		fmt.Sprintf("touch %q 2>/dev/null && exit 66", filepath.Join(config.CachesDir, "new.txt")),
+		"touch /usr/generic-worker-sandbox-test 2>/dev/null && exit 67",
+		`test -z "$(ls -A /tmp)" || exit 68`,
+		"echo sandboxed > /tmp/scratch.txt || exit 69",
+		"echo all good",
+	}, "\n")
+	payload := GenericWorkerPayload{
+		Command: [][]string{
+			{"/bin/bash", "-c", script},
+		},
+		MaxRunTime: 30,
+	}
+	td := testTask(t)
+
+	taskID := submitAndAssert(t, td, payload, "completed", "completed")
+
+	logtext, _, _, _ := getArtifactContent(t, taskID, "public/logs/live_backing.log")
+	if !strings.Contains(string(logtext), "[sandbox] Task commands run in a sandbox") || !strings.Contains(string(logtext), "all good") {
+		t.Fatalf("Expected task log to show sandboxed task command succeeded:\n%s", logtext)
+	}
+	if _, err := os.Stat("/usr/generic-worker-sandbox-test"); err == nil {
+		_ = os.Remove("/usr/generic-worker-sandbox-test")
+		t.Fatal("Sandboxed task command was able to write to /usr")
+	}
+}
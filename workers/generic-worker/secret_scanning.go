@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/taskcluster/taskcluster/v28/internal/scopes"
+)
+
+// SecretScanningFeature scans the files of public artifacts for secrets, such
+// as private keys and taskcluster access tokens, before they are uploaded, so
+// that secrets that a task writes to its artifacts by mistake are not
+// published. The detectors that files are scanned with, and what happens to
+// an artifact that appears to contain a secret, are set in the worker config.
+type SecretScanningFeature struct {
+}
+
+// maxSecretScanLineLength is the length of the chunks that lines longer than
+// it are scanned in, so that files without line breaks can be scanned
+// without reading them into memory in full.
+const maxSecretScanLineLength = 1024 * 1024
+
+// secretScanChunkOverlap is the number of bytes at the end of a chunk of a
+// long line that are scanned again with the next chunk, so that secrets that
+// span the boundary between chunks are detected. It is far longer than the
+// secrets that the built-in detectors look for.
+const secretScanChunkOverlap = 4096
+
+// secretDetector detects secrets in the lines of a file.
+type secretDetector struct {
+	name  string
+	match func(line []byte) bool
+}
+
+var (
+	// secretDetectors are the detectors that public artifacts are scanned
+	// with, set up from the worker config when the feature is initialised
+	secretDetectors []*secretDetector
+
+	privateKeyPattern = regexp.MustCompile(`-----BEGIN ([A-Z0-9]+ )*PRIVATE KEY( BLOCK)?-----`)
+	// taskcluster access tokens are 44 character url-safe base64 strings,
+	// which are only distinctive where they are assigned to something
+	taskclusterAccessTokenPattern = regexp.MustCompile(`(?i)access_?token["']?\s*[:=]\s*["']?[A-Za-z0-9_-]{44}([^A-Za-z0-9_-]|$)`)
+	// candidates for random strings, including any label of a base64
+	// encoded digest, such as sha256=<digest> in the RECORD files of python
+	// wheels, or sha512-<digest> in the integrity values of npm lock files,
+	// which are random, but not secret
+	highEntropyCandidatePattern = regexp.MustCompile(`((?i:md5|sha1|sha224|sha256|sha384|sha512)[=:-])?([A-Za-z0-9+/_=-]{32,})`)
+)
+
+// highEntropyThreshold returns the Shannon entropy, in bits per character,
+// above which a string of the given length is considered random. A random
+// base64 string of n characters has an expected entropy of about
+// 6 - 63/(2n ln 2) bits per character, since short strings can't contain
+// all 64 characters equally often, so a fixed threshold would either miss
+// many short random strings, or report long strings that aren't random. Half
+// a bit below the expected entropy, fewer than 1 in 1000 random strings of 32
+// characters are missed, whereas words, identifiers and hex encoded hashes
+// (at most 4 bits per character) are below it.
+func highEntropyThreshold(length int) float64 {
+	return 6 - 63/(2*float64(length)*math.Ln2) - 0.5
+}
+
+var builtInSecretDetectors = map[string]func(line []byte) bool{
+	"privateKey":             privateKeyPattern.Match,
+	"taskclusterAccessToken": taskclusterAccessTokenPattern.Match,
+	"highEntropy": func(line []byte) bool {
+		for _, match := range highEntropyCandidatePattern.FindAllSubmatch(line, -1) {
+			if len(match[1]) > 0 {
+				// labelled digest
+				continue
+			}
+			candidate := match[2]
+			if shannonEntropy(candidate) > highEntropyThreshold(len(candidate)) {
+				return true
+			}
+		}
+		return false
+	},
+}
+
+func (feature *SecretScanningFeature) Name() string {
+	return "Secret Scanning"
+}
+
+func (feature *SecretScanningFeature) Initialise() error {
+	switch secretScanningMode() {
+	case "disabled", "optional", "always":
+	default:
+		return fmt.Errorf("Invalid value %q for config setting secretScanning - must be one of \"disabled\", \"optional\" or \"always\"", config.SecretScanning)
+	}
+	switch config.SecretScanningAction {
+	case "error", "private":
+	default:
+		return fmt.Errorf("Invalid value %q for config setting secretScanningAction - must be \"error\" or \"private\"", config.SecretScanningAction)
+	}
+	secretDetectors = []*secretDetector{}
+	for _, name := range config.SecretScanningDetectors {
+		match, exists := builtInSecretDetectors[name]
+		if !exists {
+			return fmt.Errorf("Invalid entry %q in config setting secretScanningDetectors - must be one of \"privateKey\", \"taskclusterAccessToken\" or \"highEntropy\"", name)
+		}
+		secretDetectors = append(secretDetectors, &secretDetector{name: name, match: match})
+	}
+	for _, pattern := range config.SecretScanningPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("Invalid entry %q in config setting secretScanningPatterns: %v", pattern, err)
+		}
+		secretDetectors = append(secretDetectors, &secretDetector{name: "pattern " + pattern, match: re.Match})
+	}
+	return nil
+}
+
+func (feature *SecretScanningFeature) PersistState() error {
+	return nil
+}
+
+// IsEnabled returns true if the task requests secret scanning, even if the
+// worker has it disabled, so that the task does not publish artifacts that
+// have not been scanned.
+func (feature *SecretScanningFeature) IsEnabled(task *TaskRun) bool {
+	return secretScanningMode() == "always" || task.Payload.Features.SecretScanning
+}
+
+type SecretScanningTask struct {
+	task *TaskRun
+}
+
+func (feature *SecretScanningFeature) NewTaskFeature(task *TaskRun) TaskFeature {
+	return &SecretScanningTask{
+		task: task,
+	}
+}
+
+func (sst *SecretScanningTask) ValidatePayload() *CommandExecutionError {
+	if secretScanningMode() == "disabled" {
+		return MalformedPayloadError(atPayloadValue("/features/secretScanning", fmt.Errorf("Task payload enables feature secretScanning, but secret scanning is disabled on this worker (config setting secretScanning is \"disabled\")")))
+	}
+	return nil
+}
+
+func (sst *SecretScanningTask) RequiredScopes() scopes.Required {
+	return scopes.Required{}
+}
+
+func (sst *SecretScanningTask) ReservedArtifacts() []string {
+	return []string{}
+}
+
+func (sst *SecretScanningTask) Start() *CommandExecutionError {
+	sst.task.scanSecrets = true
+	sst.task.Infof("[secret scanning] Public artifacts will be scanned for secrets before they are uploaded")
+	return nil
+}
+
+func (sst *SecretScanningTask) Stop(err *ExecutionErrors) {
+}
+
+func secretScanningMode() string {
+	if config.SecretScanning == "" {
+		return "disabled"
+	}
+	return config.SecretScanning
+}
+
+// scanArtifactForSecrets returns the artifact to upload in place of the
+// given artifact, which is the artifact itself, unless it is a public
+// artifact whose file appears to contain a secret. In that case it is an
+// error artifact, or the artifact under a private name, depending on config
+// setting secretScanningAction.
+func (task *TaskRun) scanArtifactForSecrets(artifact TaskArtifact) TaskArtifact {
+	s3Artifact, isS3Artifact := artifact.(*S3Artifact)
+	if !task.scanSecrets || !isS3Artifact || !strings.HasPrefix(s3Artifact.Name, "public/") {
+		return artifact
+	}
+	detector, line, err := findSecret(filepath.Join(taskContext.TaskDir, s3Artifact.Path))
+	if err != nil {
+		return &ErrorArtifact{
+			BaseArtifact: s3Artifact.BaseArtifact,
+			Path:         s3Artifact.Path,
+			Message:      fmt.Sprintf("Could not scan file '%s' for secrets: %v", s3Artifact.Path, err),
+			Reason:       "invalid-resource-on-worker",
+		}
+	}
+	if detector == "" {
+		return artifact
+	}
+	finding := fmt.Sprintf("file '%s' appears to contain a secret (detected by %v on line %v)", s3Artifact.Path, detector, line)
+	if config.SecretScanningAction == "private" {
+		privateName := "private/" + strings.TrimPrefix(s3Artifact.Name, "public/")
+		task.Warnf("[secret scanning] Uploading artifact %v as %v, since %v", s3Artifact.Name, privateName, finding)
+		privateArtifact := *s3Artifact
+		privateArtifact.BaseArtifact = &BaseArtifact{
+			Name:    privateName,
+			Expires: s3Artifact.Expires,
+		}
+		return &privateArtifact
+	}
+	return &ErrorArtifact{
+		BaseArtifact: s3Artifact.BaseArtifact,
+		Path:         s3Artifact.Path,
+		Message:      fmt.Sprintf("Not uploading public artifact %v, since %v", s3Artifact.Name, finding),
+		Reason:       "invalid-resource-on-worker",
+	}
+}
+
+// findSecret returns the name of the first detector that detects a secret in
+// the given file, and the line number it is detected on, or an empty
+// detector name if none do.
+func findSecret(file string) (detector string, line int, err error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	reader := bufio.NewReaderSize(f, maxSecretScanLineLength)
+	// overlap is the end of the previous chunk of the current line, if it
+	// is longer than maxSecretScanLineLength
+	var overlap []byte
+	line = 1
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		if err != nil && err != bufio.ErrBufferFull && err != io.EOF {
+			return "", 0, err
+		}
+		data := chunk
+		if overlap != nil {
+			data = append(overlap, chunk...)
+		}
+		if err != bufio.ErrBufferFull {
+			data = bytes.TrimSuffix(bytes.TrimSuffix(data, []byte("\n")), []byte("\r"))
+		}
+		for _, d := range secretDetectors {
+			if d.match(data) {
+				return d.name, line, nil
+			}
+		}
+		switch err {
+		case bufio.ErrBufferFull:
+			if len(data) > secretScanChunkOverlap {
+				data = data[len(data)-secretScanChunkOverlap:]
+			}
+			// chunk is only valid until the next read
+			overlap = append([]byte{}, data...)
+		case io.EOF:
+			return "", 0, nil
+		default:
+			overlap = nil
+			line++
+		}
+	}
+}
+
+// shannonEntropy returns the Shannon entropy of the characters of s, in bits
+// per character.
+func shannonEntropy(s []byte) float64 {
+	counts := map[byte]int{}
+	for _, c := range s {
+		counts[c]++
+	}
+	entropy := 0.0
+	for _, count := range counts {
+		p := float64(count) / float64(len(s))
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
@@ -0,0 +1,72 @@
+// +build darwin,!docker linux,!docker freebsd
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func secretScanningPayload() GenericWorkerPayload {
+	return GenericWorkerPayload{
+		Command: [][]string{
+			{
+				"/bin/bash",
+				"-c",
+				// split the header, so that the task definition doesn't contain it
+				`echo '-----BEGIN RSA PRIVATE ''KEY-----' > key.pem && echo 'harmless' > notes.txt`,
+			},
+		},
+		Artifacts: []Artifact{
+			{
+				Path: "key.pem",
+				Name: "public/key.pem",
+				Type: "file",
+			},
+			{
+				Path: "notes.txt",
+				Name: "public/notes.txt",
+				Type: "file",
+			},
+		},
+		MaxRunTime: 30,
+		Features: FeatureFlags{
+			SecretScanning: true,
+		},
+	}
+}
+
+func TestSecretScanningFailsTask(t *testing.T) {
+	_, teardown := setupWithFakeServices(t)
+	defer teardown()
+
+	td := testTask(t)
+	taskID := submitAndAssert(t, td, secretScanningPayload(), "failed", "failed")
+
+	logtext, _, _, _ := getArtifactContent(t, taskID, "public/logs/live_backing.log")
+	if !strings.Contains(string(logtext), "Not uploading public artifact public/key.pem, since file 'key.pem' appears to contain a secret (detected by privateKey on line 1)") {
+		t.Fatalf("Expected task log to report secret:\n%s", logtext)
+	}
+	content, _, _, _ := getArtifactContent(t, taskID, "public/notes.txt")
+	if string(content) != "harmless\n" {
+		t.Fatalf("Expected artifact without secrets to be uploaded, but got %q", content)
+	}
+}
+
+func TestSecretScanningMovesArtifactToPrivateName(t *testing.T) {
+	_, teardown := setupWithFakeServices(t)
+	defer teardown()
+	config.SecretScanningAction = "private"
+
+	td := testTask(t)
+	taskID := submitAndAssert(t, td, secretScanningPayload(), "completed", "completed")
+
+	logtext, _, _, _ := getArtifactContent(t, taskID, "public/logs/live_backing.log")
+	if !strings.Contains(string(logtext), "Uploading artifact public/key.pem as private/key.pem") {
+		t.Fatalf("Expected task log to report that artifact was moved to a private name:\n%s", logtext)
+	}
+	content, _, _, _ := getArtifactContent(t, taskID, "private/key.pem")
+	if !strings.Contains(string(content), "PRIVATE KEY") {
+		t.Fatalf("Expected artifact to be uploaded under private name, but got %q", content)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakePrivateKeyHeader is assembled at runtime, so that this file does not
+// itself look like it contains a private key
+var fakePrivateKeyHeader = "-----BEGIN RSA " + "PRIVATE KEY-----"
+
+func TestFindSecret(t *testing.T) {
+	defer prepareEnvironment(t)()
+	configureWorker(t)
+	config.SecretScanningDetectors = []string{"privateKey", "taskclusterAccessToken", "highEntropy"}
+	config.SecretScanningPatterns = []string{`hunter[0-9]`}
+	err := (&SecretScanningFeature{}).Initialise()
+	if err != nil {
+		t.Fatalf("Could not initialise secret scanning: %v", err)
+	}
+
+	dir, err := ioutil.TempDir("", t.Name())
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	for _, test := range []struct {
+		content          string
+		expectedDetector string
+		expectedLine     int
+	}{
+		{"nothing to see here\n", "", 0},
+		{"build log\n" + fakePrivateKeyHeader + "\nMIIEow...\n", "privateKey", 2},
+		{"{\n  \"clientId\": \"x\",\n  \"accessToken\": \"" + strings.Repeat("aB3_", 11) + "\"\n}\n", "taskclusterAccessToken", 3},
+		{"TASKCLUSTER_ACCESS_TOKEN=" + strings.Repeat("aB3_", 11) + "\n", "taskclusterAccessToken", 1},
+		{"key: Zm9vYmFyYmF6cXV4UXdFclR5VWlPcEFzRGZHaEpr\n", "highEntropy", 1},
+		// hex encoded hashes are not random enough to be reported
+		{"sha256: 9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08\n", "", 0},
+		{"password is hunter2", "pattern hunter[0-9]", 1},
+		{strings.Repeat("x", 3*maxSecretScanLineLength) + fakePrivateKeyHeader, "privateKey", 1},
+		// secrets that span the boundary between chunks of a long line
+		{"\n" + strings.Repeat("x", maxSecretScanLineLength-20) + "accessToken=" + strings.Repeat("aB3_", 11) + "\n", "taskclusterAccessToken", 2},
+		{strings.Repeat("x", 2*maxSecretScanLineLength-10) + fakePrivateKeyHeader + "\n", "privateKey", 1},
+	} {
+		file := filepath.Join(dir, "artifact.txt")
+		err := ioutil.WriteFile(file, []byte(test.content), 0644)
+		if err != nil {
+			t.Fatalf("Could not write file: %v", err)
+		}
+		detector, line, err := findSecret(file)
+		if err != nil {
+			t.Fatalf("Could not scan file: %v", err)
+		}
+		if detector != test.expectedDetector || line != test.expectedLine {
+			t.Errorf("Expected detector %q on line %v but got detector %q on line %v for content %.100q", test.expectedDetector, test.expectedLine, detector, line, test.content)
+		}
+	}
+}
+
+func TestHighEntropyDetector(t *testing.T) {
+	highEntropy := builtInSecretDetectors["highEntropy"]
+
+	// short random tokens have a lower entropy than long ones, but should
+	// still be detected
+	const urlSafe = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_"
+	r := rand.New(rand.NewSource(1))
+	missed := 0
+	for i := 0; i < 1000; i++ {
+		token := make([]byte, 32)
+		for j := range token {
+			token[j] = urlSafe[r.Intn(len(urlSafe))]
+		}
+		if !highEntropy([]byte("token: " + string(token))) {
+			missed++
+		}
+	}
+	if missed > 5 {
+		t.Fatalf("Expected at most 5 of 1000 random 32 character tokens to be missed, but %v were", missed)
+	}
+
+	// digests are random, but not secret
+	sha256Sum := sha256.Sum256([]byte("some file"))
+	sha512Sum := sha512.Sum512([]byte("some package"))
+	for _, line := range []string{
+		"numpy/__init__.py,sha256=" + base64.RawURLEncoding.EncodeToString(sha256Sum[:]) + ",12345",
+		`"integrity": "sha512-` + base64.StdEncoding.EncodeToString(sha512Sum[:]) + `"`,
+		"digest: SHA256:" + base64.StdEncoding.EncodeToString(sha256Sum[:]),
+	} {
+		if highEntropy([]byte(line)) {
+			t.Errorf("Expected digest not to be detected as secret: %v", line)
+		}
+	}
+}
+
+func TestSecretScanningInvalidConfig(t *testing.T) {
+	defer prepareEnvironment(t)()
+	configureWorker(t)
+	config.SecretScanningPatterns = []string{`(`}
+	err := (&SecretScanningFeature{}).Initialise()
+	if err == nil || !strings.Contains(err.Error(), "secretScanningPatterns") {
+		t.Fatalf("Expected invalid pattern to be reported, but got %v", err)
+	}
+	config.SecretScanningPatterns = []string{}
+	config.SecretScanningDetectors = []string{"passwords"}
+	err = (&SecretScanningFeature{}).Initialise()
+	if err == nil || !strings.Contains(err.Error(), "secretScanningDetectors") {
+		t.Fatalf("Expected invalid detector to be reported, but got %v", err)
+	}
+}
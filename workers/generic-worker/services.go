@@ -0,0 +1,273 @@
+// +build darwin,!docker linux,!docker freebsd
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/taskcluster/shell"
+	"github.com/taskcluster/taskcluster/v28/internal/scopes"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/process"
+)
+
+// ServicesFeature runs the sidecar services listed in the task payload, such
+// as databases or mock servers, for the duration of the task. Services are
+// started in order, each one after the previous one is ready, before the
+// task commands run, and are terminated in reverse order once the task
+// commands have completed. The output of each service is published as a
+// separate log artifact.
+type ServicesFeature struct {
+}
+
+const (
+	// defaultServiceReadinessTimeout is how long to wait for a service to be
+	// ready, if the readiness probe of the service has no timeout
+	defaultServiceReadinessTimeout = 60 * time.Second
+	// serviceReadinessProbeInterval is the time between readiness probes
+	serviceReadinessProbeInterval = 250 * time.Millisecond
+)
+
+func (feature *ServicesFeature) Name() string {
+	return "Services"
+}
+
+func (feature *ServicesFeature) Initialise() error {
+	return nil
+}
+
+func (feature *ServicesFeature) PersistState() error {
+	return nil
+}
+
+func (feature *ServicesFeature) IsEnabled(task *TaskRun) bool {
+	return len(task.Payload.Services) > 0
+}
+
+type ServicesTask struct {
+	task     *TaskRun
+	services []*service
+}
+
+// service is a running sidecar service of a task.
+type service struct {
+	name    string
+	command *process.Command
+	logFile *os.File
+	// result is set before exited is closed
+	result *process.Result
+	exited chan struct{}
+	// failureReported is set if the task has already failed because the
+	// service exited early
+	failureReported bool
+}
+
+func (feature *ServicesFeature) NewTaskFeature(task *TaskRun) TaskFeature {
+	return &ServicesTask{
+		task: task,
+	}
+}
+
+// generateServiceCommands generates the service commands up front, together
+// with the task commands, so that features can configure them in the same
+// way as the task commands (e.g. with environment variables, or network
+// isolation), before they start.
+func (task *TaskRun) generateServiceCommands() {
+	task.ServiceCommands = make([]*process.Command, len(task.Payload.Services))
+	for i, svc := range task.Payload.Services {
+		command, err := task.newServiceCommand(svc.Command) // platform specific
+		if err != nil {
+			panic(err)
+		}
+		for variable, value := range svc.Env {
+			command.SetEnv(variable, value)
+		}
+		task.ServiceCommands[i] = command
+	}
+}
+
+func (st *ServicesTask) RequiredScopes() scopes.Required {
+	return scopes.Required{}
+}
+
+func (st *ServicesTask) ReservedArtifacts() []string {
+	// duplicate service names are reported by Start
+	artifacts := []string{}
+	reserved := map[string]bool{}
+	for _, svc := range st.task.Payload.Services {
+		if name := serviceLogName(svc.Name); !reserved[name] {
+			artifacts = append(artifacts, name)
+			reserved[name] = true
+		}
+	}
+	return artifacts
+}
+
+// ReservedArtifactPointer returns the JSON pointer of the name of the
+// service whose log is published as the given artifact.
+func (st *ServicesTask) ReservedArtifactPointer(name string) string {
+	for i, svc := range st.task.Payload.Services {
+		if serviceLogName(svc.Name) == name {
+			return fmt.Sprintf("/services/%v/name", i)
+		}
+	}
+	return ""
+}
+
+func (st *ServicesTask) Start() *CommandExecutionError {
+	names := map[string]bool{}
+	for _, svc := range st.task.Payload.Services {
+		if names[svc.Name] {
+			return MalformedPayloadError(fmt.Errorf("Service name %q is used by more than one service in task payload", svc.Name))
+		}
+		names[svc.Name] = true
+		if svc.ReadinessProbe.TCPPort != 0 && svc.ReadinessProbe.URL != "" {
+			return MalformedPayloadError(fmt.Errorf("Readiness probe of service %q has both tcpPort and url - only one may be given", svc.Name))
+		}
+	}
+	err := os.MkdirAll(filepath.Join(taskContext.TaskDir, "generic-worker", "services"), 0755)
+	if err != nil {
+		return executionError(internalError, errored, fmt.Errorf("Could not create directory for service logs: %v", err))
+	}
+	for i, svc := range st.task.Payload.Services {
+		logFile, err := os.Create(filepath.Join(taskContext.TaskDir, serviceLogPath(svc.Name)))
+		if err != nil {
+			return executionError(internalError, errored, fmt.Errorf("Could not create log file of service %q: %v", svc.Name, err))
+		}
+		s := &service{
+			name:    svc.Name,
+			command: st.task.ServiceCommands[i],
+			logFile: logFile,
+			exited:  make(chan struct{}),
+		}
+		st.services = append(st.services, s)
+		s.command.DirectOutput(logFile)
+		st.task.Infof("[services] Starting service %v: %v", svc.Name, shell.Escape(svc.Command...))
+		go func() {
+			s.result = s.command.Execute()
+			close(s.exited)
+		}()
+		err = s.waitUntilReady(svc.ReadinessProbe)
+		if err != nil {
+			return Failure(err)
+		}
+		st.task.Infof("[services] Service %v is ready", svc.Name)
+	}
+	return nil
+}
+
+func (st *ServicesTask) Stop(err *ExecutionErrors) {
+	for i := len(st.services) - 1; i >= 0; i-- {
+		s := st.services[i]
+		select {
+		case <-s.exited:
+			if !s.failureReported {
+				err.add(Failure(fmt.Errorf("[services] Service %v exited before the task commands completed: %v", s.name, serviceExitDescription(s.result))))
+			}
+		default:
+			st.task.Infof("[services] Stopping service %v", s.name)
+			_, e := s.command.Terminate(st.task.gracePeriod(), false)
+			if e != nil {
+				log.Printf("WARNING: could not terminate service %v: %v", s.name, e)
+			}
+			<-s.exited
+		}
+		e := s.logFile.Close()
+		if e != nil {
+			log.Printf("WARNING: could not close log file of service %v: %v", s.name, e)
+		}
+		err.add(st.task.uploadLog(serviceLogName(s.name), serviceLogPath(s.name)))
+	}
+}
+
+// waitUntilReady returns nil once the readiness probe of the service
+// succeeds, or an error if the service exits first, or the probe does not
+// succeed within its timeout. A service without a readiness probe is ready
+// immediately.
+func (s *service) waitUntilReady(probe ReadinessProbe) error {
+	if probe.TCPPort == 0 && probe.URL == "" {
+		return nil
+	}
+	timeout := time.Duration(probe.Timeout) * time.Second
+	if timeout == 0 {
+		timeout = defaultServiceReadinessTimeout
+	}
+	deadline := time.After(timeout)
+	ticker := time.NewTicker(serviceReadinessProbeInterval)
+	defer ticker.Stop()
+	for {
+		err := s.probe(probe)
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-s.exited:
+			s.failureReported = true
+			return fmt.Errorf("[services] Service %v exited before it was ready: %v", s.name, serviceExitDescription(s.result))
+		case <-deadline:
+			return fmt.Errorf("[services] Service %v was not ready after %v: %v", s.name, timeout, err)
+		case <-ticker.C:
+		}
+	}
+}
+
+// probe checks the readiness of the service once. Connections are made from
+// the network namespace of the service, which is not necessarily the
+// network namespace of the worker.
+func (s *service) probe(probe ReadinessProbe) error {
+	dial := func(ctx context.Context, network, address string) (conn net.Conn, err error) {
+		err = s.command.InNetworkNamespace(func() error {
+			// without fallback, the socket is created by this goroutine
+			dialer := &net.Dialer{Timeout: 5 * time.Second, FallbackDelay: -1}
+			conn, err = dialer.DialContext(ctx, network, address)
+			return err
+		})
+		return
+	}
+	if probe.TCPPort != 0 {
+		conn, err := dial(context.Background(), "tcp", fmt.Sprintf("127.0.0.1:%v", probe.TCPPort))
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+	client := &http.Client{
+		Timeout: 5 * time.Second,
+		Transport: &http.Transport{
+			DialContext:       dial,
+			DisableKeepAlives: true,
+		},
+	}
+	resp, err := client.Get(probe.URL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("GET %v returned status code %v", probe.URL, resp.StatusCode)
+	}
+	return nil
+}
+
+func serviceExitDescription(result *process.Result) string {
+	if result.SystemError != nil {
+		return result.SystemError.Error()
+	}
+	return fmt.Sprintf("exit code %v", result.ExitCode())
+}
+
+func serviceLogName(name string) string {
+	return "public/logs/services/" + name + ".log"
+}
+
+// serviceLogPath returns the path of the log file of the service, relative
+// to the task directory.
+func serviceLogPath(name string) string {
+	return filepath.Join("generic-worker", "services", name+".log")
+}
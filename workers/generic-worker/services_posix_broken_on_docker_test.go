@@ -0,0 +1,137 @@
+// +build darwin,!docker linux,!docker freebsd
+
+package main
+
+import (
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// freePort returns a TCP port on the loopback interface that nothing is
+// listening on.
+func freePort(t *testing.T) int {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Could not find free port: %v", err)
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func TestServiceReadyBeforeTaskCommands(t *testing.T) {
+	_, teardown := setupWithFakeServices(t)
+	defer teardown()
+
+	port := strconv.Itoa(freePort(t))
+	payload := GenericWorkerPayload{
+		Command: goRun("curlget.go", "http://127.0.0.1:"+port+"/hello"),
+		Services: []SidecarService{
+			{
+				Name:    "web",
+				Command: []string{"go", "run", filepath.Join(testdataDir, "serve-http.go"), port},
+				ReadinessProbe: ReadinessProbe{
+					URL: "http://127.0.0.1:" + port + "/health",
+				},
+			},
+		},
+		MaxRunTime: 180,
+	}
+	td := testTask(t)
+
+	taskID := submitAndAssert(t, td, payload, "completed", "completed")
+
+	logtext, _, _, _ := getArtifactContent(t, taskID, "public/logs/live_backing.log")
+	if !strings.Contains(string(logtext), "[services] Service web is ready") || !strings.Contains(string(logtext), "hello from service") {
+		t.Fatalf("Expected task command to reach service:\n%s", logtext)
+	}
+	servicelog, _, _, _ := getArtifactContent(t, taskID, "public/logs/services/web.log")
+	if !strings.Contains(string(servicelog), "Listening on 127.0.0.1:"+port) || !strings.Contains(string(servicelog), "Serving /hello") {
+		t.Fatalf("Expected service output in service log:\n%s", servicelog)
+	}
+}
+
+func TestServiceExitingEarlyFailsTask(t *testing.T) {
+	_, teardown := setupWithFakeServices(t)
+	defer teardown()
+
+	payload := GenericWorkerPayload{
+		Command: sleep(2),
+		Services: []SidecarService{
+			{
+				Name:    "short-lived",
+				Command: []string{"/bin/bash", "-c", "echo bye; exit 3"},
+			},
+		},
+		MaxRunTime: 30,
+	}
+	td := testTask(t)
+
+	taskID := submitAndAssert(t, td, payload, "failed", "failed")
+
+	logtext, _, _, _ := getArtifactContent(t, taskID, "public/logs/live_backing.log")
+	if !strings.Contains(string(logtext), "[services] Service short-lived exited before the task commands completed: exit code 3") {
+		t.Fatalf("Expected task log to report that service exited early:\n%s", logtext)
+	}
+	servicelog, _, _, _ := getArtifactContent(t, taskID, "public/logs/services/short-lived.log")
+	if strings.TrimSpace(string(servicelog)) != "bye" {
+		t.Fatalf("Expected service output in service log, but got:\n%s", servicelog)
+	}
+}
+
+func TestServiceNotReadyFailsTask(t *testing.T) {
+	_, teardown := setupWithFakeServices(t)
+	defer teardown()
+
+	payload := GenericWorkerPayload{
+		Command: helloGoodbye(),
+		Services: []SidecarService{
+			{
+				Name:    "never-ready",
+				Command: []string{"sleep", "60"},
+				ReadinessProbe: ReadinessProbe{
+					TCPPort: int64(freePort(t)),
+					Timeout: 1,
+				},
+			},
+		},
+		MaxRunTime: 30,
+	}
+	td := testTask(t)
+
+	taskID := submitAndAssert(t, td, payload, "failed", "failed")
+
+	logtext, _, _, _ := getArtifactContent(t, taskID, "public/logs/live_backing.log")
+	if !strings.Contains(string(logtext), "[services] Service never-ready was not ready after 1s") {
+		t.Fatalf("Expected task log to report that service was not ready:\n%s", logtext)
+	}
+	if strings.Contains(string(logtext), "hello world!") {
+		t.Fatalf("Expected task commands not to run:\n%s", logtext)
+	}
+}
+
+func TestDuplicateServiceNames(t *testing.T) {
+	_, teardown := setupWithFakeServices(t)
+	defer teardown()
+
+	payload := GenericWorkerPayload{
+		Command: helloGoodbye(),
+		Services: []SidecarService{
+			{
+				Name:    "db",
+				Command: []string{"sleep", "60"},
+			},
+			{
+				Name:    "db",
+				Command: []string{"sleep", "60"},
+			},
+		},
+		MaxRunTime: 30,
+	}
+	td := testTask(t)
+
+	_ = submitAndAssert(t, td, payload, "exception", "malformed-payload")
+}
@@ -0,0 +1,8 @@
+// +build windows darwin,docker linux,docker
+
+package main
+
+// generateServiceCommands does nothing, since sidecar services are not
+// supported by this engine.
+func (task *TaskRun) generateServiceCommands() {
+}
@@ -30,10 +30,6 @@ func PlatformTaskEnvironmentSetup(taskDirName string) (reboot bool) {
 	return false
 }
 
-func platformFeatures() []Feature {
-	return []Feature{}
-}
-
 func deleteDir(path string) error {
 	log.Print("Removing directory '" + path + "'...")
 	err := host.Run("/bin/chmod", "-R", "u+w", path)
@@ -69,8 +65,8 @@ func (task *TaskRun) prepareCommand(index int) *CommandExecutionError {
 // Set an environment variable in each command.  This can be called from a feature's
 // NewTaskFeature method to set variables for the task.
 func (task *TaskRun) setVariable(variable string, value string) error {
-	for i := range task.Commands {
-		task.Commands[i].SetEnv(variable, value)
+	for _, command := range task.allCommands() {
+		command.SetEnv(variable, value)
 	}
 	return nil
 }
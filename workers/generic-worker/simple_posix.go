@@ -2,8 +2,44 @@
 
 package main
 
-import "os"
+import (
+	"os"
+	"time"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/process"
+)
+
+func platformFeatures() []Feature {
+	return []Feature{
+		// network isolation is stopped after the process reaper, so that no
+		// task processes remain in the task network namespace
+		&NetworkIsolationFeature{},
+		&ProcessReaperFeature{},
+		&SandboxFeature{},
+		// task metadata is started before services, so that services can
+		// also query it
+		&TaskMetadataFeature{},
+		// services are started after the features above have configured
+		// the service commands, and are stopped before they are stopped
+		&ServicesFeature{},
+		// live artifacts are stopped first, so that no artifacts are
+		// uploaded once the task features above have stopped
+		&LiveArtifactsFeature{},
+	}
+}
 
 func MkdirAllTaskUser(dir string, perms os.FileMode) (err error) {
 	return os.MkdirAll(dir, perms)
 }
+
+// gracePeriod returns how long task commands have to exit after SIGTERM,
+// before they are killed, when the task is aborted.
+func (task *TaskRun) gracePeriod() time.Duration {
+	return time.Duration(task.Payload.GracePeriod) * time.Second
+}
+
+// newServiceCommand returns a command that runs in the task directory, with
+// the environment of the task commands.
+func (task *TaskRun) newServiceCommand(commandLine []string) (*process.Command, error) {
+	return process.NewCommand(commandLine, taskContext.TaskDir, task.EnvVars())
+}
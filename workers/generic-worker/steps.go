@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	tcclient "github.com/taskcluster/taskcluster/v28/clients/client-go"
+	"github.com/taskcluster/taskcluster/v28/internal/scopes"
+)
+
+const (
+	stepsName = "public/steps.json"
+)
+
+var (
+	stepsPath = filepath.Join("generic-worker", "steps.json")
+)
+
+// taskStep holds the settings of a step of the task payload, whose command
+// is the task command with the same index.
+type taskStep struct {
+	Name            string
+	Env             map[string]string
+	Timeout         time.Duration
+	ContinueOnError bool
+}
+
+// StepSummary is the outcome of a step, as published in public/steps.json.
+type StepSummary struct {
+	Name    string `json:"name,omitempty"`
+	Command string `json:"command"`
+	// Result is one of "succeeded", "failed", "timed-out", "aborted" or
+	// "not-run"
+	Result          string         `json:"result"`
+	ExitCode        *int64         `json:"exitCode,omitempty"`
+	Started         *tcclient.Time `json:"started,omitempty"`
+	DurationSeconds float64        `json:"durationSeconds"`
+	ContinueOnError bool           `json:"continueOnError"`
+}
+
+// StepsFeature publishes a summary of the steps of the task, when the task
+// payload has steps rather than commands.
+type StepsFeature struct {
+}
+
+func (feature *StepsFeature) Name() string {
+	return "Steps"
+}
+
+func (feature *StepsFeature) Initialise() error {
+	return nil
+}
+
+func (feature *StepsFeature) PersistState() error {
+	return nil
+}
+
+func (feature *StepsFeature) IsEnabled(task *TaskRun) bool {
+	return len(task.steps) > 0
+}
+
+type StepsTask struct {
+	task *TaskRun
+}
+
+func (feature *StepsFeature) NewTaskFeature(task *TaskRun) TaskFeature {
+	task.stepSummaries = make([]*StepSummary, len(task.steps))
+	for i, step := range task.steps {
+		task.stepSummaries[i] = &StepSummary{
+			Name:            step.Name,
+			Command:         task.formatCommand(i),
+			Result:          "not-run",
+			ContinueOnError: step.ContinueOnError,
+		}
+	}
+	return &StepsTask{
+		task: task,
+	}
+}
+
+func (st *StepsTask) RequiredScopes() scopes.Required {
+	return scopes.Required{}
+}
+
+func (st *StepsTask) ReservedArtifacts() []string {
+	return []string{
+		stepsName,
+	}
+}
+
+func (st *StepsTask) Start() *CommandExecutionError {
+	return nil
+}
+
+func (st *StepsTask) Stop(err *ExecutionErrors) {
+	summary, e := json.MarshalIndent(
+		map[string][]*StepSummary{
+			"steps": st.task.stepSummaries,
+		},
+		"",
+		"  ",
+	)
+	if e != nil {
+		panic(e)
+	}
+	e = ioutil.WriteFile(filepath.Join(taskContext.TaskDir, stepsPath), summary, 0644)
+	if e != nil {
+		panic(e)
+	}
+	err.add(st.task.uploadArtifact(
+		&S3Artifact{
+			BaseArtifact: &BaseArtifact{
+				Name:    stepsName,
+				Expires: st.task.Definition.Expires,
+			},
+			ContentType:     "application/json",
+			ContentEncoding: "gzip",
+			Path:            stepsPath,
+		},
+	))
+}
+
+// step returns the step of the task command with the given index, or nil if
+// the task payload has commands rather than steps.
+func (task *TaskRun) step(index int) *taskStep {
+	if index >= len(task.steps) {
+		return nil
+	}
+	return task.steps[index]
+}
+
+// commandDescription describes the task command with the given index in the
+// task log, including the step name, if it has one.
+func (task *TaskRun) commandDescription(index int) string {
+	if step := task.step(index); step != nil && step.Name != "" {
+		return fmt.Sprintf("command %v (step %q)", index, step.Name)
+	}
+	return fmt.Sprintf("command %v", index)
+}
+
+// setStepTimer terminates the task command with the given index if it runs
+// for longer than the timeout of its step. The returned function stops the
+// timer, and reports whether the timeout expired.
+func (task *TaskRun) setStepTimer(index int) (stop func() (expired bool)) {
+	step := task.step(index)
+	if step == nil || step.Timeout == 0 {
+		return func() bool {
+			return false
+		}
+	}
+	timer := time.AfterFunc(
+		step.Timeout,
+		func() {
+			task.Errorf("Terminating %v since it exceeded its timeout of %v", task.commandDescription(index), step.Timeout)
+			_, err := task.Commands[index].Terminate(task.gracePeriod(), true)
+			if err != nil {
+				task.Warnf("%v", err)
+			}
+		},
+	)
+	return func() bool {
+		return !timer.Stop()
+	}
+}
+
+// stepError returns err, unless the step of the task command with the given
+// index may fail without failing the task.
+func (task *TaskRun) stepError(index int, err *CommandExecutionError) *CommandExecutionError {
+	if step := task.step(index); step != nil && step.ContinueOnError {
+		task.Warnf("Continuing after failure of %v, since it has continueOnError set: %v", task.commandDescription(index), err)
+		return nil
+	}
+	return err
+}
+
+// recordStep records the outcome of the step of the task command with the
+// given index in the step summary.
+func (task *TaskRun) recordStep(index int, started time.Time, duration time.Duration, exitCode int64, result string) {
+	if index >= len(task.stepSummaries) {
+		return
+	}
+	summary := task.stepSummaries[index]
+	startedTime := tcclient.Time(started)
+	summary.Started = &startedTime
+	summary.DurationSeconds = duration.Seconds()
+	summary.ExitCode = &exitCode
+	summary.Result = result
+}
@@ -0,0 +1,13 @@
+// +build docker
+
+package main
+
+import (
+	"time"
+)
+
+// stepTimeout returns 0, since the docker engine cannot terminate commands,
+// so steps do not have a timeout.
+func stepTimeout(step Step) time.Duration {
+	return 0
+}
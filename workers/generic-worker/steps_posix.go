@@ -0,0 +1,38 @@
+// +build darwin linux freebsd
+
+package main
+
+import (
+	"errors"
+)
+
+// expandSteps makes the commands of the steps in the task payload, if any,
+// the task commands, since steps are an alternative form of task commands.
+func (task *TaskRun) expandSteps() *CommandExecutionError {
+	if len(task.Payload.Command) > 0 && len(task.Payload.Steps) > 0 {
+		return MalformedPayloadError(errors.New("Task payload contains both command and steps - only one may be given"))
+	}
+	if len(task.Payload.Command) == 0 && len(task.Payload.Steps) == 0 {
+		return MalformedPayloadError(errors.New("Task payload contains neither command nor steps - one of them must be given"))
+	}
+	for _, step := range task.Payload.Steps {
+		task.Payload.Command = append(task.Payload.Command, step.Command)
+		task.steps = append(task.steps, &taskStep{
+			Name:            step.Name,
+			Env:             step.Env,
+			Timeout:         stepTimeout(step), // engine specific
+			ContinueOnError: step.ContinueOnError,
+		})
+	}
+	return nil
+}
+
+// setStepEnv sets the environment variables of each step in the command of
+// the step.
+func (task *TaskRun) setStepEnv() {
+	for i, step := range task.steps {
+		for variable, value := range step.Env {
+			task.Commands[i].SetEnv(variable, value)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+// +build darwin,!docker linux,!docker freebsd
+
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func stepSummaries(t *testing.T, taskID string) []StepSummary {
+	t.Helper()
+	content, _, _, _ := getArtifactContent(t, taskID, "public/steps.json")
+	var summary struct {
+		Steps []StepSummary `json:"steps"`
+	}
+	err := json.Unmarshal(content, &summary)
+	if err != nil {
+		t.Fatalf("Could not parse public/steps.json: %v\n%s", err, content)
+	}
+	return summary.Steps
+}
+
+func assertStepSummary(t *testing.T, summary StepSummary, name, result string, exitCode int64) {
+	t.Helper()
+	if summary.Name != name || summary.Result != result {
+		t.Fatalf("Expected step %q to have result %q, but got %#v", name, result, summary)
+	}
+	if exitCode == -1 {
+		if summary.ExitCode != nil || summary.Started != nil {
+			t.Fatalf("Expected step %q not to have run, but got %#v", name, summary)
+		}
+		return
+	}
+	if summary.ExitCode == nil || *summary.ExitCode != exitCode {
+		t.Fatalf("Expected step %q to have exit code %v, but got %#v", name, exitCode, summary)
+	}
+}
+
+func TestSteps(t *testing.T) {
+	_, teardown := setupWithFakeServices(t)
+	defer teardown()
+
+	payload := GenericWorkerPayload{
+		Steps: []Step{
+			{
+				Name:    "greet",
+				Command: []string{"echo", "hello world!"},
+			},
+			{
+				Name:            "flaky",
+				Command:         []string{"/bin/bash", "-c", "exit 3"},
+				ContinueOnError: true,
+			},
+			{
+				Command: []string{"/bin/bash", "-c", `test "${STEP_VAR}" = step-value && test "${TASK_VAR}" = task-value`},
+				Env: map[string]string{
+					"STEP_VAR": "step-value",
+				},
+			},
+		},
+		Env: map[string]string{
+			"STEP_VAR": "task-value",
+			"TASK_VAR": "task-value",
+		},
+		MaxRunTime: 30,
+	}
+	td := testTask(t)
+
+	taskID := submitAndAssert(t, td, payload, "completed", "completed")
+
+	logtext, _, _, _ := getArtifactContent(t, taskID, "public/logs/live_backing.log")
+	if !strings.Contains(string(logtext), `Executing command 0 (step "greet"): echo 'hello world!'`) ||
+		!strings.Contains(string(logtext), `Continuing after failure of command 1 (step "flaky"), since it has continueOnError set`) {
+		t.Fatalf("Expected task log to name steps:\n%s", logtext)
+	}
+	summaries := stepSummaries(t, taskID)
+	if len(summaries) != 3 {
+		t.Fatalf("Expected 3 steps in summary, but got %#v", summaries)
+	}
+	assertStepSummary(t, summaries[0], "greet", "succeeded", 0)
+	assertStepSummary(t, summaries[1], "flaky", "failed", 3)
+	assertStepSummary(t, summaries[2], "", "succeeded", 0)
+	if !summaries[1].ContinueOnError || summaries[1].Command != "/bin/bash -c 'exit 3'" {
+		t.Fatalf("Unexpected summary of step flaky: %#v", summaries[1])
+	}
+}
+
+func TestStepTimeout(t *testing.T) {
+	_, teardown := setupWithFakeServices(t)
+	defer teardown()
+
+	payload := GenericWorkerPayload{
+		Steps: []Step{
+			{
+				Name:    "slow",
+				Command: []string{"sleep", "60"},
+				Timeout: 1,
+			},
+			{
+				Name:    "never",
+				Command: []string{"echo", "hello world!"},
+			},
+		},
+		MaxRunTime: 30,
+	}
+	td := testTask(t)
+
+	taskID := submitAndAssert(t, td, payload, "failed", "failed")
+
+	logtext, _, _, _ := getArtifactContent(t, taskID, "public/logs/live_backing.log")
+	if !strings.Contains(string(logtext), `command 0 (step "slow") exceeded its timeout of 1s`) {
+		t.Fatalf("Expected task log to report step timeout:\n%s", logtext)
+	}
+	summaries := stepSummaries(t, taskID)
+	if len(summaries) != 2 {
+		t.Fatalf("Expected 2 steps in summary, but got %#v", summaries)
+	}
+	// the exit code of an aborted command is -4
+	assertStepSummary(t, summaries[0], "slow", "timed-out", -4)
+	assertStepSummary(t, summaries[1], "never", "not-run", -1)
+	if summaries[0].DurationSeconds < 1 || summaries[0].DurationSeconds > 30 {
+		t.Fatalf("Expected step slow to run for its timeout, but got %#v", summaries[0])
+	}
+}
+
+func TestCommandAndSteps(t *testing.T) {
+	_, teardown := setupWithFakeServices(t)
+	defer teardown()
+
+	payload := GenericWorkerPayload{
+		Command: helloGoodbye(),
+		Steps: []Step{
+			{
+				Command: []string{"echo", "hello world!"},
+			},
+		},
+		MaxRunTime: 30,
+	}
+	td := testTask(t)
+
+	_ = submitAndAssert(t, td, payload, "exception", "malformed-payload")
+}
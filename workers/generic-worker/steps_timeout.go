@@ -0,0 +1,13 @@
+// +build darwin,!docker linux,!docker freebsd,!docker
+
+package main
+
+import (
+	"time"
+)
+
+// stepTimeout returns the timeout of the given step in the task payload, or
+// 0 if it has none.
+func stepTimeout(step Step) time.Duration {
+	return time.Duration(step.Timeout) * time.Second
+}
@@ -0,0 +1,11 @@
+package main
+
+// Steps are not supported on Windows, since the environment of each command
+// is carried over to the next command, so steps could not have their own
+// environment variables.
+func (task *TaskRun) expandSteps() *CommandExecutionError {
+	return nil
+}
+
+func (task *TaskRun) setStepEnv() {
+}
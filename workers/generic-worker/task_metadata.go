@@ -0,0 +1,221 @@
+// +build !docker
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	tcclient "github.com/taskcluster/taskcluster/v28/clients/client-go"
+	"github.com/taskcluster/taskcluster/v28/clients/client-go/tcqueue"
+	"github.com/taskcluster/taskcluster/v28/internal/scopes"
+)
+
+// TaskMetadataFeature runs a read-only local HTTP endpoint, that task
+// commands can query for metadata about the running task, such as its run
+// ID, how long it may still run for, and the worker it runs on, without
+// having to call the taskcluster APIs. It serves nothing that the task
+// couldn't get from the queue, so requests are not authenticated.
+type TaskMetadataFeature struct {
+}
+
+func (feature *TaskMetadataFeature) Name() string {
+	return "Task Metadata"
+}
+
+func (feature *TaskMetadataFeature) Initialise() error {
+	return nil
+}
+
+func (feature *TaskMetadataFeature) PersistState() error {
+	return nil
+}
+
+func (feature *TaskMetadataFeature) IsEnabled(task *TaskRun) bool {
+	return task.Payload.Features.TaskMetadata
+}
+
+type TaskMetadataTask struct {
+	task   *TaskRun
+	server *http.Server
+}
+
+// TaskMetadata is the response to a request for / of the task metadata
+// endpoint.
+type TaskMetadata struct {
+	Task   tcqueue.TaskDefinitionResponse `json:"task"`
+	Run    RunMetadata                    `json:"run"`
+	Worker WorkerMetadata                 `json:"worker"`
+}
+
+// RunMetadata is the response to a request for /run of the task metadata
+// endpoint.
+type RunMetadata struct {
+	TaskID string `json:"taskId"`
+	RunID  uint   `json:"runId"`
+	// Status is the status of the task run, as known to the worker, such
+	// as "Claimed", "Reclaimed" or "Aborted"
+	Status     TaskStatus    `json:"status"`
+	TakenUntil tcclient.Time `json:"takenUntil"`
+	Deadline   tcclient.Time `json:"deadline"`
+	MaxRunTime int64         `json:"maxRunTime"`
+	// MaxRunTimeDeadline and MaxRunTimeRemainingSeconds are only set once
+	// the max run timer has started, which is just before the first task
+	// command runs
+	MaxRunTimeDeadline         *tcclient.Time `json:"maxRunTimeDeadline,omitempty"`
+	MaxRunTimeRemainingSeconds *float64       `json:"maxRunTimeRemainingSeconds,omitempty"`
+}
+
+// WorkerMetadata is the response to a request for /worker of the task
+// metadata endpoint.
+type WorkerMetadata struct {
+	ProvisionerID    string `json:"provisionerId"`
+	WorkerType       string `json:"workerType"`
+	WorkerPoolID     string `json:"workerPoolId"`
+	WorkerGroup      string `json:"workerGroup"`
+	WorkerID         string `json:"workerId"`
+	InstanceID       string `json:"instanceId,omitempty"`
+	InstanceType     string `json:"instanceType,omitempty"`
+	Region           string `json:"region,omitempty"`
+	AvailabilityZone string `json:"availabilityZone,omitempty"`
+	// WorkerLocation is the json object of config setting workerLocation,
+	// see https://github.com/taskcluster/taskcluster-rfcs/blob/master/rfcs/0148-taskcluster-worker-location.md
+	WorkerLocation json.RawMessage `json:"workerLocation,omitempty"`
+}
+
+func (feature *TaskMetadataFeature) NewTaskFeature(task *TaskRun) TaskFeature {
+	return &TaskMetadataTask{
+		task: task,
+	}
+}
+
+func (tmt *TaskMetadataTask) RequiredScopes() scopes.Required {
+	return scopes.Required{}
+}
+
+func (tmt *TaskMetadataTask) ReservedArtifacts() []string {
+	return []string{}
+}
+
+func (tmt *TaskMetadataTask) Start() *CommandExecutionError {
+	address := fmt.Sprintf("127.0.0.1:%v", config.TaskMetadataPort)
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return executionError(internalError, errored, fmt.Errorf("Could not start task metadata endpoint: %v", err))
+	}
+	mux := http.NewServeMux()
+	handleMetadata(mux, "/", func() interface{} {
+		return &TaskMetadata{
+			Task:   tmt.task.Definition,
+			Run:    tmt.runMetadata(),
+			Worker: workerMetadata(),
+		}
+	})
+	handleMetadata(mux, "/task", func() interface{} {
+		return &tmt.task.Definition
+	})
+	handleMetadata(mux, "/run", func() interface{} {
+		run := tmt.runMetadata()
+		return &run
+	})
+	handleMetadata(mux, "/worker", func() interface{} {
+		worker := workerMetadata()
+		return &worker
+	})
+	tmt.server = &http.Server{
+		Handler: mux,
+	}
+	go func() {
+		err := tmt.server.Serve(listener)
+		if err != http.ErrServerClosed {
+			log.Printf("WARNING: task metadata endpoint stopped: %v", err)
+		}
+	}()
+	url := "http://" + address
+	err = tmt.task.setVariable("TASKCLUSTER_TASK_METADATA_URL", url)
+	if err != nil {
+		return MalformedPayloadError(err)
+	}
+	tmt.task.Infof("[task metadata] Task metadata is served at %v", url)
+	return nil
+}
+
+func (tmt *TaskMetadataTask) Stop(err *ExecutionErrors) {
+	if tmt.server == nil {
+		return
+	}
+	e := tmt.server.Shutdown(context.Background())
+	if e != nil {
+		log.Printf("WARNING: could not stop task metadata endpoint: %v", e)
+	}
+}
+
+// handleMetadata responds to GET requests for exactly the given path with
+// the json encoding of the value that metadata returns.
+func handleMetadata(mux *http.ServeMux, path string, metadata func() interface{}) {
+	mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != path {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "Task metadata is read-only", http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := json.MarshalIndent(metadata(), "", "  ")
+		if err != nil {
+			panic(err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(append(body, '\n'))
+	})
+}
+
+func (tmt *TaskMetadataTask) runMetadata() RunMetadata {
+	task := tmt.task
+	run := RunMetadata{
+		TaskID:     task.TaskID,
+		RunID:      task.RunID,
+		Status:     task.StatusManager.LastKnownStatus(),
+		TakenUntil: task.StatusManager.TakenUntil(),
+		Deadline:   task.Definition.Deadline,
+		MaxRunTime: task.Payload.MaxRunTime,
+	}
+	task.maxRunTimeMux.Lock()
+	deadline := task.maxRunTimeDeadline
+	task.maxRunTimeMux.Unlock()
+	if !deadline.IsZero() {
+		maxRunTimeDeadline := tcclient.Time(deadline)
+		remaining := time.Until(deadline).Seconds()
+		if remaining < 0 {
+			remaining = 0
+		}
+		run.MaxRunTimeDeadline = &maxRunTimeDeadline
+		run.MaxRunTimeRemainingSeconds = &remaining
+	}
+	return run
+}
+
+func workerMetadata() WorkerMetadata {
+	worker := WorkerMetadata{
+		ProvisionerID:    config.ProvisionerID,
+		WorkerType:       config.WorkerType,
+		WorkerPoolID:     config.ProvisionerID + "/" + config.WorkerType,
+		WorkerGroup:      config.WorkerGroup,
+		WorkerID:         config.WorkerID,
+		InstanceID:       config.InstanceID,
+		InstanceType:     config.InstanceType,
+		Region:           config.Region,
+		AvailabilityZone: config.AvailabilityZone,
+	}
+	if json.Valid([]byte(config.WorkerLocation)) {
+		worker.WorkerLocation = json.RawMessage(config.WorkerLocation)
+	}
+	return worker
+}
@@ -0,0 +1,45 @@
+// +build darwin,!docker linux,!docker freebsd
+
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestTaskMetadata(t *testing.T) {
+	_, teardown := setupWithFakeServices(t)
+	defer teardown()
+
+	payload := GenericWorkerPayload{
+		Command: append(
+			goRun("curlget.go", "TASKCLUSTER_TASK_METADATA_URL/run"),
+			[]string{"go", "run", "curlget.go", "TASKCLUSTER_TASK_METADATA_URL/worker"},
+		),
+		MaxRunTime: 180,
+		Features: FeatureFlags{
+			TaskMetadata: true,
+		},
+	}
+	td := testTask(t)
+
+	taskID := submitAndAssert(t, td, payload, "completed", "completed")
+
+	logtext, _, _, _ := getArtifactContent(t, taskID, "public/logs/live_backing.log")
+	decoder := json.NewDecoder(strings.NewReader(string(logtext[strings.Index(string(logtext), "\n{")+1:])))
+	var run RunMetadata
+	err := decoder.Decode(&run)
+	if err != nil {
+		t.Fatalf("Could not decode run metadata in task log: %v\n%s", err, logtext)
+	}
+	if run.TaskID != taskID || run.RunID != 0 || run.MaxRunTime != 180 || (run.Status != claimed && run.Status != reclaimed) {
+		t.Fatalf("Unexpected run metadata %#v", run)
+	}
+	if run.MaxRunTimeRemainingSeconds == nil || *run.MaxRunTimeRemainingSeconds <= 0 || *run.MaxRunTimeRemainingSeconds > 180 {
+		t.Fatalf("Expected remaining max run time between 0 and 180 seconds, but got %#v", run)
+	}
+	if !strings.Contains(string(logtext), `"workerPoolId": "`+config.ProvisionerID+"/"+config.WorkerType+`"`) {
+		t.Fatalf("Expected worker metadata in task log:\n%s", logtext)
+	}
+}
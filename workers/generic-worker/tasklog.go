@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// TaskLog is the backing log file of a task (see logPath). It behaves like
+// the underlying *os.File, except that writes beyond a configurable maximum
+// size are not written to disk. When the maximum size is reached, a
+// truncation notice is written to the log, and further output is either
+// discarded, or, if keepTail is set, retained in a ring buffer so that the
+// most recent output can be appended to the log when it is closed.
+//
+// If keepTail is not set, messages from the worker itself (written with
+// WriteWorkerMessage, see (*TaskRun).Log) are still written beyond the
+// maximum size, up to workerMessageReserve bytes of them, so that a
+// truncated log still explains how the task was resolved. With keepTail,
+// they are the last lines of the retained tail.
+type TaskLog struct {
+	*os.File
+	mutex     sync.Mutex
+	maxSize   int64
+	keepTail  bool
+	written   int64
+	discarded int64
+	truncated bool
+	tail      *ringBuffer
+	// reserveUsed is the number of bytes of worker messages written beyond
+	// the maximum size
+	reserveUsed int64
+}
+
+// workerMessageReserve is the number of bytes of worker messages that may be
+// written to a task log beyond its maximum size.
+const workerMessageReserve = 64 * 1024
+
+// workerMessageWriter is a task log writer that distinguishes messages from
+// the worker itself from the output of the task commands, which may look the
+// same.
+type workerMessageWriter interface {
+	io.Writer
+	WriteWorkerMessage(p []byte) (int, error)
+}
+
+// NewTaskLog returns a TaskLog that writes to file, with a maximum size of
+// maxSize bytes. A maxSize of 0 means the log is not limited.
+func NewTaskLog(file *os.File, maxSize int64) *TaskLog {
+	return &TaskLog{
+		File:    file,
+		maxSize: maxSize,
+	}
+}
+
+// SetLimits updates the maximum size of the task log. It should be called
+// before the task commands are started, since output that has already been
+// discarded cannot be recovered.
+func (l *TaskLog) SetLimits(maxSize int64, keepTail bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.maxSize = maxSize
+	l.keepTail = keepTail
+}
+
+// Truncated returns true if output has been discarded from the task log.
+// Output retained in the tail of the log is not considered discarded.
+func (l *TaskLog) Truncated() bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.tail != nil {
+		return l.discarded > int64(len(l.tail.buf))
+	}
+	return l.truncated
+}
+
+// MaxSize returns the maximum size of the task log in bytes, or 0 if the
+// task log is not limited.
+func (l *TaskLog) MaxSize() int64 {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.maxSize
+}
+
+// Write writes p to the task log, discarding any bytes beyond the maximum
+// size. Discarded bytes are reported as written, so that task commands do
+// not fail when their output is truncated.
+func (l *TaskLog) Write(p []byte) (int, error) {
+	return l.write(p, false)
+}
+
+// WriteWorkerMessage writes p, a message from the worker itself, to the task
+// log. Unlike Write, it may write beyond the maximum size, up to
+// workerMessageReserve bytes.
+func (l *TaskLog) WriteWorkerMessage(p []byte) (int, error) {
+	return l.write(p, true)
+}
+
+func (l *TaskLog) write(p []byte, workerMessage bool) (int, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.maxSize <= 0 {
+		n, err := l.File.Write(p)
+		l.written += int64(n)
+		return n, err
+	}
+	headSize := l.maxSize
+	if l.keepTail {
+		headSize = l.maxSize / 2
+	}
+	remaining := headSize - l.written
+	if remaining < 0 {
+		remaining = 0
+	}
+	if int64(len(p)) <= remaining {
+		n, err := l.File.Write(p)
+		l.written += int64(n)
+		return n, err
+	}
+	if !l.keepTail && workerMessage && l.reserveUsed+int64(len(p)) <= workerMessageReserve {
+		n, err := l.File.Write(p)
+		l.reserveUsed += int64(n)
+		return n, err
+	}
+	n, err := l.File.Write(p[:remaining])
+	l.written += int64(n)
+	if err != nil {
+		return n, err
+	}
+	overflow := p[remaining:]
+	if !l.truncated {
+		l.truncated = true
+		err = l.writeNotice()
+		if err != nil {
+			return n, err
+		}
+	}
+	l.discarded += int64(len(overflow))
+	if l.keepTail {
+		if l.tail == nil {
+			l.tail = newRingBuffer(int(l.maxSize - headSize))
+		}
+		l.tail.Write(overflow)
+	}
+	return len(p), nil
+}
+
+func (l *TaskLog) writeNotice() error {
+	notice := fmt.Sprintf("\n[taskcluster:error] Task log has exceeded its maximum size of %v bytes; further output will be discarded\n", l.maxSize)
+	if l.keepTail {
+		notice = fmt.Sprintf("\n[taskcluster:error] Task log has exceeded its maximum size of %v bytes; further output will be omitted, except for the last %v bytes, which will be written when the task completes\n", l.maxSize, l.maxSize-l.maxSize/2)
+	}
+	_, err := l.File.WriteString(notice)
+	return err
+}
+
+// Close writes the retained tail of a truncated task log (if any) and then
+// closes the underlying file.
+func (l *TaskLog) Close() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	err := l.writeTail()
+	closeErr := l.File.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+func (l *TaskLog) writeTail() error {
+	if l.tail == nil {
+		return nil
+	}
+	tail := l.tail.Bytes()
+	_, err := l.File.WriteString(fmt.Sprintf("[taskcluster:error] %v bytes of task log omitted; last %v bytes follow:\n", l.discarded-int64(len(tail)), len(tail)))
+	if err != nil {
+		return err
+	}
+	_, err = l.File.Write(tail)
+	return err
+}
+
+// ringBuffer retains the last len(buf) bytes written to it.
+type ringBuffer struct {
+	buf  []byte
+	pos  int
+	full bool
+}
+
+func newRingBuffer(size int) *ringBuffer {
+	return &ringBuffer{
+		buf: make([]byte, size),
+	}
+}
+
+func (r *ringBuffer) Write(p []byte) {
+	size := len(r.buf)
+	if size == 0 {
+		return
+	}
+	if len(p) >= size {
+		copy(r.buf, p[len(p)-size:])
+		r.pos = 0
+		r.full = true
+		return
+	}
+	n := copy(r.buf[r.pos:], p)
+	if n < len(p) {
+		copy(r.buf, p[n:])
+		r.full = true
+	}
+	r.pos = (r.pos + len(p)) % size
+	if r.pos == 0 {
+		r.full = true
+	}
+}
+
+// Bytes returns the retained bytes, oldest first.
+func (r *ringBuffer) Bytes() []byte {
+	if !r.full {
+		return append([]byte{}, r.buf[:r.pos]...)
+	}
+	return append(append([]byte{}, r.buf[r.pos:]...), r.buf[:r.pos]...)
+}
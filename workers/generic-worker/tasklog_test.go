@@ -0,0 +1,151 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func writeTaskLog(t *testing.T, maxSize int64, keepTail bool, writes ...string) string {
+	t.Helper()
+	file, err := ioutil.TempFile("", "task-log")
+	if err != nil {
+		t.Fatalf("Could not create temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	taskLog := NewTaskLog(file, 0)
+	taskLog.SetLimits(maxSize, keepTail)
+	for _, w := range writes {
+		n, err := taskLog.Write([]byte(w))
+		if err != nil {
+			t.Fatalf("Could not write to task log: %v", err)
+		}
+		if n != len(w) {
+			t.Fatalf("Expected %v bytes to be reported as written, but got %v", len(w), n)
+		}
+	}
+	total := int64(len(strings.Join(writes, "")))
+	if truncated := maxSize > 0 && total > maxSize; truncated != taskLog.Truncated() {
+		t.Fatalf("Expected truncated=%v after writing %v bytes with limit %v", truncated, total, maxSize)
+	}
+	err = taskLog.Close()
+	if err != nil {
+		t.Fatalf("Could not close task log: %v", err)
+	}
+	bytes, err := ioutil.ReadFile(file.Name())
+	if err != nil {
+		t.Fatalf("Could not read task log: %v", err)
+	}
+	return string(bytes)
+}
+
+func TestTaskLogUnlimited(t *testing.T) {
+	content := writeTaskLog(t, 0, false, "hello ", "world\n")
+	if content != "hello world\n" {
+		t.Fatalf("Unexpected task log content: %q", content)
+	}
+}
+
+func TestTaskLogWithinLimit(t *testing.T) {
+	content := writeTaskLog(t, 12, false, "hello ", "world\n")
+	if content != "hello world\n" {
+		t.Fatalf("Unexpected task log content: %q", content)
+	}
+}
+
+func TestTaskLogTruncated(t *testing.T) {
+	content := writeTaskLog(t, 10, false, "0123456", "789abcdef", "ghijk")
+	if !strings.HasPrefix(content, "0123456789\n[taskcluster:error] Task log has exceeded its maximum size of 10 bytes") {
+		t.Fatalf("Unexpected task log content: %q", content)
+	}
+	if strings.Contains(content, "abc") || strings.Contains(content, "ghijk") {
+		t.Fatalf("Task log contains output beyond limit: %q", content)
+	}
+}
+
+func TestTaskLogTruncatedKeepTail(t *testing.T) {
+	content := writeTaskLog(t, 10, true, "01234", "56789", "abcdefghij", "klm", "nopqrst")
+	if !strings.HasPrefix(content, "01234\n[taskcluster:error] Task log has exceeded its maximum size of 10 bytes") {
+		t.Fatalf("Unexpected task log content: %q", content)
+	}
+	if !strings.HasSuffix(content, "[taskcluster:error] 20 bytes of task log omitted; last 5 bytes follow:\npqrst") {
+		t.Fatalf("Unexpected task log content: %q", content)
+	}
+}
+
+func TestRingBuffer(t *testing.T) {
+	r := newRingBuffer(5)
+	r.Write([]byte("ab"))
+	if got := string(r.Bytes()); got != "ab" {
+		t.Fatalf("Expected %q but got %q", "ab", got)
+	}
+	r.Write([]byte("cdef"))
+	if got := string(r.Bytes()); got != "bcdef" {
+		t.Fatalf("Expected %q but got %q", "bcdef", got)
+	}
+	r.Write([]byte("gh"))
+	if got := string(r.Bytes()); got != "defgh" {
+		t.Fatalf("Expected %q but got %q", "defgh", got)
+	}
+	r.Write([]byte("0123456789"))
+	if got := string(r.Bytes()); got != "56789" {
+		t.Fatalf("Expected %q but got %q", "56789", got)
+	}
+}
+
+// newTestTaskLog returns a TaskLog with the given maximum size, and a
+// function that closes it and returns its content.
+func newTestTaskLog(t *testing.T, maxSize int64) (*TaskLog, func() string) {
+	t.Helper()
+	file, err := ioutil.TempFile("", "task-log")
+	if err != nil {
+		t.Fatalf("Could not create temp file: %v", err)
+	}
+	taskLog := NewTaskLog(file, maxSize)
+	return taskLog, func() string {
+		defer os.Remove(file.Name())
+		err := taskLog.Close()
+		if err != nil {
+			t.Fatalf("Could not close task log: %v", err)
+		}
+		bytes, err := ioutil.ReadFile(file.Name())
+		if err != nil {
+			t.Fatalf("Could not read task log: %v", err)
+		}
+		return string(bytes)
+	}
+}
+
+func TestTaskLogTruncatedWorkerMessages(t *testing.T) {
+	taskLog, content := newTestTaskLog(t, 10)
+	task := &TaskRun{
+		logWriter: taskLog,
+	}
+	_, _ = taskLog.Write([]byte("0123456789abc"))
+	// task output that looks like worker messages must not use up the
+	// reserve for worker messages
+	line := "[taskcluster " + strings.Repeat("x", 1000) + "]\n"
+	for i := 0; i < workerMessageReserve/len(line)+10; i++ {
+		_, _ = taskLog.Write([]byte(line))
+	}
+	task.Errorf("Task timed out")
+	_, _ = taskLog.Write([]byte("def"))
+	log := content()
+	if !strings.HasSuffix(log, "[taskcluster:error] Task timed out\n") {
+		t.Fatalf("Expected worker message to be written beyond maximum size: %q", log)
+	}
+	if strings.Contains(log, "abc") || strings.Contains(log, "def") || strings.Contains(log, "xxx") {
+		t.Fatalf("Task log contains output beyond limit: %q", log)
+	}
+
+	// worker messages beyond the reserve are discarded too
+	taskLog, content = newTestTaskLog(t, 10)
+	_, _ = taskLog.Write([]byte("0123456789abc"))
+	for i := 0; i < workerMessageReserve/len(line)+10; i++ {
+		_, _ = taskLog.WriteWorkerMessage([]byte(line))
+	}
+	if log := content(); int64(len(log)) > 10+workerMessageReserve+1024 {
+		t.Fatalf("Expected at most %v bytes of worker messages beyond maximum size, but task log has %v bytes", workerMessageReserve, len(log))
+	}
+}
@@ -167,7 +167,7 @@ func (tsm *TaskStatusManager) reclaim() error {
 			if err != nil {
 				// probably task was cancelled - in any case, we should kill the running task...
 				log.Printf("%v", err)
-				task.kill()
+				task.kill(false)
 				return err
 			}
 
@@ -209,7 +209,7 @@ func (tsm *TaskStatusManager) Abort(cee *CommandExecutionError) error {
 		aborted,
 		func(task *TaskRun) error {
 			task.Errorf("Aborting task...")
-			task.kill()
+			task.kill(cee != nil && cee.Cause == errMaxRunTimeExceeded)
 			tsm.abortException = cee
 			return nil
 		},
@@ -0,0 +1,83 @@
+package tcfake
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/taskcluster/taskcluster/v28/clients/client-go/tcauth"
+)
+
+// Auth is an in-memory fake of the taskcluster auth service. It implements
+// expandScopes, using roles added with AddRole.
+type Auth struct {
+	mutex sync.Mutex
+	roles map[string][]string
+}
+
+// NewAuth returns a fake auth service with no roles.
+func NewAuth() *Auth {
+	return &Auth{
+		roles: map[string][]string{},
+	}
+}
+
+// AddRole adds a role, or replaces an existing role, with the given scopes.
+// As with the real auth service, a roleID ending in "*" matches any role
+// with the given prefix.
+func (a *Auth) AddRole(roleID string, scopes ...string) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.roles[roleID] = scopes
+}
+
+// ExpandScopes returns the given scopes together with the scopes of all the
+// roles that they (directly or indirectly) assume, sorted and without
+// duplicates.
+func (a *Auth) ExpandScopes(scopes []string) []string {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	expanded := map[string]bool{}
+	pending := append([]string{}, scopes...)
+	for len(pending) > 0 {
+		scope := pending[0]
+		pending = pending[1:]
+		if expanded[scope] {
+			continue
+		}
+		expanded[scope] = true
+		if !strings.HasPrefix(scope, "assume:") {
+			continue
+		}
+		role := strings.TrimPrefix(scope, "assume:")
+		for roleID, roleScopes := range a.roles {
+			if roleID == role || strings.HasSuffix(roleID, "*") && strings.HasPrefix(role, strings.TrimSuffix(roleID, "*")) {
+				pending = append(pending, roleScopes...)
+			}
+		}
+	}
+	result := make([]string, 0, len(expanded))
+	for scope := range expanded {
+		result = append(result, scope)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// ServeHTTP handles requests under /api/auth/v1/.
+func (a *Auth) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/api/auth/v1/")
+	switch {
+	case path == "scopes/expand" && r.Method == http.MethodPost:
+		var request tcauth.SetOfScopes
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, "InputError", "%v", err)
+			return
+		}
+		writeJSON(w, http.StatusOK, &tcauth.SetOfScopes{Scopes: a.ExpandScopes(request.Scopes)})
+	default:
+		writeError(w, http.StatusNotFound, "ResourceNotFound", "no such endpoint: %v %v", r.Method, r.URL.Path)
+	}
+}
@@ -0,0 +1,34 @@
+package tcfake
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	tcclient "github.com/taskcluster/taskcluster/v28/clients/client-go"
+	"github.com/taskcluster/taskcluster/v28/clients/client-go/tcauth"
+)
+
+func TestAuthExpandScopes(t *testing.T) {
+	server, _, dir := startServer(t)
+	defer os.RemoveAll(dir)
+	defer server.Close()
+
+	server.Auth.AddRole("worker-pool:*", "queue:claim-work:*", "assume:project:test")
+	server.Auth.AddRole("project:test", "secrets:get:project/test/*")
+	auth := tcauth.New(&tcclient.Credentials{ClientID: "test", AccessToken: "test"}, server.RootURL())
+	resp, err := auth.ExpandScopes(&tcauth.SetOfScopes{Scopes: []string{"assume:worker-pool:proj/type", "foo"}})
+	if err != nil {
+		t.Fatalf("Could not expand scopes: %v", err)
+	}
+	expected := []string{
+		"assume:project:test",
+		"assume:worker-pool:proj/type",
+		"foo",
+		"queue:claim-work:*",
+		"secrets:get:project/test/*",
+	}
+	if !reflect.DeepEqual(resp.Scopes, expected) {
+		t.Fatalf("Expected scopes %v but got %v", expected, resp.Scopes)
+	}
+}
@@ -0,0 +1,86 @@
+package tcfake
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/taskcluster/taskcluster/v28/clients/client-go/tcindex"
+)
+
+// Index is an in-memory fake of the taskcluster index service. It implements
+// insertTask and findTask.
+type Index struct {
+	mutex   sync.Mutex
+	entries map[string]tcindex.IndexedTaskResponse
+}
+
+// NewIndex returns an empty fake index.
+func NewIndex() *Index {
+	return &Index{
+		entries: map[string]tcindex.IndexedTaskResponse{},
+	}
+}
+
+// InsertTask indexes a task under the given namespace. As with the real index
+// service, an existing entry is only replaced by an entry with an equal or
+// higher rank.
+func (i *Index) InsertTask(namespace string, request tcindex.InsertTaskRequest) tcindex.IndexedTaskResponse {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	if existing, exists := i.entries[namespace]; exists && existing.Rank > request.Rank {
+		return existing
+	}
+	entry := tcindex.IndexedTaskResponse{
+		Data:      request.Data,
+		Expires:   request.Expires,
+		Namespace: namespace,
+		Rank:      request.Rank,
+		TaskID:    request.TaskID,
+	}
+	i.entries[namespace] = entry
+	return entry
+}
+
+// FindTask returns the task indexed under the given namespace, and whether
+// there is one. Expired entries are not found.
+func (i *Index) FindTask(namespace string) (tcindex.IndexedTaskResponse, bool) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	entry, exists := i.entries[namespace]
+	if exists && time.Time(entry.Expires).Before(time.Now()) {
+		return tcindex.IndexedTaskResponse{}, false
+	}
+	return entry, exists
+}
+
+// ServeHTTP handles requests under /api/index/v1/.
+func (i *Index) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/api/index/v1/")
+	if !strings.HasPrefix(path, "task/") {
+		writeError(w, http.StatusNotFound, "ResourceNotFound", "no such endpoint: %v %v", r.Method, r.URL.Path)
+		return
+	}
+	namespace := strings.TrimPrefix(path, "task/")
+	switch r.Method {
+	case http.MethodGet:
+		entry, exists := i.FindTask(namespace)
+		if !exists {
+			writeError(w, http.StatusNotFound, "ResourceNotFound", "no task indexed under %v", namespace)
+			return
+		}
+		writeJSON(w, http.StatusOK, &entry)
+	case http.MethodPut:
+		var request tcindex.InsertTaskRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, "InputError", "%v", err)
+			return
+		}
+		entry := i.InsertTask(namespace, request)
+		writeJSON(w, http.StatusOK, &entry)
+	default:
+		writeError(w, http.StatusNotFound, "ResourceNotFound", "no such endpoint: %v %v", r.Method, r.URL.Path)
+	}
+}
@@ -0,0 +1,39 @@
+package tcfake
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	tcclient "github.com/taskcluster/taskcluster/v28/clients/client-go"
+	"github.com/taskcluster/taskcluster/v28/clients/client-go/tcindex"
+)
+
+func TestIndex(t *testing.T) {
+	server, _, dir := startServer(t)
+	defer os.RemoveAll(dir)
+	defer server.Close()
+
+	index := tcindex.New(&tcclient.Credentials{ClientID: "test", AccessToken: "test"}, server.RootURL())
+	_, err := index.FindTask("project.test.latest")
+	if err == nil {
+		t.Fatal("Was able to find a task that has not been indexed")
+	}
+	expires := tcclient.Time(time.Now().Add(time.Hour))
+	for _, entry := range []tcindex.InsertTaskRequest{
+		{Expires: expires, Rank: 2, TaskID: "task-a"},
+		{Expires: expires, Rank: 1, TaskID: "task-b"},
+	} {
+		_, err := index.InsertTask("project.test.latest", &entry)
+		if err != nil {
+			t.Fatalf("Could not index task: %v", err)
+		}
+	}
+	found, err := index.FindTask("project.test.latest")
+	if err != nil {
+		t.Fatalf("Could not find task: %v", err)
+	}
+	if found.TaskID != "task-a" {
+		t.Fatalf("Expected task with highest rank (task-a) to be indexed but got %v", found.TaskID)
+	}
+}
@@ -0,0 +1,580 @@
+package tcfake
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tcclient "github.com/taskcluster/taskcluster/v28/clients/client-go"
+	"github.com/taskcluster/taskcluster/v28/clients/client-go/tcqueue"
+)
+
+// Queue is an in-memory fake of the taskcluster queue service. Artifacts
+// with storage type s3 are uploaded to the fake via HTTP PUT, and are stored
+// as files under ArtifactsDir.
+type Queue struct {
+	// Directory where the content of s3 artifacts is written, under
+	// <taskId>/<runId>/<artifact name>
+	ArtifactsDir string
+	// How long a claim lasts before the task needs to be reclaimed
+	ClaimDuration time.Duration
+
+	mutex   sync.Mutex
+	baseURL string
+	tasks   map[string]*fakeTask
+	// task IDs in the order the tasks were created, so that claimWork hands
+	// out tasks first come, first served
+	order []string
+	// quarantine expiry of workers, keyed by
+	// <provisionerId>/<workerType>/<workerGroup>/<workerId>
+	quarantines map[string]time.Time
+}
+
+type fakeTask struct {
+	definition tcqueue.TaskDefinitionResponse
+	status     tcqueue.TaskStatusStructure
+	// artifacts per run, keyed by artifact name
+	artifacts map[int64]map[string]*Artifact
+}
+
+// Artifact describes an artifact created in the fake queue.
+type Artifact struct {
+	Name        string        `json:"name"`
+	StorageType string        `json:"storageType"`
+	ContentType string        `json:"contentType,omitempty"`
+	Expires     tcclient.Time `json:"expires"`
+	// Path is the local file that the content of an s3 artifact was written
+	// to. It is empty until the content has been uploaded.
+	Path string `json:"path,omitempty"`
+	// URL is the target of a reference (redirect) artifact
+	URL string `json:"url,omitempty"`
+	// Reason and Message are set for error artifacts
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// NewQueue returns a fake queue that stores uploaded artifacts under
+// artifactsDir.
+func NewQueue(artifactsDir string) *Queue {
+	return &Queue{
+		ArtifactsDir:  artifactsDir,
+		ClaimDuration: 20 * time.Minute,
+		tasks:         map[string]*fakeTask{},
+		quarantines:   map[string]time.Time{},
+	}
+}
+
+// CreateTask adds a pending task to the fake queue.
+func (q *Queue) CreateTask(taskID string, definition tcqueue.TaskDefinitionResponse) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.createTask(taskID, definition)
+}
+
+func (q *Queue) createTask(taskID string, definition tcqueue.TaskDefinitionResponse) {
+	if _, exists := q.tasks[taskID]; !exists {
+		q.order = append(q.order, taskID)
+	}
+	q.tasks[taskID] = &fakeTask{
+		definition: definition,
+		status: tcqueue.TaskStatusStructure{
+			Deadline:      definition.Deadline,
+			Expires:       definition.Expires,
+			ProvisionerID: definition.ProvisionerID,
+			RetriesLeft:   definition.Retries,
+			Runs: []tcqueue.RunInformation{
+				{
+					ReasonCreated: "scheduled",
+					RunID:         0,
+					Scheduled:     tcclient.Time(time.Now()),
+					State:         "pending",
+				},
+			},
+			SchedulerID: definition.SchedulerID,
+			State:       "pending",
+			TaskGroupID: definition.TaskGroupID,
+			TaskID:      taskID,
+			WorkerType:  definition.WorkerType,
+		},
+		artifacts: map[int64]map[string]*Artifact{},
+	}
+}
+
+// ClaimTask claims the pending run of the given task, as if it had been
+// returned from a claimWork call made by the given worker.
+func (q *Queue) ClaimTask(taskID, workerGroup, workerID string) (*tcqueue.TaskClaim, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	t, exists := q.tasks[taskID]
+	if !exists {
+		return nil, fmt.Errorf("task %v not found", taskID)
+	}
+	return q.claim(taskID, t, workerGroup, workerID)
+}
+
+// ClaimWork claims up to maxTasks pending tasks for the given provisioner and
+// worker type, oldest first. Unlike the real queue, it does not wait for
+// tasks to become available. Quarantined workers are not given any tasks.
+func (q *Queue) ClaimWork(provisionerID, workerType, workerGroup, workerID string, maxTasks int64) []tcqueue.TaskClaim {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	claims := []tcqueue.TaskClaim{}
+	if time.Now().Before(q.quarantines[strings.Join([]string{provisionerID, workerType, workerGroup, workerID}, "/")]) {
+		return claims
+	}
+	for _, taskID := range q.order {
+		if int64(len(claims)) >= maxTasks {
+			break
+		}
+		t := q.tasks[taskID]
+		if t.status.State != "pending" || t.definition.ProvisionerID != provisionerID || t.definition.WorkerType != workerType {
+			continue
+		}
+		claim, err := q.claim(taskID, t, workerGroup, workerID)
+		if err == nil {
+			claims = append(claims, *claim)
+		}
+	}
+	return claims
+}
+
+// QuarantinedUntil returns the time until which the given worker is
+// quarantined, or the zero time if it has never been quarantined.
+func (q *Queue) QuarantinedUntil(provisionerID, workerType, workerGroup, workerID string) time.Time {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.quarantines[strings.Join([]string{provisionerID, workerType, workerGroup, workerID}, "/")]
+}
+
+func (q *Queue) claim(taskID string, t *fakeTask, workerGroup, workerID string) (*tcqueue.TaskClaim, error) {
+	runID := int64(len(t.status.Runs) - 1)
+	run := &t.status.Runs[runID]
+	if run.State != "pending" {
+		return nil, fmt.Errorf("task %v has no pending run", taskID)
+	}
+	now := time.Now()
+	run.State = "running"
+	run.Started = tcclient.Time(now)
+	run.TakenUntil = tcclient.Time(now.Add(q.ClaimDuration))
+	run.WorkerGroup = workerGroup
+	run.WorkerID = workerID
+	t.status.State = "running"
+	return &tcqueue.TaskClaim{
+		Credentials: taskCredentials(taskID, runID),
+		RunID:       runID,
+		Status:      t.statusCopy(),
+		TakenUntil:  run.TakenUntil,
+		Task:        t.definition,
+		WorkerGroup: workerGroup,
+		WorkerID:    workerID,
+	}, nil
+}
+
+// Status returns the current status of the given task.
+func (q *Queue) Status(taskID string) (tcqueue.TaskStatusStructure, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	t, exists := q.tasks[taskID]
+	if !exists {
+		return tcqueue.TaskStatusStructure{}, fmt.Errorf("task %v not found", taskID)
+	}
+	return t.statusCopy(), nil
+}
+
+// statusCopy returns a copy of the task status that does not share the runs
+// of the task.
+func (t *fakeTask) statusCopy() tcqueue.TaskStatusStructure {
+	status := t.status
+	status.Runs = append([]tcqueue.RunInformation{}, t.status.Runs...)
+	return status
+}
+
+// Artifacts returns the artifacts created for the given task run, sorted by
+// name.
+func (q *Queue) Artifacts(taskID string, runID int64) []Artifact {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	t, exists := q.tasks[taskID]
+	if !exists {
+		return nil
+	}
+	artifacts := []Artifact{}
+	for _, a := range t.artifacts[runID] {
+		artifacts = append(artifacts, *a)
+	}
+	sort.Slice(artifacts, func(i, j int) bool {
+		return artifacts[i].Name < artifacts[j].Name
+	})
+	return artifacts
+}
+
+func taskCredentials(taskID string, runID int64) tcqueue.TaskCredentials {
+	return tcqueue.TaskCredentials{
+		ClientID:    fmt.Sprintf("task-client/%v/%v", taskID, runID),
+		AccessToken: "fake-access-token",
+	}
+}
+
+// ServeHTTP handles requests under /api/queue/v1/ and uploads of artifact
+// content under /_artifacts/.
+func (q *Queue) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/_artifacts/"):
+		q.serveArtifactContent(w, r, strings.TrimPrefix(r.URL.Path, "/_artifacts/"))
+	case strings.HasPrefix(r.URL.Path, "/api/queue/v1/"):
+		q.serveAPI(w, r, strings.TrimPrefix(r.URL.Path, "/api/queue/v1/"))
+	default:
+		writeError(w, http.StatusNotFound, "ResourceNotFound", "no such endpoint: %v %v", r.Method, r.URL.Path)
+	}
+}
+
+func (q *Queue) serveAPI(w http.ResponseWriter, r *http.Request, path string) {
+	if strings.HasPrefix(path, "claim-work/") && r.Method == http.MethodPost {
+		q.claimWork(w, r, strings.TrimPrefix(path, "claim-work/"))
+		return
+	}
+	if strings.HasPrefix(path, "provisioners/") && r.Method == http.MethodPut {
+		q.quarantineWorker(w, r, strings.TrimPrefix(path, "provisioners/"))
+		return
+	}
+	// path is of the form task/<taskId>[/...]
+	parts := strings.SplitN(path, "/", 3)
+	if len(parts) < 2 || parts[0] != "task" {
+		writeError(w, http.StatusNotFound, "ResourceNotFound", "no such endpoint: %v %v", r.Method, r.URL.Path)
+		return
+	}
+	taskID := parts[1]
+	rest := ""
+	if len(parts) == 3 {
+		rest = parts[2]
+	}
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if rest == "" && r.Method == http.MethodPut {
+		q.createTaskFromRequest(w, r, taskID)
+		return
+	}
+	t, exists := q.tasks[taskID]
+	if !exists {
+		writeError(w, http.StatusNotFound, "ResourceNotFound", "task %v not found", taskID)
+		return
+	}
+	switch {
+	case rest == "" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, t.definition)
+	case rest == "status" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, &tcqueue.TaskStatusResponse{Status: t.status})
+	case strings.HasPrefix(rest, "artifacts/") && r.Method == http.MethodGet:
+		q.getArtifact(w, r, t, int64(len(t.status.Runs)-1), strings.TrimPrefix(rest, "artifacts/"))
+	case strings.HasPrefix(rest, "runs/"):
+		runParts := strings.SplitN(strings.TrimPrefix(rest, "runs/"), "/", 2)
+		runID, err := strconv.ParseInt(runParts[0], 10, 64)
+		if err != nil || runID < 0 || runID >= int64(len(t.status.Runs)) || len(runParts) < 2 {
+			writeError(w, http.StatusNotFound, "ResourceNotFound", "run %v of task %v not found", runParts[0], taskID)
+			return
+		}
+		q.serveRun(w, r, taskID, t, runID, runParts[1])
+	default:
+		writeError(w, http.StatusNotFound, "ResourceNotFound", "no such endpoint: %v %v", r.Method, r.URL.Path)
+	}
+}
+
+func (q *Queue) claimWork(w http.ResponseWriter, r *http.Request, path string) {
+	// path is of the form <provisionerId>/<workerType>
+	parts := strings.SplitN(path, "/", 2)
+	if len(parts) != 2 {
+		writeError(w, http.StatusNotFound, "ResourceNotFound", "no such endpoint: %v %v", r.Method, r.URL.Path)
+		return
+	}
+	var request tcqueue.ClaimWorkRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "InputError", "%v", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, &tcqueue.ClaimWorkResponse{
+		Tasks: q.ClaimWork(parts[0], parts[1], request.WorkerGroup, request.WorkerID, request.Tasks),
+	})
+}
+
+func (q *Queue) quarantineWorker(w http.ResponseWriter, r *http.Request, path string) {
+	// path is of the form <provisionerId>/worker-types/<workerType>/workers/<workerGroup>/<workerId>
+	parts := strings.Split(path, "/")
+	if len(parts) != 6 || parts[1] != "worker-types" || parts[3] != "workers" {
+		writeError(w, http.StatusNotFound, "ResourceNotFound", "no such endpoint: %v %v", r.Method, r.URL.Path)
+		return
+	}
+	var request tcqueue.QuarantineWorkerRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "InputError", "%v", err)
+		return
+	}
+	provisionerID, workerType, workerGroup, workerID := parts[0], parts[2], parts[4], parts[5]
+	q.mutex.Lock()
+	q.quarantines[strings.Join([]string{provisionerID, workerType, workerGroup, workerID}, "/")] = time.Time(request.QuarantineUntil)
+	q.mutex.Unlock()
+	writeJSON(w, http.StatusOK, &tcqueue.WorkerResponse{
+		Actions:         []tcqueue.WorkerAction{},
+		ProvisionerID:   provisionerID,
+		QuarantineUntil: request.QuarantineUntil,
+		RecentTasks:     []tcqueue.TaskRun{},
+		WorkerGroup:     workerGroup,
+		WorkerID:        workerID,
+		WorkerType:      workerType,
+	})
+}
+
+// createTaskFromRequest handles createTask calls. The task definition request
+// is converted to a task definition with the same json representation, since
+// the two differ only in which properties are required.
+func (q *Queue) createTaskFromRequest(w http.ResponseWriter, r *http.Request, taskID string) {
+	var definition tcqueue.TaskDefinitionResponse
+	if err := json.NewDecoder(r.Body).Decode(&definition); err != nil {
+		writeError(w, http.StatusBadRequest, "InputError", "%v", err)
+		return
+	}
+	if _, exists := q.tasks[taskID]; exists {
+		writeError(w, http.StatusConflict, "RequestConflict", "task %v already exists", taskID)
+		return
+	}
+	if definition.SchedulerID == "" {
+		definition.SchedulerID = "-"
+	}
+	if definition.TaskGroupID == "" {
+		definition.TaskGroupID = taskID
+	}
+	if definition.Priority == "" {
+		definition.Priority = "lowest"
+	}
+	q.createTask(taskID, definition)
+	writeJSON(w, http.StatusOK, &tcqueue.TaskStatusResponse{Status: q.tasks[taskID].status})
+}
+
+func (q *Queue) serveRun(w http.ResponseWriter, r *http.Request, taskID string, t *fakeTask, runID int64, action string) {
+	run := &t.status.Runs[runID]
+	switch {
+	case strings.HasPrefix(action, "artifacts/") && r.Method == http.MethodGet:
+		q.getArtifact(w, r, t, runID, strings.TrimPrefix(action, "artifacts/"))
+		return
+	case r.Method != http.MethodPost:
+		writeError(w, http.StatusNotFound, "ResourceNotFound", "no such endpoint: %v %v", r.Method, r.URL.Path)
+		return
+	case run.State != "running":
+		writeError(w, http.StatusConflict, "RequestConflict", "run %v of task %v is %v, not running", runID, taskID, run.State)
+		return
+	}
+	switch {
+	case action == "reclaim":
+		run.TakenUntil = tcclient.Time(time.Now().Add(q.ClaimDuration))
+		writeJSON(w, http.StatusOK, &tcqueue.TaskReclaimResponse{
+			Credentials: taskCredentials(taskID, runID),
+			RunID:       runID,
+			Status:      t.status,
+			TakenUntil:  run.TakenUntil,
+			WorkerGroup: run.WorkerGroup,
+			WorkerID:    run.WorkerID,
+		})
+	case action == "completed", action == "failed":
+		q.resolve(t, run, action, action)
+		writeJSON(w, http.StatusOK, &tcqueue.TaskStatusResponse{Status: t.status})
+	case action == "exception":
+		var request tcqueue.TaskExceptionRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, "InputError", "%v", err)
+			return
+		}
+		q.resolve(t, run, "exception", request.Reason)
+		if (request.Reason == "worker-shutdown" || request.Reason == "intermittent-task") && t.status.RetriesLeft > 0 {
+			t.status.RetriesLeft--
+			t.status.Runs = append(t.status.Runs, tcqueue.RunInformation{
+				ReasonCreated: "retry",
+				RunID:         int64(len(t.status.Runs)),
+				Scheduled:     tcclient.Time(time.Now()),
+				State:         "pending",
+			})
+			t.status.State = "pending"
+		}
+		writeJSON(w, http.StatusOK, &tcqueue.TaskStatusResponse{Status: t.status})
+	case strings.HasPrefix(action, "artifacts/"):
+		q.createArtifact(w, r, taskID, t, runID, strings.TrimPrefix(action, "artifacts/"))
+	default:
+		writeError(w, http.StatusNotFound, "ResourceNotFound", "no such endpoint: %v %v", r.Method, r.URL.Path)
+	}
+}
+
+func (q *Queue) resolve(t *fakeTask, run *tcqueue.RunInformation, state, reason string) {
+	run.State = state
+	run.ReasonResolved = reason
+	run.Resolved = tcclient.Time(time.Now())
+	t.status.State = state
+}
+
+func (q *Queue) createArtifact(w http.ResponseWriter, r *http.Request, taskID string, t *fakeTask, runID int64, name string) {
+	var request struct {
+		StorageType string        `json:"storageType"`
+		ContentType string        `json:"contentType"`
+		Expires     tcclient.Time `json:"expires"`
+		URL         string        `json:"url"`
+		Reason      string        `json:"reason"`
+		Message     string        `json:"message"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "InputError", "%v", err)
+		return
+	}
+	artifact := &Artifact{
+		Name:        name,
+		StorageType: request.StorageType,
+		ContentType: request.ContentType,
+		Expires:     request.Expires,
+		URL:         request.URL,
+		Reason:      request.Reason,
+		Message:     request.Message,
+	}
+	if t.artifacts[runID] == nil {
+		t.artifacts[runID] = map[string]*Artifact{}
+	}
+	if existing := t.artifacts[runID][name]; existing != nil {
+		// reference artifacts may be updated, everything else must match
+		if existing.StorageType != artifact.StorageType || (existing.StorageType == "s3" && existing.ContentType != artifact.ContentType) {
+			writeError(w, http.StatusConflict, "RequestConflict", "artifact %v already exists with different properties", name)
+			return
+		}
+		artifact.Path = existing.Path
+	}
+	t.artifacts[runID][name] = artifact
+	switch artifact.StorageType {
+	case "s3":
+		writeJSON(w, http.StatusOK, &tcqueue.S3ArtifactResponse{
+			ContentType: artifact.ContentType,
+			Expires:     artifact.Expires,
+			PutURL:      fmt.Sprintf("%v/_artifacts/%v/%v/%v", q.baseURL, taskID, runID, escapePath(name)),
+			StorageType: "s3",
+		})
+	case "reference":
+		writeJSON(w, http.StatusOK, &tcqueue.RedirectArtifactResponse{StorageType: "reference"})
+	case "error":
+		writeJSON(w, http.StatusOK, &tcqueue.ErrorArtifactResponse{StorageType: "error"})
+	default:
+		delete(t.artifacts[runID], name)
+		writeError(w, http.StatusBadRequest, "InputError", "unsupported storage type %q", artifact.StorageType)
+	}
+}
+
+func (q *Queue) getArtifact(w http.ResponseWriter, r *http.Request, t *fakeTask, runID int64, name string) {
+	artifact := t.artifacts[runID][name]
+	if artifact == nil {
+		writeError(w, http.StatusNotFound, "ResourceNotFound", "artifact %v not found", name)
+		return
+	}
+	switch artifact.StorageType {
+	case "s3":
+		if artifact.Path == "" {
+			writeError(w, http.StatusNotFound, "ResourceNotFound", "content of artifact %v has not been uploaded", name)
+			return
+		}
+		w.Header().Set("Content-Type", artifact.ContentType)
+		http.ServeFile(w, r, artifact.Path)
+	case "reference":
+		http.Redirect(w, r, artifact.URL, http.StatusSeeOther)
+	default:
+		writeError(w, http.StatusFailedDependency, artifact.Reason, "%v", artifact.Message)
+	}
+}
+
+// serveArtifactContent emulates the S3 PUT of artifact content, to a URL
+// returned from createArtifact.
+func (q *Queue) serveArtifactContent(w http.ResponseWriter, r *http.Request, path string) {
+	if r.Method != http.MethodPut {
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "only PUT is supported")
+		return
+	}
+	parts := strings.SplitN(path, "/", 3)
+	if len(parts) != 3 {
+		writeError(w, http.StatusNotFound, "ResourceNotFound", "invalid artifact path %v", path)
+		return
+	}
+	taskID, name := parts[0], parts[2]
+	runID, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "ResourceNotFound", "invalid run id %v", parts[1])
+		return
+	}
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	t := q.tasks[taskID]
+	if t == nil || t.artifacts[runID][name] == nil || t.artifacts[runID][name].StorageType != "s3" {
+		writeError(w, http.StatusForbidden, "AccessDenied", "no s3 artifact %v for run %v of task %v", name, runID, taskID)
+		return
+	}
+	var body io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gzipReader, err := gzip.NewReader(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "InvalidContent", "%v", err)
+			return
+		}
+		defer gzipReader.Close()
+		body = gzipReader
+	}
+	runDir := filepath.Join(q.ArtifactsDir, taskID, strconv.FormatInt(runID, 10))
+	file := filepath.Join(runDir, filepath.FromSlash(name))
+	if !strings.HasPrefix(file, runDir+string(filepath.Separator)) {
+		writeError(w, http.StatusBadRequest, "InputError", "invalid artifact name %v", name)
+		return
+	}
+	err = writeFile(file, body)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "InternalServerError", "%v", err)
+		return
+	}
+	t.artifacts[runID][name].Path = file
+	w.WriteHeader(http.StatusOK)
+}
+
+func escapePath(name string) string {
+	segments := strings.Split(name, "/")
+	for i := range segments {
+		segments[i] = url.PathEscape(segments[i])
+	}
+	return strings.Join(segments, "/")
+}
+
+func writeFile(file string, content io.Reader) error {
+	err := os.MkdirAll(filepath.Dir(file), 0755)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, content)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, statusCode int, code, format string, v ...interface{}) {
+	writeJSON(w, statusCode, map[string]string{
+		"code":    code,
+		"message": fmt.Sprintf(format, v...),
+	})
+}
@@ -0,0 +1,235 @@
+package tcfake
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	tcclient "github.com/taskcluster/taskcluster/v28/clients/client-go"
+	"github.com/taskcluster/taskcluster/v28/clients/client-go/tcqueue"
+)
+
+func startServer(t *testing.T) (*Server, *tcqueue.Queue, string) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "tcfake")
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %v", err)
+	}
+	server, err := NewServer(dir)
+	if err != nil {
+		t.Fatalf("Could not start fake server: %v", err)
+	}
+	queue := tcqueue.New(&tcclient.Credentials{ClientID: "test", AccessToken: "test"}, server.RootURL())
+	return server, queue, dir
+}
+
+func createTask(server *Server, taskID string) {
+	now := time.Now()
+	server.Queue.CreateTask(taskID, tcqueue.TaskDefinitionResponse{
+		Created:       tcclient.Time(now),
+		Deadline:      tcclient.Time(now.Add(time.Hour)),
+		Expires:       tcclient.Time(now.Add(24 * time.Hour)),
+		Payload:       json.RawMessage(`{}`),
+		ProvisionerID: "test-provisioner",
+		Retries:       1,
+		WorkerType:    "test-worker-type",
+	})
+}
+
+func TestQueueTaskLifecycle(t *testing.T) {
+	server, queue, dir := startServer(t)
+	defer os.RemoveAll(dir)
+	defer server.Close()
+
+	createTask(server, "task-a")
+	claim, err := server.Queue.ClaimTask("task-a", "test-worker-group", "test-worker")
+	if err != nil {
+		t.Fatalf("Could not claim task: %v", err)
+	}
+	if claim.RunID != 0 || claim.Status.State != "running" {
+		t.Fatalf("Unexpected claim: %#v", claim)
+	}
+	_, err = server.Queue.ClaimTask("task-a", "test-worker-group", "test-worker")
+	if err == nil {
+		t.Fatal("Was able to claim a task that is already running")
+	}
+
+	reclaim, err := queue.ReclaimTask("task-a", "0")
+	if err != nil {
+		t.Fatalf("Could not reclaim task: %v", err)
+	}
+	if reclaim.WorkerID != "test-worker" {
+		t.Fatalf("Expected worker id test-worker but got %v", reclaim.WorkerID)
+	}
+
+	payload := tcqueue.PostArtifactRequest(json.RawMessage(`{"storageType": "s3", "contentType": "text/plain", "expires": "` + tcclient.Time(time.Now().Add(time.Hour)).String() + `"}`))
+	resp, err := queue.CreateArtifact("task-a", "0", "public/build/hello.txt", &payload)
+	if err != nil {
+		t.Fatalf("Could not create artifact: %v", err)
+	}
+	var s3Response tcqueue.S3ArtifactResponse
+	err = json.Unmarshal(*resp, &s3Response)
+	if err != nil {
+		t.Fatalf("Could not unmarshal createArtifact response: %v", err)
+	}
+	req, err := http.NewRequest(http.MethodPut, s3Response.PutURL, bytes.NewBufferString("hello"))
+	if err != nil {
+		t.Fatalf("Could not create PUT request: %v", err)
+	}
+	putResp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Could not PUT artifact: %v", err)
+	}
+	putResp.Body.Close()
+	if putResp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status code 200 from PUT but got %v", putResp.StatusCode)
+	}
+	content, err := ioutil.ReadFile(filepath.Join(dir, "task-a", "0", "public", "build", "hello.txt"))
+	if err != nil {
+		t.Fatalf("Could not read uploaded artifact: %v", err)
+	}
+	if string(content) != "hello" {
+		t.Fatalf("Expected artifact content %q but got %q", "hello", content)
+	}
+
+	conflicting := tcqueue.PostArtifactRequest(json.RawMessage(`{"storageType": "error", "reason": "file-missing-on-worker", "message": "oops", "expires": "` + tcclient.Time(time.Now().Add(time.Hour)).String() + `"}`))
+	_, err = queue.CreateArtifact("task-a", "0", "public/build/hello.txt", &conflicting)
+	if err == nil {
+		t.Fatal("Was able to create an artifact that conflicts with an existing artifact")
+	}
+
+	_, err = queue.ReportCompleted("task-a", "0")
+	if err != nil {
+		t.Fatalf("Could not report task completed: %v", err)
+	}
+	status, err := queue.Status("task-a")
+	if err != nil {
+		t.Fatalf("Could not get task status: %v", err)
+	}
+	if status.Status.State != "completed" {
+		t.Fatalf("Expected task to be completed but it is %v", status.Status.State)
+	}
+	artifacts := server.Queue.Artifacts("task-a", 0)
+	if len(artifacts) != 1 || artifacts[0].Path == "" {
+		t.Fatalf("Unexpected artifacts: %#v", artifacts)
+	}
+	_, err = queue.ReportFailed("task-a", "0")
+	if err == nil {
+		t.Fatal("Was able to resolve a task that is already resolved")
+	}
+}
+
+func TestQueueRetriesWorkerShutdown(t *testing.T) {
+	server, queue, dir := startServer(t)
+	defer os.RemoveAll(dir)
+	defer server.Close()
+
+	createTask(server, "task-b")
+	_, err := server.Queue.ClaimTask("task-b", "test-worker-group", "test-worker")
+	if err != nil {
+		t.Fatalf("Could not claim task: %v", err)
+	}
+	resp, err := queue.ReportException("task-b", "0", &tcqueue.TaskExceptionRequest{Reason: "worker-shutdown"})
+	if err != nil {
+		t.Fatalf("Could not report exception: %v", err)
+	}
+	if len(resp.Status.Runs) != 2 || resp.Status.State != "pending" {
+		t.Fatalf("Expected a new pending run, but got status %#v", resp.Status)
+	}
+	claim, err := server.Queue.ClaimTask("task-b", "test-worker-group", "test-worker")
+	if err != nil {
+		t.Fatalf("Could not claim task: %v", err)
+	}
+	if claim.RunID != 1 {
+		t.Fatalf("Expected run 1 to be claimed, but got run %v", claim.RunID)
+	}
+}
+
+func TestQueueClaimWork(t *testing.T) {
+	server, queue, dir := startServer(t)
+	defer os.RemoveAll(dir)
+	defer server.Close()
+
+	now := time.Now()
+	for _, taskID := range []string{"task-c", "task-d", "task-e"} {
+		_, err := queue.CreateTask(taskID, &tcqueue.TaskDefinitionRequest{
+			Created:       tcclient.Time(now),
+			Deadline:      tcclient.Time(now.Add(time.Hour)),
+			Payload:       json.RawMessage(`{}`),
+			ProvisionerID: "test-provisioner",
+			WorkerType:    "test-worker-type",
+		})
+		if err != nil {
+			t.Fatalf("Could not create task %v: %v", taskID, err)
+		}
+	}
+	createTask(server, "task-f")
+	server.Queue.tasks["task-f"].definition.WorkerType = "other-worker-type"
+
+	request := &tcqueue.ClaimWorkRequest{
+		Tasks:       2,
+		WorkerGroup: "test-worker-group",
+		WorkerID:    "test-worker",
+	}
+	resp, err := queue.ClaimWork("test-provisioner", "test-worker-type", request)
+	if err != nil {
+		t.Fatalf("Could not claim work: %v", err)
+	}
+	if len(resp.Tasks) != 2 || resp.Tasks[0].Status.TaskID != "task-c" || resp.Tasks[1].Status.TaskID != "task-d" {
+		t.Fatalf("Expected tasks task-c and task-d to be claimed, but got %#v", resp.Tasks)
+	}
+	if resp.Tasks[0].Task.SchedulerID != "-" || resp.Tasks[0].Task.TaskGroupID != "task-c" {
+		t.Fatalf("Expected task defaults to be applied, but got %#v", resp.Tasks[0].Task)
+	}
+	resp, err = queue.ClaimWork("test-provisioner", "test-worker-type", request)
+	if err != nil {
+		t.Fatalf("Could not claim work: %v", err)
+	}
+	if len(resp.Tasks) != 1 || resp.Tasks[0].Status.TaskID != "task-e" {
+		t.Fatalf("Expected only task-e to be claimed, but got %#v", resp.Tasks)
+	}
+	resp, err = queue.ClaimWork("test-provisioner", "test-worker-type", request)
+	if err != nil {
+		t.Fatalf("Could not claim work: %v", err)
+	}
+	if len(resp.Tasks) != 0 {
+		t.Fatalf("Expected no tasks to be claimed, but got %#v", resp.Tasks)
+	}
+}
+
+func TestQueueQuarantineWorker(t *testing.T) {
+	server, queue, dir := startServer(t)
+	defer os.RemoveAll(dir)
+	defer server.Close()
+
+	createTask(server, "task-g")
+	quarantineUntil := tcclient.Time(time.Now().Add(time.Hour))
+	resp, err := queue.QuarantineWorker("test-provisioner", "test-worker-type", "test-worker-group", "test-worker", &tcqueue.QuarantineWorkerRequest{
+		QuarantineUntil: quarantineUntil,
+	})
+	if err != nil {
+		t.Fatalf("Could not quarantine worker: %v", err)
+	}
+	if resp.WorkerID != "test-worker" || resp.QuarantineUntil.String() != quarantineUntil.String() {
+		t.Fatalf("Unexpected quarantineWorker response: %#v", resp)
+	}
+	if until := server.Queue.QuarantinedUntil("test-provisioner", "test-worker-type", "test-worker-group", "test-worker"); until.IsZero() {
+		t.Fatal("Worker was not quarantined")
+	}
+	claimed, err := queue.ClaimWork("test-provisioner", "test-worker-type", &tcqueue.ClaimWorkRequest{
+		Tasks:       1,
+		WorkerGroup: "test-worker-group",
+		WorkerID:    "test-worker",
+	})
+	if err != nil {
+		t.Fatalf("Could not claim work: %v", err)
+	}
+	if len(claimed.Tasks) != 0 {
+		t.Fatalf("Quarantined worker was able to claim tasks: %#v", claimed.Tasks)
+	}
+}
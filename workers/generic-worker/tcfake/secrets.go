@@ -0,0 +1,83 @@
+package tcfake
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/taskcluster/taskcluster/v28/clients/client-go/tcsecrets"
+)
+
+// Secrets is an in-memory fake of the taskcluster secrets service. It
+// implements get, set and remove.
+type Secrets struct {
+	mutex   sync.Mutex
+	secrets map[string]tcsecrets.Secret
+}
+
+// NewSecrets returns a fake secrets service with no secrets.
+func NewSecrets() *Secrets {
+	return &Secrets{
+		secrets: map[string]tcsecrets.Secret{},
+	}
+}
+
+// Set creates or replaces the named secret.
+func (s *Secrets) Set(name string, secret tcsecrets.Secret) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.secrets[name] = secret
+}
+
+// Get returns the named secret, and whether it exists. Expired secrets do
+// not exist.
+func (s *Secrets) Get(name string) (tcsecrets.Secret, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	secret, exists := s.secrets[name]
+	if exists && time.Time(secret.Expires).Before(time.Now()) {
+		return tcsecrets.Secret{}, false
+	}
+	return secret, exists
+}
+
+// ServeHTTP handles requests under /api/secrets/v1/.
+func (s *Secrets) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/api/secrets/v1/")
+	if !strings.HasPrefix(path, "secret/") {
+		writeError(w, http.StatusNotFound, "ResourceNotFound", "no such endpoint: %v %v", r.Method, r.URL.Path)
+		return
+	}
+	name := strings.TrimPrefix(path, "secret/")
+	switch r.Method {
+	case http.MethodGet:
+		secret, exists := s.Get(name)
+		if !exists {
+			writeError(w, http.StatusNotFound, "ResourceNotFound", "secret %v not found", name)
+			return
+		}
+		writeJSON(w, http.StatusOK, &secret)
+	case http.MethodPut:
+		var secret tcsecrets.Secret
+		if err := json.NewDecoder(r.Body).Decode(&secret); err != nil {
+			writeError(w, http.StatusBadRequest, "InputError", "%v", err)
+			return
+		}
+		s.Set(name, secret)
+		writeJSON(w, http.StatusOK, struct{}{})
+	case http.MethodDelete:
+		s.mutex.Lock()
+		_, exists := s.secrets[name]
+		delete(s.secrets, name)
+		s.mutex.Unlock()
+		if !exists {
+			writeError(w, http.StatusNotFound, "ResourceNotFound", "secret %v not found", name)
+			return
+		}
+		writeJSON(w, http.StatusOK, struct{}{})
+	default:
+		writeError(w, http.StatusNotFound, "ResourceNotFound", "no such endpoint: %v %v", r.Method, r.URL.Path)
+	}
+}
@@ -0,0 +1,54 @@
+package tcfake
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	tcclient "github.com/taskcluster/taskcluster/v28/clients/client-go"
+	"github.com/taskcluster/taskcluster/v28/clients/client-go/tcsecrets"
+)
+
+func TestSecrets(t *testing.T) {
+	server, _, dir := startServer(t)
+	defer os.RemoveAll(dir)
+	defer server.Close()
+
+	secrets := tcsecrets.New(&tcclient.Credentials{ClientID: "test", AccessToken: "test"}, server.RootURL())
+	_, err := secrets.Get("project/test/secret")
+	if err == nil {
+		t.Fatal("Was able to get a secret that does not exist")
+	}
+	err = secrets.Set("project/test/secret", &tcsecrets.Secret{
+		Expires: tcclient.Time(time.Now().Add(time.Hour)),
+		Secret:  json.RawMessage(`{"password":"hunter2"}`),
+	})
+	if err != nil {
+		t.Fatalf("Could not set secret: %v", err)
+	}
+	secret, err := secrets.Get("project/test/secret")
+	if err != nil {
+		t.Fatalf("Could not get secret: %v", err)
+	}
+	if string(secret.Secret) != `{"password":"hunter2"}` {
+		t.Fatalf("Unexpected secret: %s", secret.Secret)
+	}
+
+	server.Secrets.Set("project/test/expired", tcsecrets.Secret{
+		Expires: tcclient.Time(time.Now().Add(-time.Hour)),
+		Secret:  json.RawMessage(`{}`),
+	})
+	_, err = secrets.Get("project/test/expired")
+	if err == nil {
+		t.Fatal("Was able to get an expired secret")
+	}
+
+	err = secrets.Remove("project/test/secret")
+	if err != nil {
+		t.Fatalf("Could not remove secret: %v", err)
+	}
+	if _, exists := server.Secrets.Get("project/test/secret"); exists {
+		t.Fatal("Secret still exists after being removed")
+	}
+}
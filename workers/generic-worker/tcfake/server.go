@@ -0,0 +1,83 @@
+// Package tcfake provides in-process fakes of the taskcluster services that
+// generic-worker talks to, served over HTTP on a local port, so that tasks
+// can be run, and the worker tested end-to-end, without a taskcluster
+// deployment.
+package tcfake
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/taskcluster/taskcluster/v28/clients/client-go/tcpurgecache"
+)
+
+// Server serves the fake taskcluster services on a local port. Its root URL
+// can be used in place of the root URL of a taskcluster deployment.
+type Server struct {
+	Auth          *Auth
+	Index         *Index
+	Queue         *Queue
+	Secrets       *Secrets
+	WorkerManager *WorkerManager
+
+	listener net.Listener
+	server   *http.Server
+	rootURL  string
+}
+
+// NewServer starts a fake taskcluster server listening on a random port of
+// the loopback interface. Artifacts uploaded to the fake queue are written
+// under artifactsDir.
+func NewServer(artifactsDir string) (*Server, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		Auth:          NewAuth(),
+		Index:         NewIndex(),
+		Queue:         NewQueue(artifactsDir),
+		Secrets:       NewSecrets(),
+		WorkerManager: NewWorkerManager(),
+		listener:      listener,
+		rootURL:       "http://" + listener.Addr().String(),
+	}
+	s.Queue.baseURL = s.rootURL
+	mux := http.NewServeMux()
+	mux.Handle("/api/queue/v1/", s.Queue)
+	mux.Handle("/_artifacts/", s.Queue)
+	mux.Handle("/api/auth/v1/", s.Auth)
+	mux.Handle("/api/index/v1/", s.Index)
+	mux.Handle("/api/secrets/v1/", s.Secrets)
+	mux.Handle("/api/worker-manager/v1/", s.WorkerManager)
+	mux.HandleFunc("/api/purge-cache/v1/purge-cache/", servePurgeRequests)
+	s.server = &http.Server{
+		Handler: mux,
+	}
+	go func() {
+		_ = s.server.Serve(listener)
+	}()
+	return s, nil
+}
+
+// servePurgeRequests responds to purgeRequests calls of the purge cache
+// service, reporting that no caches need purging.
+func servePurgeRequests(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusNotFound, "ResourceNotFound", "no such endpoint: %v %v", r.Method, r.URL.Path)
+		return
+	}
+	writeJSON(w, http.StatusOK, &tcpurgecache.OpenPurgeRequestList{
+		Requests: []tcpurgecache.PurgeCacheRequestsEntry{},
+	})
+}
+
+// RootURL returns the root URL of the fake services.
+func (s *Server) RootURL() string {
+	return s.rootURL
+}
+
+// Close stops the server.
+func (s *Server) Close() error {
+	return s.server.Close()
+}
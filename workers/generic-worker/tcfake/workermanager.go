@@ -0,0 +1,61 @@
+package tcfake
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tcclient "github.com/taskcluster/taskcluster/v28/clients/client-go"
+	"github.com/taskcluster/taskcluster/v28/clients/client-go/tcworkermanager"
+)
+
+// WorkerManager is an in-memory fake of the taskcluster worker manager
+// service. It implements reportWorkerError.
+type WorkerManager struct {
+	mutex  sync.Mutex
+	errors []tcworkermanager.WorkerPoolError
+}
+
+// NewWorkerManager returns a fake worker manager with no reported errors.
+func NewWorkerManager() *WorkerManager {
+	return &WorkerManager{
+		errors: []tcworkermanager.WorkerPoolError{},
+	}
+}
+
+// Errors returns the worker errors that have been reported, oldest first.
+func (wm *WorkerManager) Errors() []tcworkermanager.WorkerPoolError {
+	wm.mutex.Lock()
+	defer wm.mutex.Unlock()
+	return append([]tcworkermanager.WorkerPoolError{}, wm.errors...)
+}
+
+// ServeHTTP handles requests under /api/worker-manager/v1/.
+func (wm *WorkerManager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/api/worker-manager/v1/")
+	if !strings.HasPrefix(path, "worker-pool-errors/") || r.Method != http.MethodPost {
+		writeError(w, http.StatusNotFound, "ResourceNotFound", "no such endpoint: %v %v", r.Method, r.URL.Path)
+		return
+	}
+	var report tcworkermanager.WorkerErrorReport
+	if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+		writeError(w, http.StatusBadRequest, "InputError", "%v", err)
+		return
+	}
+	wm.mutex.Lock()
+	poolError := tcworkermanager.WorkerPoolError{
+		Description:  report.Description,
+		ErrorID:      strconv.Itoa(len(wm.errors)),
+		Extra:        report.Extra,
+		Kind:         report.Kind,
+		Reported:     tcclient.Time(time.Now()),
+		Title:        report.Title,
+		WorkerPoolID: strings.TrimPrefix(path, "worker-pool-errors/"),
+	}
+	wm.errors = append(wm.errors, poolError)
+	wm.mutex.Unlock()
+	writeJSON(w, http.StatusOK, &poolError)
+}
@@ -0,0 +1,33 @@
+package tcfake
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	tcclient "github.com/taskcluster/taskcluster/v28/clients/client-go"
+	"github.com/taskcluster/taskcluster/v28/clients/client-go/tcworkermanager"
+)
+
+func TestWorkerManagerReportWorkerError(t *testing.T) {
+	server, _, dir := startServer(t)
+	defer os.RemoveAll(dir)
+	defer server.Close()
+
+	workerManager := tcworkermanager.New(&tcclient.Credentials{ClientID: "test", AccessToken: "test"}, server.RootURL())
+	_, err := workerManager.ReportWorkerError("test-provisioner/test-worker-type", &tcworkermanager.WorkerErrorReport{
+		Description: "Something went wrong",
+		Extra:       json.RawMessage(`{}`),
+		Kind:        "worker-error",
+		Title:       "Oops",
+		WorkerGroup: "test-worker-group",
+		WorkerID:    "test-worker",
+	})
+	if err != nil {
+		t.Fatalf("Could not report worker error: %v", err)
+	}
+	errors := server.WorkerManager.Errors()
+	if len(errors) != 1 || errors[0].WorkerPoolID != "test-provisioner/test-worker-type" || errors[0].Title != "Oops" {
+		t.Fatalf("Unexpected worker pool errors: %#v", errors)
+	}
+}
@@ -0,0 +1,80 @@
+// +build darwin,!docker linux,!docker freebsd
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGracePeriodAfterMaxRunTime(t *testing.T) {
+	_, teardown := setupWithFakeServices(t)
+	defer teardown()
+
+	payload := GenericWorkerPayload{
+		Command: [][]string{
+			{
+				"/bin/bash",
+				"-c",
+				`trap 'echo "caught SIGTERM"; echo flushed > state.txt; exit 3' TERM; while true; do sleep 0.1; done`,
+			},
+		},
+		MaxRunTime:  2,
+		GracePeriod: 20,
+		Artifacts: []Artifact{
+			{
+				Path: "state.txt",
+				Type: "file",
+				Name: "public/state.txt",
+			},
+		},
+	}
+	td := testTask(t)
+
+	startTime := time.Now()
+	taskID := submitAndAssert(t, td, payload, "failed", "failed")
+	if duration := time.Since(startTime); duration > 15*time.Second {
+		t.Fatalf("Task should have exited soon after SIGTERM, but took %v", duration)
+	}
+
+	logtext, _, _, _ := getArtifactContent(t, taskID, "public/logs/live_backing.log")
+	for _, expected := range []string{"max run time exceeded", "caught SIGTERM", "Command TIMED OUT"} {
+		if !strings.Contains(string(logtext), expected) {
+			t.Fatalf("Expected task log to contain %q:\n%s", expected, logtext)
+		}
+	}
+	content, _, _, _ := getArtifactContent(t, taskID, "public/state.txt")
+	if string(content) != "flushed\n" {
+		t.Fatalf("Expected artifact written after SIGTERM to be uploaded, but got %q", content)
+	}
+}
+
+func TestKillAfterGracePeriod(t *testing.T) {
+	_, teardown := setupWithFakeServices(t)
+	defer teardown()
+
+	payload := GenericWorkerPayload{
+		Command: [][]string{
+			{
+				"/bin/bash",
+				"-c",
+				`trap '' TERM; sleep 60`,
+			},
+		},
+		MaxRunTime:  2,
+		GracePeriod: 2,
+	}
+	td := testTask(t)
+
+	startTime := time.Now()
+	taskID := submitAndAssert(t, td, payload, "failed", "failed")
+	duration := time.Since(startTime)
+	if duration < 4*time.Second || duration > 30*time.Second {
+		t.Fatalf("Task ignoring SIGTERM should have been killed after max run time and grace period, but took %v", duration)
+	}
+	logtext, _, _, _ := getArtifactContent(t, taskID, "public/logs/live_backing.log")
+	if !strings.Contains(string(logtext), "Command TIMED OUT") {
+		t.Fatalf("Expected task log to report that the command timed out:\n%s", logtext)
+	}
+}
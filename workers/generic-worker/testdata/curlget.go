@@ -10,10 +10,11 @@ import (
 
 func main() {
 	if len(os.Args) != 2 {
-		log.Fatal("Usage: go run curlget.go <url>\n<url> will have the current $TASKCLUSTER_PROXY_URL substituted for the string TASKCLUSTER_PROXY_URL")
+		log.Fatal("Usage: go run curlget.go <url>\n<url> will have the current $TASKCLUSTER_PROXY_URL substituted for the string TASKCLUSTER_PROXY_URL, and the current $TASKCLUSTER_TASK_METADATA_URL substituted for the string TASKCLUSTER_TASK_METADATA_URL")
 	}
 	url := os.Args[1]
 	url = strings.Replace(url, "TASKCLUSTER_PROXY_URL", os.Getenv("TASKCLUSTER_PROXY_URL"), -1)
+	url = strings.Replace(url, "TASKCLUSTER_TASK_METADATA_URL", os.Getenv("TASKCLUSTER_TASK_METADATA_URL"), -1)
 	res, err := http.Get(url)
 	if err != nil {
 		log.Fatalf("%v", err)
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+)
+
+func main() {
+	if len(os.Args) != 2 {
+		log.Fatal("Usage: go run serve-http.go <port>")
+	}
+	http.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	http.HandleFunc("/hello", func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("Serving %v", r.URL.Path)
+		fmt.Fprintln(w, "hello from service")
+	})
+	address := "127.0.0.1:" + os.Args[1]
+	log.Printf("Listening on %v", address)
+	log.Fatal(http.ListenAndServe(address, nil))
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+)
+
+func main() {
+	if len(os.Args) != 3 && len(os.Args) != 4 {
+		log.Fatal("Usage: go run upload-artifact.go <path> <name> [<token>]\nUploads the file at <path> as live artifact <name>, authenticating with <token>, or with $TASKCLUSTER_ARTIFACT_UPLOAD_TOKEN if not given")
+	}
+	token := os.Getenv("TASKCLUSTER_ARTIFACT_UPLOAD_TOKEN")
+	if len(os.Args) == 4 {
+		token = os.Args[3]
+	}
+	body, err := json.Marshal(map[string]string{
+		"path": os.Args[1],
+		"name": os.Args[2],
+	})
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, os.Getenv("TASKCLUSTER_ARTIFACT_UPLOAD_URL"), bytes.NewReader(body))
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	defer res.Body.Close()
+	response, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	fmt.Printf("Upload of %v returned status code %v: %s", os.Args[2], res.StatusCode, response)
+}
@@ -0,0 +1,490 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/taskcluster/taskcluster/v28/internal/scopes"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/fileutil"
+)
+
+const (
+	testResultsName = "public/test-results.json"
+	// defaultMaxFailuresInLog is the number of failed tests that are listed
+	// in the task log, if the task payload does not say
+	defaultMaxFailuresInLog = 10
+	// maxTestMessageLength is the maximum length of the message of a test
+	// in public/test-results.json
+	maxTestMessageLength = 10000
+)
+
+var (
+	testResultsPath = filepath.Join("generic-worker", "test-results.json")
+)
+
+// TestResultsFeature parses the test result files that the task payload
+// lists, once the task commands have completed, logs a summary of them, and
+// publishes them in a normalized form, so that failed tests can be found
+// without downloading and reading the test result files.
+type TestResultsFeature struct {
+}
+
+// TestResult is the result of a single test, in public/test-results.json.
+type TestResult struct {
+	Suite string `json:"suite,omitempty"`
+	Name  string `json:"name"`
+	// Result is one of "passed", "failed" or "skipped"
+	Result          string  `json:"result"`
+	DurationSeconds float64 `json:"durationSeconds,omitempty"`
+	Message         string  `json:"message,omitempty"`
+	// File is the test result file that the test was found in, relative to
+	// the task directory
+	File string `json:"file"`
+}
+
+// TestResultsSummary counts the tests in public/test-results.json by result.
+type TestResultsSummary struct {
+	Total   int `json:"total"`
+	Passed  int `json:"passed"`
+	Failed  int `json:"failed"`
+	Skipped int `json:"skipped"`
+}
+
+// TestResultsReport is the content of public/test-results.json.
+type TestResultsReport struct {
+	Summary TestResultsSummary `json:"summary"`
+	Tests   []TestResult       `json:"tests"`
+}
+
+func (feature *TestResultsFeature) Name() string {
+	return "Test Results"
+}
+
+func (feature *TestResultsFeature) Initialise() error {
+	return nil
+}
+
+func (feature *TestResultsFeature) PersistState() error {
+	return nil
+}
+
+func (feature *TestResultsFeature) IsEnabled(task *TaskRun) bool {
+	return len(task.Payload.TestResults.Files) > 0
+}
+
+type TestResultsTask struct {
+	task *TaskRun
+}
+
+func (feature *TestResultsFeature) NewTaskFeature(task *TaskRun) TaskFeature {
+	return &TestResultsTask{
+		task: task,
+	}
+}
+
+func (trt *TestResultsTask) RequiredScopes() scopes.Required {
+	return scopes.Required{}
+}
+
+func (trt *TestResultsTask) ReservedArtifacts() []string {
+	return []string{
+		testResultsName,
+	}
+}
+
+func (trt *TestResultsTask) Start() *CommandExecutionError {
+	return nil
+}
+
+func (trt *TestResultsTask) Stop(err *ExecutionErrors) {
+	report := &TestResultsReport{
+		Tests: []TestResult{},
+	}
+	for _, files := range trt.task.Payload.TestResults.Files {
+		paths, e := testResultFiles(files.Path)
+		if e != nil {
+			trt.task.Warnf("[test results] %v", e)
+			continue
+		}
+		if len(paths) == 0 {
+			trt.task.Warnf("[test results] No test result files found matching %v", files.Path)
+			continue
+		}
+		for _, path := range paths {
+			results, e := parseTestResultFile(path, files.Format)
+			if e != nil {
+				trt.task.Warnf("[test results] Could not parse %v as %v: %v", path, files.Format, e)
+				continue
+			}
+			for i := range results {
+				results[i].File = filepath.ToSlash(path)
+			}
+			report.Tests = append(report.Tests, results...)
+		}
+	}
+	report.Summary = summarizeTestResults(report.Tests)
+	trt.logSummary(report)
+
+	content, e := json.MarshalIndent(report, "", "  ")
+	if e != nil {
+		panic(e)
+	}
+	e = ioutil.WriteFile(filepath.Join(taskContext.TaskDir, testResultsPath), content, 0644)
+	if e != nil {
+		panic(e)
+	}
+	err.add(trt.task.uploadArtifact(
+		&S3Artifact{
+			BaseArtifact: &BaseArtifact{
+				Name:    testResultsName,
+				Expires: trt.task.Definition.Expires,
+			},
+			ContentType:     "application/json",
+			ContentEncoding: "gzip",
+			Path:            testResultsPath,
+		},
+	))
+	if report.Summary.Failed > 0 && trt.task.Payload.TestResults.FailTaskOnFailures {
+		err.add(Failure(fmt.Errorf("[test results] %v test(s) failed", report.Summary.Failed)))
+	}
+}
+
+// logSummary writes the number of passed, failed and skipped tests, and the
+// first failures, to the task log.
+func (trt *TestResultsTask) logSummary(report *TestResultsReport) {
+	s := report.Summary
+	trt.task.Infof("[test results] %v test(s): %v passed, %v failed, %v skipped", s.Total, s.Passed, s.Failed, s.Skipped)
+	maxFailures := int(trt.task.Payload.TestResults.MaxFailuresInLog)
+	if maxFailures == 0 {
+		maxFailures = defaultMaxFailuresInLog
+	}
+	listed := 0
+	for _, test := range report.Tests {
+		if test.Result != "failed" {
+			continue
+		}
+		if listed == maxFailures {
+			trt.task.Infof("[test results] ... and %v more failure(s), see %v", s.Failed-listed, testResultsName)
+			return
+		}
+		listed++
+		name := test.Name
+		if test.Suite != "" {
+			name = test.Suite + ": " + name
+		}
+		message := strings.SplitN(strings.TrimSpace(test.Message), "\n", 2)[0]
+		if message == "" {
+			trt.task.Infof("[test results] FAILED %v", name)
+		} else {
+			trt.task.Infof("[test results] FAILED %v - %v", name, message)
+		}
+	}
+}
+
+// testResultFiles returns the files, relative to the task directory, that
+// match the given glob pattern. Files outside of the task directory are not
+// permitted, since the worker may be able to read files that the task can't.
+func testResultFiles(pattern string) ([]string, error) {
+	if filepath.IsAbs(pattern) {
+		return nil, fmt.Errorf("Test result file path %v is not relative to the task directory", pattern)
+	}
+	matches, err := filepath.Glob(filepath.Join(taskContext.TaskDir, pattern))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid test result file path %v: %v", pattern, err)
+	}
+	paths := []string{}
+	for _, match := range matches {
+		rel, err := filepath.Rel(taskContext.TaskDir, match)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil, fmt.Errorf("Test result file %v is not inside the task directory", match)
+		}
+		// symbolic links are not followed, see parseTestResultFile
+		info, err := os.Lstat(match)
+		if err != nil {
+			return nil, err
+		}
+		if info.IsDir() {
+			continue
+		}
+		paths = append(paths, rel)
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// parseTestResultFile parses the regular file at the given path relative to
+// the task directory. Since the worker may run as root, the file is opened
+// without following symbolic links, which task commands could swap into the
+// path, and without blocking on named pipes.
+func parseTestResultFile(path, format string) ([]TestResult, error) {
+	file, err := fileutil.OpenInDir(taskContext.TaskDir, path)
+	if err == fileutil.ErrOutsideDir {
+		return nil, fmt.Errorf("%v is not inside the task directory", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("%v is not a regular file", path)
+	}
+	switch format {
+	case "junit":
+		return parseJUnit(file)
+	case "tap":
+		return parseTAP(file)
+	case "go-test-json":
+		return parseGoTestJSON(file)
+	}
+	return nil, fmt.Errorf("unknown test result format %q", format)
+}
+
+func summarizeTestResults(tests []TestResult) TestResultsSummary {
+	summary := TestResultsSummary{
+		Total: len(tests),
+	}
+	for _, test := range tests {
+		switch test.Result {
+		case "passed":
+			summary.Passed++
+		case "failed":
+			summary.Failed++
+		case "skipped":
+			summary.Skipped++
+		}
+	}
+	return summary
+}
+
+func truncateTestMessage(message string) string {
+	message = strings.TrimSpace(message)
+	if len(message) > maxTestMessageLength {
+		return message[:maxTestMessageLength] + "..."
+	}
+	return message
+}
+
+// junitTestSuite is a <testsuite> or <testsuites> element of a JUnit XML
+// file, either of which may be the root element, and may be nested.
+type junitTestSuite struct {
+	Name       string           `xml:"name,attr"`
+	TestSuites []junitTestSuite `xml:"testsuite"`
+	TestCases  []junitTestCase  `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string         `xml:"name,attr"`
+	ClassName string         `xml:"classname,attr"`
+	Time      string         `xml:"time,attr"`
+	Failures  []junitMessage `xml:"failure"`
+	Errors    []junitMessage `xml:"error"`
+	Skipped   *junitMessage  `xml:"skipped"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+func (m junitMessage) String() string {
+	return strings.TrimSpace(m.Message + "\n" + m.Text)
+}
+
+func parseJUnit(r io.Reader) ([]TestResult, error) {
+	var root junitTestSuite
+	err := xml.NewDecoder(r).Decode(&root)
+	if err != nil {
+		return nil, err
+	}
+	results := []TestResult{}
+	var walk func(suite junitTestSuite)
+	walk = func(suite junitTestSuite) {
+		for _, tc := range suite.TestCases {
+			result := TestResult{
+				Suite:  tc.ClassName,
+				Name:   tc.Name,
+				Result: "passed",
+			}
+			if result.Suite == "" {
+				result.Suite = suite.Name
+			}
+			if seconds, err := strconv.ParseFloat(tc.Time, 64); err == nil {
+				result.DurationSeconds = seconds
+			}
+			switch {
+			case len(tc.Failures) > 0 || len(tc.Errors) > 0:
+				result.Result = "failed"
+				messages := []string{}
+				for _, m := range append(tc.Failures, tc.Errors...) {
+					messages = append(messages, m.String())
+				}
+				result.Message = truncateTestMessage(strings.Join(messages, "\n"))
+			case tc.Skipped != nil:
+				result.Result = "skipped"
+				result.Message = truncateTestMessage(tc.Skipped.String())
+			}
+			results = append(results, result)
+		}
+		for _, child := range suite.TestSuites {
+			walk(child)
+		}
+	}
+	walk(root)
+	return results, nil
+}
+
+// parseTAP parses the top level test points of a TAP stream. Tests with a
+// SKIP or TODO directive are skipped. The YAML diagnostic block that follows
+// a failed test point, if any, is its message.
+func parseTAP(r io.Reader) ([]TestResult, error) {
+	results := []TestResult{}
+	var inDiagnostic bool
+	var diagnostic []string
+	flush := func() {
+		if len(results) > 0 && len(diagnostic) > 0 && results[len(results)-1].Result == "failed" {
+			results[len(results)-1].Message = truncateTestMessage(strings.Join(diagnostic, "\n"))
+		}
+		diagnostic = nil
+		inDiagnostic = false
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if inDiagnostic {
+			if trimmed == "..." {
+				flush()
+			} else {
+				diagnostic = append(diagnostic, trimmed)
+			}
+			continue
+		}
+		if trimmed == "---" && line != trimmed {
+			inDiagnostic = true
+			continue
+		}
+		var passed bool
+		var rest string
+		switch {
+		case strings.HasPrefix(line, "ok"):
+			passed, rest = true, strings.TrimPrefix(line, "ok")
+		case strings.HasPrefix(line, "not ok"):
+			passed, rest = false, strings.TrimPrefix(line, "not ok")
+		default:
+			continue
+		}
+		if rest != "" && rest[0] != ' ' && rest[0] != '\t' {
+			continue
+		}
+		description, directive := rest, ""
+		if i := strings.Index(rest, "#"); i >= 0 {
+			description, directive = rest[:i], strings.TrimSpace(rest[i+1:])
+		}
+		// strip test number and separator from description
+		description = strings.TrimSpace(description)
+		if fields := strings.SplitN(description, " ", 2); len(fields) > 0 {
+			if _, err := strconv.Atoi(fields[0]); err == nil {
+				if len(fields) == 2 {
+					description = fields[1]
+				} else {
+					description = ""
+				}
+			}
+		}
+		description = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(description), "- "))
+		result := TestResult{
+			Name:   description,
+			Result: "passed",
+		}
+		upper := strings.ToUpper(directive)
+		switch {
+		case strings.HasPrefix(upper, "SKIP") || strings.HasPrefix(upper, "TODO"):
+			result.Result = "skipped"
+			result.Message = directive
+		case !passed:
+			result.Result = "failed"
+		}
+		results = append(results, result)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// goTestEvent is an event of the output of go test -json.
+type goTestEvent struct {
+	Action  string
+	Package string
+	Test    string
+	Elapsed float64
+	Output  string
+}
+
+// parseGoTestJSON parses the output of go test -json. A package that fails
+// without any failed tests, e.g. since it does not compile, is reported as a
+// failed test with the name of the package.
+func parseGoTestJSON(r io.Reader) ([]TestResult, error) {
+	results := []TestResult{}
+	output := map[string]*strings.Builder{}
+	failedTests := map[string]bool{}
+	decoder := json.NewDecoder(r)
+	for {
+		var event goTestEvent
+		err := decoder.Decode(&event)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		key := event.Package + "\x00" + event.Test
+		switch event.Action {
+		case "output":
+			if output[key] == nil {
+				output[key] = &strings.Builder{}
+			}
+			output[key].WriteString(event.Output)
+		case "pass", "fail", "skip":
+			if event.Test == "" && (event.Action != "fail" || failedTests[event.Package]) {
+				continue
+			}
+			result := TestResult{
+				Suite:           event.Package,
+				Name:            event.Test,
+				DurationSeconds: event.Elapsed,
+			}
+			if result.Name == "" {
+				result.Name = event.Package
+			}
+			switch event.Action {
+			case "pass":
+				result.Result = "passed"
+			case "fail":
+				result.Result = "failed"
+				failedTests[event.Package] = true
+				if output[key] != nil {
+					result.Message = truncateTestMessage(output[key].String())
+				}
+			case "skip":
+				result.Result = "skipped"
+			}
+			results = append(results, result)
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,122 @@
+// +build darwin,!docker linux,!docker freebsd
+
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestTestResultsPublished(t *testing.T) {
+	_, teardown := setupWithFakeServices(t)
+	defer teardown()
+
+	payload := GenericWorkerPayload{
+		Command: [][]string{
+			{
+				"/bin/bash",
+				"-c",
+				`mkdir -p reports && printf '1..3\nok 1 - first\nnot ok 2 - second\nnot ok 3 - third\n' > reports/results.tap`,
+			},
+		},
+		TestResults: TestResults{
+			Files: []TestResultFiles{
+				{
+					Path:   "reports/*.tap",
+					Format: "tap",
+				},
+				{
+					Path:   "missing/*.xml",
+					Format: "junit",
+				},
+			},
+			FailTaskOnFailures: true,
+			MaxFailuresInLog:   1,
+		},
+		MaxRunTime: 30,
+	}
+	td := testTask(t)
+
+	taskID := submitAndAssert(t, td, payload, "failed", "failed")
+
+	logtext, _, _, _ := getArtifactContent(t, taskID, "public/logs/live_backing.log")
+	for _, expected := range []string{
+		"[test results] No test result files found matching missing/*.xml",
+		"[test results] 3 test(s): 1 passed, 2 failed, 0 skipped",
+		"[test results] FAILED second",
+		"[test results] ... and 1 more failure(s), see public/test-results.json",
+		"[test results] 2 test(s) failed",
+	} {
+		if !strings.Contains(string(logtext), expected) {
+			t.Fatalf("Expected task log to contain %q:\n%s", expected, logtext)
+		}
+	}
+	content, _, _, _ := getArtifactContent(t, taskID, "public/test-results.json")
+	var report TestResultsReport
+	err := json.Unmarshal(content, &report)
+	if err != nil {
+		t.Fatalf("Could not parse public/test-results.json: %v\n%s", err, content)
+	}
+	if report.Summary != (TestResultsSummary{Total: 3, Passed: 1, Failed: 2}) || len(report.Tests) != 3 || report.Tests[2].File != "reports/results.tap" {
+		t.Fatalf("Unexpected test results: %#v", report)
+	}
+}
+
+func TestTestResultsOutsideTaskDirectory(t *testing.T) {
+	_, teardown := setupWithFakeServices(t)
+	defer teardown()
+
+	payload := GenericWorkerPayload{
+		Command: [][]string{
+			{"ln", "-s", "/etc/passwd", "results.tap"},
+		},
+		TestResults: TestResults{
+			Files: []TestResultFiles{
+				{
+					Path:   "results.tap",
+					Format: "tap",
+				},
+			},
+		},
+		MaxRunTime: 30,
+	}
+	td := testTask(t)
+
+	taskID := submitAndAssert(t, td, payload, "completed", "completed")
+
+	logtext, _, _, _ := getArtifactContent(t, taskID, "public/logs/live_backing.log")
+	if !strings.Contains(string(logtext), "Could not parse results.tap as tap: results.tap is a symbolic link") {
+		t.Fatalf("Expected test result file outside task directory to be rejected:\n%s", logtext)
+	}
+}
+
+func TestTestResultsNamedPipe(t *testing.T) {
+	_, teardown := setupWithFakeServices(t)
+	defer teardown()
+
+	payload := GenericWorkerPayload{
+		Command: [][]string{
+			{"mkfifo", "results.xml"},
+		},
+		TestResults: TestResults{
+			Files: []TestResultFiles{
+				{
+					Path:   "*.xml",
+					Format: "junit",
+				},
+			},
+		},
+		MaxRunTime: 30,
+	}
+	td := testTask(t)
+
+	// reading the named pipe would block forever, so the task would never
+	// be resolved
+	taskID := submitAndAssert(t, td, payload, "completed", "completed")
+
+	logtext, _, _, _ := getArtifactContent(t, taskID, "public/logs/live_backing.log")
+	if !strings.Contains(string(logtext), "Could not parse results.xml as junit: results.xml is not a regular file") {
+		t.Fatalf("Expected named pipe to be rejected as test result file:\n%s", logtext)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func assertTestResults(t *testing.T, results []TestResult, expected []TestResult) {
+	t.Helper()
+	if len(results) != len(expected) {
+		t.Fatalf("Expected %v test results, but got %v: %#v", len(expected), len(results), results)
+	}
+	for i := range expected {
+		r, e := results[i], expected[i]
+		if r.Suite != e.Suite || r.Name != e.Name || r.Result != e.Result || !strings.Contains(r.Message, e.Message) {
+			t.Fatalf("Expected test result %v to be %#v, but got %#v", i, e, r)
+		}
+	}
+}
+
+func TestParseJUnit(t *testing.T) {
+	results, err := parseJUnit(strings.NewReader(`<?xml version="1.0" encoding="UTF-8"?>
+<testsuites>
+  <testsuite name="suite" tests="4">
+    <testcase classname="pkg.Thing" name="works" time="0.5"/>
+    <testcase classname="pkg.Thing" name="breaks" time="1.25">
+      <failure message="expected 1, got 2" type="AssertionError">stack trace</failure>
+    </testcase>
+    <testcase name="crashes">
+      <error message="boom"/>
+    </testcase>
+    <testcase classname="pkg.Thing" name="later">
+      <skipped message="not implemented"/>
+    </testcase>
+  </testsuite>
+</testsuites>`))
+	if err != nil {
+		t.Fatalf("Could not parse JUnit XML: %v", err)
+	}
+	assertTestResults(t, results, []TestResult{
+		{Suite: "pkg.Thing", Name: "works", Result: "passed"},
+		{Suite: "pkg.Thing", Name: "breaks", Result: "failed", Message: "expected 1, got 2\nstack trace"},
+		{Suite: "suite", Name: "crashes", Result: "failed", Message: "boom"},
+		{Suite: "pkg.Thing", Name: "later", Result: "skipped", Message: "not implemented"},
+	})
+	if results[1].DurationSeconds != 1.25 {
+		t.Fatalf("Expected duration of 1.25 seconds, but got %v", results[1].DurationSeconds)
+	}
+
+	// a <testsuite> root element is also permitted
+	results, err = parseJUnit(strings.NewReader(`<testsuite name="root"><testcase name="works"/></testsuite>`))
+	if err != nil {
+		t.Fatalf("Could not parse JUnit XML: %v", err)
+	}
+	assertTestResults(t, results, []TestResult{
+		{Suite: "root", Name: "works", Result: "passed"},
+	})
+
+	_, err = parseJUnit(strings.NewReader(`not xml`))
+	if err == nil {
+		t.Fatal("Expected invalid JUnit XML not to be parsed")
+	}
+}
+
+func TestParseTAP(t *testing.T) {
+	results, err := parseTAP(strings.NewReader(`TAP version 13
+1..5
+ok 1 - addition works
+not ok 2 - subtraction works
+  ---
+  message: expected 1, got 2
+  ...
+ok 3 # SKIP no network
+not ok 4 - division # TODO not implemented
+    ok 1 - a subtest is ignored
+ok 5
+okay, not a test point
+`))
+	if err != nil {
+		t.Fatalf("Could not parse TAP: %v", err)
+	}
+	assertTestResults(t, results, []TestResult{
+		{Name: "addition works", Result: "passed"},
+		{Name: "subtraction works", Result: "failed", Message: "message: expected 1, got 2"},
+		{Name: "", Result: "skipped", Message: "SKIP no network"},
+		{Name: "division", Result: "skipped", Message: "TODO not implemented"},
+		{Name: "", Result: "passed"},
+	})
+}
+
+func TestParseGoTestJSON(t *testing.T) {
+	results, err := parseGoTestJSON(strings.NewReader(`{"Action":"run","Package":"example.com/a","Test":"TestGood"}
+{"Action":"pass","Package":"example.com/a","Test":"TestGood","Elapsed":0.1}
+{"Action":"run","Package":"example.com/a","Test":"TestBad"}
+{"Action":"output","Package":"example.com/a","Test":"TestBad","Output":"    a_test.go:10: wrong answer\n"}
+{"Action":"fail","Package":"example.com/a","Test":"TestBad","Elapsed":0.2}
+{"Action":"skip","Package":"example.com/a","Test":"TestSkipped"}
+{"Action":"fail","Package":"example.com/a","Elapsed":0.5}
+{"Action":"output","Package":"example.com/b","Output":"b.go:3:1: syntax error\n"}
+{"Action":"fail","Package":"example.com/b","Elapsed":0}
+{"Action":"pass","Package":"example.com/c","Elapsed":0.1}
+`))
+	if err != nil {
+		t.Fatalf("Could not parse go test JSON: %v", err)
+	}
+	assertTestResults(t, results, []TestResult{
+		{Suite: "example.com/a", Name: "TestGood", Result: "passed"},
+		{Suite: "example.com/a", Name: "TestBad", Result: "failed", Message: "wrong answer"},
+		{Suite: "example.com/a", Name: "TestSkipped", Result: "skipped"},
+		{Suite: "example.com/b", Name: "example.com/b", Result: "failed", Message: "syntax error"},
+	})
+}
@@ -19,6 +19,12 @@ const (
 	CANT_CREATE_ED25519_KEYPAIR ExitCode = 75
 	CANT_SAVE_CONFIG            ExitCode = 76
 	CANT_CONNECT_PROTOCOL_PIPE  ExitCode = 78
+	TASK_UNSUCCESSFUL           ExitCode = 79
+	CANT_READ_TASK_PAYLOAD      ExitCode = 80
+	CANT_READ_TASK_HISTORY      ExitCode = 81
+	WORKER_QUARANTINED          ExitCode = 82
+	HOST_UNHEALTHY              ExitCode = 83
+	TASK_PAYLOAD_INVALID        ExitCode = 84
 )
 
 func usage(versionName string) string {
@@ -35,6 +41,15 @@ and reports back results to the queue.
                                             [--worker-runner-protocol-pipe PIPE]
                                             [--configure-for-aws | --configure-for-gcp | --configure-for-azure]` + installServiceSummary() + `
     generic-worker show-payload-schema
+    generic-worker run-task                 --payload PAYLOAD-FILE
+                                            [--config         CONFIG-FILE]
+                                            [--artifacts-dir  ARTIFACTS-DIR]
+                                            [--scope          SCOPE]...
+    generic-worker validate-payload         --payload PAYLOAD-FILE
+                                            [--config         CONFIG-FILE]
+                                            [--scope          SCOPE]... [--json]
+    generic-worker history                  [--task-id TASK-ID] [--state STATE]
+                                            [--since SINCE] [--last N] [--json]
     generic-worker new-ed25519-keypair      --file ED25519-PRIVATE-KEY-FILE` + customTargetsSummary() + `
     generic-worker --help
     generic-worker --version
@@ -48,7 +63,40 @@ and reports back results to the queue.
                                             payload is validated against a json schema baked
                                             into the release. This option outputs the json
                                             schema used in this version of the generic
-                                            worker.` + installService() + `
+                                            worker.
+    run-task                                Runs a single task locally, without claiming it from
+                                            a taskcluster deployment, in order to reproduce or
+                                            debug task failures. The task payload is read from
+                                            PAYLOAD-FILE and validated against the payload schema
+                                            (see show-payload-schema). The task is created in a
+                                            fake queue served on a local port, which writes the
+                                            task artifacts to ARTIFACTS-DIR rather than uploading
+                                            them to S3. The config file is optional; settings
+                                            only needed to talk to a taskcluster deployment are
+                                            given placeholder values. The task is granted the
+                                            scopes given with --scope, if any. The exit code
+                                            is 0 if the task is resolved as completed.
+    validate-payload                        Validates the task definition or task payload in
+                                            PAYLOAD-FILE, which may be json or yaml, without
+                                            running the task. The payload is validated against
+                                            the payload schema (see show-payload-schema), and
+                                            is checked in the same way as when a task is run:
+                                            mount contents are parsed, task features must not
+                                            reserve the same artifact names, osGroups must be
+                                            supported, and the task must have the scopes that
+                                            the features it uses require. The task is granted
+                                            the scopes in the task definition, and those given
+                                            with --scope. Each problem is reported with the
+                                            JSON pointer of the invalid value, where there is
+                                            one. The exit code is 0 if the payload is valid.
+    history                                 Lists the task runs that this worker has executed,
+                                            oldest first, from the task history file
+                                            task-history.jsonl in the current directory. For
+                                            each task run the start time, duration, resolution,
+                                            command exit codes, free disk space before and
+                                            after the task, and task mounts are shown. The
+                                            options --task-id, --state, --since and --last
+                                            select which task runs are listed.` + installService() + `
     new-ed25519-keypair                     This will generate a fresh, new ed25519
                                             compliant private/public key pair. The public
                                             key will be written to stdout and the private
@@ -62,6 +110,26 @@ and reports back results to the queue.
                                             installation should use, rather than the config
                                             to use during install.
                                             [default: generic-worker.config]
+    --payload PAYLOAD-FILE                  The json file containing the task payload to run.
+                                            For validate-payload, a json or yaml file
+                                            containing either a task definition or a task
+                                            payload.
+    --artifacts-dir ARTIFACTS-DIR           The directory to write task artifacts to, under
+                                            <taskId>/<runId>/<artifact name>.
+                                            [default: artifacts]
+    --scope SCOPE                           A scope to grant to the task. May be given several
+                                            times.
+    --task-id TASK-ID                       Only list runs of the given task.
+    --state STATE                           Only list task runs resolved with the given state
+                                            (completed, failed or exception).
+    --since SINCE                           Only list task runs started since SINCE, which is
+                                            either an RFC3339 timestamp, or a duration such as
+                                            24h, meaning that long ago.
+                                            [default: ]
+    --last N                                Only list the N most recent matching task runs.
+    --json                                  Output one json object per task run, rather than a
+                                            table. For validate-payload, output the problems
+                                            found as a json object.
     --worker-runner-protocol-pipe PIPE      Use this option when running generic-worker under
                                             worker-runner, passing the same value as given for
                                             'worker.protocolPipe' in the runner configuration.
@@ -161,6 +229,55 @@ and reports back results to the queue.
                                             directory will be created if it does not exist. This
                                             may be a relative path to the current directory, or
                                             an absolute path. [default: "downloads"]
+          healthCheckCommands               An array of commands to run as health checks, as the
+                                            user that runs generic-worker. A command that exits
+                                            with a non-zero exit code, or does not complete
+                                            within healthCheckTimeoutSecs seconds, fails the
+                                            health check. Its output is written to the worker
+                                            log. The worker does not claim tasks while any
+                                            health check fails. Built-in health checks are
+                                            configured with the other healthCheck* settings.
+                                            Health check failures are reported in hostUnhealthy
+                                            worker metrics events. [default: []]
+          healthCheckIntervalSecs           The worker runs health checks before claiming a task,
+                                            if they were last run more than this many seconds
+                                            ago, or a task has run since. [default: 60]
+          healthCheckMaxClockSkewSecs       If non-zero, a health check fails if the local clock
+                                            differs from the clock of the queue by more than
+                                            this many seconds. [default: 0]
+          healthCheckMaxFailureSecs         If non-zero, the worker reports a worker error to the
+                                            worker manager and exits with exit code 83 if health
+                                            checks fail for longer than this many seconds.
+                                            Otherwise the worker waits for the health checks to
+                                            pass, until idleTimeoutSecs is reached, so with the
+                                            default settings a worker whose health checks keep
+                                            failing never exits, and never claims another task.
+                                            [default: 0]
+          healthCheckMaxWorkerFailures      If non-zero, a health check fails if at least this
+                                            many task runs that started within the last
+                                            healthCheckWorkerFailuresSecs seconds were resolved
+                                            as exception/internal-error or
+                                            exception/resource-unavailable, according to the
+                                            task history. [default: 0]
+          healthCheckMinFreeDiskMegabytes   If non-zero, a health check fails if less than this
+                                            many megabytes of disk space are free in tasksDir or
+                                            cachesDir. [default: 0]
+          healthCheckMinFreeInodes          If non-zero, a health check fails if fewer than this
+                                            many inodes are free in tasksDir or cachesDir.
+                                            [default: 0]
+          healthCheckMinFreeMemoryMegabytes If non-zero, a health check fails if less than this
+                                            many megabytes of memory are available.
+                                            [default: 0]
+          healthCheckRequiredExecutables    An array of executables that must be present in the
+                                            PATH of generic-worker, or a health check fails.
+                                            [default: []]
+          healthCheckTimeoutSecs            The maximum number of seconds each command in
+                                            healthCheckCommands may run for, before it is
+                                            killed. If zero, health check commands are not time
+                                            limited. [default: 60]
+          healthCheckWorkerFailuresSecs     The period of time, in seconds, over which worker
+                                            failures are counted for
+                                            healthCheckMaxWorkerFailures. [default: 3600]
           idleTimeoutSecs                   How many seconds to wait without getting a new
                                             task to perform, before the worker process exits.
                                             An integer, >= 0. A value of 0 means "never reach
@@ -169,6 +286,10 @@ and reports back results to the queue.
                                             [default: 0]
           instanceID                        The EC2 instance ID of the worker. Used by chain of trust.
           instanceType                      The EC2 instance Type of the worker. Used by chain of trust.
+          liveArtifactsPort                 Port number of the local HTTP endpoint that task
+                                            commands of tasks with feature liveArtifacts
+                                            enabled upload artifacts with, while the task is
+                                            running. [default: 60024]
           livelogCertificate                SSL certificate to be used by livelog for hosting
                                             logs over https. If not set, http will be used.
           livelogExecutable                 Filepath of LiveLog executable to use; see
@@ -184,8 +305,125 @@ and reports back results to the queue.
                                             stateless dns server; see
                                             https://github.com/taskcluster/stateless-dns-server
                                             Optional if stateless DNS is not in use.
+          maxArtifacts                      The maximum number of artifacts that a task may
+                                            publish with payload property artifacts, counting
+                                            each file of a directory artifact as an artifact.
+                                            Tasks may lower, but not raise, this limit in
+                                            their payload. If any artifact limit is exceeded,
+                                            none of these artifacts are uploaded, and the task
+                                            fails. Live artifacts are subject to the same
+                                            limits, and the live artifacts that a task has
+                                            uploaded count towards this limit and the total
+                                            size limit. If zero, the number of artifacts is
+                                            not limited. [default: 0]
+          maxArtifactSizeMegabytes          The maximum size, in megabytes, of any one artifact
+                                            of payload property artifacts. Tasks may lower,
+                                            but not raise, this limit in their payload. If
+                                            zero, artifact size is not limited. [default: 0]
+          maxConcurrentMounts               The maximum number of mounts of a task whose
+                                            content is downloaded and extracted at the same
+                                            time. Mounts to overlapping paths, or of the same
+                                            writable directory cache, are always prepared in
+                                            the order they are listed in the task payload. If
+                                            zero or one, mounts are prepared one at a time.
+                                            [default: 4]
+          maxTaskLogSizeMegabytes           The maximum size, in megabytes, of the task log
+                                            (public/logs/live_backing.log). Output beyond this
+                                            size is discarded, and a truncation notice is
+                                            written to the task log. Tasks may lower, but not
+                                            raise, this limit in their payload. If zero, the
+                                            task log size is not limited. [default: 0]
+          maxTotalArtifactsSizeMegabytes    The maximum total size, in megabytes, of the
+                                            artifacts of payload property artifacts. Tasks may
+                                            lower, but not raise, this limit in their payload.
+                                            If zero, total artifact size is not limited.
+                                            [default: 0]
+          mountContentCacheRetryTimeoutSecs The time, in seconds, after the first attempt to
+                                            download mount content from the mount content
+                                            cache (see mountContentCacheURL), after which
+                                            failed attempts are no longer retried, and the
+                                            content is downloaded directly instead.
+                                            [default: 60]
+          mountContentCacheURL              The base URL of a pull-through HTTP cache, such as
+                                            a site-local cache, that mount content from urls
+                                            and task artifacts is downloaded through, if the
+                                            task payload declares its SHA256. The content is
+                                            requested from
+                                              <mountContentCacheURL>/sha256/<sha256>?url=<url>
+                                            where <url> is the url that the cache should fetch
+                                            the content from, if it doesn't have it already.
+                                            For artifacts, this is a signed url that expires
+                                            after a short time. If the content cannot be
+                                            downloaded from the cache, or does not have the
+                                            required SHA256, it is downloaded directly
+                                            instead. If empty, mount content is always
+                                            downloaded directly. [default: ""]
+          mountDownloadRetryTimeoutSecs     The time, in seconds, after the first attempt to
+                                            download mount content, after which failed
+                                            attempts are no longer retried. Retries resume the
+                                            download where the failed attempt stopped, if the
+                                            server supports range requests. If zero, failed
+                                            attempts are retried indefinitely. [default: 900]
+          networkIsolation                  Whether task commands run in an isolated network
+                                            namespace (Linux only; requires generic-worker to
+                                            run as root, with ip and iptables installed).
+                                            One of "disabled", "optional" (tasks opt in with
+                                            payload feature networkIsolation) or "always".
+                                            Isolated task commands may only connect to the
+                                            networks and hosts in payload property
+                                            egressAllowlist and config setting
+                                            networkIsolationEgressAllowlist. The cloud instance
+                                            metadata endpoint 169.254.169.254 is always
+                                            blocked. The taskcluster proxy and DNS resolvers
+                                            remain reachable from the task on the loopback
+                                            interface. [default: "disabled"]
+          networkIsolationEgressAllowlist   IPv4 networks in CIDR notation (e.g. "10.0.0.0/8")
+                                            and hosts (e.g. "github.com") that isolated task
+                                            commands may connect to, in addition to those in
+                                            payload property egressAllowlist. Hosts are
+                                            resolved when each task starts. [default: []]
+          networkIsolationSubnet            The IPv4 subnet, with a prefix length of at most 30,
+                                            used for the link between the worker and the
+                                            network namespace of isolated task commands. It
+                                            should not overlap with any network that tasks need
+                                            to reach. [default: "10.213.0.0/30"]
           numberOfTasksToRun                If zero, run tasks indefinitely. Otherwise, after
                                             this many tasks, exit. [default: 0]
+          postTaskHook                      A command to run after each task has been resolved,
+                                            e.g. to reset emulators or clear browser profiles.
+                                            It runs as the user that runs generic-worker, with
+                                            environment variables TASK_ID, RUN_ID, TASK_STATE
+                                            and TASK_REASON_RESOLVED set. Its output is written
+                                            to the worker log. A failing post-task hook is only
+                                            logged, since the task has already been resolved.
+                                            [default: ""]
+          preTaskHook                       A command to run before each task is claimed, e.g.
+                                            to check tool versions. It runs as the user that
+                                            runs generic-worker, and its output is written to
+                                            the worker log. If it fails, or does not complete
+                                            within taskHookTimeoutSecs seconds, the worker
+                                            reports a worker error to the worker manager and
+                                            exits with exit code 83, without claiming a task.
+                                            [default: ""]
+          prewarmCaches                     Content to download into the worker caches when the
+                                            worker starts, before it claims its first task, so
+                                            that tasks on a fresh worker that mount the content
+                                            do not have to download it. Each entry has property
+                                            content, which is url content, task artifact
+                                            content, or indexed artifact content, e.g.
+                                              {"url": "<url>", "sha256": "<sha256>"}
+                                              {"taskId": "<taskId>", "artifact": "<name>",
+                                               "sha256": "<sha256>"}
+                                              {"namespace": "<index namespace>",
+                                               "artifact": "<name>", "sha256": "<sha256>"}
+                                            The SHA256 of the content is required. If an entry
+                                            also has properties cacheName and format (one of
+                                            "rar", "tar.bz2", "tar.gz" or "zip"), the content
+                                            is extracted into a writable directory cache with
+                                            that name, unless the worker has one already.
+                                            Content that cannot be downloaded is logged, but
+                                            does not prevent the worker from starting.
+                                            [default: []]
           privateIP                         The private IP of the worker, used by chain of trust.
           provisionerId                     The taskcluster provisioner which is taking care
                                             of provisioning environments with generic-worker
@@ -193,6 +431,20 @@ and reports back results to the queue.
           purgeCacheRootURL                 The root URL for taskcluster purge cache API calls.
                                             If not provided, the value from config property
                                             rootURL is used. Intended for development/testing.
+          quarantineAfterFailures           If greater than zero, the worker quarantines itself
+                                            after this many consecutive tasks are resolved as
+                                            exception/internal-error or
+                                            exception/resource-unavailable, since these suggest
+                                            a problem with the host rather than with the tasks.
+                                            The worker asks the queue to quarantine it for
+                                            quarantineDurationSecs seconds, reports a worker
+                                            error to the worker manager, and exits with exit
+                                            code 82, so that it can be replaced. Task runs
+                                            interrupted by a worker crash count as internal
+                                            errors. [default: 0]
+          quarantineDurationSecs            How long the worker should be quarantined for, if it
+                                            quarantines itself (see quarantineAfterFailures).
+                                            [default: 86400]
           queueRootURL                      The root URL for taskcluster queue API calls.
                                             If not provided, the value from config property
                                             rootURL is used. Intended for development/testing.
@@ -214,7 +466,30 @@ and reports back results to the queue.
                                             Administrator. Furthermore, even if
                                             runTasksAsCurrentUser is true, the script will still
                                             be executed as the task user, rather than the
-                                            current user (that runs the generic-worker process).` + runTasksAsCurrentUserUsage() + `
+                                            current user (that runs the generic-worker process).` + runTasksAsCurrentUserUsage() + sandboxTasksUsage() + `
+          secretScanning                    Whether files of public artifacts (artifacts whose
+                                            names start with "public/") are scanned for secrets
+                                            before they are uploaded. One of "disabled",
+                                            "optional" (tasks opt in with payload feature
+                                            secretScanning) or "always". [default: "optional"]
+          secretScanningAction              What to do with a public artifact whose file
+                                            appears to contain a secret. "error" uploads an
+                                            error artifact in its place, which fails the task.
+                                            "private" uploads it with prefix "public/" of its
+                                            name replaced by "private/", so that it may only be
+                                            read with scopes. [default: "error"]
+          secretScanningDetectors           The built-in detectors that files are scanned with.
+                                            "privateKey" detects PEM, OpenSSH and PGP private
+                                            keys, "taskclusterAccessToken" detects assignments
+                                            of taskcluster access tokens, such as
+                                            "accessToken": "<token>", and "highEntropy" detects
+                                            long random strings, such as base64 encoded keys,
+                                            other than labelled digests, such as
+                                            sha256=<digest>.
+                                            [default: ["privateKey", "taskclusterAccessToken"]]
+          secretScanningPatterns            Additional regular expressions (in go syntax) that
+                                            files are scanned with. A file matches if a line
+                                            of the file matches. [default: []]
           secretsRootURL                    The root URL for taskcluster secrets API calls.
                                             If not provided, the value from config property
                                             rootURL is used. Intended for development/testing.
@@ -248,6 +523,13 @@ and reports back results to the queue.
                                             [default: "taskcluster-proxy"]
           taskclusterProxyPort              Port number for taskcluster-proxy HTTP requests.
                                             [default: 80]
+          taskHookTimeoutSecs               The maximum number of seconds that preTaskHook and
+                                            postTaskHook may run for, before they are killed.
+                                            If zero, hooks are not time limited. [default: 300]
+          taskMetadataPort                  Port number of the local HTTP endpoint that serves
+                                            metadata about the running task to task commands
+                                            of tasks with feature taskMetadata enabled.
+                                            [default: 60025]
           tasksDir                          The location where task directories should be
                                             created on the worker. [default: ` + fmt.Sprintf("%q", defaultTasksDir()) + `]
           workerGroup                       Typically this would be an aws region - an
@@ -326,5 +608,19 @@ and reports back results to the queue.
     76     Not able to save generic-worker config file after fetching it from AWS provisioner
            or Google Cloud metadata.` + exitCode77() + `
     78     Not able to connect to --worker-runner-protocol-pipe.
+    79     The task run by the run-task target was not resolved as completed.
+    80     The task payload file given to the run-task or validate-payload target could
+           not be read, or is not valid json (or for validate-payload, yaml).
+    81     The task history file could not be read by the history target, or an invalid
+           option was given.
+    82     The worker quarantined itself after too many consecutive tasks were resolved as
+           exception/internal-error or exception/resource-unavailable (see config setting
+           quarantineAfterFailures). If config setting shutdownMachineOnInternalError is
+           true, the host is also shut down.
+    83     The host is unhealthy, since the pre-task hook failed (see config setting
+           preTaskHook), or health checks failed for longer than healthCheckMaxFailureSecs
+           seconds. If config setting shutdownMachineOnInternalError is true, the host is
+           also shut down.
+    84     The task payload given to the validate-payload target is invalid.
 `
 }
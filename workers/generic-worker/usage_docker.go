@@ -0,0 +1,7 @@
+// +build docker
+
+package main
+
+func sandboxTasksUsage() string {
+	return ``
+}
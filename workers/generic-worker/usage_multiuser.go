@@ -17,3 +17,7 @@ func exitCode77() string {
     77     Not able to apply required file access permissions to the generic-worker config
            file so that task users can't read from or write to it.`
 }
+
+func sandboxTasksUsage() string {
+	return ``
+}
@@ -0,0 +1,18 @@
+// +build simple
+
+package main
+
+func sandboxTasksUsage() string {
+	return `
+          sandboxTasks                      If true, task commands run in a sandbox, with their
+                                            own user and mount namespaces (Linux only). In the
+                                            sandbox, only the task directory and /tmp (which is
+                                            empty) are writable, and the generic-worker config
+                                            file, the ed25519 signing key, the livelog key, and
+                                            the caches and downloads directories are hidden.
+                                            Task commands still run as the same user as
+                                            generic-worker, and files of other users appear to
+                                            be owned by the overflow user (nobody). Requires
+                                            unprivileged user namespaces to be enabled in the
+                                            kernel. [default: false]`
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/ghodss/yaml"
+	tcclient "github.com/taskcluster/taskcluster/v28/clients/client-go"
+	"github.com/taskcluster/taskcluster/v28/clients/client-go/tcqueue"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/gwconfig"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// PayloadError is a problem with a task payload, as reported by the
+// validate-payload target. Pointer is the JSON pointer of the invalid value
+// in the validated file, if the problem is with a particular value.
+type PayloadError struct {
+	Pointer string `json:"pointer,omitempty"`
+	Message string `json:"message"`
+	// located is true if Pointer is known, since "" is also the pointer of
+	// the task payload itself
+	located bool
+}
+
+// payloadValueError is a problem caused by the value at a JSON pointer in
+// the task payload, such as /mounts/1/content, so that the validate-payload
+// target can report where the problem is.
+type payloadValueError struct {
+	pointer string
+	err     error
+}
+
+func (e *payloadValueError) Error() string {
+	return e.err.Error()
+}
+
+// atPayloadValue returns err, annotated with the JSON pointer of the value
+// in the task payload that caused it, or nil if err is nil.
+func atPayloadValue(pointer string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &payloadValueError{
+		pointer: pointer,
+		err:     err,
+	}
+}
+
+func (e PayloadError) String() string {
+	if e.Pointer == "" {
+		return e.Message
+	}
+	return e.Pointer + ": " + e.Message
+}
+
+// validateTaskFile validates the task definition or task payload in
+// taskFile, which may be json or yaml, for the validate-payload target. The
+// payload is validated against the payload schema of this engine and
+// platform, and then checked by the task features, in the same way as when
+// the worker runs the task. The task is granted the given scopes, in
+// addition to any in the task definition.
+func validateTaskFile(configFile *gwconfig.File, taskFile string, taskScopes []string, jsonOutput bool) (exitCode ExitCode) {
+	defer func() {
+		if r := recover(); r != nil {
+			HandleCrash(r)
+			exitCode = INTERNAL_ERROR
+		}
+	}()
+
+	content, err := ioutil.ReadFile(taskFile)
+	if err != nil {
+		log.Printf("Could not read task file %v: %v", taskFile, err)
+		return CANT_READ_TASK_PAYLOAD
+	}
+	definition, pointerPrefix, err := readTaskDefinition(content)
+	if err != nil {
+		log.Printf("Could not read task file %v: %v", taskFile, err)
+		return CANT_READ_TASK_PAYLOAD
+	}
+	definition.Scopes = append(definition.Scopes, taskScopes...)
+
+	configProvider = &localConfigProvider{}
+	err = applyConfig(configFile, configProvider)
+	if err != nil {
+		log.Printf("Error loading configuration: %v", err)
+		return CANT_LOAD_CONFIG
+	}
+	// the task can only be claimed by workers of its own worker type
+	if definition.ProvisionerID != "" && definition.WorkerType != "" {
+		config.ProvisionerID = definition.ProvisionerID
+		config.WorkerType = definition.WorkerType
+	}
+	Features = allFeatures()
+
+	payloadErrors := prefixPointers(validateTask(definition), pointerPrefix)
+
+	if jsonOutput {
+		output, err := json.MarshalIndent(
+			map[string]interface{}{
+				"valid":  len(payloadErrors) == 0,
+				"errors": payloadErrors,
+			},
+			"",
+			"  ",
+		)
+		if err != nil {
+			panic(err)
+		}
+		fmt.Println(string(output))
+	} else {
+		for _, e := range payloadErrors {
+			fmt.Printf("%v: %v\n", taskFile, e)
+		}
+		if len(payloadErrors) == 0 {
+			fmt.Printf("%v: task payload is valid\n", taskFile)
+		}
+	}
+	if len(payloadErrors) > 0 {
+		return TASK_PAYLOAD_INVALID
+	}
+	return TASKS_COMPLETE
+}
+
+// readTaskDefinition reads a task definition, or a task payload, from json
+// or yaml content. A task definition is recognised by its payload property.
+// The returned pointer prefix is the JSON pointer of the task payload.
+func readTaskDefinition(content []byte) (definition tcqueue.TaskDefinitionResponse, pointerPrefix string, err error) {
+	jsonContent, err := yaml.YAMLToJSON(content)
+	if err != nil {
+		return
+	}
+	var properties map[string]json.RawMessage
+	if json.Unmarshal(jsonContent, &properties) == nil && properties["payload"] != nil {
+		err = json.Unmarshal(jsonContent, &definition)
+		pointerPrefix = "/payload"
+	} else {
+		definition.Payload = json.RawMessage(jsonContent)
+	}
+	if time.Time(definition.Expires).IsZero() {
+		// without an expiry, artifact expiries are not checked against it
+		definition.Expires = tcclient.Time(time.Date(9999, time.December, 31, 0, 0, 0, 0, time.UTC))
+	}
+	return
+}
+
+// prefixPointers prepends pointerPrefix, the JSON pointer of the task
+// payload in the validated file, to the known pointers of payloadErrors.
+// Pointers that are not known are left empty.
+func prefixPointers(payloadErrors []PayloadError, pointerPrefix string) []PayloadError {
+	for i := range payloadErrors {
+		if payloadErrors[i].located {
+			payloadErrors[i].Pointer = pointerPrefix + payloadErrors[i].Pointer
+		}
+	}
+	return payloadErrors
+}
+
+// validateTask returns the problems with the payload of the given task
+// definition, with JSON pointers relative to the task payload, where known.
+func validateTask(definition tcqueue.TaskDefinitionResponse) []PayloadError {
+	schemaErrors, err := payloadSchemaErrors(definition.Payload)
+	if err != nil {
+		return []PayloadError{{Message: err.Error()}}
+	}
+	if len(schemaErrors) > 0 {
+		return schemaErrors
+	}
+	task := &TaskRun{
+		Definition: definition,
+		Artifacts:  map[string]TaskArtifact{},
+		featureArtifacts: map[string]string{
+			logName: "Native Log",
+		},
+	}
+	errors := &ExecutionErrors{}
+	errors.add(task.validatePayload())
+	if !errors.Occurred() {
+		task.createTaskFeatures(errors)
+	}
+	payloadErrors := make([]PayloadError, len(*errors))
+	for i, e := range *errors {
+		payloadErrors[i] = PayloadError{Message: e.Cause.Error()}
+		if valueError, ok := e.Cause.(*payloadValueError); ok {
+			payloadErrors[i].Pointer = valueError.pointer
+			payloadErrors[i].located = true
+		}
+	}
+	return payloadErrors
+}
+
+// payloadSchemaErrors validates payload against the payload schema, and
+// returns any validation errors, with the JSON pointers of the invalid
+// values.
+func payloadSchemaErrors(payload json.RawMessage) ([]PayloadError, error) {
+	result, err := gojsonschema.Validate(
+		gojsonschema.NewStringLoader(taskPayloadSchema()),
+		gojsonschema.NewBytesLoader(payload),
+	)
+	if err != nil {
+		return nil, err
+	}
+	payloadErrors := []PayloadError{}
+	for _, desc := range result.Errors() {
+		payloadErrors = append(payloadErrors, PayloadError{
+			Pointer: jsonPointer(desc.Context()),
+			Message: desc.Description(),
+			located: true,
+		})
+	}
+	return payloadErrors, nil
+}
+
+// jsonPointer converts the context of a validation error, such as
+// (root).mounts.0.content, to a JSON pointer, such as /mounts/0/content.
+func jsonPointer(context *gojsonschema.JsonContext) string {
+	// split on a separator that property names of task payloads don't
+	// contain, unlike "."
+	tokens := strings.Split(context.String("\x00"), "\x00")
+	pointer := ""
+	for _, token := range tokens[1:] {
+		pointer += "/" + strings.NewReplacer("~", "~0", "/", "~1").Replace(token)
+	}
+	return pointer
+}
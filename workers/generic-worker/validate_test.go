@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/taskcluster/taskcluster/v28/clients/client-go/tcqueue"
+)
+
+func TestPayloadSchemaErrorPointers(t *testing.T) {
+	payloadErrors, err := payloadSchemaErrors(json.RawMessage(`{"maxRunTime": "ten", "env": {"a/b~c": 1}}`))
+	if err != nil {
+		t.Fatalf("Could not validate payload: %v", err)
+	}
+	pointers := map[string]bool{}
+	for _, e := range payloadErrors {
+		pointers[e.Pointer] = true
+	}
+	for _, expected := range []string{"/maxRunTime", "/env/a~1b~0c"} {
+		if !pointers[expected] {
+			t.Fatalf("Expected a validation error for %v, but got %v", expected, payloadErrors)
+		}
+	}
+}
+
+func TestReadTaskDefinition(t *testing.T) {
+	definition, pointerPrefix, err := readTaskDefinition([]byte("provisionerId: my-provisioner\nworkerType: my-worker-type\nscopes: [a, b]\npayload:\n  maxRunTime: 10\n"))
+	if err != nil {
+		t.Fatalf("Could not read task definition: %v", err)
+	}
+	if pointerPrefix != "/payload" || definition.WorkerType != "my-worker-type" || len(definition.Scopes) != 2 || string(definition.Payload) != `{"maxRunTime":10}` {
+		t.Fatalf("Task definition not read correctly: %#v (pointer prefix %q)", definition, pointerPrefix)
+	}
+
+	definition, pointerPrefix, err = readTaskDefinition([]byte(`{"maxRunTime": 10}`))
+	if err != nil {
+		t.Fatalf("Could not read task payload: %v", err)
+	}
+	if pointerPrefix != "" || string(definition.Payload) != `{"maxRunTime":10}` {
+		t.Fatalf("Task payload not read correctly: %#v (pointer prefix %q)", definition, pointerPrefix)
+	}
+}
+
+func TestValidateTaskFeatures(t *testing.T) {
+	defer prepareEnvironment(t)()
+	configureWorker(t)
+	Features = allFeatures()
+
+	dependency := "KTBKfEgxR5GdfIIREQIvFQ"
+	mounts := []MountEntry{
+		// requires scope "queue:get-artifact:private/build.zip"
+		&FileMount{
+			File: "build.zip",
+			Content: json.RawMessage(`{
+				"taskId":   "` + dependency + `",
+				"artifact": "private/build.zip"
+			}`),
+		},
+	}
+	payload, err := json.Marshal(
+		GenericWorkerPayload{
+			Command:    helloGoodbye(),
+			MaxRunTime: 30,
+			Mounts:     toMountArray(t, &mounts),
+		},
+	)
+	if err != nil {
+		t.Fatalf("Could not marshal task payload: %v", err)
+	}
+	definition := tcqueue.TaskDefinitionResponse{
+		Payload: payload,
+	}
+
+	for _, test := range []struct {
+		dependencies []string
+		scopes       []string
+		expected     string
+		pointer      string
+	}{
+		{
+			scopes:   []string{"queue:get-artifact:private/build.zip"},
+			expected: "[mounts] task.dependencies needs to include " + dependency,
+			pointer:  "/payload/mounts/0/content",
+		},
+		{
+			dependencies: []string{dependency},
+			expected:     "queue:get-artifact:private/build.zip",
+		},
+		{
+			dependencies: []string{dependency},
+			scopes:       []string{"queue:get-artifact:private/*"},
+		},
+	} {
+		definition.Dependencies = test.dependencies
+		definition.Scopes = test.scopes
+		payloadErrors := prefixPointers(validateTask(definition), "/payload")
+		if test.expected == "" {
+			if len(payloadErrors) > 0 {
+				t.Fatalf("Expected task to be valid, but got %v", payloadErrors)
+			}
+			continue
+		}
+		if len(payloadErrors) != 1 || !strings.Contains(payloadErrors[0].Message, test.expected) {
+			t.Fatalf("Expected one error containing %q, but got %v", test.expected, payloadErrors)
+		}
+		if payloadErrors[0].Pointer != test.pointer {
+			t.Fatalf("Expected error %v to have pointer %q", payloadErrors[0], test.pointer)
+		}
+	}
+}
+
+func TestPrefixPointers(t *testing.T) {
+	payloadErrors := prefixPointers(
+		[]PayloadError{
+			{Message: "maxRunTime is required", located: true},
+			{Pointer: "/osGroups", Message: "osGroups feature is not supported", located: true},
+			{Message: "Feature \"Mounts\" requires scopes"},
+		},
+		"/payload",
+	)
+	for i, expected := range []string{"/payload", "/payload/osGroups", ""} {
+		if payloadErrors[i].Pointer != expected {
+			t.Fatalf("Expected error %v to have pointer %q", payloadErrors[i], expected)
+		}
+	}
+}
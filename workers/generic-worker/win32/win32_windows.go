@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
 	"syscall"
 	"time"
 	"unicode/utf16"
@@ -51,6 +52,7 @@ var (
 	procGetUserObjectInformationW    = user32.NewProc("GetUserObjectInformationW")
 	procDeleteProfileW               = userenv.NewProc("DeleteProfileW")
 	procGetDiskFreeSpaceExW          = kernel32.NewProc("GetDiskFreeSpaceExW")
+	procGetFinalPathNameByHandleW    = kernel32.NewProc("GetFinalPathNameByHandleW")
 
 	FOLDERID_LocalAppData   = syscall.GUID{Data1: 0xF1B32785, Data2: 0x6FBA, Data3: 0x4FCF, Data4: [8]byte{0x9D, 0x55, 0x7B, 0x8E, 0x7F, 0x15, 0x70, 0x91}}
 	FOLDERID_RoamingAppData = syscall.GUID{Data1: 0x3EB685DB, Data2: 0x65F9, Data3: 0x4CF6, Data4: [8]byte{0xA0, 0x3A, 0xE3, 0xEF, 0x65, 0x72, 0x9F, 0x3D}}
@@ -814,3 +816,55 @@ func DeleteProfile(
 	}
 	return
 }
+
+// https://docs.microsoft.com/en-us/windows/win32/api/fileapi/nf-fileapi-getfinalpathnamebyhandlew
+// DWORD GetFinalPathNameByHandleW(
+//   HANDLE hFile,
+//   LPWSTR lpszFilePath,
+//   DWORD  cchFilePath,
+//   DWORD  dwFlags
+// );
+func GetFinalPathNameByHandle(
+	hFile syscall.Handle,
+	lpszFilePath *uint16,
+	cchFilePath uint32,
+	dwFlags uint32,
+) (n uint32, err error) {
+	r1, _, e1 := procGetFinalPathNameByHandleW.Call(
+		uintptr(hFile),
+		uintptr(unsafe.Pointer(lpszFilePath)),
+		uintptr(cchFilePath),
+		uintptr(dwFlags),
+	)
+	n = uint32(r1)
+	if r1 == 0 {
+		err = os.NewSyscallError("GetFinalPathNameByHandleW", e1)
+	}
+	return
+}
+
+// FinalPathName returns the path of the given open file, with any symbolic
+// links and junctions resolved
+func FinalPathName(file *os.File) (string, error) {
+	n := uint32(syscall.MAX_PATH)
+	for {
+		b := make([]uint16, n)
+		m, err := GetFinalPathNameByHandle(syscall.Handle(file.Fd()), &b[0], n, 0)
+		if err != nil {
+			return "", err
+		}
+		// if the buffer is too small, m is the required size, including
+		// the terminating null character
+		if m < n {
+			path := syscall.UTF16ToString(b[:m])
+			switch {
+			case strings.HasPrefix(path, `\\?\UNC\`):
+				return `\\` + path[len(`\\?\UNC\`):], nil
+			case strings.HasPrefix(path, `\\?\`):
+				return path[len(`\\?\`):], nil
+			}
+			return path, nil
+		}
+		n = m
+	}
+}